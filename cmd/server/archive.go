@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"unitycn/internal/archive"
+)
+
+// runExport - выгрузка всех данных в архив
+func runExport(configPath string, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	includePasswords := fs.Bool("include-passwords", false, "выгружать хэши паролей")
+	uploads := fs.String("uploads", archive.DefaultUploadsDir, "каталог загруженных файлов")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("использование: export [-include-passwords] [-uploads dir] <файл.tar.gz>")
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	cluster, _, err := openRepository(config)
+	if err != nil {
+		return err
+	}
+	defer cluster.Close()
+
+	out, err := os.Create(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	manifest, err := archive.Export(cluster.Primary(), out, archive.ExportOptions{
+		IncludePasswords: *includePasswords,
+		UploadsDir:       *uploads,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Архив %s создан (формат v%d)\n", fs.Arg(0), manifest.FormatVersion)
+	printCounts(manifest.Counts)
+	return out.Close()
+}
+
+// runImport - загрузка данных из архива
+func runImport(configPath string, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "только проверить архив, ничего не записывать")
+	uploads := fs.String("uploads", archive.DefaultUploadsDir, "куда распаковать загруженные файлы")
+	staging := fs.String("staging", archive.DefaultStagingDir, "временный каталог на той же файловой системе, что -uploads")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("использование: import [-dry-run] [-uploads dir] [-staging dir] <файл.tar.gz>")
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	cluster, _, err := openRepository(config)
+	if err != nil {
+		return err
+	}
+	defer cluster.Close()
+
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	report, err := archive.Import(cluster.Primary(), in, archive.ImportOptions{
+		DryRun:     *dryRun,
+		UploadsDir: *uploads,
+		StagingDir: *staging,
+	})
+	if err != nil {
+		return err
+	}
+
+	if report.DryRun {
+		fmt.Println("Пробный запуск, изменения не сохранены")
+	}
+	fmt.Println("Создано:")
+	printCounts(report.Created)
+	fmt.Println("Пропущено (уже существуют):")
+	printCounts(report.Skipped)
+	if len(report.Conflicts) > 0 {
+		fmt.Printf("Конфликты (%d):\n", len(report.Conflicts))
+		for _, c := range report.Conflicts {
+			fmt.Printf("  %s %s: %s\n", c.Entity, c.Key, c.Message)
+		}
+	}
+	return nil
+}
+
+func printCounts(counts map[string]int) {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-10s %d\n", name, counts[name])
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"unitycn/internal/auth"
+	"unitycn/internal/database"
+	"unitycn/internal/handlers"
+	"unitycn/internal/mailer"
+	"unitycn/internal/models"
+	"unitycn/internal/oidc"
+	"unitycn/internal/ratelimit"
+	"unitycn/internal/realtime"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server struct {
+		Port string `yaml:"port"`
+		// BaseURL - адрес сайта для ссылок в письмах
+		BaseURL string `yaml:"base_url"`
+		// TrustedProxies - адреса и подсети прокси, чьим X-Forwarded-For
+		// верить при определении IP клиента; пусто - никому
+		TrustedProxies []string `yaml:"trusted_proxies"`
+		// Cookies - атрибуты Secure и SameSite для кук
+		Cookies handlers.CookieOptions `yaml:"cookies"`
+		// Security - Content-Security-Policy и HSTS
+		Security handlers.SecurityOptions `yaml:"security"`
+	} `yaml:"server"`
+	Auth struct {
+		// Ключи подписи, issuer и audience токенов сессии
+		auth.Config `yaml:",inline"`
+		// Политика паролей и алгоритм хэширования
+		Password auth.PasswordConfig `yaml:"password"`
+		// Роли, которым обязательна двухфакторная аутентификация
+		Require2FARoles []string `yaml:"require_2fa_roles"`
+		TOTPIssuer      string   `yaml:"totp_issuer"`
+		// Отсрочка удаления аккаунта по запросу пользователя
+		DeletionGrace time.Duration `yaml:"deletion_grace"`
+	} `yaml:"auth"`
+	OIDC      oidc.Config       `yaml:"oidc"`
+	Mail      mailer.Config     `yaml:"mail"`
+	Database  database.DBConfig `yaml:"database"`
+	RateLimit ratelimit.Config  `yaml:"rate_limit"`
+	// Realtime - доставка событий (новых сообщений) открытым соединениям
+	Realtime realtime.Config `yaml:"realtime"`
+	// Reactions - реакции на посты и комментарии
+	Reactions handlers.Reactions `yaml:"reactions"`
+	Admin     struct {
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+	} `yaml:"admin"`
+}
+
+// loadConfig - чтение config.yaml, общее для всех команд
+func loadConfig(path string) (*Config, error) {
+	configFile, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия %s: %v", path, err)
+	}
+	defer configFile.Close()
+
+	var config Config
+	decoder := yaml.NewDecoder(configFile)
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга %s: %v", path, err)
+	}
+
+	return &config, nil
+}
+
+// loadPasswords - политика паролей из конфига
+func loadPasswords(config *Config) (*auth.Passwords, error) {
+	passwords, err := auth.NewPasswords(config.Auth.Password)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка настройки auth.password: %v", err)
+	}
+	return passwords, nil
+}
+
+// openRepository - подключение к БД и создание репозитория
+func openRepository(config *Config) (*database.Cluster, *models.Repository, error) {
+	cluster, err := database.ConnectCluster(config.Database)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка подключения к БД: %v", err)
+	}
+
+	// Чтение лент и статистики - через реплики
+	repo := models.NewRepository(cluster.Primary()).WithReader(cluster)
+	return cluster, repo, nil
+}
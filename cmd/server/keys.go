@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"unitycn/internal/auth"
+)
+
+// runKeys - keys list|generate|retire
+func runKeys(configPath string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("использование: keys list|generate|retire -h")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("keys "+action, flag.ExitOnError)
+	alg := fs.String("alg", auth.AlgEdDSA, "алгоритм нового ключа: EdDSA или RS256 (для generate)")
+	kid := fs.String("kid", "", "идентификатор ключа (для retire)")
+	fs.Parse(args[1:])
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	dir := config.Auth.KeysDir
+	if dir == "" {
+		dir = "./keys"
+	}
+
+	switch action {
+	case "list":
+		keys, err := auth.LoadKeys(dir)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			fmt.Printf("В %s нет ключей (сервер создаст ключ EdDSA при запуске)\n", dir)
+			return nil
+		}
+		// Ключ подписи - как в auth.NewService
+		signing := config.Auth.SigningKey
+		if signing == "" {
+			for _, key := range keys {
+				if key.CanSign() {
+					signing = key.ID
+				}
+			}
+		}
+		for _, key := range keys {
+			state := "только проверка"
+			switch {
+			case key.ID == signing:
+				state = "подпись"
+			case key.CanSign():
+				state = "запасной"
+			}
+			fmt.Printf("%-30s %-6s %s\n", key.ID, key.Algorithm, state)
+		}
+	case "generate":
+		key, err := auth.GenerateKey(dir, *alg)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Создан ключ %s (%s) в %s\n", key.ID, key.Algorithm, dir)
+		if config.Auth.SigningKey != "" {
+			fmt.Printf("auth.signing_key = %s: новый ключ начнёт подписывать после смены signing_key\n", config.Auth.SigningKey)
+		} else {
+			fmt.Println("Новые токены подписываются им после перезапуска сервера")
+		}
+	case "retire":
+		if *kid == "" {
+			return fmt.Errorf("не задан -kid")
+		}
+		if *kid == config.Auth.SigningKey {
+			return fmt.Errorf("ключ %s указан в auth.signing_key", *kid)
+		}
+		if err := auth.RetireKey(dir, *kid); err != nil {
+			return err
+		}
+		fmt.Printf("Ключ %s выведен из оборота: закрытая часть удалена, выданные им токены действуют до своего срока\n", *kid)
+	default:
+		return fmt.Errorf("неизвестное действие keys: %s", action)
+	}
+
+	return nil
+}
@@ -1,109 +1,76 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
-
-	"html/template"
-	"unitycn/internal/auth"
-	"unitycn/internal/database"
-	"unitycn/internal/handlers"
-	"unitycn/internal/models"
-
 	"os"
-
-	"github.com/gin-gonic/gin"
-	"gopkg.in/yaml.v3"
 )
 
-type Config struct {
-	Server struct {
-		Port   string `yaml:"port"`
-		Secret string `yaml:"secret_key"`
-	} `yaml:"server"`
-	Database database.DBConfig `yaml:"database"`
-	Admin    struct {
-		Username string `yaml:"username"`
-		Password string `yaml:"password"`
-	} `yaml:"admin"`
-}
+const usageText = `Платформа Единство 团结
 
-func main() {
-	// Включим подробное логирование
-	log.Println("=== Запуск Платформы Единство ===")
+Использование:
+  server [-config config.yaml] <команда> [аргументы]
 
-	// Чтение конфига
-	configFile, err := os.Open("config.yaml")
-	if err != nil {
-		log.Fatal("Ошибка открытия config.yaml:", err)
-	}
-	defer configFile.Close()
-
-	var config Config
-	decoder := yaml.NewDecoder(configFile)
-	if err := decoder.Decode(&config); err != nil {
-		log.Fatal("Ошибка парсинга config.yaml:", err)
-	}
-
-	log.Printf("Конфиг загружен: порт=%s", config.Server.Port)
-
-	// Подключение к БД
-	log.Println("Подключение к PostgreSQL...")
-	db, err := database.Connect(config.Database)
-	if err != nil {
-		log.Fatal("Ошибка подключения к БД:", err)
-	}
-	defer db.Close()
+Команды:
+  serve                         запуск веб-сервера (по умолчанию)
+  migrate up|down|status        применение, откат и состояние миграций
+  user create|passwd|set-role|ban|unban|unlock|reset-2fa
+                                управление пользователями
+  hash-password                 хэш пароля из stdin (для admin.password в config.yaml)
+  seed                          заполнение БД правдоподобными тестовыми данными
+  export <файл.tar.gz>          выгрузка всех данных в архив
+  import <файл.tar.gz>          загрузка данных из архива
+  keys list|generate|retire     ключи подписи токенов сессии
+  openapi dump|check            вывод OpenAPI документа, проверка что все маршруты описаны
 
-	// Инициализация репозитория
-	repo := models.NewRepository(db)
+Подробнее: server <команда> -h
+`
 
-	// Инициализация аутентификации
-	auth.Init(config.Server.Secret)
-	log.Println("Аутентификация инициализирована")
+func usage() {
+	fmt.Fprint(os.Stderr, usageText)
+}
 
-	// Создание админа, если его нет
-	log.Printf("Проверка администратора: %s", config.Admin.Username)
-	if err := ensureAdminExists(repo, config.Admin.Username, config.Admin.Password); err != nil {
-		log.Printf("Предупреждение: не удалось создать администратора: %v", err)
-	} else {
-		log.Println("Администратор проверен/создан")
+func main() {
+	configPath := flag.String("config", "config.yaml", "путь к файлу конфигурации")
+	flag.Usage = usage
+	flag.Parse()
+
+	command := "serve"
+	args := flag.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
 	}
 
-	// Настройка маршрутов
-	r := setupRouter(repo, config.Server.Secret)
-
-	// Запуск сервера
-	log.Printf("Сервер запущен на http://localhost%s", config.Server.Port)
-	if err := r.Run(config.Server.Port); err != nil {
-		log.Fatal("Ошибка запуска сервера:", err)
+	var err error
+	switch command {
+	case "serve":
+		err = runServe(*configPath, args)
+	case "migrate":
+		err = runMigrate(*configPath, args)
+	case "user":
+		err = runUser(*configPath, args)
+	case "hash-password":
+		err = runHashPassword(*configPath, args)
+	case "seed":
+		err = runSeed(*configPath, args)
+	case "export":
+		err = runExport(*configPath, args)
+	case "import":
+		err = runImport(*configPath, args)
+	case "keys":
+		err = runKeys(*configPath, args)
+	case "openapi":
+		err = runOpenAPI(args)
+	case "help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "Неизвестная команда: %s\n\n", command)
+		usage()
+		os.Exit(2)
 	}
-}
-
-func setupRouter(repo *models.Repository, secret string) *gin.Engine {
-	r := gin.Default()
-	r.Static("/static", "./static")
-	tmpl := template.Must(template.New("").ParseGlob("templates/*.html"))
-	tmpl = template.Must(tmpl.ParseGlob("templates/admin/*.html"))
-
-	r.SetHTMLTemplate(tmpl)
 
-	// Используем RegisterRoutes из web.go
-	handlers.RegisterRoutes(r, repo, secret)
-
-	return r
-}
-
-func ensureAdminExists(repo *models.Repository, username, hashedPassword string) error {
-	// Проверяем, существует ли уже администратор
-	_, err := repo.GetUserByUsername(username)
-	if err == nil {
-		// Пользователь уже существует
-		log.Printf("Администратор %s уже существует", username)
-		return nil
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	log.Printf("Создание администратора: %s", username)
-
-	// Если пользователя нет - создаём с display_name = username
-	return repo.CreateUser(username, hashedPassword, "admin", username)
 }
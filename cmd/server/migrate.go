@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"unitycn/internal/database"
+)
+
+// runMigrate - migrate up|down|status
+func runMigrate(configPath string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("использование: migrate up|down|status [-dir migrations] [-steps N]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	dir := fs.String("dir", "migrations", "каталог с миграциями")
+	steps := fs.Int("steps", 1, "сколько миграций откатить (для down)")
+	fs.Parse(args[1:])
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	db, err := database.Connect(config.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch action {
+	case "up":
+		done, err := database.MigrateUp(db, *dir)
+		for _, m := range done {
+			fmt.Printf("применена  %03d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Println("Новых миграций нет")
+		}
+	case "down":
+		done, err := database.MigrateDown(db, *dir, *steps)
+		for _, m := range done {
+			fmt.Printf("откачена   %03d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+	case "status":
+		states, err := database.MigrationStatus(db, *dir)
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			applied := "не применена"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%03d_%-30s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		return fmt.Errorf("неизвестное действие migrate: %s", action)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"unitycn/internal/handlers"
+	"unitycn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runOpenAPI - openapi dump|check
+func runOpenAPI(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("использование: openapi dump|check")
+	}
+
+	switch args[0] {
+	case "dump":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(handlers.OpenAPIDocument())
+	case "check":
+		// Маршруты регистрируются без БД и ключей - обработчики не вызываются
+		gin.SetMode(gin.ReleaseMode)
+		r := gin.New()
+		handlers.RegisterRoutes(r, models.NewRepository(nil), nil, handlers.Options{})
+
+		missing := handlers.UndocumentedRoutes(r.Routes())
+		if len(missing) > 0 {
+			for _, route := range missing {
+				fmt.Fprintf(os.Stderr, "нет в OpenAPI: %s\n", route)
+			}
+			return fmt.Errorf("маршрутов без описания: %d", len(missing))
+		}
+		fmt.Printf("Все %d маршрутов описаны\n", len(r.Routes()))
+		return nil
+	default:
+		return fmt.Errorf("неизвестное действие openapi: %s", args[0])
+	}
+}
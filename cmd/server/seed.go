@@ -0,0 +1,224 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"unitycn/internal/models"
+)
+
+var (
+	seedFirstNames = []string{
+		"Иван", "Пётр", "Алексей", "Николай", "Сергей", "Михаил", "Владимир", "Дмитрий",
+		"Анна", "Мария", "Екатерина", "Ольга", "Наталья", "Татьяна", "Елена", "Надежда",
+		"Ли", "Ван", "Чжан", "Лю", "Чэнь",
+	}
+	seedLastNames = []string{
+		"Иванов", "Петров", "Смирнов", "Кузнецов", "Попов", "Соколов", "Лебедев", "Козлов",
+		"Новиков", "Морозов", "Волков", "Соловьёв", "Васильев", "Зайцев", "Павлов",
+	}
+	seedTranslit = map[string]string{
+		"Иван": "ivan", "Пётр": "petr", "Алексей": "aleksey", "Николай": "nikolay",
+		"Сергей": "sergey", "Михаил": "mikhail", "Владимир": "vladimir", "Дмитрий": "dmitry",
+		"Анна": "anna", "Мария": "maria", "Екатерина": "ekaterina", "Ольга": "olga",
+		"Наталья": "natalya", "Татьяна": "tatyana", "Елена": "elena", "Надежда": "nadezhda",
+		"Ли": "li", "Ван": "wang", "Чжан": "zhang", "Лю": "liu", "Чэнь": "chen",
+	}
+	seedPosts = []string{
+		"Сегодня на заводе перевыполнили план на 120%! Слава труду!",
+		"Провели субботник во дворе: посадили десять берёз и покрасили скамейки.",
+		"Читаю «Капитал», второй том идёт тяжелее первого. Кто осилил - поделитесь конспектом.",
+		"В нашей библиотеке открылся кружок изучения китайского языка. 团结就是力量!",
+		"Товарищи, кто едет на слёт в следующие выходные? Нужны люди для стенгазеты.",
+		"Бригада сварщиков закончила монтаж нового цеха на две недели раньше срока.",
+		"Урожай картофеля в этом году отличный, колхоз выполнил план досрочно.",
+		"Предлагаю организовать шахматный турнир между цехами. Кто за?",
+		"Посмотрел вчера «Броненосец Потёмкин» в клубе. Классика, которая не стареет.",
+		"Напоминаю: собрание профкома в четверг в 18:00, явка обязательна.",
+		"Поздравляю всех с Днём космонавтики! Гагарин - наш герой.",
+		"Сдали объект досрочно, спасибо всей бригаде за слаженную работу.",
+		"Ищу единомышленников для хора рабочей самодеятельности.",
+		"Ремонт в школе закончен, дети пойдут первого сентября в светлые классы.",
+		"Коллективный труд - основа нашей силы. Вместе мы построим будущее!",
+	}
+	seedComments = []string{
+		"Поддерживаю, товарищ!", "Отличная новость!", "Так держать!", "Я в деле.",
+		"Полностью согласен.", "Слава труду!", "А где записаться?", "Горжусь нашими!",
+		"Спасибо за информацию.", "Буду обязательно.", "团结!", "Вперёд, к новым победам!",
+	}
+	seedHeroes = []struct {
+		name, description, birthDate string
+	}{
+		{"Алексей Стаханов", "Шахтёр, зачинатель стахановского движения.", "1906-01-03"},
+		{"Валентина Терешкова", "Первая женщина-космонавт.", "1937-03-06"},
+		{"Юрий Гагарин", "Первый человек в космосе.", "1934-03-09"},
+		{"Лэй Фэн", "Солдат НОАК, символ самоотверженного служения народу.", "1940-12-18"},
+		{"Паша Ангелина", "Одна из первых женщин-трактористок, бригадир.", "1912-01-12"},
+	}
+)
+
+// runSeed - заполнение БД правдоподобными тестовыми данными
+func runSeed(configPath string, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	users := fs.Int("users", 20, "количество пользователей")
+	posts := fs.Int("posts", 100, "количество постов")
+	comments := fs.Int("comments", 300, "количество комментариев")
+	likes := fs.Int("likes", 500, "количество лайков")
+	heroes := fs.Bool("heroes", true, "добавить героев")
+	password := fs.String("password", "revolution", "пароль всех тестовых пользователей")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "зерно генератора случайных чисел")
+	fs.Parse(args)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	cluster, _, err := openRepository(config)
+	if err != nil {
+		return err
+	}
+	defer cluster.Close()
+
+	rnd := rand.New(rand.NewSource(*seed))
+	now := time.Now()
+	// randomTime - случайный момент за последние 90 дней после from
+	randomTime := func(from time.Time) time.Time {
+		if from.IsZero() {
+			from = now.AddDate(0, 0, -90)
+		}
+		span := now.Sub(from)
+		if span <= 0 {
+			return now
+		}
+		return from.Add(time.Duration(rnd.Int63n(int64(span))))
+	}
+
+	// Один хэш на всех - хэширование паролей намеренно медленное
+	passwords, err := loadPasswords(config)
+	if err != nil {
+		return err
+	}
+	hash, err := passwords.Hash(*password)
+	if err != nil {
+		return fmt.Errorf("ошибка хэширования пароля: %v", err)
+	}
+
+	tx, err := cluster.Primary().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	type seededUser struct {
+		id        int
+		createdAt time.Time
+	}
+	var userList []seededUser
+	for i := 0; i < *users; i++ {
+		first := seedFirstNames[rnd.Intn(len(seedFirstNames))]
+		last := seedLastNames[rnd.Intn(len(seedLastNames))]
+		username := fmt.Sprintf("%s_%d", seedTranslit[first], rnd.Intn(100000))
+		createdAt := randomTime(time.Time{})
+
+		var id int
+		err := tx.QueryRow(`
+			INSERT INTO users (username, password, role, display_name, created_at)
+			VALUES ($1, $2, 'user', $3, $4)
+			ON CONFLICT (username) DO NOTHING RETURNING id`,
+			username, hash, first+" "+last, createdAt,
+		).Scan(&id)
+		if err != nil {
+			// Совпадение имени - просто пропускаем
+			continue
+		}
+		userList = append(userList, seededUser{id, createdAt})
+	}
+	if len(userList) == 0 {
+		return fmt.Errorf("не создано ни одного пользователя")
+	}
+
+	type seededPost struct {
+		id        int
+		createdAt time.Time
+	}
+	var postList []seededPost
+	for i := 0; i < *posts; i++ {
+		author := userList[rnd.Intn(len(userList))]
+		createdAt := randomTime(author.createdAt)
+
+		var id int
+		err := tx.QueryRow(`
+			INSERT INTO posts (user_id, content, slogan, created_at)
+			VALUES ($1, $2, '团结', $3) RETURNING id`,
+			author.id, seedPosts[rnd.Intn(len(seedPosts))], createdAt,
+		).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("ошибка создания поста: %v", err)
+		}
+		postList = append(postList, seededPost{id, createdAt})
+	}
+
+	createdComments := 0
+	for i := 0; i < *comments && len(postList) > 0; i++ {
+		post := postList[rnd.Intn(len(postList))]
+		author := userList[rnd.Intn(len(userList))]
+		_, err := tx.Exec(`
+			INSERT INTO comments (post_id, user_id, content, created_at)
+			VALUES ($1, $2, $3, $4)`,
+			post.id, author.id, seedComments[rnd.Intn(len(seedComments))], randomTime(post.createdAt),
+		)
+		if err != nil {
+			return fmt.Errorf("ошибка создания комментария: %v", err)
+		}
+		createdComments++
+	}
+
+	createdLikes := 0
+	for i := 0; i < *likes && len(postList) > 0; i++ {
+		post := postList[rnd.Intn(len(postList))]
+		user := userList[rnd.Intn(len(userList))]
+		res, err := tx.Exec(`
+			INSERT INTO post_reactions (post_id, user_id, reaction, created_at)
+			VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`,
+			post.id, user.id, models.ReactionLike, randomTime(post.createdAt),
+		)
+		if err != nil {
+			return fmt.Errorf("ошибка создания лайка: %v", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE posts SET likes = likes + 1 WHERE id = $1", post.id); err != nil {
+			return err
+		}
+		createdLikes++
+	}
+
+	createdHeroes := 0
+	if *heroes {
+		for _, h := range seedHeroes {
+			res, err := tx.Exec(`
+				INSERT INTO heroes (name, description, birth_date, image_url)
+				SELECT $1, $2, $3::date, ''
+				WHERE NOT EXISTS (SELECT 1 FROM heroes WHERE name = $1)`,
+				h.name, h.description, h.birthDate,
+			)
+			if err != nil {
+				return fmt.Errorf("ошибка создания героя: %v", err)
+			}
+			n, _ := res.RowsAffected()
+			createdHeroes += int(n)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Создано: пользователей %d, постов %d, комментариев %d, лайков %d, героев %d\n",
+		len(userList), len(postList), createdComments, createdLikes, createdHeroes)
+	fmt.Printf("Пароль тестовых пользователей: %s\n", *password)
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"time"
+
+	"unitycn/internal/auth"
+	"unitycn/internal/handlers"
+	"unitycn/internal/mailer"
+	"unitycn/internal/models"
+	"unitycn/internal/oidc"
+	"unitycn/internal/ratelimit"
+	"unitycn/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runServe - запуск веб-сервера
+func runServe(configPath string, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Parse(args)
+
+	// Включим подробное логирование
+	log.Println("=== Запуск Платформы Единство ===")
+
+	// Чтение конфига
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Конфиг загружен: порт=%s", config.Server.Port)
+
+	// Подключение к БД
+	log.Println("Подключение к PostgreSQL...")
+	cluster, repo, err := openRepository(config)
+	if err != nil {
+		return err
+	}
+	defer cluster.Close()
+
+	// Ключи подписи токенов
+	tokens, created, err := auth.NewService(config.Auth.Config)
+	if err != nil {
+		return fmt.Errorf("ошибка настройки auth: %v", err)
+	}
+	if created != nil {
+		log.Printf("Создан ключ подписи %s (%s)", created.ID, created.Algorithm)
+	}
+	log.Printf("Токены подписываются ключом %s (%s)", tokens.SigningKey().ID, tokens.SigningKey().Algorithm)
+
+	passwords, err := loadPasswords(config)
+	if err != nil {
+		return err
+	}
+	log.Printf("Пароли хэшируются %s, минимум %d символов", passwords.Algorithm(), passwords.MinLength())
+
+	// Создание админа, если его нет
+	log.Printf("Проверка администратора: %s", config.Admin.Username)
+	if err := ensureAdminExists(repo, config.Admin.Username, config.Admin.Password); err != nil {
+		log.Printf("Предупреждение: не удалось создать администратора: %v", err)
+	} else {
+		log.Println("Администратор проверен/создан")
+	}
+
+	// Ограничение частоты запросов
+	limiter, err := ratelimit.New(config.RateLimit)
+	if err != nil {
+		return fmt.Errorf("ошибка настройки rate_limit: %v", err)
+	}
+	if limiter != nil {
+		defer limiter.Close()
+		log.Printf("Ограничения запросов включены (backend=%s)", config.RateLimit.Backend)
+	}
+
+	// Внешние провайдеры входа
+	providers, err := oidc.NewRegistry(config.OIDC)
+	if err != nil {
+		return fmt.Errorf("ошибка настройки oidc: %v", err)
+	}
+	for _, p := range providers.List() {
+		log.Printf("Вход через OIDC: %s (%s)", p.Config.Name, p.Config.Issuer)
+	}
+
+	// Почта
+	mail, err := mailer.New(config.Mail)
+	if err != nil {
+		return fmt.Errorf("ошибка настройки mail: %v", err)
+	}
+	baseURL := config.Server.BaseURL
+	if baseURL == "" {
+		baseURL = "http://localhost" + config.Server.Port
+	}
+	log.Printf("Почта: %T, ссылки на %s", mail, baseURL)
+
+	// События для открытых соединений (новые сообщения)
+	events, err := realtime.New(config.Realtime, cluster.Primary(), config.Database.ConnString())
+	if err != nil {
+		return fmt.Errorf("ошибка настройки realtime: %v", err)
+	}
+	defer events.Close()
+	log.Printf("Доставка событий: %T", events)
+
+	if err := config.Server.Cookies.Validate(); err != nil {
+		return fmt.Errorf("ошибка настройки server.cookies: %v", err)
+	}
+	if err := config.Reactions.Validate(); err != nil {
+		return fmt.Errorf("ошибка настройки reactions: %v", err)
+	}
+
+	// Настройка маршрутов
+	r, err := setupRouter(repo, tokens, config.Server.TrustedProxies, handlers.Options{
+		Limiter: limiter,
+		TwoFactor: handlers.TwoFactorOptions{
+			Issuer:        config.Auth.TOTPIssuer,
+			RequiredRoles: config.Auth.Require2FARoles,
+		},
+		OIDC:          providers,
+		Mailer:        mail,
+		BaseURL:       baseURL,
+		Passwords:     passwords,
+		DeletionGrace: config.Auth.DeletionGrace,
+		Cookies:       config.Server.Cookies,
+		Security:      config.Server.Security,
+		Events:        events,
+		Reactions:     config.Reactions,
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка настройки server.trusted_proxies: %v", err)
+	}
+
+	// Удаление аккаунтов, отсрочка которых истекла
+	go func() {
+		for {
+			handlers.DeleteDueAccounts(repo)
+			time.Sleep(accountDeletionInterval)
+		}
+	}()
+
+	// Запуск сервера
+	log.Printf("Сервер запущен на http://localhost%s", config.Server.Port)
+	return r.Run(config.Server.Port)
+}
+
+// accountDeletionInterval - как часто удаляются аккаунты, отсрочка которых истекла
+const accountDeletionInterval = time.Hour
+
+func setupRouter(repo *models.Repository, tokens *auth.Service, trustedProxies []string, opts handlers.Options) (*gin.Engine, error) {
+	r := gin.Default()
+	if err := handlers.TrustProxies(r, trustedProxies); err != nil {
+		return nil, err
+	}
+	r.Static("/static", "./static")
+	tmpl := template.Must(template.New("").ParseGlob("templates/*.html"))
+	tmpl = template.Must(tmpl.ParseGlob("templates/admin/*.html"))
+
+	r.SetHTMLTemplate(tmpl)
+
+	// Используем RegisterRoutes из web.go
+	handlers.RegisterRoutes(r, repo, tokens, opts)
+
+	return r, nil
+}
+
+func ensureAdminExists(repo *models.Repository, username, hashedPassword string) error {
+	// Проверяем, существует ли уже администратор
+	_, err := repo.GetUserByUsername(username)
+	if err == nil {
+		// Пользователь уже существует
+		log.Printf("Администратор %s уже существует", username)
+		return nil
+	}
+
+	log.Printf("Создание администратора: %s", username)
+
+	// Если пользователя нет - создаём с display_name = username
+	return repo.CreateUser(username, hashedPassword, "admin", username)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bufio"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// readPasswordNoEcho - чтение строки из терминала без эха;
+// ok=false, если stdin не терминал
+func readPasswordNoEcho() (line string, ok bool, err error) {
+	fd := int(os.Stdin.Fd())
+	state, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return "", false, nil
+	}
+
+	noEcho := *state
+	noEcho.Lflag &^= unix.ECHO
+	noEcho.Lflag |= unix.ICANON | unix.ISIG
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &noEcho); err != nil {
+		return "", false, nil
+	}
+	defer unix.IoctlSetTermios(fd, unix.TCSETS, state)
+
+	line, err = bufio.NewReader(os.Stdin).ReadString('\n')
+	// Enter не отобразился - переводим строку сами
+	os.Stderr.WriteString("\n")
+	return line, true, err
+}
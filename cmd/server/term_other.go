@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// readPasswordNoEcho - без termios: читаем stdin как есть
+func readPasswordNoEcho() (string, bool, error) {
+	return "", false, nil
+}
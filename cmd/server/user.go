@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"unitycn/internal/models"
+)
+
+// validRoles - роли, которые можно назначить (как в UpdateUserRole)
+var validRoles = map[string]bool{"admin": true, "moderator": true, "user": true}
+
+// runUser - user create|passwd|set-role|ban|unban|unlock|reset-2fa
+func runUser(configPath string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("использование: user create|passwd|set-role|ban|unban|unlock|reset-2fa -h")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("user "+action, flag.ExitOnError)
+	username := fs.String("username", "", "имя пользователя")
+	password := fs.String("password", "", "пароль (если не задан - читается из stdin)")
+	displayName := fs.String("display-name", "", "отображаемое имя (для create)")
+	role := fs.String("role", "user", "роль: user, moderator, admin")
+	reason := fs.String("reason", "", "причина блокировки (для ban)")
+	fs.Parse(args[1:])
+
+	if *username == "" {
+		return fmt.Errorf("не задан -username")
+	}
+	if (action == "create" || action == "set-role") && !validRoles[*role] {
+		return fmt.Errorf("неверная роль: %s", *role)
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	passwords, err := loadPasswords(config)
+	if err != nil {
+		return err
+	}
+	cluster, repo, err := openRepository(config)
+	if err != nil {
+		return err
+	}
+	defer cluster.Close()
+
+	if action == "create" {
+		pass, err := passwordArg(*password)
+		if err != nil {
+			return err
+		}
+		if err := passwords.Validate(pass, *username); err != nil {
+			return fmt.Errorf("пароль не подходит: %v", err)
+		}
+		hash, err := passwords.Hash(pass)
+		if err != nil {
+			return fmt.Errorf("ошибка хэширования пароля: %v", err)
+		}
+		if err := repo.CreateUser(*username, hash, *role, *displayName); err != nil {
+			return fmt.Errorf("ошибка создания пользователя: %v", err)
+		}
+		fmt.Printf("Пользователь %s создан (роль %s)\n", *username, *role)
+		return nil
+	}
+
+	user, err := repo.GetUserByUsername(*username)
+	if err != nil {
+		return fmt.Errorf("пользователь %s не найден", *username)
+	}
+
+	switch action {
+	case "passwd":
+		pass, err := passwordArg(*password)
+		if err != nil {
+			return err
+		}
+		if err := passwords.Validate(pass, user.Username); err != nil {
+			return fmt.Errorf("пароль не подходит: %v", err)
+		}
+		hash, err := passwords.Hash(pass)
+		if err != nil {
+			return fmt.Errorf("ошибка хэширования пароля: %v", err)
+		}
+		if err := repo.UpdateUserPassword(user.ID, hash); err != nil {
+			return err
+		}
+		fmt.Printf("Пароль пользователя %s изменён\n", user.Username)
+	case "set-role":
+		if err := repo.UpdateUserRole(user.ID, *role); err != nil {
+			return err
+		}
+		fmt.Printf("Роль пользователя %s: %s\n", user.Username, *role)
+	case "ban":
+		if err := repo.SetUserBanned(user.ID, true, *reason); err != nil {
+			return err
+		}
+		fmt.Printf("Пользователь %s заблокирован\n", user.Username)
+	case "unban":
+		if err := repo.SetUserBanned(user.ID, false, ""); err != nil {
+			return err
+		}
+		fmt.Printf("Пользователь %s разблокирован\n", user.Username)
+	case "unlock":
+		// Неудачные попытки до этой записи больше не учитываются
+		if err := repo.RecordLoginEvent(user.ID, user.Username, "", "cli", models.LoginUnlocked); err != nil {
+			return err
+		}
+		fmt.Printf("Вход пользователя %s разблокирован\n", user.Username)
+	case "reset-2fa":
+		// Потерян телефон и коды восстановления
+		if err := repo.DisableTOTP(user.ID); err != nil {
+			return err
+		}
+		fmt.Printf("2FA пользователя %s отключена\n", user.Username)
+	default:
+		return fmt.Errorf("неизвестное действие user: %s", action)
+	}
+
+	return nil
+}
+
+// runHashPassword - вывод хэша для admin.password в config.yaml;
+// алгоритм и параметры - из auth.password
+func runHashPassword(configPath string, args []string) error {
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	passwords, err := loadPasswords(config)
+	if err != nil {
+		return err
+	}
+
+	// В аргументах пароль остаётся в истории shell и виден в ps
+	if len(args) > 0 {
+		return fmt.Errorf("пароль не передаётся аргументом: введите его в терминале или подайте в stdin")
+	}
+	pass, err := passwordArg("")
+	if err != nil {
+		return err
+	}
+
+	hash, err := passwords.Hash(pass)
+	if err != nil {
+		return fmt.Errorf("ошибка хэширования пароля: %v", err)
+	}
+	fmt.Println(hash)
+	return nil
+}
+
+// passwordArg - пароль из аргумента или первой строки stdin
+// (с терминала - без эха)
+func passwordArg(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Пароль: ")
+	line, tty, err := readPasswordNoEcho()
+	if !tty {
+		line, err = bufio.NewReader(os.Stdin).ReadString('\n')
+	}
+	if err != nil && line == "" {
+		return "", fmt.Errorf("пароль не введён")
+	}
+
+	password = strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("пароль не может быть пустым")
+	}
+	return password, nil
+}
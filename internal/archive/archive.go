@@ -0,0 +1,458 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FormatVersion - версия формата архива. Увеличивается при несовместимых
+// изменениях; Import отказывается читать архивы более новой версии.
+const FormatVersion = 1
+
+// DefaultUploadsDir - каталог загруженных файлов (отдаётся как /static/uploads)
+const DefaultUploadsDir = "static/uploads"
+
+// DefaultStagingDir - куда распаковываются файлы до фиксации импорта:
+// вне отдаваемого каталога static, но на той же файловой системе,
+// чтобы перенос на место был переименованием
+const DefaultStagingDir = "import-tmp"
+
+// Manifest - описание архива (manifest.json)
+type Manifest struct {
+	FormatVersion    int               `json:"format_version"`
+	Application      string            `json:"application"`
+	Kind             string            `json:"kind,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+	IncludePasswords bool              `json:"include_passwords"`
+	Counts           map[string]int    `json:"counts"`
+	Checksums        map[string]string `json:"checksums"`
+}
+
+// ExportOptions - параметры выгрузки
+type ExportOptions struct {
+	// IncludePasswords - выгружать хэши паролей (по умолчанию нет)
+	IncludePasswords bool
+	// UploadsDir - каталог загруженных файлов; пустой или отсутствующий пропускается
+	UploadsDir string
+}
+
+type userRecord struct {
+	ID              int        `json:"id"`
+	Username        string     `json:"username"`
+	DisplayName     string     `json:"display_name"`
+	Role            string     `json:"role"`
+	Bio             string     `json:"bio,omitempty"`
+	AvatarURL       string     `json:"avatar_url,omitempty"`
+	PasswordHash    string     `json:"password_hash,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Email           string     `json:"email,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	Locale          string     `json:"locale,omitempty"`
+}
+
+type postRecord struct {
+	ID          int       `json:"id"`
+	UserID      int       `json:"user_id"`
+	CommunityID int       `json:"community_id,omitempty"`
+	Kind        string    `json:"kind,omitempty"` // пусто в архивах до репостов - post
+	OriginalID  int       `json:"original_id,omitempty"`
+	Content     string    `json:"content"`
+	Slogan      string    `json:"slogan"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type communityRecord struct {
+	ID          int       `json:"id"`
+	Slug        string    `json:"slug"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Visibility  string    `json:"visibility"`
+	CreatedBy   int       `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type communityMemberRecord struct {
+	CommunityID int       `json:"community_id"`
+	UserID      int       `json:"user_id"`
+	Role        string    `json:"role"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// likeRecord - лайк из архивов до появления реакций (likes.jsonl), импортируется как реакция like
+type likeRecord struct {
+	PostID    int       `json:"post_id"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type reactionRecord struct {
+	PostID    int       `json:"post_id"`
+	UserID    int       `json:"user_id"`
+	Reaction  string    `json:"reaction"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type commentReactionRecord struct {
+	CommentID int       `json:"comment_id"`
+	UserID    int       `json:"user_id"`
+	Reaction  string    `json:"reaction"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type commentRecord struct {
+	ID        int       `json:"id"`
+	PostID    int       `json:"post_id"`
+	UserID    int       `json:"user_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// collectionRecord - подборка закладок; видна только владельцу user_id
+type collectionRecord struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type bookmarkRecord struct {
+	UserID       int       `json:"user_id"`
+	PostID       int       `json:"post_id"`
+	CollectionID int       `json:"collection_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type heroRecord struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	BirthDate   time.Time `json:"birth_date"`
+	ImageURL    string    `json:"image_url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type uploadRecord struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// entity - выгружаемая таблица: запрос и разбор строки
+type entity struct {
+	name  string
+	query string
+	scan  func(rows *sql.Rows) (interface{}, error)
+}
+
+func entities(includePasswords bool) []entity {
+	return []entity{
+		{"users", `SELECT id, username, display_name, role, COALESCE(bio, ''), COALESCE(avatar_url, ''), password, created_at,
+		                  COALESCE(email, ''), email_verified_at, COALESCE(locale, '')
+		           FROM users ORDER BY id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var u userRecord
+				err := rows.Scan(&u.ID, &u.Username, &u.DisplayName, &u.Role, &u.Bio, &u.AvatarURL, &u.PasswordHash, &u.CreatedAt,
+					&u.Email, &u.EmailVerifiedAt, &u.Locale)
+				if !includePasswords {
+					u.PasswordHash = ""
+				}
+				return u, err
+			}},
+		{"communities", `SELECT id, slug, name, description, visibility, COALESCE(created_by, 0), created_at
+		                 FROM communities ORDER BY id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var c communityRecord
+				err := rows.Scan(&c.ID, &c.Slug, &c.Name, &c.Description, &c.Visibility, &c.CreatedBy, &c.CreatedAt)
+				return c, err
+			}},
+		{"community_members", `SELECT community_id, user_id, role, status, created_at
+		                       FROM community_members ORDER BY community_id, user_id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var m communityMemberRecord
+				err := rows.Scan(&m.CommunityID, &m.UserID, &m.Role, &m.Status, &m.CreatedAt)
+				return m, err
+			}},
+		{"posts", `SELECT id, user_id, COALESCE(community_id, 0), kind, COALESCE(original_id, 0), content, slogan, created_at
+		           FROM posts ORDER BY id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var p postRecord
+				err := rows.Scan(&p.ID, &p.UserID, &p.CommunityID, &p.Kind, &p.OriginalID, &p.Content, &p.Slogan, &p.CreatedAt)
+				return p, err
+			}},
+		{"reactions", `SELECT post_id, user_id, reaction, created_at FROM post_reactions
+		               ORDER BY post_id, created_at, user_id, reaction`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var r reactionRecord
+				err := rows.Scan(&r.PostID, &r.UserID, &r.Reaction, &r.CreatedAt)
+				return r, err
+			}},
+		{"comments", `SELECT id, post_id, user_id, content, created_at FROM comments ORDER BY id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var c commentRecord
+				err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt)
+				return c, err
+			}},
+		{"comment_reactions", `SELECT comment_id, user_id, reaction, created_at FROM comment_reactions
+		                       ORDER BY comment_id, created_at, user_id, reaction`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var r commentReactionRecord
+				err := rows.Scan(&r.CommentID, &r.UserID, &r.Reaction, &r.CreatedAt)
+				return r, err
+			}},
+		{"collections", `SELECT id, user_id, name, created_at FROM bookmark_collections ORDER BY id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var c collectionRecord
+				err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt)
+				return c, err
+			}},
+		{"bookmarks", `SELECT user_id, post_id, COALESCE(collection_id, 0), created_at FROM bookmarks
+		               ORDER BY user_id, created_at, post_id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var b bookmarkRecord
+				err := rows.Scan(&b.UserID, &b.PostID, &b.CollectionID, &b.CreatedAt)
+				return b, err
+			}},
+		{"heroes", `SELECT id, name, COALESCE(description, ''), birth_date, COALESCE(image_url, ''), created_at
+		            FROM heroes ORDER BY id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var h heroRecord
+				err := rows.Scan(&h.ID, &h.Name, &h.Description, &h.BirthDate, &h.ImageURL, &h.CreatedAt)
+				return h, err
+			}},
+	}
+}
+
+// Export - выгрузка всех данных в tar.gz: JSON Lines на каждую сущность,
+// загруженные файлы в uploads/ и manifest.json с количеством и контрольными суммами
+func Export(db *sql.DB, w io.Writer, opts ExportOptions) (*Manifest, error) {
+	manifest := &Manifest{
+		FormatVersion:    FormatVersion,
+		Application:      "unitycn",
+		CreatedAt:        time.Now().UTC(),
+		IncludePasswords: opts.IncludePasswords,
+		Counts:           make(map[string]int),
+		Checksums:        make(map[string]string),
+	}
+
+	// Все выборки из одного снимка БД
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY"); err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, e := range entities(opts.IncludePasswords) {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+
+		rows, err := tx.Query(e.query)
+		if err != nil {
+			return nil, fmt.Errorf("выгрузка %s: %v", e.name, err)
+		}
+		for rows.Next() {
+			record, err := e.scan(rows)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("выгрузка %s: %v", e.name, err)
+			}
+			if err := enc.Encode(record); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			manifest.Counts[e.name]++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("выгрузка %s: %v", e.name, err)
+		}
+
+		if err := writeFile(tw, manifest, e.name+".jsonl", buf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := exportUploads(tw, manifest, opts.UploadsDir); err != nil {
+		return nil, fmt.Errorf("выгрузка файлов: %v", err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:    "manifest.json",
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: manifest.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gz.Close()
+}
+
+// exportUploads - файлы из каталога загрузок в uploads/ и их список в uploads.jsonl
+func exportUploads(tw *tar.Writer, manifest *Manifest, dir string) error {
+	var list bytes.Buffer
+	enc := json.NewEncoder(&list)
+
+	if dir != "" {
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && p == dir {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+
+			record := uploadRecord{Path: filepath.ToSlash(rel), Size: int64(len(data)), SHA256: checksum(data)}
+			if err := writeFile(tw, manifest, "uploads/"+record.Path, data); err != nil {
+				return err
+			}
+			manifest.Counts["uploads"]++
+			return enc.Encode(record)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeFile(tw, manifest, "uploads.jsonl", list.Bytes())
+}
+
+func writeFile(tw *tar.Writer, manifest *Manifest, name string, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: manifest.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	manifest.Checksums[name] = checksum(data)
+	_, err = tw.Write(data)
+	return err
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// readArchive - чтение всех файлов архива в память с проверкой контрольных сумм
+func readArchive(r io.Reader) (*Manifest, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("архив не в формате gzip: %v", err)
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("ошибка чтения архива: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(header.Name)
+		if strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return nil, nil, fmt.Errorf("недопустимый путь в архиве: %s", header.Name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[name] = data
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		return nil, nil, fmt.Errorf("нет или повреждён manifest.json: %v", err)
+	}
+	if manifest.Kind == KindPersonal {
+		return nil, nil, fmt.Errorf("архив личных данных пользователя нельзя загрузить")
+	}
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > FormatVersion {
+		return nil, nil, fmt.Errorf("неподдерживаемая версия формата: %d (поддерживается до %d)",
+			manifest.FormatVersion, FormatVersion)
+	}
+
+	for name, sum := range manifest.Checksums {
+		data, ok := files[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("в архиве нет файла %s", name)
+		}
+		if checksum(data) != sum {
+			return nil, nil, fmt.Errorf("контрольная сумма %s не совпадает", name)
+		}
+	}
+
+	return &manifest, files, nil
+}
+
+// decodeLines - разбор JSON Lines файла архива
+func decodeLines[T any](files map[string][]byte, name string) ([]T, error) {
+	var records []T
+	scanner := bufio.NewScanner(bytes.NewReader(files[name]))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record T
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
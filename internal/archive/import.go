@@ -0,0 +1,805 @@
+package archive
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"unitycn/internal/models"
+)
+
+// disabledPassword - хэш-заглушка для пользователей, выгруженных без пароля.
+// Не совпадает ни с одним хэшем, войти можно только после смены пароля.
+const disabledPassword = "!"
+
+// maxLocaleLen - размер users.locale
+const maxLocaleLen = 5
+
+// maxCollectionNameLen - размер bookmark_collections.name
+const maxCollectionNameLen = 100
+
+// ImportOptions - параметры загрузки
+type ImportOptions struct {
+	// DryRun - проверить архив и посчитать изменения без записи
+	DryRun bool
+	// UploadsDir - куда распаковывать загруженные файлы; пустой - не распаковывать
+	UploadsDir string
+	// StagingDir - временный каталог для файлов до фиксации; должен быть
+	// на той же файловой системе, что UploadsDir. Пустой - DefaultStagingDir
+	StagingDir string
+}
+
+// Conflict - запись архива, которая расходится с уже существующей в БД.
+// Существующие данные не перезаписываются.
+type Conflict struct {
+	Entity  string `json:"entity"`
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+// Report - итог импорта
+type Report struct {
+	DryRun    bool           `json:"dry_run"`
+	Created   map[string]int `json:"created"`
+	Skipped   map[string]int `json:"skipped"`
+	Conflicts []Conflict     `json:"conflicts"`
+}
+
+func (r *Report) conflict(entity, key, format string, args ...interface{}) {
+	r.Conflicts = append(r.Conflicts, Conflict{
+		Entity:  entity,
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// ValidationError - нарушения ссылочной целостности внутри архива
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "архив не прошёл проверку: " + strings.Join(e.Problems, "; ")
+}
+
+type archiveData struct {
+	users            []userRecord
+	communities      []communityRecord
+	communityMembers []communityMemberRecord
+	posts            []postRecord
+	likes            []likeRecord
+	reactions        []reactionRecord
+	comments         []commentRecord
+	commentReactions []commentReactionRecord
+	collections      []collectionRecord
+	bookmarks        []bookmarkRecord
+	heroes           []heroRecord
+	uploads          []uploadRecord
+}
+
+// Import - загрузка архива в одной транзакции с переназначением ID.
+// Повторный импорт того же архива ничего не создаёт: записи сопоставляются
+// по естественным ключам (username, автор+время+текст, имя героя и т.д.).
+func Import(db *sql.DB, r io.Reader, opts ImportOptions) (*Report, error) {
+	_, files, err := readArchive(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decodeArchive(files)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(data, files); err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		DryRun:    opts.DryRun,
+		Created:   make(map[string]int),
+		Skipped:   make(map[string]int),
+		Conflicts: []Conflict{},
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userIDs, err := importUsers(tx, data.users, report)
+	if err != nil {
+		return nil, err
+	}
+	communityIDs, err := importCommunities(tx, data.communities, userIDs, report)
+	if err != nil {
+		return nil, err
+	}
+	if err := importCommunityMembers(tx, data.communityMembers, communityIDs, userIDs, report); err != nil {
+		return nil, err
+	}
+	postIDs, err := importPosts(tx, data.posts, userIDs, communityIDs, report)
+	if err != nil {
+		return nil, err
+	}
+	if err := importReactions(tx, data.reactions, postIDs, userIDs, report); err != nil {
+		return nil, err
+	}
+	commentIDs, err := importComments(tx, data.comments, postIDs, userIDs, report)
+	if err != nil {
+		return nil, err
+	}
+	if err := importCommentReactions(tx, data.commentReactions, commentIDs, userIDs, report); err != nil {
+		return nil, err
+	}
+	collectionIDs, err := importCollections(tx, data.collections, userIDs, report)
+	if err != nil {
+		return nil, err
+	}
+	if err := importBookmarks(tx, data.bookmarks, userIDs, postIDs, collectionIDs, report); err != nil {
+		return nil, err
+	}
+	if err := importHeroes(tx, data.heroes, report); err != nil {
+		return nil, err
+	}
+	staged, err := importUploads(data.uploads, files, opts, report)
+	if staged != nil {
+		defer staged.cleanup()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if staged != nil {
+		if err := staged.publish(opts.UploadsDir); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+func decodeArchive(files map[string][]byte) (*archiveData, error) {
+	var data archiveData
+	var err error
+	if data.users, err = decodeLines[userRecord](files, "users.jsonl"); err != nil {
+		return nil, err
+	}
+	if data.communities, err = decodeLines[communityRecord](files, "communities.jsonl"); err != nil {
+		return nil, err
+	}
+	if data.communityMembers, err = decodeLines[communityMemberRecord](files, "community_members.jsonl"); err != nil {
+		return nil, err
+	}
+	if data.posts, err = decodeLines[postRecord](files, "posts.jsonl"); err != nil {
+		return nil, err
+	}
+	if data.likes, err = decodeLines[likeRecord](files, "likes.jsonl"); err != nil {
+		return nil, err
+	}
+	if data.reactions, err = decodeLines[reactionRecord](files, "reactions.jsonl"); err != nil {
+		return nil, err
+	}
+	// Лайки архивов до появления реакций
+	for _, l := range data.likes {
+		data.reactions = append(data.reactions, reactionRecord{
+			PostID: l.PostID, UserID: l.UserID, Reaction: models.ReactionLike, CreatedAt: l.CreatedAt,
+		})
+	}
+	if data.comments, err = decodeLines[commentRecord](files, "comments.jsonl"); err != nil {
+		return nil, err
+	}
+	if data.commentReactions, err = decodeLines[commentReactionRecord](files, "comment_reactions.jsonl"); err != nil {
+		return nil, err
+	}
+	if data.collections, err = decodeLines[collectionRecord](files, "collections.jsonl"); err != nil {
+		return nil, err
+	}
+	if data.bookmarks, err = decodeLines[bookmarkRecord](files, "bookmarks.jsonl"); err != nil {
+		return nil, err
+	}
+	if data.heroes, err = decodeLines[heroRecord](files, "heroes.jsonl"); err != nil {
+		return nil, err
+	}
+	if data.uploads, err = decodeLines[uploadRecord](files, "uploads.jsonl"); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// validate - проверка ссылок между сущностями архива до записи в БД
+func validate(data *archiveData, files map[string][]byte) error {
+	var problems []string
+
+	users := make(map[int]bool)
+	usernames := make(map[string]bool)
+	for _, u := range data.users {
+		if users[u.ID] {
+			problems = append(problems, fmt.Sprintf("пользователь %d повторяется", u.ID))
+		}
+		if usernames[u.Username] {
+			problems = append(problems, fmt.Sprintf("username %s повторяется", u.Username))
+		}
+		if u.Username == "" {
+			problems = append(problems, fmt.Sprintf("пользователь %d без username", u.ID))
+		}
+		if len(u.Locale) > maxLocaleLen {
+			problems = append(problems, fmt.Sprintf("пользователь %d: неверный язык %q", u.ID, u.Locale))
+		}
+		users[u.ID] = true
+		usernames[u.Username] = true
+	}
+
+	communities := make(map[int]bool)
+	slugs := make(map[string]bool)
+	for _, c := range data.communities {
+		if communities[c.ID] {
+			problems = append(problems, fmt.Sprintf("сообщество %d повторяется", c.ID))
+		}
+		if slugs[c.Slug] || c.Slug == "" {
+			problems = append(problems, fmt.Sprintf("сообщество %d: адрес %q пустой или повторяется", c.ID, c.Slug))
+		}
+		if c.CreatedBy != 0 && !users[c.CreatedBy] {
+			problems = append(problems, fmt.Sprintf("сообщество %d: нет создателя %d", c.ID, c.CreatedBy))
+		}
+		communities[c.ID] = true
+		slugs[c.Slug] = true
+	}
+
+	for _, m := range data.communityMembers {
+		if !communities[m.CommunityID] || !users[m.UserID] {
+			problems = append(problems, fmt.Sprintf("участник %d/%d ссылается на несуществующие данные", m.CommunityID, m.UserID))
+		}
+	}
+
+	posts := make(map[int]bool)
+	for _, p := range data.posts {
+		if posts[p.ID] {
+			problems = append(problems, fmt.Sprintf("пост %d повторяется", p.ID))
+		}
+		if !users[p.UserID] {
+			problems = append(problems, fmt.Sprintf("пост %d: нет автора %d", p.ID, p.UserID))
+		}
+		if p.CommunityID != 0 && !communities[p.CommunityID] {
+			problems = append(problems, fmt.Sprintf("пост %d: нет сообщества %d", p.ID, p.CommunityID))
+		}
+		switch p.Kind {
+		case "", models.PostKindPost:
+			if p.OriginalID != 0 {
+				problems = append(problems, fmt.Sprintf("пост %d: исходный пост у обычного поста", p.ID))
+			}
+		case models.PostKindRepost, models.PostKindQuote:
+			// Исходный пост создаётся раньше, поэтому должен идти выше
+			if p.OriginalID != 0 && !posts[p.OriginalID] {
+				problems = append(problems, fmt.Sprintf("пост %d: нет исходного поста %d выше в архиве", p.ID, p.OriginalID))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("пост %d: неизвестный вид %q", p.ID, p.Kind))
+		}
+		posts[p.ID] = true
+	}
+
+	for _, r := range data.reactions {
+		if !posts[r.PostID] || !users[r.UserID] {
+			problems = append(problems, fmt.Sprintf("реакция %d/%d ссылается на несуществующие данные", r.PostID, r.UserID))
+		}
+		if r.Reaction == "" {
+			problems = append(problems, fmt.Sprintf("реакция %d/%d без вида", r.PostID, r.UserID))
+		}
+	}
+
+	comments := make(map[int]bool)
+	for _, c := range data.comments {
+		if comments[c.ID] {
+			problems = append(problems, fmt.Sprintf("комментарий %d повторяется", c.ID))
+		}
+		if !posts[c.PostID] {
+			problems = append(problems, fmt.Sprintf("комментарий %d: нет поста %d", c.ID, c.PostID))
+		}
+		if !users[c.UserID] {
+			problems = append(problems, fmt.Sprintf("комментарий %d: нет автора %d", c.ID, c.UserID))
+		}
+		comments[c.ID] = true
+	}
+
+	for _, r := range data.commentReactions {
+		if !comments[r.CommentID] || !users[r.UserID] {
+			problems = append(problems, fmt.Sprintf("реакция на комментарий %d/%d ссылается на несуществующие данные", r.CommentID, r.UserID))
+		}
+		if r.Reaction == "" {
+			problems = append(problems, fmt.Sprintf("реакция на комментарий %d/%d без вида", r.CommentID, r.UserID))
+		}
+	}
+
+	// Подборка принадлежит одному пользователю, и класть в неё можно только его закладки
+	collections := make(map[int]int)
+	collectionNames := make(map[string]bool)
+	for _, c := range data.collections {
+		if _, ok := collections[c.ID]; ok {
+			problems = append(problems, fmt.Sprintf("подборка %d повторяется", c.ID))
+		}
+		if !users[c.UserID] {
+			problems = append(problems, fmt.Sprintf("подборка %d: нет владельца %d", c.ID, c.UserID))
+		}
+		key := fmt.Sprintf("%d/%s", c.UserID, c.Name)
+		if c.Name == "" || utf8.RuneCountInString(c.Name) > maxCollectionNameLen || collectionNames[key] {
+			problems = append(problems, fmt.Sprintf("подборка %d: название %q пустое, длинное или повторяется", c.ID, c.Name))
+		}
+		collections[c.ID] = c.UserID
+		collectionNames[key] = true
+	}
+
+	for _, b := range data.bookmarks {
+		if !posts[b.PostID] || !users[b.UserID] {
+			problems = append(problems, fmt.Sprintf("закладка %d/%d ссылается на несуществующие данные", b.UserID, b.PostID))
+		}
+		if owner, ok := collections[b.CollectionID]; b.CollectionID != 0 && (!ok || owner != b.UserID) {
+			problems = append(problems, fmt.Sprintf("закладка %d/%d: подборка %d не принадлежит пользователю", b.UserID, b.PostID, b.CollectionID))
+		}
+	}
+
+	for _, u := range data.uploads {
+		if strings.HasPrefix(filepath.Clean(u.Path), "..") || filepath.IsAbs(u.Path) {
+			problems = append(problems, fmt.Sprintf("файл %s: недопустимый путь", u.Path))
+			continue
+		}
+		if _, ok := files["uploads/"+u.Path]; !ok {
+			problems = append(problems, fmt.Sprintf("файл %s отсутствует в архиве", u.Path))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// importUsers - существующий username переиспользуется, данные не перезаписываются
+func importUsers(tx *sql.Tx, users []userRecord, report *Report) (map[int]int, error) {
+	ids := make(map[int]int)
+	for _, u := range users {
+		var id int
+		var role, displayName string
+		err := tx.QueryRow(
+			"SELECT id, role, display_name FROM users WHERE username = $1", u.Username,
+		).Scan(&id, &role, &displayName)
+		if err == nil {
+			ids[u.ID] = id
+			report.Skipped["users"]++
+			if role != u.Role || displayName != u.DisplayName {
+				report.conflict("users", u.Username,
+					"пользователь уже существует с другими данными (роль %s, имя %q), оставлен без изменений",
+					role, displayName)
+			}
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		password := u.PasswordHash
+		if password == "" {
+			password = disabledPassword
+		}
+
+		// Подтверждённый адрес уникален: если он уже подтверждён у другого
+		// пользователя, адрес переносится без подтверждения
+		verifiedAt := u.EmailVerifiedAt
+		if u.Email != "" && verifiedAt != nil {
+			var taken bool
+			err := tx.QueryRow(
+				"SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND email_verified_at IS NOT NULL)", u.Email,
+			).Scan(&taken)
+			if err != nil {
+				return nil, err
+			}
+			if taken {
+				verifiedAt = nil
+				report.conflict("users", u.Username, "email %s уже подтверждён другим пользователем, перенесён без подтверждения", u.Email)
+			}
+		}
+
+		err = tx.QueryRow(`
+			INSERT INTO users (username, password, role, display_name, bio, avatar_url, created_at,
+			                   email, email_verified_at, locale)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, NULLIF($8, ''), $9, NULLIF($10, '')) RETURNING id`,
+			u.Username, password, u.Role, u.DisplayName, u.Bio, u.AvatarURL, u.CreatedAt,
+			u.Email, verifiedAt, u.Locale,
+		).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("пользователь %s: %v", u.Username, err)
+		}
+		ids[u.ID] = id
+		report.Created["users"]++
+	}
+	return ids, nil
+}
+
+// importCommunities - существующий адрес переиспользуется, данные не перезаписываются
+func importCommunities(tx *sql.Tx, communities []communityRecord, userIDs map[int]int, report *Report) (map[int]int, error) {
+	ids := make(map[int]int)
+	for _, c := range communities {
+		var id int
+		var visibility string
+		err := tx.QueryRow("SELECT id, visibility FROM communities WHERE slug = $1", c.Slug).Scan(&id, &visibility)
+		if err == nil {
+			ids[c.ID] = id
+			report.Skipped["communities"]++
+			if visibility != c.Visibility {
+				report.conflict("communities", c.Slug,
+					"сообщество уже существует с режимом %s, оставлено без изменений", visibility)
+			}
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		err = tx.QueryRow(`
+			INSERT INTO communities (slug, name, description, visibility, created_by, created_at)
+			VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6) RETURNING id`,
+			c.Slug, c.Name, c.Description, c.Visibility, userIDs[c.CreatedBy], c.CreatedAt,
+		).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("сообщество %s: %v", c.Slug, err)
+		}
+		ids[c.ID] = id
+		report.Created["communities"]++
+	}
+	return ids, nil
+}
+
+func importCommunityMembers(tx *sql.Tx, members []communityMemberRecord, communityIDs, userIDs map[int]int, report *Report) error {
+	for _, m := range members {
+		res, err := tx.Exec(`
+			INSERT INTO community_members (community_id, user_id, role, status, created_at)
+			VALUES ($1, $2, $3, $4, $5) ON CONFLICT (community_id, user_id) DO NOTHING`,
+			communityIDs[m.CommunityID], userIDs[m.UserID], m.Role, m.Status, m.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("участник сообщества %d: %v", m.CommunityID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			report.Skipped["community_members"]++
+			continue
+		}
+		report.Created["community_members"]++
+	}
+	return nil
+}
+
+func importPosts(tx *sql.Tx, posts []postRecord, userIDs, communityIDs map[int]int, report *Report) (map[int]int, error) {
+	ids := make(map[int]int)
+	for _, p := range posts {
+		userID := userIDs[p.UserID]
+		kind := p.Kind
+		if kind == "" {
+			kind = models.PostKindPost
+		}
+		originalID := ids[p.OriginalID]
+
+		var id int
+		var err error
+		if kind == models.PostKindRepost && originalID != 0 {
+			// Репост поста от пользователя - один
+			err = tx.QueryRow(
+				"SELECT id FROM posts WHERE user_id = $1 AND original_id = $2 AND kind = $3", userID, originalID, kind,
+			).Scan(&id)
+		} else {
+			err = tx.QueryRow(`
+				SELECT id FROM posts WHERE user_id = $1 AND created_at = $2 AND content = $3
+				ORDER BY id LIMIT 1`,
+				userID, p.CreatedAt, p.Content,
+			).Scan(&id)
+		}
+		if err == nil {
+			ids[p.ID] = id
+			report.Skipped["posts"]++
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		err = tx.QueryRow(`
+			INSERT INTO posts (user_id, community_id, kind, original_id, content, slogan, created_at)
+			VALUES ($1, NULLIF($2, 0), $3, NULLIF($4, 0), $5, $6, $7) RETURNING id`,
+			userID, communityIDs[p.CommunityID], kind, originalID, p.Content, p.Slogan, p.CreatedAt,
+		).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("пост %d: %v", p.ID, err)
+		}
+		ids[p.ID] = id
+		report.Created["posts"]++
+	}
+	return ids, nil
+}
+
+func importReactions(tx *sql.Tx, reactions []reactionRecord, postIDs, userIDs map[int]int, report *Report) error {
+	for _, r := range reactions {
+		postID := postIDs[r.PostID]
+		res, err := tx.Exec(`
+			INSERT INTO post_reactions (post_id, user_id, reaction, created_at)
+			VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`,
+			postID, userIDs[r.UserID], r.Reaction, r.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("реакция на пост %d: %v", r.PostID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			report.Skipped["reactions"]++
+			continue
+		}
+		if r.Reaction == models.ReactionLike {
+			if _, err := tx.Exec("UPDATE posts SET likes = likes + 1 WHERE id = $1", postID); err != nil {
+				return err
+			}
+		}
+		report.Created["reactions"]++
+	}
+	return nil
+}
+
+func importComments(tx *sql.Tx, comments []commentRecord, postIDs, userIDs map[int]int, report *Report) (map[int]int, error) {
+	ids := make(map[int]int)
+	for _, c := range comments {
+		postID, userID := postIDs[c.PostID], userIDs[c.UserID]
+
+		var id int
+		err := tx.QueryRow(`
+			SELECT id FROM comments
+			WHERE post_id = $1 AND user_id = $2 AND created_at = $3 AND content = $4
+			ORDER BY id LIMIT 1`,
+			postID, userID, c.CreatedAt, c.Content,
+		).Scan(&id)
+		if err == nil {
+			ids[c.ID] = id
+			report.Skipped["comments"]++
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		err = tx.QueryRow(`
+			INSERT INTO comments (post_id, user_id, content, created_at)
+			VALUES ($1, $2, $3, $4) RETURNING id`,
+			postID, userID, c.Content, c.CreatedAt,
+		).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("комментарий %d: %v", c.ID, err)
+		}
+		ids[c.ID] = id
+		report.Created["comments"]++
+	}
+	return ids, nil
+}
+
+func importCommentReactions(tx *sql.Tx, reactions []commentReactionRecord, commentIDs, userIDs map[int]int, report *Report) error {
+	for _, r := range reactions {
+		res, err := tx.Exec(`
+			INSERT INTO comment_reactions (comment_id, user_id, reaction, created_at)
+			VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`,
+			commentIDs[r.CommentID], userIDs[r.UserID], r.Reaction, r.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("реакция на комментарий %d: %v", r.CommentID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			report.Skipped["comment_reactions"]++
+			continue
+		}
+		if r.Reaction == models.ReactionLike {
+			if _, err := tx.Exec("UPDATE comments SET likes = likes + 1 WHERE id = $1", commentIDs[r.CommentID]); err != nil {
+				return err
+			}
+		}
+		report.Created["comment_reactions"]++
+	}
+	return nil
+}
+
+// importCollections - подборка пользователя с тем же названием переиспользуется;
+// подборки других пользователей не затрагиваются
+func importCollections(tx *sql.Tx, collections []collectionRecord, userIDs map[int]int, report *Report) (map[int]int, error) {
+	ids := make(map[int]int)
+	for _, c := range collections {
+		userID := userIDs[c.UserID]
+		var id int
+		err := tx.QueryRow(
+			"SELECT id FROM bookmark_collections WHERE user_id = $1 AND name = $2", userID, c.Name,
+		).Scan(&id)
+		if err == nil {
+			ids[c.ID] = id
+			report.Skipped["collections"]++
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		err = tx.QueryRow(
+			"INSERT INTO bookmark_collections (user_id, name, created_at) VALUES ($1, $2, $3) RETURNING id",
+			userID, c.Name, c.CreatedAt,
+		).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("подборка %d: %v", c.ID, err)
+		}
+		ids[c.ID] = id
+		report.Created["collections"]++
+	}
+	return ids, nil
+}
+
+// importBookmarks - существующая закладка остаётся в своей подборке
+func importBookmarks(tx *sql.Tx, bookmarks []bookmarkRecord, userIDs, postIDs, collectionIDs map[int]int, report *Report) error {
+	for _, b := range bookmarks {
+		res, err := tx.Exec(`
+			INSERT INTO bookmarks (user_id, post_id, collection_id, created_at)
+			VALUES ($1, $2, NULLIF($3, 0), $4) ON CONFLICT (user_id, post_id) DO NOTHING`,
+			userIDs[b.UserID], postIDs[b.PostID], collectionIDs[b.CollectionID], b.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("закладка %d/%d: %v", b.UserID, b.PostID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			report.Skipped["bookmarks"]++
+			continue
+		}
+		report.Created["bookmarks"]++
+	}
+	return nil
+}
+
+func importHeroes(tx *sql.Tx, heroes []heroRecord, report *Report) error {
+	for _, h := range heroes {
+		var description, imageURL string
+		err := tx.QueryRow(`
+			SELECT COALESCE(description, ''), COALESCE(image_url, '') FROM heroes
+			WHERE name = $1 AND birth_date = $2 LIMIT 1`,
+			h.Name, h.BirthDate,
+		).Scan(&description, &imageURL)
+		if err == nil {
+			report.Skipped["heroes"]++
+			if description != h.Description || imageURL != h.ImageURL {
+				report.conflict("heroes", h.Name, "герой уже существует с другим описанием, оставлен без изменений")
+			}
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO heroes (name, description, birth_date, image_url, created_at)
+			VALUES ($1, $2, $3, $4, $5)`,
+			h.Name, h.Description, h.BirthDate, h.ImageURL, h.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("герой %s: %v", h.Name, err)
+		}
+		report.Created["heroes"]++
+	}
+	return nil
+}
+
+// stagingMaxAge - каталоги распаковки старше этого остались от прерванного
+// импорта и удаляются при следующем
+const stagingMaxAge = 24 * time.Hour
+
+// stagedUploads - файлы, распакованные во временный каталог StagingDir.
+// На место они переносятся только после фиксации транзакции, иначе удаляются.
+type stagedUploads struct {
+	dir   string
+	paths []string
+}
+
+// publish - перенести распакованные файлы на место; файл, появившийся
+// за время импорта, не перезаписывается
+func (s *stagedUploads) publish(uploadsDir string) error {
+	for _, path := range s.paths {
+		target := filepath.Join(uploadsDir, filepath.FromSlash(path))
+		if _, err := os.Lstat(target); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(s.dir, filepath.FromSlash(path)), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanup - удалить временный каталог вместе с тем, что не перенесено
+func (s *stagedUploads) cleanup() {
+	os.RemoveAll(s.dir)
+}
+
+// importUploads - распаковка файлов во временный каталог; существующий файл
+// с другим содержимым не перезаписывается
+func importUploads(uploads []uploadRecord, files map[string][]byte, opts ImportOptions, report *Report) (*stagedUploads, error) {
+	if opts.UploadsDir == "" {
+		report.Skipped["uploads"] += len(uploads)
+		return nil, nil
+	}
+
+	var staged *stagedUploads
+	for _, u := range uploads {
+		data := files["uploads/"+u.Path]
+		target := filepath.Join(opts.UploadsDir, filepath.FromSlash(u.Path))
+
+		existing, err := os.ReadFile(target)
+		if err == nil {
+			report.Skipped["uploads"]++
+			if !bytes.Equal(existing, data) {
+				report.conflict("uploads", u.Path, "файл уже существует с другим содержимым, оставлен без изменений")
+			}
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return staged, err
+		}
+
+		report.Created["uploads"]++
+		if opts.DryRun {
+			continue
+		}
+		if staged == nil {
+			dir, err := newStagingDir(opts.StagingDir)
+			if err != nil {
+				return nil, err
+			}
+			staged = &stagedUploads{dir: dir}
+		}
+		tmp := filepath.Join(staged.dir, filepath.FromSlash(u.Path))
+		if err := os.MkdirAll(filepath.Dir(tmp), 0755); err != nil {
+			return staged, err
+		}
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			return staged, err
+		}
+		staged.paths = append(staged.paths, u.Path)
+	}
+	return staged, nil
+}
+
+// newStagingDir - временный каталог для распаковки; заодно удаляет
+// оставшиеся от импортов, прерванных до cleanup
+func newStagingDir(stagingDir string) (string, error) {
+	if stagingDir == "" {
+		stagingDir = DefaultStagingDir
+	}
+	if err := os.MkdirAll(stagingDir, 0700); err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir(stagingDir)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), "import-") {
+			continue
+		}
+		if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > stagingMaxAge {
+			os.RemoveAll(filepath.Join(stagingDir, e.Name()))
+		}
+	}
+
+	return os.MkdirTemp(stagingDir, "import-")
+}
@@ -0,0 +1,77 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestReport - пустой отчёт, как в Import
+func newTestReport() *Report {
+	return &Report{Created: make(map[string]int), Skipped: make(map[string]int), Conflicts: []Conflict{}}
+}
+
+// TestImportUploadsStaging - до фиксации файлы лежат вне UploadsDir,
+// после publish переносятся на место
+func TestImportUploadsStaging(t *testing.T) {
+	root := t.TempDir()
+	opts := ImportOptions{
+		UploadsDir: filepath.Join(root, "static", "uploads"),
+		StagingDir: filepath.Join(root, "import-tmp"),
+	}
+	uploads := []uploadRecord{{Path: "avatars/a.png"}}
+	files := map[string][]byte{"uploads/avatars/a.png": []byte("png")}
+
+	staged, err := importUploads(uploads, files, opts, newTestReport())
+	if err != nil {
+		t.Fatalf("importUploads: %v", err)
+	}
+	defer staged.cleanup()
+
+	if filepath.Dir(staged.dir) != opts.StagingDir {
+		t.Fatalf("каталог распаковки %s, ожидался внутри %s", staged.dir, opts.StagingDir)
+	}
+	if _, err := os.Stat(opts.UploadsDir); !os.IsNotExist(err) {
+		t.Fatalf("до фиксации UploadsDir не должен появляться: %v", err)
+	}
+
+	if err := staged.publish(opts.UploadsDir); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(opts.UploadsDir, "avatars", "a.png"))
+	if err != nil || string(data) != "png" {
+		t.Fatalf("файл после publish: %q, %v", data, err)
+	}
+}
+
+// TestNewStagingDirSweepsStale - каталоги прерванных импортов удаляются,
+// свежие (идущий импорт) остаются
+func TestNewStagingDirSweepsStale(t *testing.T) {
+	stagingDir := t.TempDir()
+	stale := filepath.Join(stagingDir, "import-stale")
+	fresh := filepath.Join(stagingDir, "import-fresh")
+	for _, dir := range []string{stale, fresh} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * stagingMaxAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := newStagingDir(stagingDir)
+	if err != nil {
+		t.Fatalf("newStagingDir: %v", err)
+	}
+	if filepath.Dir(dir) != stagingDir {
+		t.Fatalf("каталог %s вне %s", dir, stagingDir)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("устаревший каталог не удалён: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Fatalf("свежий каталог удалён: %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// === ВЫГРУЗКА ЛИЧНЫХ ДАННЫХ ===
+
+// KindPersonal - архив данных одного пользователя (Import его не принимает)
+const KindPersonal = "personal"
+
+type profileRecord struct {
+	Username         string     `json:"username"`
+	DisplayName      string     `json:"display_name"`
+	Role             string     `json:"role"`
+	Email            string     `json:"email,omitempty"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at,omitempty"`
+	Bio              string     `json:"bio,omitempty"`
+	AvatarURL        string     `json:"avatar_url,omitempty"`
+	Locale           string     `json:"locale,omitempty"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+type loginEventRecord struct {
+	Result    string    `json:"result"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type identityRecord struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type relationRecord struct {
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type membershipRecord struct {
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type messageRecord struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversation_id"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ownCollectionRecord, ownBookmarkRecord - подборки и закладки владельца архива, без user_id
+type ownCollectionRecord struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ownBookmarkRecord struct {
+	PostID       int       `json:"post_id"`
+	CollectionID int       `json:"collection_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type apiTokenRecord struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// personalEntities - данные пользователя $1: профиль, его посты, комментарии,
+// реакции, закладки, участие в сообществах, отправленные сообщения, история
+// входов, привязанные провайдеры, заблокированные и скрытые пользователи и
+// токены API (без секретов)
+func personalEntities() []entity {
+	return []entity{
+		{"profile", `SELECT username, display_name, role, COALESCE(email, ''), email_verified_at,
+		                    COALESCE(bio, ''), COALESCE(avatar_url, ''), COALESCE(locale, ''),
+		                    totp_enabled_at IS NOT NULL, created_at
+		             FROM users WHERE id = $1`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var p profileRecord
+				err := rows.Scan(&p.Username, &p.DisplayName, &p.Role, &p.Email, &p.EmailVerifiedAt,
+					&p.Bio, &p.AvatarURL, &p.Locale, &p.TwoFactorEnabled, &p.CreatedAt)
+				return p, err
+			}},
+		{"posts", `SELECT id, user_id, COALESCE(community_id, 0), kind, COALESCE(original_id, 0), content, slogan, created_at
+		           FROM posts WHERE user_id = $1 ORDER BY id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var p postRecord
+				err := rows.Scan(&p.ID, &p.UserID, &p.CommunityID, &p.Kind, &p.OriginalID, &p.Content, &p.Slogan, &p.CreatedAt)
+				return p, err
+			}},
+		{"comments", `SELECT id, post_id, user_id, content, created_at FROM comments WHERE user_id = $1 ORDER BY id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var c commentRecord
+				err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt)
+				return c, err
+			}},
+		{"reactions", `SELECT post_id, user_id, reaction, created_at FROM post_reactions
+		               WHERE user_id = $1 ORDER BY created_at`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var r reactionRecord
+				err := rows.Scan(&r.PostID, &r.UserID, &r.Reaction, &r.CreatedAt)
+				return r, err
+			}},
+		{"comment_reactions", `SELECT comment_id, user_id, reaction, created_at FROM comment_reactions
+		                       WHERE user_id = $1 ORDER BY created_at`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var r commentReactionRecord
+				err := rows.Scan(&r.CommentID, &r.UserID, &r.Reaction, &r.CreatedAt)
+				return r, err
+			}},
+		{"bookmark_collections", `SELECT id, name, created_at FROM bookmark_collections WHERE user_id = $1 ORDER BY id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var c ownCollectionRecord
+				err := rows.Scan(&c.ID, &c.Name, &c.CreatedAt)
+				return c, err
+			}},
+		{"bookmarks", `SELECT post_id, COALESCE(collection_id, 0), created_at FROM bookmarks
+		               WHERE user_id = $1 ORDER BY created_at`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var b ownBookmarkRecord
+				err := rows.Scan(&b.PostID, &b.CollectionID, &b.CreatedAt)
+				return b, err
+			}},
+		{"communities", `SELECT c.slug, c.name, m.role, m.status, m.created_at
+		                 FROM community_members m JOIN communities c ON c.id = m.community_id
+		                 WHERE m.user_id = $1 ORDER BY m.created_at`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var m membershipRecord
+				err := rows.Scan(&m.Slug, &m.Name, &m.Role, &m.Status, &m.CreatedAt)
+				return m, err
+			}},
+		{"messages", `SELECT id, conversation_id, content, created_at FROM messages WHERE user_id = $1 ORDER BY id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var m messageRecord
+				err := rows.Scan(&m.ID, &m.ConversationID, &m.Content, &m.CreatedAt)
+				return m, err
+			}},
+		{"login_events", `SELECT result, ip, user_agent, created_at FROM login_events WHERE user_id = $1 ORDER BY id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var e loginEventRecord
+				err := rows.Scan(&e.Result, &e.IP, &e.UserAgent, &e.CreatedAt)
+				return e, err
+			}},
+		{"identities", `SELECT provider, COALESCE(email, ''), created_at FROM user_identities WHERE user_id = $1 ORDER BY id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var i identityRecord
+				err := rows.Scan(&i.Provider, &i.Email, &i.CreatedAt)
+				return i, err
+			}},
+		{"blocks", `SELECT u.username, b.created_at FROM user_blocks b JOIN users u ON u.id = b.blocked_id
+		            WHERE b.blocker_id = $1 ORDER BY b.created_at`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var r relationRecord
+				err := rows.Scan(&r.Username, &r.CreatedAt)
+				return r, err
+			}},
+		{"mutes", `SELECT u.username, m.created_at FROM user_mutes m JOIN users u ON u.id = m.muted_id
+		           WHERE m.user_id = $1 ORDER BY m.created_at`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var r relationRecord
+				err := rows.Scan(&r.Username, &r.CreatedAt)
+				return r, err
+			}},
+		{"api_tokens", `SELECT name, scopes, expires_at, created_at FROM api_tokens WHERE user_id = $1 ORDER BY id`,
+			func(rows *sql.Rows) (interface{}, error) {
+				var t apiTokenRecord
+				var scopes string
+				err := rows.Scan(&t.Name, &scopes, &t.ExpiresAt, &t.CreatedAt)
+				t.Scopes = strings.Fields(scopes)
+				return t, err
+			}},
+	}
+}
+
+// ExportUser - личные данные пользователя в tar.gz: JSON Lines на каждую
+// сущность и manifest.json (kind = personal). Хэши паролей и секреты не выгружаются.
+func ExportUser(db *sql.DB, w io.Writer, userID int) (*Manifest, error) {
+	manifest := &Manifest{
+		FormatVersion: FormatVersion,
+		Application:   "unitycn",
+		Kind:          KindPersonal,
+		CreatedAt:     time.Now().UTC(),
+		Counts:        make(map[string]int),
+		Checksums:     make(map[string]string),
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY"); err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, e := range personalEntities() {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+
+		rows, err := tx.Query(e.query, userID)
+		if err != nil {
+			return nil, fmt.Errorf("выгрузка %s: %v", e.name, err)
+		}
+		for rows.Next() {
+			record, err := e.scan(rows)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("выгрузка %s: %v", e.name, err)
+			}
+			if err := enc.Encode(record); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			manifest.Counts[e.name]++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("выгрузка %s: %v", e.name, err)
+		}
+
+		if err := writeFile(tw, manifest, e.name+".jsonl", buf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if manifest.Counts["profile"] == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:    "manifest.json",
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: manifest.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gz.Close()
+}
@@ -1,52 +1,179 @@
 package auth
 
 import (
-	"time"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var secretKey []byte
+// === ХЭШИ ПАРОЛЕЙ ===
 
-func Init(key string) {
-	secretKey = []byte(key)
+// Алгоритмы хэширования паролей
+const (
+	AlgArgon2id = "argon2id"
+	AlgBcrypt   = "bcrypt"
+)
+
+// Hasher - алгоритм хэширования паролей. Хэш несёт свои параметры,
+// поэтому проверяются и хэши, созданные со старыми настройками.
+type Hasher interface {
+	// Name - название алгоритма (argon2id, bcrypt)
+	Name() string
+	// Hash - хэш с текущими параметрами
+	Hash(password string) (string, error)
+	// Identify - хэш создан этим алгоритмом
+	Identify(hash string) bool
+	// Verify - пароль совпадает с хэшем этого алгоритма
+	Verify(password, hash string) bool
+	// Outdated - хэш этого алгоритма слабее текущих параметров
+	Outdated(hash string) bool
+}
+
+// === BCRYPT ===
+
+const defaultBcryptCost = 12
+
+// bcryptMaxBytes - bcrypt не хэширует пароли длиннее (ErrPasswordTooLong);
+// проверяются такие пароли только по первым 72 байтам
+const bcryptMaxBytes = 72
+
+// BcryptHasher - bcrypt; пароль не длиннее bcryptMaxBytes байт
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Name() string { return AlgBcrypt }
+
+func (h BcryptHasher) cost() int {
+	if h.Cost == 0 {
+		return defaultBcryptCost
+	}
+	return h.Cost
 }
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+func (h BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.cost())
 	return string(bytes), err
 }
 
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+func (h BcryptHasher) Identify(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
 }
 
-func GenerateToken(userID int, username, role string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"user_id":  userID,
-			"username": username,
-			"role":     role,
-			"exp":      time.Now().Add(time.Hour * 24).Unix(),
-		})
+func (h BcryptHasher) Verify(password, hash string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+func (h BcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < h.cost()
+}
+
+// === ARGON2ID ===
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
 
-	return token.SignedString(secretKey)
+// Argon2Params - параметры argon2id (RFC 9106)
+type Argon2Params struct {
+	// Time - число проходов
+	Time uint32 `yaml:"time"`
+	// MemoryKiB - память в КиБ
+	MemoryKiB uint32 `yaml:"memory_kib"`
+	// Threads - параллельность
+	Threads uint8 `yaml:"threads"`
 }
 
-func VerifyToken(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
+func (p Argon2Params) withDefaults() Argon2Params {
+	if p.Time == 0 {
+		p.Time = 2
+	}
+	if p.MemoryKiB == 0 {
+		p.MemoryKiB = 64 * 1024
+	}
+	if p.Threads == 0 {
+		p.Threads = 2
+	}
+	return p
+}
 
+// Argon2idHasher - argon2id в формате PHC: $argon2id$v=19$m=65536,t=2,p=2$соль$хэш
+type Argon2idHasher struct {
+	Params Argon2Params
+}
+
+func (h Argon2idHasher) Name() string { return AlgArgon2id }
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	p := h.Params.withDefaults()
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.MemoryKiB, p.Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		p.MemoryKiB, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) Identify(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+// parseArgon2 - параметры, соль и ключ из строки PHC
+func parseArgon2(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgArgon2id {
+		return p, nil, nil, fmt.Errorf("неверный формат argon2id")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("неподдерживаемая версия argon2id")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.MemoryKiB, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, fmt.Errorf("неверные параметры argon2id: %w", err)
+	}
+	if p.Time == 0 || p.MemoryKiB == 0 || p.Threads == 0 {
+		return p, nil, nil, fmt.Errorf("неверные параметры argon2id")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
 	if err != nil {
-		return nil, err
+		return p, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, fmt.Errorf("неверный ключ argon2id")
 	}
+	return p, salt, key, nil
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
+func (h Argon2idHasher) Verify(password, hash string) bool {
+	p, salt, key, err := parseArgon2(hash)
+	if err != nil {
+		return false
 	}
+	actual := argon2.IDKey([]byte(password), salt, p.Time, p.MemoryKiB, p.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(actual, key) == 1
+}
 
-	return nil, jwt.ErrSignatureInvalid
+func (h Argon2idHasher) Outdated(hash string) bool {
+	current := h.Params.withDefaults()
+	p, salt, key, err := parseArgon2(hash)
+	if err != nil {
+		return true
+	}
+	return p.Time < current.Time || p.MemoryKiB < current.MemoryKiB || p.Threads < current.Threads ||
+		len(salt) < argon2SaltLen || len(key) < argon2KeyLen
 }
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// bloomFilter - множество строк с ложноположительными ответами (но без
+// ложноотрицательных): список утёкших паролей занимает биты, а не строки
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// newBloomFilter - фильтр на n строк с вероятностью ложного срабатывания p
+func newBloomFilter(n int, p float64) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// hashes - две независимые хэш-функции; остальные получаются их комбинацией
+func (f *bloomFilter) hashes(s string) (uint64, uint64) {
+	h1 := fnv.New64a()
+	h1.Write([]byte(s))
+	h2 := fnv.New64()
+	h2.Write([]byte(s))
+	return h1.Sum64(), h2.Sum64() | 1
+}
+
+func (f *bloomFilter) add(s string) {
+	a, b := f.hashes(s)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (a + i*b) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *bloomFilter) has(s string) bool {
+	a, b := f.hashes(s)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (a + i*b) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
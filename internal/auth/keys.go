@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// === КЛЮЧИ ПОДПИСИ ===
+
+// Алгоритмы подписи токенов
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+const (
+	rsaKeyBits    = 3072
+	minRSAKeyBits = 2048
+
+	privateKeySuffix = ".pem"
+	publicKeySuffix  = ".pub.pem"
+)
+
+// ErrUnknownKey - ключа с таким kid нет
+var ErrUnknownKey = errors.New("неизвестный ключ подписи")
+
+// Key - ключ подписи. Ключ без закрытой части (выведенный из оборота)
+// только проверяет выданные им токены, пока они не истекут.
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+}
+
+// CanSign - есть ли закрытая часть
+func (k *Key) CanSign() bool {
+	return k.Private != nil
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	if k.Algorithm == AlgRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// algorithmOf - алгоритм по типу открытого ключа
+func algorithmOf(pub crypto.PublicKey) (string, error) {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return AlgEdDSA, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return "", fmt.Errorf("RSA ключ короче %d бит", minRSAKeyBits)
+		}
+		return AlgRS256, nil
+	}
+	return "", fmt.Errorf("неподдерживаемый тип ключа %T", pub)
+}
+
+// LoadKeys - ключи из каталога: <kid>.pem (PKCS#8, закрытый) и <kid>.pub.pem
+// (PKIX, только проверка). Отсортированы по kid, новые - в конце.
+func LoadKeys(dir string) ([]*Key, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[string]*Key{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, privateKeySuffix) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+
+		key, err := readKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		// Закрытая часть важнее открытой, если есть обе
+		if existing, ok := byID[key.ID]; ok && existing.CanSign() {
+			continue
+		}
+		byID[key.ID] = key
+	}
+
+	keys := make([]*Key, 0, len(byID))
+	for _, key := range byID {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func readKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("нет PEM блока")
+	}
+
+	name := filepath.Base(path)
+	key := &Key{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key.ID = strings.TrimSuffix(name, privateKeySuffix)
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("неподдерживаемый тип ключа %T", parsed)
+		}
+		key.Private = signer
+		key.Public = signer.Public()
+	case "PUBLIC KEY":
+		key.ID = strings.TrimSuffix(name, publicKeySuffix)
+		key.Public, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("неизвестный PEM блок %q", block.Type)
+	}
+
+	key.Algorithm, err = algorithmOf(key.Public)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// GenerateKey - новый ключ в каталоге. kid начинается с времени создания,
+// поэтому более новый ключ идёт позже при сортировке.
+func GenerateKey(dir, algorithm string) (*Key, error) {
+	var signer crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		return nil, fmt.Errorf("неизвестный алгоритм %q (EdDSA или RS256)", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	key := &Key{
+		ID:        time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(suffix),
+		Algorithm: algorithm,
+		Private:   signer,
+		Public:    signer.Public(),
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	path := filepath.Join(dir, key.ID+privateKeySuffix)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// RetireKey - вывод ключа из оборота: закрытая часть удаляется, открытая
+// остаётся, чтобы выданные токены действовали до своего срока
+func RetireKey(dir, kid string) error {
+	privatePath := filepath.Join(dir, kid+privateKeySuffix)
+	key, err := readKey(privatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public)
+	if err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+publicKeySuffix), data, 0o644); err != nil {
+		return err
+	}
+	return os.Remove(privatePath)
+}
+
+// === JWKS ===
+
+// JWK - открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS - набор открытых ключей для проверки токенов другими сервисами
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *Key) jwk() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+	switch pub := k.Public.(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	}
+	return jwk
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// === ПАРОЛИ: ПОЛИТИКА И ХЭШИРОВАНИЕ ===
+
+const (
+	defaultMinPasswordLength     = 8
+	defaultMaxPasswordLength     = 128
+	defaultBreachedFalsePositive = 0.001
+)
+
+// Причины отказа в пароле
+var (
+	ErrPasswordTooShort       = errors.New("пароль слишком короткий")
+	ErrPasswordTooLong        = errors.New("пароль слишком длинный")
+	ErrPasswordBreached       = errors.New("пароль есть в списке утёкших")
+	ErrPasswordSameAsUsername = errors.New("пароль совпадает с логином")
+)
+
+// commonPasswords - самые частые пароли, проверяются всегда
+//
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// PasswordConfig - раздел auth.password в config.yaml
+type PasswordConfig struct {
+	// Algorithm - хэш новых паролей: argon2id (по умолчанию) или bcrypt
+	Algorithm string `yaml:"algorithm"`
+	// BcryptCost - стоимость bcrypt
+	BcryptCost int `yaml:"bcrypt_cost"`
+	// Argon2 - параметры argon2id
+	Argon2 Argon2Params `yaml:"argon2"`
+	// MinLength, MaxLength - длина пароля в символах
+	MinLength int `yaml:"min_length"`
+	MaxLength int `yaml:"max_length"`
+	// BreachedList - файл утёкших паролей, по одному в строке
+	BreachedList string `yaml:"breached_list"`
+	// BreachedFalsePositive - доля хороших паролей, ошибочно признанных утёкшими
+	BreachedFalsePositive float64 `yaml:"breached_false_positive"`
+}
+
+// Passwords - проверка паролей по политике, хэширование текущим алгоритмом
+// и проверка хэшей любого из поддерживаемых алгоритмов
+type Passwords struct {
+	config   PasswordConfig
+	hasher   Hasher
+	hashers  []Hasher
+	breached *bloomFilter
+
+	dummyHashOnce sync.Once
+	dummyHash     string
+}
+
+// DefaultPasswords - политика и алгоритм по умолчанию, без внешнего списка
+func DefaultPasswords() *Passwords {
+	p, _ := NewPasswords(PasswordConfig{})
+	return p
+}
+
+// NewPasswords - политика из конфига; список утёкших паролей читается в фильтр Блума
+func NewPasswords(config PasswordConfig) (*Passwords, error) {
+	if config.MinLength == 0 {
+		config.MinLength = defaultMinPasswordLength
+	}
+	if config.MaxLength == 0 {
+		config.MaxLength = defaultMaxPasswordLength
+	}
+	if config.MinLength > config.MaxLength {
+		return nil, fmt.Errorf("min_length больше max_length")
+	}
+	if config.BreachedFalsePositive <= 0 || config.BreachedFalsePositive >= 1 {
+		config.BreachedFalsePositive = defaultBreachedFalsePositive
+	}
+
+	bcryptHasher := BcryptHasher{Cost: config.BcryptCost}
+	argonHasher := Argon2idHasher{Params: config.Argon2}
+	p := &Passwords{config: config}
+	switch config.Algorithm {
+	case "", AlgArgon2id:
+		p.hasher = argonHasher
+	case AlgBcrypt:
+		p.hasher = bcryptHasher
+	default:
+		return nil, fmt.Errorf("неизвестный алгоритм паролей %q (argon2id или bcrypt)", config.Algorithm)
+	}
+	p.hashers = []Hasher{argonHasher, bcryptHasher}
+
+	list := strings.Split(commonPasswords, "\n")
+	if config.BreachedList != "" {
+		extra, err := readLines(config.BreachedList)
+		if err != nil {
+			return nil, fmt.Errorf("breached_list: %w", err)
+		}
+		list = append(list, extra...)
+	}
+	p.breached = newBloomFilter(len(list), config.BreachedFalsePositive)
+	for _, line := range list {
+		if line = strings.TrimSpace(line); line != "" {
+			p.breached.add(strings.ToLower(line))
+		}
+	}
+
+	return p, nil
+}
+
+// readLines - строки файла
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// Algorithm - алгоритм новых хэшей
+func (p *Passwords) Algorithm() string {
+	return p.hasher.Name()
+}
+
+// MinLength - минимальная длина пароля
+func (p *Passwords) MinLength() int {
+	return p.config.MinLength
+}
+
+// MaxLength - максимальная длина пароля
+func (p *Passwords) MaxLength() int {
+	return p.config.MaxLength
+}
+
+// MaxBytes - предел длины пароля в байтах у алгоритма хэширования; 0 - нет
+func (p *Passwords) MaxBytes() int {
+	if p.hasher.Name() == AlgBcrypt {
+		return bcryptMaxBytes
+	}
+	return 0
+}
+
+// Validate - пароль по политике: длина, список утёкших, совпадение с логином
+func (p *Passwords) Validate(password, username string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.config.MinLength {
+		return ErrPasswordTooShort
+	}
+	// Кириллица - 2 байта на символ: для bcrypt предел в байтах наступает раньше
+	if length > p.config.MaxLength || (p.MaxBytes() > 0 && len(password) > p.MaxBytes()) {
+		return ErrPasswordTooLong
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		return ErrPasswordSameAsUsername
+	}
+	if p.breached.has(strings.ToLower(password)) {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+// Hash - хэш текущим алгоритмом
+func (p *Passwords) Hash(password string) (string, error) {
+	return p.hasher.Hash(password)
+}
+
+// Verify - проверка пароля. rehash - хэш создан другим алгоритмом или
+// с более слабыми параметрами: после успешного входа его стоит заменить.
+func (p *Passwords) Verify(password, hash string) (ok, rehash bool) {
+	for _, h := range p.hashers {
+		if !h.Identify(hash) {
+			continue
+		}
+		if !h.Verify(password, hash) {
+			return false, false
+		}
+		return true, h.Name() != p.hasher.Name() || h.Outdated(hash)
+	}
+	return false, false
+}
+
+// CheckDummy - та же работа, что и проверка настоящего хэша. Вызывается
+// для несуществующих логинов, чтобы время ответа не выдавало,
+// зарегистрирован ли пользователь.
+func (p *Passwords) CheckDummy(password string) {
+	p.dummyHashOnce.Do(func() {
+		p.dummyHash, _ = p.hasher.Hash("unitycn-dummy-password")
+	})
+	p.Verify(password, p.dummyHash)
+}
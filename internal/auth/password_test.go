@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestValidateBcryptMaxBytes - с bcrypt пароль длиннее 72 байт отклоняется
+// при проверке политики, а не ошибкой хэширования
+func TestValidateBcryptMaxBytes(t *testing.T) {
+	// 40 символов кириллицы - 80 байт, в пределах max_length
+	long := strings.Repeat("щ", 40)
+
+	bcrypt, err := NewPasswords(PasswordConfig{Algorithm: AlgBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatalf("NewPasswords: %v", err)
+	}
+	if err := bcrypt.Validate(long, "user"); !errors.Is(err, ErrPasswordTooLong) {
+		t.Fatalf("bcrypt: %v, ожидалось ErrPasswordTooLong", err)
+	}
+	fits := strings.Repeat("щ", 36)
+	if err := bcrypt.Validate(fits, "user"); err != nil {
+		t.Fatalf("bcrypt, 72 байта: %v", err)
+	}
+	if _, err := bcrypt.Hash(fits); err != nil {
+		t.Fatalf("хэш 72 байт: %v", err)
+	}
+
+	argon := DefaultPasswords()
+	if argon.MaxBytes() != 0 {
+		t.Fatalf("argon2id: MaxBytes = %d", argon.MaxBytes())
+	}
+	if err := argon.Validate(long, "user"); err != nil {
+		t.Fatalf("argon2id: %v", err)
+	}
+}
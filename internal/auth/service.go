@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// === СЕРВИС ТОКЕНОВ ===
+
+const (
+	defaultIssuer     = "unitycn"
+	defaultSessionTTL = 24 * time.Hour
+	defaultKeysDir    = "./keys"
+
+	// tokenTypeMFA - частичный токен между паролем и вторым фактором
+	tokenTypeMFA = "mfa"
+)
+
+// MFATokenTTL - сколько действует частичный токен второго шага входа
+const MFATokenTTL = 5 * time.Minute
+
+// Config - раздел auth в config.yaml, относящийся к токенам
+type Config struct {
+	// Issuer - iss выдаваемых токенов
+	Issuer string `yaml:"issuer"`
+	// Audience - aud выдаваемых токенов; по умолчанию совпадает с issuer
+	Audience string `yaml:"audience"`
+	// KeysDir - каталог ключей подписи (server keys generate|retire)
+	KeysDir string `yaml:"keys_dir"`
+	// SigningKey - kid ключа подписи; пусто - самый новый ключ с закрытой частью
+	SigningKey string `yaml:"signing_key"`
+	// SessionTTL - срок токена сессии
+	SessionTTL time.Duration `yaml:"session_ttl"`
+}
+
+func (c *Config) defaults() {
+	if c.Issuer == "" {
+		c.Issuer = defaultIssuer
+	}
+	if c.Audience == "" {
+		c.Audience = c.Issuer
+	}
+	if c.KeysDir == "" {
+		c.KeysDir = defaultKeysDir
+	}
+	if c.SessionTTL == 0 {
+		c.SessionTTL = defaultSessionTTL
+	}
+}
+
+// Service - выдача и проверка токенов. Подписывает один ключ, проверяют все
+// ключи каталога: так ключи меняются без разлогинивания пользователей.
+type Service struct {
+	config  Config
+	signer  *Key
+	keys    map[string]*Key
+	methods []string
+}
+
+// NewService - сервис с ключами из config.KeysDir. Если ключей нет,
+// создаётся ключ EdDSA (created = true), чтобы сервер запускался без подготовки.
+func NewService(config Config) (service *Service, created *Key, err error) {
+	config.defaults()
+
+	keys, err := LoadKeys(config.KeysDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(keys) == 0 {
+		created, err = GenerateKey(config.KeysDir, AlgEdDSA)
+		if err != nil {
+			return nil, nil, fmt.Errorf("создание ключа подписи: %w", err)
+		}
+		keys = []*Key{created}
+	}
+
+	service, err = NewServiceWithKeys(config, keys)
+	return service, created, err
+}
+
+// NewServiceWithKeys - сервис с готовым набором ключей
+func NewServiceWithKeys(config Config, keys []*Key) (*Service, error) {
+	config.defaults()
+
+	s := &Service{config: config, keys: map[string]*Key{}}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		s.keys[key.ID] = key
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			s.methods = append(s.methods, key.Algorithm)
+		}
+		if config.SigningKey == "" && key.CanSign() {
+			s.signer = key // ключи отсортированы: последний - самый новый
+		}
+	}
+
+	if config.SigningKey != "" {
+		key, ok := s.keys[config.SigningKey]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownKey, config.SigningKey)
+		}
+		s.signer = key
+	}
+	if s.signer == nil || !s.signer.CanSign() {
+		return nil, fmt.Errorf("нет закрытого ключа для подписи токенов")
+	}
+	return s, nil
+}
+
+// SigningKey - ключ, которым подписываются новые токены
+func (s *Service) SigningKey() *Key {
+	return s.signer
+}
+
+// SessionTTL - срок токена сессии (и куки с ним)
+func (s *Service) SessionTTL() time.Duration {
+	return s.config.SessionTTL
+}
+
+// JWKS - открытые ключи всех действующих ключей
+func (s *Service) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range s.keys {
+		set.Keys = append(set.Keys, key.jwk())
+	}
+	return set
+}
+
+// sign - подпись claims активным ключом с kid, iss, aud и сроком.
+// jti задаётся, если вызывающий не передал свой (ссылки из писем хранят его в БД).
+func (s *Service) sign(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	if _, ok := claims["jti"]; !ok {
+		jti := make([]byte, 12)
+		if _, err := rand.Read(jti); err != nil {
+			return "", err
+		}
+		claims["jti"] = hex.EncodeToString(jti)
+	}
+
+	now := time.Now()
+	claims["iss"] = s.config.Issuer
+	claims["aud"] = s.config.Audience
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+
+	token := jwt.NewWithClaims(s.signer.method(), claims)
+	token.Header["kid"] = s.signer.ID
+	return token.SignedString(s.signer.Private)
+}
+
+// parse - подпись ключом из kid с его алгоритмом, iss, aud и срок
+func (s *Service) parse(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims,
+		func(t *jwt.Token) (interface{}, error) {
+			kid, _ := t.Header["kid"].(string)
+			key, ok := s.keys[kid]
+			if !ok {
+				return nil, ErrUnknownKey
+			}
+			// Алгоритм задаёт ключ, а не заголовок токена
+			if t.Method.Alg() != key.Algorithm {
+				return nil, jwt.ErrTokenSignatureInvalid
+			}
+			return key.Public, nil
+		},
+		jwt.WithValidMethods(s.methods),
+		jwt.WithIssuer(s.config.Issuer),
+		jwt.WithAudience(s.config.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// GenerateToken - токен сессии
+func (s *Service) GenerateToken(userID int, username, role string) (string, error) {
+	return s.sign(jwt.MapClaims{
+		"sub":      strconv.Itoa(userID),
+		"user_id":  userID,
+		"username": username,
+		"role":     role,
+	}, s.config.SessionTTL)
+}
+
+// VerifyToken - проверка токена сессии
+func (s *Service) VerifyToken(tokenString string) (jwt.MapClaims, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	// Служебные токены (2FA, ссылки из писем) не дают доступа
+	if typ, _ := claims["typ"].(string); typ != "" {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+// GenerateMFAToken - частичный токен: пароль проверен, нужен код 2FA.
+// Не принимается как сессия (VerifyToken его отклоняет).
+func (s *Service) GenerateMFAToken(userID int, username string) (string, error) {
+	return s.GenerateTypedToken(tokenTypeMFA, jwt.MapClaims{
+		"user_id":  userID,
+		"username": username,
+	}, MFATokenTTL)
+}
+
+// VerifyMFAToken - проверка частичного токена второго шага входа
+func (s *Service) VerifyMFAToken(tokenString string) (jwt.MapClaims, error) {
+	return s.VerifyTypedToken(tokenString, tokenTypeMFA)
+}
+
+// GenerateTypedToken - подписанные данные для служебных целей (typ),
+// например состояние входа через OIDC. Сессией не являются.
+func (s *Service) GenerateTypedToken(typ string, claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	all := jwt.MapClaims{"typ": typ}
+	for k, v := range claims {
+		all[k] = v
+	}
+	return s.sign(all, ttl)
+}
+
+// VerifyTypedToken - проверка служебного токена нужного типа
+func (s *Service) VerifyTypedToken(tokenString, typ string) (jwt.MapClaims, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if t, _ := claims["typ"].(string); t != typ {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
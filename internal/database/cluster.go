@@ -0,0 +1,141 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultHealthCheckInterval = 10 * time.Second
+
+// Cluster - основная БД и реплики для чтения с проверкой их состояния
+type Cluster struct {
+	primary  *sql.DB
+	replicas []*replica
+	next     atomic.Uint64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type replica struct {
+	name    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// ConnectCluster - подключение к основной БД и репликам.
+// Недоступная реплика не мешает старту: она помечается нездоровой,
+// а чтение уходит на основную БД до её восстановления.
+func ConnectCluster(config DBConfig) (*Cluster, error) {
+	primary, err := Connect(config)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := &Cluster{
+		primary: primary,
+		stop:    make(chan struct{}),
+	}
+
+	for _, rc := range config.Replicas {
+		replicaConfig := config.replicaConfig(rc)
+		db, err := open(replicaConfig)
+		if err != nil {
+			log.Printf("Предупреждение: реплика %s:%d пропущена: %v",
+				replicaConfig.Host, replicaConfig.Port, err)
+			continue
+		}
+
+		rep := &replica{
+			name: fmt.Sprintf("%s:%d", replicaConfig.Host, replicaConfig.Port),
+			db:   db,
+		}
+		rep.check()
+		if !rep.healthy.Load() {
+			log.Printf("Предупреждение: реплика %s пока недоступна", rep.name)
+		}
+		cluster.replicas = append(cluster.replicas, rep)
+	}
+
+	if len(cluster.replicas) > 0 {
+		interval := config.HealthCheckInterval
+		if interval <= 0 {
+			interval = defaultHealthCheckInterval
+		}
+		cluster.wg.Add(1)
+		go cluster.healthLoop(interval)
+		log.Printf("Подключено реплик для чтения: %d", len(cluster.replicas))
+	}
+
+	return cluster, nil
+}
+
+// Primary - основная БД (запись и чтение)
+func (c *Cluster) Primary() *sql.DB {
+	return c.primary
+}
+
+// Reader - здоровая реплика по кругу, либо основная БД
+func (c *Cluster) Reader() *sql.DB {
+	n := len(c.replicas)
+	if n == 0 {
+		return c.primary
+	}
+
+	start := c.next.Add(1)
+	for i := 0; i < n; i++ {
+		rep := c.replicas[(start+uint64(i))%uint64(n)]
+		if rep.healthy.Load() {
+			return rep.db
+		}
+	}
+
+	return c.primary
+}
+
+// Close - остановка проверок и закрытие всех соединений
+func (c *Cluster) Close() error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	c.wg.Wait()
+
+	for _, rep := range c.replicas {
+		rep.db.Close()
+	}
+	return c.primary.Close()
+}
+
+func (c *Cluster) healthLoop(interval time.Duration) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			for _, rep := range c.replicas {
+				rep.check()
+			}
+		}
+	}
+}
+
+func (rep *replica) check() {
+	err := rep.db.Ping()
+	healthy := err == nil
+
+	if rep.healthy.Swap(healthy) != healthy {
+		if healthy {
+			log.Printf("Реплика %s доступна", rep.name)
+		} else {
+			log.Printf("Реплика %s недоступна, чтение переключено на основную БД: %v", rep.name, err)
+		}
+	}
+}
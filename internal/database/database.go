@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"time"
 
 	_ "github.com/lib/pq"
 )
@@ -15,24 +16,120 @@ type DBConfig struct {
 	Password string `yaml:"password"`
 	DBName   string `yaml:"dbname"`
 	SSLMode  string `yaml:"sslmode"`
+
+	// Настройки пула соединений (0 - значение по умолчанию database/sql)
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+
+	// Повторные попытки подключения при старте, пока PostgreSQL не готов
+	ConnectRetries int           `yaml:"connect_retries"`
+	RetryBackoff   time.Duration `yaml:"retry_backoff"`
+
+	// Реплики только для чтения
+	Replicas            []ReplicaConfig `yaml:"replicas"`
+	HealthCheckInterval time.Duration   `yaml:"health_check_interval"`
 }
 
-func Connect(config DBConfig) (*sql.DB, error) {
-	connStr := fmt.Sprintf(
+// ReplicaConfig - реплика для чтения. Пустые поля берутся из основной БД.
+type ReplicaConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	DBName   string `yaml:"dbname"`
+	SSLMode  string `yaml:"sslmode"`
+}
+
+const maxRetryBackoff = 30 * time.Second
+
+// ConnString - строка подключения lib/pq (и для pq.Listener)
+func (config DBConfig) ConnString() string {
+	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		config.Host, config.Port, config.User, config.Password,
 		config.DBName, config.SSLMode,
 	)
+}
 
-	db, err := sql.Open("postgres", connStr)
+// replicaConfig - конфиг реплики с подставленными значениями основной БД
+func (config DBConfig) replicaConfig(replica ReplicaConfig) DBConfig {
+	merged := config
+	merged.Replicas = nil
+	if replica.Host != "" {
+		merged.Host = replica.Host
+	}
+	if replica.Port != 0 {
+		merged.Port = replica.Port
+	}
+	if replica.User != "" {
+		merged.User = replica.User
+	}
+	if replica.Password != "" {
+		merged.Password = replica.Password
+	}
+	if replica.DBName != "" {
+		merged.DBName = replica.DBName
+	}
+	if replica.SSLMode != "" {
+		merged.SSLMode = replica.SSLMode
+	}
+	return merged
+}
+
+func open(config DBConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", config.ConnString())
 	if err != nil {
 		return nil, fmt.Errorf("ошибка подключения к БД: %v", err)
 	}
 
-	// Проверяем подключение
-	err = db.Ping()
+	if config.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(config.MaxOpenConns)
+	}
+	if config.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	if config.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	}
+	if config.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+	}
+
+	return db, nil
+}
+
+func Connect(config DBConfig) (*sql.DB, error) {
+	db, err := open(config)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка ping БД: %v", err)
+		return nil, err
+	}
+
+	// Проверяем подключение, ждём PostgreSQL с экспоненциальной задержкой
+	backoff := config.RetryBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = db.Ping()
+		if err == nil {
+			break
+		}
+		if attempt >= config.ConnectRetries {
+			db.Close()
+			return nil, fmt.Errorf("ошибка ping БД: %v", err)
+		}
+
+		log.Printf("PostgreSQL недоступен (попытка %d/%d): %v, повтор через %s",
+			attempt+1, config.ConnectRetries, err, backoff)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
 	}
 
 	log.Println("Успешное подключение к PostgreSQL")
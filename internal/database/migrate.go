@@ -0,0 +1,247 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// legacySchemaVersion - миграции, которые применялись вручную через psql
+// до появления schema_migrations. В такой БД они отмечаются как применённые.
+const legacySchemaVersion = 4
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+?)(\.down)?\.sql$`)
+
+// Migration - пара файлов NNN_name.sql (up) и NNN_name.down.sql (down)
+type Migration struct {
+	Version  int
+	Name     string
+	UpFile   string
+	DownFile string
+}
+
+// MigrationState - миграция и время её применения (nil - не применена)
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// LoadMigrations - чтение списка миграций из каталога
+func LoadMigrations(dir string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения каталога миграций: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := migrationFileRe.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(m[1])
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if m[3] != "" {
+			migration.DownFile = path
+		} else {
+			migration.UpFile = path
+		}
+	}
+
+	var migrations []Migration
+	for _, migration := range byVersion {
+		if migration.UpFile == "" {
+			return nil, fmt.Errorf("миграция %03d: нет файла up", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// ensureMigrationsTable - создание schema_migrations и отметка ручных миграций
+func ensureMigrationsTable(db *sql.DB, migrations []Migration) error {
+	var exists bool
+	err := db.QueryRow(`SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return fmt.Errorf("ошибка создания schema_migrations: %v", err)
+	}
+
+	// БД, созданная вручную до появления раннера
+	var legacy bool
+	err = db.QueryRow(`SELECT to_regclass('users') IS NOT NULL`).Scan(&legacy)
+	if err != nil || !legacy {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if migration.Version > legacySchemaVersion {
+			break
+		}
+		_, err = db.Exec(
+			"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)",
+			migration.Version, migration.Name,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func appliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatus - состояние всех миграций из каталога
+func MigrationStatus(db *sql.DB, dir string) ([]MigrationState, error) {
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(db, migrations); err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, migration := range migrations {
+		state := MigrationState{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			state.AppliedAt = &appliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// MigrateUp - применение всех новых миграций по порядку
+func MigrateUp(db *sql.DB, dir string) ([]Migration, error) {
+	states, err := MigrationStatus(db, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, state := range states {
+		if state.AppliedAt != nil {
+			continue
+		}
+		err := runMigration(db, state.UpFile, func(tx *sql.Tx) error {
+			_, err := tx.Exec(
+				"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)",
+				state.Version, state.Name,
+			)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("миграция %03d_%s: %v", state.Version, state.Name, err)
+		}
+		done = append(done, state.Migration)
+	}
+	return done, nil
+}
+
+// MigrateDown - откат последних steps применённых миграций
+func MigrateDown(db *sql.DB, dir string, steps int) ([]Migration, error) {
+	states, err := MigrationStatus(db, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(states) - 1; i >= 0 && len(done) < steps; i-- {
+		state := states[i]
+		if state.AppliedAt == nil {
+			continue
+		}
+		if state.DownFile == "" {
+			return done, fmt.Errorf("миграция %03d_%s: нет файла down", state.Version, state.Name)
+		}
+		err := runMigration(db, state.DownFile, func(tx *sql.Tx) error {
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = $1", state.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("откат %03d_%s: %v", state.Version, state.Name, err)
+		}
+		done = append(done, state.Migration)
+	}
+	return done, nil
+}
+
+func runMigration(db *sql.DB, file string, record func(tx *sql.Tx) error) error {
+	script, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(script)) == "" {
+		return fmt.Errorf("пустой файл %s", file)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(string(script)); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
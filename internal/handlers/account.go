@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unitycn/internal/archive"
+	"unitycn/internal/auth"
+	"unitycn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === ВЫГРУЗКА ДАННЫХ И УДАЛЕНИЕ АККАУНТА ===
+
+const (
+	// sessionIssuedAtKey - время выдачи токена сессии (для повторной аутентификации)
+	sessionIssuedAtKey = "session_issued_at"
+	// reauthMaxAge - без пароля (вход только через OIDC) подтверждением считается свежий вход
+	reauthMaxAge = 10 * time.Minute
+
+	defaultDeletionGrace = 14 * 24 * time.Hour
+)
+
+// reauthenticate - подтверждение опасного действия: пароль (или недавний вход,
+// если пароля нет) и код 2FA, если она включена. При отказе - статус и код ошибки.
+func reauthenticate(c *gin.Context, repo *models.Repository, passwords *auth.Passwords, user *models.User, password, code string) (int, string) {
+	if user.Password == models.ExternalPassword {
+		issuedAt, ok := c.Get(sessionIssuedAtKey)
+		if t, _ := issuedAt.(time.Time); !ok || time.Since(t) > reauthMaxAge {
+			return http.StatusUnauthorized, ErrReauthRequired
+		}
+	} else if ok, _ := passwords.Verify(password, user.Password); !ok {
+		return http.StatusUnauthorized, ErrInvalidCredentials
+	}
+
+	if user.TwoFactorEnabled() {
+		valid, err := verifySecondFactor(repo, user, code)
+		if err != nil {
+			log.Printf("Ошибка проверки кода 2FA: %v", err)
+			return http.StatusInternalServerError, ErrInternal
+		}
+		if !valid {
+			return http.StatusUnauthorized, ErrInvalid2FACode
+		}
+	}
+	return 0, ""
+}
+
+// ExportMyData - архив личных данных: профиль, посты, комментарии, реакции,
+// закладки, история входов, привязанные провайдеры и токены API
+func ExportMyData(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		// Архив собирается в памяти: при ошибке клиент получит её, а не обрывок файла
+		var buf bytes.Buffer
+		if _, err := archive.ExportUser(repo.DB(), &buf, user.ID); err != nil {
+			log.Printf("Ошибка выгрузки данных %s: %v", user.Username, err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		filename := fmt.Sprintf("unitycn-%s-%s.tar.gz", user.Username, time.Now().Format("20060102-150405"))
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Data(http.StatusOK, "application/gzip", buf.Bytes())
+	}
+}
+
+// deletionRequest - запрос на удаление аккаунта с повторной аутентификацией
+type deletionRequest struct {
+	Password string `json:"password" doc:"не нужен, если аккаунт без пароля и вход был не раньше 10 минут назад"`
+	Code     string `json:"code,omitempty" doc:"код 2FA или код восстановления, если 2FA включена"`
+	Mode     string `json:"mode" doc:"anonymize - посты и комментарии остаются от имени «Удален», remove - удаляются"`
+}
+
+// deletionStatus - запрошено ли удаление аккаунта
+type deletionStatus struct {
+	Scheduled bool       `json:"scheduled"`
+	DeleteAt  *time.Time `json:"delete_at,omitempty" doc:"до этого момента удаление можно отменить"`
+	Mode      string     `json:"mode,omitempty"`
+	GraceDays int        `json:"grace_days" doc:"отсрочка удаления"`
+}
+
+func newDeletionStatus(user *models.User, grace time.Duration) deletionStatus {
+	return deletionStatus{
+		Scheduled: user.DeletionScheduledAt != nil,
+		DeleteAt:  user.DeletionScheduledAt,
+		Mode:      user.DeletionMode,
+		GraceDays: int(grace / (24 * time.Hour)),
+	}
+}
+
+// GetAccountDeletion - состояние запроса на удаление
+func GetAccountDeletion(repo *models.Repository, opts Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		respond(c, http.StatusOK, newDeletionStatus(user, opts.DeletionGrace))
+	}
+}
+
+// ScheduleAccountDeletion - удаление аккаунта по истечении отсрочки
+func ScheduleAccountDeletion(repo *models.Repository, opts Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		var req deletionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+		if !models.ValidDeletionMode(req.Mode) {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"mode"}})
+			return
+		}
+		if status, code := reauthenticate(c, repo, opts.Passwords, user, req.Password, req.Code); code != "" {
+			respondError(c, status, code)
+			return
+		}
+
+		deleteAt, err := repo.ScheduleAccountDeletion(user.ID, req.Mode, opts.DeletionGrace)
+		if err != nil {
+			log.Printf("Ошибка запроса удаления аккаунта: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		user.DeletionScheduledAt, user.DeletionMode = &deleteAt, req.Mode
+		log.Printf("Пользователь %s запросил удаление аккаунта (%s) на %s",
+			user.Username, req.Mode, deleteAt.Format(time.RFC3339))
+
+		if user.EmailVerified() {
+			sendMail(c, opts.Mailer, user.Email, "account_deletion", mailData{
+				Username: user.Username,
+				Email:    user.Email,
+				Link:     strings.TrimSuffix(opts.BaseURL, "/") + "/account/delete",
+				Days:     int(opts.DeletionGrace / (24 * time.Hour)),
+			})
+		}
+
+		respond(c, http.StatusOK, newDeletionStatus(user, opts.DeletionGrace))
+	}
+}
+
+// CancelAccountDeletion - отмена запроса на удаление
+func CancelAccountDeletion(repo *models.Repository, opts Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		if err := repo.CancelAccountDeletion(user.ID); err != nil {
+			log.Printf("Ошибка отмены удаления аккаунта: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		user.DeletionScheduledAt, user.DeletionMode = nil, ""
+
+		respond(c, http.StatusOK, newDeletionStatus(user, opts.DeletionGrace))
+	}
+}
+
+// AccountDeletionPage - выгрузка данных и удаление аккаунта
+func AccountDeletionPage(repo *models.Repository, opts Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := repo.GetUserByUsername(c.GetString("username"))
+		if err != nil {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+
+		renderHTML(c, http.StatusOK, "account_delete.html", gin.H{
+			"title":       "Данные и удаление аккаунта",
+			"user":        user,
+			"hasPassword": user.Password != models.ExternalPassword,
+			"deletion":    newDeletionStatus(user, opts.DeletionGrace),
+		})
+	}
+}
+
+// DeleteDueAccounts - удаление аккаунтов, отсрочка которых истекла
+func DeleteDueAccounts(repo *models.Repository) {
+	due, err := repo.DueAccountDeletions()
+	if err != nil {
+		log.Printf("Ошибка поиска аккаунтов к удалению: %v", err)
+		return
+	}
+	for _, d := range due {
+		if err := repo.DeleteAccount(d.UserID, d.Mode); err != nil {
+			log.Printf("Ошибка удаления аккаунта %s: %v", d.Username, err)
+			continue
+		}
+		log.Printf("Аккаунт %s удалён (%s)", d.Username, d.Mode)
+	}
+}
@@ -1,8 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
+	"unitycn/internal/archive"
 	"unitycn/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -15,13 +20,13 @@ func AdminDashboard(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		stats, err := repo.GetStats()
 		if err != nil {
-			c.HTML(http.StatusInternalServerError, "admin/error.html", gin.H{
+			renderHTML(c, http.StatusInternalServerError, "admin/error.html", gin.H{
 				"error": "Ошибка получения статистики",
 			})
 			return
 		}
 
-		c.HTML(http.StatusOK, "admin/dashboard.html", gin.H{
+		renderHTML(c, http.StatusOK, "admin/dashboard.html", gin.H{
 			"title": "Админ-панель",
 			"stats": stats,
 		})
@@ -33,54 +38,61 @@ func AdminUsers(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		users, err := repo.GetAllUsers()
 		if err != nil {
-			c.HTML(http.StatusInternalServerError, "admin/error.html", gin.H{
+			renderHTML(c, http.StatusInternalServerError, "admin/error.html", gin.H{
 				"error": "Ошибка получения пользователей",
 			})
 			return
 		}
 
-		c.HTML(http.StatusOK, "admin/users.html", gin.H{
-			"title": "Управление пользователями",
-			"users": users,
+		// Логины с временной блокировкой входа
+		locked, err := repo.LockedUsernames(loginLockAfter, loginFailureWindow)
+		if err != nil {
+			log.Printf("Ошибка получения блокировок входа: %v", err)
+		}
+
+		renderHTML(c, http.StatusOK, "admin/users.html", gin.H{
+			"title":  "Управление пользователями",
+			"users":  users,
+			"locked": locked,
 		})
 	}
 }
 
+// roleRequest - новая роль пользователя
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
 // UpdateUserRole - обновление роли пользователя
 func UpdateUserRole(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idStr := c.Param("id")
 		userID, err := strconv.Atoi(idStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID"})
+			respondError(c, http.StatusBadRequest, ErrInvalidID)
 			return
 		}
 
-		var req struct {
-			Role string `json:"role"`
-		}
-
+		var req roleRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
 			return
 		}
 
 		// Проверяем, что роль валидная
 		if req.Role != "admin" && req.Role != "user" && req.Role != "moderator" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверная роль"})
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"role"}})
 			return
 		}
 
 		err = repo.UpdateUserRole(userID, req.Role)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления роли"})
+			log.Printf("Ошибка обновления роли: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Роль обновлена",
-			"role":    req.Role,
-		})
+		respond(c, http.StatusOK, gin.H{"id": userID, "role": req.Role})
 	}
 }
 
@@ -90,26 +102,25 @@ func DeleteUserAdmin(repo *models.Repository) gin.HandlerFunc {
 		idStr := c.Param("id")
 		userID, err := strconv.Atoi(idStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID"})
+			respondError(c, http.StatusBadRequest, ErrInvalidID)
 			return
 		}
 
 		// Не позволяем удалить самого себя
 		currentUserID, _ := c.Get("user_id")
 		if currentUserID.(int) == userID {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Нельзя удалить самого себя"})
+			respondError(c, http.StatusBadRequest, ErrForbidden, gin.H{"reason": "self_delete"})
 			return
 		}
 
 		err = repo.DeleteUser(userID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления пользователя"})
+			log.Printf("Ошибка удаления пользователя: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Пользователь удален",
-		})
+		respond(c, http.StatusOK, gin.H{"id": userID, "deleted": true})
 	}
 }
 
@@ -118,13 +129,13 @@ func AdminPosts(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		posts, err := repo.GetAllPostsAdmin()
 		if err != nil {
-			c.HTML(http.StatusInternalServerError, "admin/error.html", gin.H{
+			renderHTML(c, http.StatusInternalServerError, "admin/error.html", gin.H{
 				"error": "Ошибка получения постов",
 			})
 			return
 		}
 
-		c.HTML(http.StatusOK, "admin/posts.html", gin.H{
+		renderHTML(c, http.StatusOK, "admin/posts.html", gin.H{
 			"title": "Управление постами",
 			"posts": posts,
 		})
@@ -137,19 +148,18 @@ func DeletePostAdmin(repo *models.Repository) gin.HandlerFunc {
 		idStr := c.Param("id")
 		postID, err := strconv.Atoi(idStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID"})
+			respondError(c, http.StatusBadRequest, ErrInvalidID)
 			return
 		}
 
 		err = repo.DeletePostAdmin(postID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления поста"})
+			log.Printf("Ошибка удаления поста: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Пост удален",
-		})
+		respond(c, http.StatusOK, gin.H{"id": postID, "deleted": true})
 	}
 }
 
@@ -159,7 +169,7 @@ func EditPostPage(repo *models.Repository) gin.HandlerFunc {
 		idStr := c.Param("id")
 		postID, err := strconv.Atoi(idStr)
 		if err != nil {
-			c.HTML(http.StatusBadRequest, "admin/error.html", gin.H{
+			renderHTML(c, http.StatusBadRequest, "admin/error.html", gin.H{
 				"error": "Неверный ID поста",
 			})
 			return
@@ -167,13 +177,13 @@ func EditPostPage(repo *models.Repository) gin.HandlerFunc {
 
 		post, err := repo.GetPostByID(postID)
 		if err != nil {
-			c.HTML(http.StatusNotFound, "admin/error.html", gin.H{
+			renderHTML(c, http.StatusNotFound, "admin/error.html", gin.H{
 				"error": "Пост не найден",
 			})
 			return
 		}
 
-		c.HTML(http.StatusOK, "admin/edit_post.html", gin.H{
+		renderHTML(c, http.StatusOK, "admin/edit_post.html", gin.H{
 			"title": "Редактирование поста",
 			"post":  post,
 		})
@@ -186,33 +196,29 @@ func UpdatePostAdmin(repo *models.Repository) gin.HandlerFunc {
 		idStr := c.Param("id")
 		postID, err := strconv.Atoi(idStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID"})
+			respondError(c, http.StatusBadRequest, ErrInvalidID)
 			return
 		}
 
-		var req struct {
-			Content string `json:"content"`
-		}
-
+		var req postRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
 			return
 		}
 
 		if req.Content == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Содержание не может быть пустым"})
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"content"}})
 			return
 		}
 
 		err = repo.UpdatePost(postID, req.Content)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления поста"})
+			log.Printf("Ошибка обновления поста: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Пост обновлен",
-		})
+		respond(c, http.StatusOK, gin.H{"id": postID, "updated": true})
 	}
 }
 
@@ -221,13 +227,13 @@ func AdminComments(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		comments, err := repo.GetAllCommentsAdmin()
 		if err != nil {
-			c.HTML(http.StatusInternalServerError, "admin/error.html", gin.H{
+			renderHTML(c, http.StatusInternalServerError, "admin/error.html", gin.H{
 				"error": "Ошибка получения комментариев",
 			})
 			return
 		}
 
-		c.HTML(http.StatusOK, "admin/comments.html", gin.H{
+		renderHTML(c, http.StatusOK, "admin/comments.html", gin.H{
 			"title":    "Управление комментариями",
 			"comments": comments,
 		})
@@ -240,19 +246,18 @@ func DeleteCommentAdmin(repo *models.Repository) gin.HandlerFunc {
 		idStr := c.Param("id")
 		commentID, err := strconv.Atoi(idStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID"})
+			respondError(c, http.StatusBadRequest, ErrInvalidID)
 			return
 		}
 
 		err = repo.DeleteCommentAdmin(commentID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления комментария"})
+			log.Printf("Ошибка удаления комментария: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Комментарий удален",
-		})
+		respond(c, http.StatusOK, gin.H{"id": commentID, "deleted": true})
 	}
 }
 
@@ -261,13 +266,13 @@ func AdminHeroes(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		heroes, err := repo.GetHeroes()
 		if err != nil {
-			c.HTML(http.StatusInternalServerError, "admin/error.html", gin.H{
+			renderHTML(c, http.StatusInternalServerError, "admin/error.html", gin.H{
 				"error": "Ошибка получения героев",
 			})
 			return
 		}
 
-		c.HTML(http.StatusOK, "admin/heroes.html", gin.H{
+		renderHTML(c, http.StatusOK, "admin/heroes.html", gin.H{
 			"title":  "Управление героями",
 			"heroes": heroes,
 		})
@@ -280,13 +285,67 @@ func GetHeroByID(repo *models.Repository) gin.HandlerFunc {
 		idStr := c.Param("id")
 		_, err := strconv.Atoi(idStr) // Используем переменную
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID"})
+			respondError(c, http.StatusBadRequest, ErrInvalidID)
 			return
 		}
 
 		// TODO: Добавить метод GetHeroByID в репозиторий
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Функция в разработке",
+		respond(c, http.StatusNotImplemented, gin.H{"implemented": false})
+	}
+}
+
+// AdminExport - выгрузка всех данных в архив (скачивание)
+func AdminExport(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filename := fmt.Sprintf("unitycn-%s.tar.gz", time.Now().Format("20060102-150405"))
+		c.Header("Content-Type", "application/gzip")
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		_, err := archive.Export(repo.DB(), c.Writer, archive.ExportOptions{
+			IncludePasswords: c.Query("include_passwords") == "1",
+			UploadsDir:       archive.DefaultUploadsDir,
 		})
+		if err != nil {
+			// Заголовки уже отправлены - только логируем и обрываем ответ
+			log.Printf("Ошибка выгрузки архива: %v", err)
+			c.Abort()
+		}
+	}
+}
+
+// AdminImport - загрузка архива (multipart, поле archive)
+func AdminImport(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fileHeader, err := c.FormFile("archive")
+		if err != nil {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"archive"}})
+			return
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+		defer file.Close()
+
+		report, err := archive.Import(repo.DB(), file, archive.ImportOptions{
+			DryRun:     c.PostForm("dry_run") == "1",
+			UploadsDir: archive.DefaultUploadsDir,
+			StagingDir: archive.DefaultStagingDir,
+		})
+		if err != nil {
+			var validationErr *archive.ValidationError
+			if errors.As(err, &validationErr) {
+				respondError(c, http.StatusUnprocessableEntity, ErrValidationFailed, gin.H{
+					"problems": validationErr.Problems,
+				})
+				return
+			}
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest, err.Error())
+			return
+		}
+
+		respond(c, http.StatusOK, report)
 	}
 }
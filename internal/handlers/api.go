@@ -1,32 +1,169 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 	"unitycn/internal/auth"
+	"unitycn/internal/mailer"
 	"unitycn/internal/models"
 
 	"github.com/gin-gonic/gin"
 )
 
+// currentUser - пользователь, определённый AuthMiddleware
+func currentUser(c *gin.Context, repo *models.Repository) (*models.User, bool) {
+	username, exists := c.Get("username")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, ErrUnauthorized)
+		return nil, false
+	}
+
+	user, err := repo.GetUserByUsername(username.(string))
+	if err != nil {
+		log.Printf("Ошибка получения пользователя %v: %v", username, err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// paramID - числовой параметр маршрута (:id)
+func paramID(c *gin.Context, name string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrInvalidID)
+		return 0, false
+	}
+	return id, true
+}
+
 // === AUTH HANDLERS ===
 
+// authenticate - проверка логина и пароля, при неудаче - код ошибки и HTTP статус.
+// Каждая попытка пишется в login_events; частые неудачи дают задержку и блокировку.
+func authenticate(c *gin.Context, repo *models.Repository, passwords *auth.Passwords, username, password string) (*models.User, int, string) {
+	userID := 0
+	user, err := repo.GetUserByUsername(username)
+	if err == nil {
+		userID = user.ID
+	}
+
+	if status, code := throttleLogin(c, repo, userID, username); code != "" {
+		return nil, status, code
+	}
+
+	if user == nil {
+		// Та же работа bcrypt, что и для существующего логина
+		passwords.CheckDummy(password)
+		recordLogin(c, repo, 0, username, models.LoginUnknownUser)
+		return nil, http.StatusUnauthorized, ErrInvalidCredentials
+	}
+
+	ok, rehash := passwords.Verify(password, user.Password)
+	if !ok {
+		recordLogin(c, repo, user.ID, username, models.LoginBadPassword)
+		return nil, http.StatusUnauthorized, ErrInvalidCredentials
+	}
+	if rehash {
+		upgradePasswordHash(repo, passwords, user, password)
+	}
+
+	// Заблокированный пользователь не может войти
+	if user.BannedAt != nil {
+		recordLogin(c, repo, user.ID, username, models.LoginBanned)
+		return nil, http.StatusForbidden, ErrAccountBanned
+	}
+
+	if user.TwoFactorEnabled() {
+		recordLogin(c, repo, user.ID, username, models.LoginMFARequired)
+	} else {
+		recordLogin(c, repo, user.ID, username, models.LoginSuccess)
+	}
+	return user, 0, ""
+}
+
+// upgradePasswordHash - пароль известен только при входе: тогда и заменяется
+// хэш устаревшего алгоритма или с более слабыми параметрами
+func upgradePasswordHash(repo *models.Repository, passwords *auth.Passwords, user *models.User, password string) {
+	hash, err := passwords.Hash(password)
+	if err != nil {
+		log.Printf("Ошибка хэширования пароля: %v", err)
+		return
+	}
+	if err := repo.RehashUserPassword(user.ID, user.Password, hash); err != nil {
+		log.Printf("Ошибка обновления хэша пароля %s: %v", user.Username, err)
+		return
+	}
+	user.Password = hash
+}
+
+// startSession - выдача токена и установка куки
+func startSession(c *gin.Context, tokens *auth.Service, user *models.User) (string, error) {
+	token, err := tokens.GenerateToken(user.ID, user.Username, user.Role)
+	if err != nil {
+		return "", err
+	}
+
+	setCookie(c, "token", token, int(tokens.SessionTTL().Seconds()), "/")
+	return token, nil
+}
+
+// loginRequest - данные входа
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// sessionUser - пользователь в ответе на вход
+type sessionUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// sessionResult - ответ API после входа или регистрации.
+// При включённой 2FA вместо сессии - mfa_token для POST /login/2fa.
+type sessionResult struct {
+	Token       string       `json:"token,omitempty"`
+	User        *sessionUser `json:"user,omitempty"`
+	MFARequired bool         `json:"mfa_required,omitempty"`
+	MFAToken    string       `json:"mfa_token,omitempty" doc:"частичный токен второго шага входа"`
+
+	TwoFactorSetupRequired bool `json:"two_factor_setup_required,omitempty" doc:"роль требует подключить 2FA"`
+	EmailVerificationSent  bool `json:"email_verification_sent,omitempty" doc:"на email отправлена ссылка подтверждения"`
+}
+
+// sessionResponse - ответ API после входа или регистрации
+func sessionResponse(token string, user *models.User) sessionResult {
+	return sessionResult{
+		Token: token,
+		User: &sessionUser{
+			ID:       user.ID,
+			Username: user.Username,
+			Role:     user.Role,
+		},
+	}
+}
+
 // Logout - выход из системы
 func Logout() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Удаляем куку с токеном
-		c.SetCookie("token", "", -1, "/", "", false, true)
+		setCookie(c, "token", "", -1, "/")
 
 		// Определяем тип запроса
 		isAPI := strings.Contains(c.Request.Header.Get("Accept"), "application/json") ||
 			strings.HasPrefix(c.Request.URL.Path, "/api/")
 
 		if isAPI {
-			c.JSON(http.StatusOK, gin.H{
-				"message": "Вы успешно вышли из системы",
-			})
+			respond(c, http.StatusOK, gin.H{"logged_out": true})
 		} else {
 			// Для веб-страниц перенаправляем на главную
 			c.Redirect(http.StatusFound, "/")
@@ -34,355 +171,603 @@ func Logout() gin.HandlerFunc {
 	}
 }
 
-func Login(repo *models.Repository, secret string) gin.HandlerFunc {
+// Login - вход через API (JSON)
+func Login(repo *models.Repository, tokens *auth.Service, opts Options) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Определяем тип запроса
-		contentType := c.ContentType()
-		var username, password string
-
-		if contentType == "application/x-www-form-urlencoded" {
-			// Веб-форма
-			username = c.PostForm("username")
-			password = c.PostForm("password")
-		} else if contentType == "application/json" {
-			// API запрос
-			var req struct {
-				Username string `json:"username"`
-				Password string `json:"password"`
-			}
+		var req loginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
 
-			if err := c.ShouldBindJSON(&req); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+		user, status, code := authenticate(c, repo, opts.Passwords, req.Username, req.Password)
+		if user == nil {
+			respondError(c, status, code)
+			return
+		}
+
+		// Второй шаг: сессия выдаётся только после кода 2FA
+		if user.TwoFactorEnabled() {
+			mfaToken, err := tokens.GenerateMFAToken(user.ID, user.Username)
+			if err != nil {
+				log.Printf("Ошибка генерации токена: %v", err)
+				respondError(c, http.StatusInternalServerError, ErrInternal)
 				return
 			}
+			respond(c, http.StatusOK, sessionResult{MFARequired: true, MFAToken: mfaToken})
+			return
+		}
 
-			username = req.Username
-			password = req.Password
-		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный Content-Type"})
+		token, err := startSession(c, tokens, user)
+		if err != nil {
+			log.Printf("Ошибка генерации токена: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		// Проверка пользователя
-		user, err := repo.GetUserByUsername(username)
-		if err != nil || !auth.CheckPasswordHash(password, user.Password) {
-			if contentType == "application/x-www-form-urlencoded" {
-				c.HTML(http.StatusUnauthorized, "login.html", gin.H{
-					"error": "Неверные учетные данные",
-				})
-			} else {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверные учетные данные"})
-			}
+		result := sessionResponse(token, user)
+		result.TwoFactorSetupRequired = opts.TwoFactor.requiredFor(user.Role)
+		respond(c, http.StatusOK, result)
+	}
+}
+
+// LoginForm - вход через веб-форму
+func LoginForm(repo *models.Repository, tokens *auth.Service, opts Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, status, code := authenticate(c, repo, opts.Passwords, c.PostForm("username"), c.PostForm("password"))
+		if user == nil {
+			renderAuthPage(c, status, "login.html", opts.OIDC, gin.H{
+				"error": message(c, code),
+			})
 			return
 		}
 
-		// Генерация токена
-		token, err := auth.GenerateToken(user.ID, user.Username, user.Role)
-		if err != nil {
-			if contentType == "application/x-www-form-urlencoded" {
-				c.HTML(http.StatusInternalServerError, "login.html", gin.H{
-					"error": "Ошибка авторизации",
+		if user.TwoFactorEnabled() {
+			mfaToken, err := tokens.GenerateMFAToken(user.ID, user.Username)
+			if err != nil {
+				log.Printf("Ошибка генерации токена: %v", err)
+				renderAuthPage(c, http.StatusInternalServerError, "login.html", opts.OIDC, gin.H{
+					"error": message(c, ErrInternal),
 				})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
+				return
 			}
+			renderHTML(c, http.StatusOK, "login_2fa.html", gin.H{"mfa_token": mfaToken})
 			return
 		}
 
-		// Устанавливаем куку в любом случае
-		c.SetCookie("token", token, 24*3600, "/", "", false, true)
+		// Роль требует 2FA - сразу на страницу подключения
+		redirect := "/"
+		if opts.TwoFactor.requiredFor(user.Role) {
+			redirect = "/account/2fa"
+		}
 
-		// Ответ в зависимости от типа запроса
-		if contentType == "application/x-www-form-urlencoded" {
-			// Для веб-формы: отправляем на страницу редиректа
-			c.HTML(http.StatusOK, "auth_redirect.html", gin.H{
-				"token":    token,
-				"username": user.Username,
-				"role":     user.Role,
-				"user_id":  user.ID,
-				"redirect": "/",
-			})
-		} else {
-			// Для API: возвращаем JSON
-			c.JSON(http.StatusOK, gin.H{
-				"token": token,
-				"user": gin.H{
-					"id":       user.ID,
-					"username": user.Username,
-					"role":     user.Role,
-				},
+		token, err := startSession(c, tokens, user)
+		if err != nil {
+			log.Printf("Ошибка генерации токена: %v", err)
+			renderAuthPage(c, http.StatusInternalServerError, "login.html", opts.OIDC, gin.H{
+				"error": message(c, ErrInternal),
 			})
+			return
 		}
+
+		// Отправляем на страницу редиректа
+		renderHTML(c, http.StatusOK, "auth_redirect.html", gin.H{
+			"token":    token,
+			"username": user.Username,
+			"role":     user.Role,
+			"user_id":  user.ID,
+			"redirect": redirect,
+		})
 	}
 }
 
-func Register(repo *models.Repository, secret string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var req struct {
-			Username    string `json:"username"`
-			Password    string `json:"password"`
-			DisplayName string `json:"display_name,omitempty"`
+// registerRequest - данные регистрации (JSON и веб-форма)
+type registerRequest struct {
+	Username    string `json:"username" doc:"3-50 символов: буквы, цифры, _ . -"`
+	Password    string `json:"password" doc:"не короче auth.password.min_length, не из списка утёкших, не равен логину"`
+	DisplayName string `json:"display_name,omitempty"`
+	Email       string `json:"email,omitempty" doc:"для восстановления пароля, подтверждается по ссылке из письма"`
+}
+
+// validUsername - от 3 до 50 символов: буквы, цифры, _ . -;
+// первый и последний символ - буква или цифра
+func validUsername(username string) bool {
+	runes := []rune(username)
+	if len(runes) < minUsernameLen || len(runes) > maxUsernameLen {
+		return false
+	}
+	for i, r := range runes {
+		alnum := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if (i == 0 || i == len(runes)-1) && !alnum {
+			return false
+		}
+		if !alnum && r != '_' && r != '.' && r != '-' {
+			return false
 		}
+	}
+	return true
+}
 
-		// Определяем тип запроса
-		contentType := c.ContentType()
-
-		if contentType == "application/x-www-form-urlencoded" {
-			// Веб-форма
-			req.Username = c.PostForm("username")
-			req.Password = c.PostForm("password")
-			req.DisplayName = c.PostForm("display_name")
-		} else if contentType == "application/json" {
-			// API запрос
-			if err := c.ShouldBindJSON(&req); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
-				return
-			}
+// passwordPolicyError - код ошибки и подсказка для пароля, не прошедшего политику
+func passwordPolicyError(passwords *auth.Passwords, err error) (string, gin.H) {
+	details := gin.H{"min_length": passwords.MinLength(), "max_length": passwords.MaxLength()}
+	if maxBytes := passwords.MaxBytes(); maxBytes > 0 {
+		details["max_bytes"] = maxBytes
+	}
+	switch {
+	case errors.Is(err, auth.ErrPasswordTooShort):
+		return ErrPasswordTooShort, details
+	case errors.Is(err, auth.ErrPasswordTooLong):
+		return ErrPasswordTooLong, details
+	case errors.Is(err, auth.ErrPasswordSameAsUsername):
+		return ErrPasswordUsername, nil
+	}
+	return ErrPasswordBreached, nil
+}
+
+// createAccount - создание пользователя; при неудаче - HTTP статус, код и подробности
+func createAccount(repo *models.Repository, passwords *auth.Passwords, req registerRequest) (*models.User, int, string, interface{}) {
+	req.Username = strings.TrimSpace(req.Username)
+	if !validUsername(req.Username) {
+		return nil, http.StatusBadRequest, ErrInvalidUsername, gin.H{"fields": []string{"username"}}
+	}
+	if err := passwords.Validate(req.Password, req.Username); err != nil {
+		code, details := passwordPolicyError(passwords, err)
+		return nil, http.StatusBadRequest, code, details
+	}
+	req.DisplayName = strings.TrimSpace(req.DisplayName)
+	if req.DisplayName != "" && !validDisplayName(req.DisplayName) {
+		return nil, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"display_name"}}
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email != "" {
+		if !mailer.ValidAddress(req.Email) {
+			return nil, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"email"}}
+		}
+		if _, err := repo.GetUserByEmail(req.Email); err == nil {
+			return nil, http.StatusConflict, ErrEmailTaken, nil
+		}
+	}
+
+	hashedPassword, err := passwords.Hash(req.Password)
+	if err != nil {
+		log.Printf("Ошибка хэширования пароля: %v", err)
+		return nil, http.StatusInternalServerError, ErrInternal, nil
+	}
+
+	err = repo.CreateUser(req.Username, hashedPassword, "user", req.DisplayName)
+	if err != nil {
+		return nil, http.StatusConflict, ErrUserExists, nil
+	}
+
+	// Получаем созданного пользователя
+	user, err := repo.GetUserByUsername(req.Username)
+	if err != nil {
+		log.Printf("Ошибка получения пользователя после регистрации: %v", err)
+		return nil, http.StatusInternalServerError, ErrInternal, nil
+	}
+
+	// Адрес сохраняется неподтверждённым, письмо отправляет вызывающий
+	if req.Email != "" {
+		if err := repo.SetUserEmail(user.ID, req.Email); err != nil {
+			log.Printf("Ошибка сохранения email: %v", err)
 		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный Content-Type"})
-			return
+			user.Email = req.Email
 		}
+	}
 
-		hashedPassword, err := auth.HashPassword(req.Password)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка хэширования пароля"})
+	return user, 0, "", nil
+}
+
+// Register - регистрация через API (JSON) с автоматической авторизацией
+func Register(repo *models.Repository, tokens *auth.Service, opts Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req registerRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
 			return
 		}
 
-		err = repo.CreateUser(req.Username, hashedPassword, "user", req.DisplayName)
-		if err != nil {
-			c.JSON(http.StatusConflict, gin.H{"error": "Пользователь уже существует"})
+		user, status, code, details := createAccount(repo, opts.Passwords, req)
+		if user == nil {
+			respondError(c, status, code, details)
 			return
 		}
 
-		// АВТОМАТИЧЕСКАЯ АВТОРИЗАЦИЯ ПОСЛЕ РЕГИСТРАЦИИ
-		// Получаем созданного пользователя
-		user, err := repo.GetUserByUsername(req.Username)
+		token, err := startSession(c, tokens, user)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка авторизации после регистрации"})
+			log.Printf("Ошибка генерации токена: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		// Генерация токена
-		token, err := auth.GenerateToken(user.ID, user.Username, user.Role)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации токена"})
-			return
+		result := sessionResponse(token, user)
+		if user.Email != "" {
+			_, code := sendVerificationEmail(c, repo, tokens, opts, user)
+			result.EmailVerificationSent = code == ""
 		}
+		respond(c, http.StatusCreated, result)
+	}
+}
 
-		// Устанавливаем куку
-		c.SetCookie("token", token, 24*3600, "/", "", false, true)
+// RegisterForm - регистрация через веб-форму
+func RegisterForm(repo *models.Repository, tokens *auth.Service, opts Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := registerRequest{
+			Username:    c.PostForm("username"),
+			Password:    c.PostForm("password"),
+			DisplayName: c.PostForm("display_name"),
+			Email:       c.PostForm("email"),
+		}
 
-		// Ответ в зависимости от типа запроса
-		if contentType == "application/x-www-form-urlencoded" {
-			// Для веб-формы: отправляем на страницу редиректа
-			c.HTML(http.StatusOK, "auth_redirect.html", gin.H{
-				"token":    token,
-				"username": user.Username,
-				"role":     user.Role,
-				"user_id":  user.ID,
-				"redirect": "/",
-				"message":  "Регистрация успешна! Вы авторизованы.",
+		user, status, code, _ := createAccount(repo, opts.Passwords, req)
+		if user == nil {
+			renderAuthPage(c, status, "register.html", opts.OIDC, gin.H{
+				"error": message(c, code),
 			})
-		} else {
-			// Для API: возвращаем JSON
-			c.JSON(http.StatusCreated, gin.H{
-				"message": "Пользователь создан",
-				"token":   token,
-				"user": gin.H{
-					"id":       user.ID,
-					"username": user.Username,
-					"role":     user.Role,
-				},
+			return
+		}
+
+		token, err := startSession(c, tokens, user)
+		if err != nil {
+			log.Printf("Ошибка генерации токена: %v", err)
+			renderAuthPage(c, http.StatusInternalServerError, "register.html", opts.OIDC, gin.H{
+				"error": message(c, ErrInternal),
 			})
+			return
+		}
+
+		msg := "Регистрация успешна! Вы авторизованы."
+		if user.Email != "" {
+			if _, code := sendVerificationEmail(c, repo, tokens, opts, user); code == "" {
+				msg += " Проверьте почту, чтобы подтвердить email."
+			}
 		}
+
+		// Отправляем на страницу редиректа
+		renderHTML(c, http.StatusOK, "auth_redirect.html", gin.H{
+			"token":    token,
+			"username": user.Username,
+			"role":     user.Role,
+			"user_id":  user.ID,
+			"redirect": "/",
+			"message":  msg,
+		})
 	}
 }
 
 // === POST HANDLERS ===
+
+// postSlogan - лозунг новых постов и репостов
+const postSlogan = "团结" // Единство
+
+// postRequest - текст поста и, если нужно, сообщество и цитируемый пост
+type postRequest struct {
+	Content   string `json:"content"`
+	Community string `json:"community,omitempty" doc:"адрес сообщества; автор должен в нём состоять"`
+	Quote     int    `json:"quote,omitempty" doc:"цитируемый пост; пост станет цитатой (kind = quote)"`
+}
+
+// likeResult - состояние лайка после переключения
+type likeResult struct {
+	PostID int  `json:"post_id"`
+	Liked  bool `json:"liked"`
+	Likes  int  `json:"likes"`
+}
+
 func CreatePost(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		username, exists := c.Get("username")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Пользователь не авторизован"})
+		user, ok := currentUser(c, repo)
+		if !ok {
 			return
 		}
 
-		user, err := repo.GetUserByUsername(username.(string))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения пользователя"})
+		var req postRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
 			return
 		}
 
-		var req struct {
-			Content string `json:"content"`
+		if strings.TrimSpace(req.Content) == "" {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"content"}})
+			return
 		}
 
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
-			return
+		var community *models.CommunityRef
+		if req.Community != "" {
+			if community, ok = postCommunity(c, repo, req.Community, user.ID); !ok {
+				return
+			}
 		}
 
-		err = repo.CreatePost(user.ID, req.Content, "团结")
+		post := models.Post{
+			UserID:    user.ID,
+			Kind:      models.PostKindPost,
+			Content:   req.Content,
+			Slogan:    postSlogan,
+			CreatedAt: time.Now(),
+			User:      user,
+			Community: community,
+		}
+		if req.Quote != 0 {
+			original, ok := sharedOriginal(c, repo, req.Quote, user.ID)
+			if !ok {
+				return
+			}
+			post.Kind = models.PostKindQuote
+			post.OriginalID = &original.ID
+			post.Original = original
+		}
+
+		communityID, quoteOf := 0, 0
+		if community != nil {
+			communityID = community.ID
+		}
+		if post.Original != nil {
+			quoteOf = post.Original.ID
+		}
+		id, err := repo.CreatePost(user.ID, req.Content, postSlogan, communityID, quoteOf)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания поста"})
+			log.Printf("Ошибка создания поста: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"message": "Пост создан"})
+		post.ID = id
+		respond(c, http.StatusCreated, post)
+	}
+}
+
+// fillViewer - поля viewer постов для пользователя, которого определил
+// OptionalAuthMiddleware; при ошибке посты отдаются без них
+func fillViewer(c *gin.Context, repo *models.Repository, posts []models.Post) {
+	viewer, _ := c.Get("user")
+	user, _ := viewer.(*models.User)
+	if err := repo.FillPostViewer(user, posts); err != nil {
+		log.Printf("Ошибка получения состояния постов для зрителя: %v", err)
 	}
 }
 
 func GetPosts(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Используем новый метод с отображением имён
-		posts, err := repo.GetPostsWithUsers(50, 0)
+		page, perPage := pageParams(c)
+		filter := models.PostFilter{ViewerID: c.GetInt("user_id"), HideMuted: true}
+
+		// Используем метод с отображением имён
+		posts, err := repo.GetPostsWithUsers(filter, perPage, (page-1)*perPage)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения постов"})
+			log.Printf("Ошибка получения постов: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusOK, posts)
+		total, err := repo.CountPosts(filter)
+		if err != nil {
+			log.Printf("Ошибка подсчёта постов: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if posts == nil {
+			posts = []models.Post{}
+		}
+		fillViewer(c, repo, posts)
+		respondPage(c, posts, page, perPage, total)
 	}
 }
 
-func LikePost(repo *models.Repository) gin.HandlerFunc {
+// GetPost - один пост с автором и полями зрителя
+func GetPost(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		username, exists := c.Get("username")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Пользователь не авторизован"})
+		postID, ok := paramID(c, "id")
+		if !ok {
 			return
 		}
 
-		user, err := repo.GetUserByUsername(username.(string))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения пользователя"})
+		post, ok := visiblePost(c, repo, postID, c.GetInt("user_id"))
+		if !ok {
 			return
 		}
 
-		idStr := c.Param("id")
-		postID, err := strconv.Atoi(idStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID"})
+		posts := []models.Post{*post}
+		if err := repo.FillOriginals(c.GetInt("user_id"), posts); err != nil {
+			log.Printf("Ошибка получения исходного поста: %v", err)
+		}
+		fillViewer(c, repo, posts)
+		respond(c, http.StatusOK, posts[0])
+	}
+}
+
+func LikePost(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		postID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+		if _, ok := interactablePost(c, repo, postID, user.ID); !ok {
 			return
 		}
 
 		liked, err := repo.LikePost(postID, user.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка лайка"})
+			log.Printf("Ошибка лайка: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		message := "Лайк добавлен"
-		if !liked {
-			message = "Лайк убран"
+		likes, err := repo.GetPostLikesCount(postID)
+		if err != nil {
+			log.Printf("Ошибка подсчёта лайков: %v", err)
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": message,
-			"liked":   liked,
-		})
+		respond(c, http.StatusOK, likeResult{PostID: postID, Liked: liked, Likes: likes})
 	}
 }
 
 // === COMMENT HANDLERS ===
 
+// commentRequest - текст комментария
+type commentRequest struct {
+	Content string `json:"content"`
+}
+
+// commentLikeResult - состояние лайка комментария после переключения
+type commentLikeResult struct {
+	CommentID int  `json:"comment_id"`
+	Liked     bool `json:"liked"`
+	Likes     int  `json:"likes"`
+}
+
 func CreateComment(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		username, exists := c.Get("username")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Пользователь не авторизован"})
-			return
-		}
-
-		user, err := repo.GetUserByUsername(username.(string))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения пользователя"})
+		user, ok := currentUser(c, repo)
+		if !ok {
 			return
 		}
 
 		// Получаем ID поста из URL параметра
-		postIDStr := c.Param("id")
-		postID, err := strconv.Atoi(postIDStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID поста"})
+		postID, ok := paramID(c, "id")
+		if !ok {
 			return
 		}
 
-		var req struct {
-			Content string `json:"content"`
-		}
-
+		var req commentRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
 			return
 		}
 
-		if req.Content == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Комментарий не может быть пустым"})
+		if strings.TrimSpace(req.Content) == "" {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"content"}})
+			return
+		}
+		if _, ok := interactablePost(c, repo, postID, user.ID); !ok {
 			return
 		}
 
-		err = repo.CreateComment(postID, user.ID, req.Content)
+		id, err := repo.CreateComment(postID, user.ID, req.Content)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания комментария"})
+			log.Printf("Ошибка создания комментария: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{
-			"message": "Комментарий добавлен",
-			"post_id": postID,
+		respond(c, http.StatusCreated, models.Comment{
+			ID:        id,
+			PostID:    postID,
+			UserID:    user.ID,
+			Content:   req.Content,
+			CreatedAt: time.Now(),
+			User:      user,
 		})
 	}
 }
 
+// GetComments - комментарии поста: ?sort=oldest (по умолчанию) или top - по лайкам
 func GetComments(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		postIDStr := c.Param("id")
-		postID, err := strconv.Atoi(postIDStr)
+		postID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+
+		order := c.DefaultQuery("sort", models.CommentsOldest)
+		if !models.ValidCommentOrder(order) {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"sort"}})
+			return
+		}
+
+		viewerID := c.GetInt("user_id")
+		post, err := repo.GetPost(postID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(c, http.StatusNotFound, ErrNotFound)
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID поста"})
+			log.Printf("Ошибка получения поста: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		if hiddenInCommunity(c, repo, post, viewerID) {
 			return
 		}
 
-		comments, err := repo.GetCommentsByPostID(postID)
+		comments, err := repo.GetCommentsByPostID(postID, viewerID, order)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения комментариев"})
+			log.Printf("Ошибка получения комментариев: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusOK, comments)
+		if comments == nil {
+			comments = []models.Comment{}
+		}
+		respond(c, http.StatusOK, comments)
 	}
 }
 
-func DeleteComment(repo *models.Repository) gin.HandlerFunc {
+// LikeComment - поставить или убрать лайк комментария (реакция like)
+func LikeComment(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		username, exists := c.Get("username")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Пользователь не авторизован"})
+		user, ok := currentUser(c, repo)
+		if !ok {
 			return
 		}
 
-		user, err := repo.GetUserByUsername(username.(string))
+		commentID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+		if _, ok := interactableComment(c, repo, commentID, user.ID); !ok {
+			return
+		}
+
+		liked, err := repo.LikeComment(commentID, user.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения пользователя"})
+			log.Printf("Ошибка лайка комментария: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		commentIDStr := c.Param("id")
-		commentID, err := strconv.Atoi(commentIDStr)
+		likes, err := repo.GetCommentLikesCount(commentID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID комментария"})
+			log.Printf("Ошибка подсчёта лайков: %v", err)
+		}
+
+		respond(c, http.StatusOK, commentLikeResult{CommentID: commentID, Liked: liked, Likes: likes})
+	}
+}
+
+func DeleteComment(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
 			return
 		}
 
-		err = repo.DeleteComment(commentID, user.ID)
+		commentID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+
+		err := repo.DeleteComment(commentID, user.ID)
+		if errors.Is(err, models.ErrNotFound) {
+			respondError(c, http.StatusNotFound, ErrNotFound)
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			log.Printf("Ошибка удаления комментария: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Комментарий удален"})
+		respond(c, http.StatusOK, gin.H{"id": commentID, "deleted": true})
 	}
 }
 
@@ -391,97 +776,95 @@ func GetHeroes(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		heroes, err := repo.GetHeroes()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения героев"})
+			log.Printf("Ошибка получения героев: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusOK, heroes)
+		if heroes == nil {
+			heroes = []models.Hero{}
+		}
+		respond(c, http.StatusOK, heroes)
 	}
 }
 
+// heroRequest - данные героя для создания и обновления
+type heroRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ImageURL    string `json:"image_url"`
+	BirthDate   string `json:"birth_date"`
+}
+
 func CreateHero(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req struct {
-			Name        string `json:"name"`
-			Description string `json:"description"`
-			ImageURL    string `json:"image_url"`
-			BirthDate   string `json:"birth_date"`
-		}
-
+		var req heroRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
 			return
 		}
 
 		birthDate, err := time.Parse("2006-01-02", req.BirthDate)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат даты. Используйте YYYY-MM-DD"})
+			respondError(c, http.StatusBadRequest, ErrInvalidDate, gin.H{"field": "birth_date"})
 			return
 		}
 
 		err = repo.CreateHero(req.Name, req.Description, req.ImageURL, birthDate)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания героя"})
+			log.Printf("Ошибка создания героя: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"message": "Герой создан"})
+		respond(c, http.StatusCreated, gin.H{"created": true})
 	}
 }
 
 func UpdateHero(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		idStr := c.Param("id")
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID"})
+		id, ok := paramID(c, "id")
+		if !ok {
 			return
 		}
 
-		var req struct {
-			Name        string `json:"name"`
-			Description string `json:"description"`
-			ImageURL    string `json:"image_url"`
-			BirthDate   string `json:"birth_date"`
-		}
-
+		var req heroRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
 			return
 		}
 
 		birthDate, err := time.Parse("2006-01-02", req.BirthDate)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат даты"})
+			respondError(c, http.StatusBadRequest, ErrInvalidDate, gin.H{"field": "birth_date"})
 			return
 		}
 
 		err = repo.UpdateHero(id, req.Name, req.Description, req.ImageURL, birthDate)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления героя"})
+			log.Printf("Ошибка обновления героя: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Герой обновлен"})
+		respond(c, http.StatusOK, gin.H{"id": id, "updated": true})
 	}
 }
 
 func DeleteHero(repo *models.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		idStr := c.Param("id")
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID"})
+		id, ok := paramID(c, "id")
+		if !ok {
 			return
 		}
 
-		err = repo.DeleteHero(id)
+		err := repo.DeleteHero(id)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления героя"})
+			log.Printf("Ошибка удаления героя: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Герой удален"})
+		respond(c, http.StatusOK, gin.H{"id": id, "deleted": true})
 	}
-
 }
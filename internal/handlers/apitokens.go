@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"unitycn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === ПЕРСОНАЛЬНЫЕ ТОКЕНЫ API ===
+
+const (
+	apiTokenPrefix      = "ucn_"
+	apiTokenMaxPerUser  = 50
+	apiTokenMaxNameLen  = 100
+	apiTokenMaxLifetime = 365 // дней
+)
+
+// Области доступа персональных токенов
+const (
+	ScopePostsRead        = "posts:read"
+	ScopePostsWrite       = "posts:write"
+	ScopeCommentsRead     = "comments:read"
+	ScopeCommentsWrite    = "comments:write"
+	ScopeAccountRead      = "account:read"
+	ScopeAccountWrite     = "account:write"
+	ScopeMessagesRead     = "messages:read"
+	ScopeMessagesWrite    = "messages:write"
+	ScopeCommunitiesRead  = "communities:read"
+	ScopeCommunitiesWrite = "communities:write"
+	ScopeBookmarksRead    = "bookmarks:read"
+	ScopeBookmarksWrite   = "bookmarks:write"
+)
+
+// apiTokenScopes - допустимые области с описанием для страницы токенов
+var apiTokenScopes = []struct {
+	Name        string
+	Description string
+}{
+	{ScopePostsRead, "чтение постов"},
+	{ScopePostsWrite, "создание постов, репосты, лайки и реакции"},
+	{ScopeCommentsRead, "чтение комментариев"},
+	{ScopeCommentsWrite, "создание и удаление комментариев, лайки и реакции на них"},
+	{ScopeAccountRead, "профиль, история входов, email и привязанные аккаунты"},
+	{ScopeAccountWrite, "изменение профиля, блокировки"},
+	{ScopeMessagesRead, "личные сообщения и поток событий"},
+	{ScopeMessagesWrite, "отправка сообщений, создание и удаление диалогов"},
+	{ScopeCommunitiesRead, "сообщества, их ленты и участники"},
+	{ScopeCommunitiesWrite, "создание сообществ, вступление, управление участниками и модерация"},
+	{ScopeBookmarksRead, "закладки и подборки"},
+	{ScopeBookmarksWrite, "добавление и удаление закладок, управление подборками"},
+}
+
+// apiTokenRouteScopes - маршруты API (без /api/v1), открытые персональным токенам,
+// и нужная область. Маршрутов, которых нет в списке, токен не открывает:
+// админка, управление токенами и 2FA доступны только из сессии.
+var apiTokenRouteScopes = map[string]string{
+	"GET /posts":                                     ScopePostsRead,
+	"GET /posts/:id":                                 ScopePostsRead,
+	"GET /users/:username":                           ScopePostsRead,
+	"GET /users/:username/posts":                     ScopePostsRead,
+	"POST /posts":                                    ScopePostsWrite,
+	"POST /posts/:id/like":                           ScopePostsWrite,
+	"POST /posts/:id/repost":                         ScopePostsWrite,
+	"DELETE /posts/:id/repost":                       ScopePostsWrite,
+	"GET /reactions":                                 ScopePostsRead,
+	"GET /posts/:id/reactions":                       ScopePostsRead,
+	"POST /posts/:id/reactions/:reaction":            ScopePostsWrite,
+	"GET /comments/:id/reactions":                    ScopeCommentsRead,
+	"POST /comments/:id/reactions/:reaction":         ScopeCommentsWrite,
+	"GET /posts/:id/comments":                        ScopeCommentsRead,
+	"POST /posts/:id/comments":                       ScopeCommentsWrite,
+	"DELETE /comments/:id":                           ScopeCommentsWrite,
+	"POST /comments/:id/like":                        ScopeCommentsWrite,
+	"GET /me":                                        ScopeAccountRead,
+	"PATCH /me":                                      ScopeAccountWrite,
+	"GET /me/login-events":                           ScopeAccountRead,
+	"GET /me/identities":                             ScopeAccountRead,
+	"GET /me/email":                                  ScopeAccountRead,
+	"GET /me/blocks":                                 ScopeAccountRead,
+	"GET /me/mutes":                                  ScopeAccountRead,
+	"POST /users/:username/block":                    ScopeAccountWrite,
+	"DELETE /users/:username/block":                  ScopeAccountWrite,
+	"POST /users/:username/mute":                     ScopeAccountWrite,
+	"DELETE /users/:username/mute":                   ScopeAccountWrite,
+	"GET /me/events":                                 ScopeMessagesRead,
+	"GET /conversations":                             ScopeMessagesRead,
+	"GET /conversations/unread":                      ScopeMessagesRead,
+	"GET /conversations/:id":                         ScopeMessagesRead,
+	"GET /conversations/:id/messages":                ScopeMessagesRead,
+	"POST /conversations/:id/read":                   ScopeMessagesRead,
+	"POST /conversations":                            ScopeMessagesWrite,
+	"DELETE /conversations/:id":                      ScopeMessagesWrite,
+	"POST /conversations/:id/messages":               ScopeMessagesWrite,
+	"GET /communities":                               ScopeCommunitiesRead,
+	"GET /communities/:slug":                         ScopeCommunitiesRead,
+	"GET /communities/:slug/posts":                   ScopeCommunitiesRead,
+	"GET /communities/:slug/members":                 ScopeCommunitiesRead,
+	"GET /me/communities":                            ScopeCommunitiesRead,
+	"POST /communities":                              ScopeCommunitiesWrite,
+	"PATCH /communities/:slug":                       ScopeCommunitiesWrite,
+	"POST /communities/:slug/join":                   ScopeCommunitiesWrite,
+	"POST /communities/:slug/leave":                  ScopeCommunitiesWrite,
+	"POST /communities/:slug/members/:username":      ScopeCommunitiesWrite,
+	"DELETE /communities/:slug/members/:username":    ScopeCommunitiesWrite,
+	"PUT /communities/:slug/moderators/:username":    ScopeCommunitiesWrite,
+	"DELETE /communities/:slug/moderators/:username": ScopeCommunitiesWrite,
+	"DELETE /communities/:slug/posts/:id":            ScopeCommunitiesWrite,
+	"DELETE /communities/:slug/comments/:id":         ScopeCommunitiesWrite,
+	"GET /me/bookmarks":                              ScopeBookmarksRead,
+	"GET /me/bookmarks/collections":                  ScopeBookmarksRead,
+	"POST /me/bookmarks/collections":                 ScopeBookmarksWrite,
+	"PATCH /me/bookmarks/collections/:id":            ScopeBookmarksWrite,
+	"DELETE /me/bookmarks/collections/:id":           ScopeBookmarksWrite,
+	"PUT /posts/:id/bookmark":                        ScopeBookmarksWrite,
+	"DELETE /posts/:id/bookmark":                     ScopeBookmarksWrite,
+}
+
+func validScope(scope string) bool {
+	for _, s := range apiTokenScopes {
+		if s.Name == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// isAPIToken - персональный токен, а не JWT сессии
+func isAPIToken(token string) bool {
+	return strings.HasPrefix(token, apiTokenPrefix)
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAPIToken - ucn_ + 32 случайных байта в base32
+func generateAPIToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)
+	return apiTokenPrefix + strings.ToLower(encoded), nil
+}
+
+// tokenRouteScope - область, нужная для текущего маршрута; false - маршрут токенам закрыт
+func tokenRouteScope(c *gin.Context) (string, bool) {
+	path := c.FullPath()
+	if strings.HasPrefix(path, "/api/v1/") {
+		path = strings.TrimPrefix(path, "/api/v1")
+	} else if strings.HasPrefix(path, "/api/") {
+		path = strings.TrimPrefix(path, "/api")
+	} else {
+		return "", false
+	}
+
+	scope, ok := apiTokenRouteScopes[c.Request.Method+" "+path]
+	return scope, ok
+}
+
+// authenticateAPIToken - пользователь персонального токена в контексте запроса.
+// checkScope = false для OptionalAuthMiddleware: там токен только представляет
+// пользователя, а доступ проверяет AuthMiddleware. При отказе - статус и код ошибки.
+func authenticateAPIToken(c *gin.Context, repo *models.Repository, raw string, checkScope bool) (int, string) {
+	token, err := repo.GetActiveAPIToken(hashAPIToken(raw))
+	if err != nil {
+		return http.StatusUnauthorized, ErrInvalidToken
+	}
+
+	user, err := repo.GetUserByID(token.UserID)
+	if err != nil {
+		return http.StatusUnauthorized, ErrInvalidToken
+	}
+	if user.BannedAt != nil {
+		return http.StatusForbidden, ErrAccountBanned
+	}
+
+	if checkScope {
+		scope, allowed := tokenRouteScope(c)
+		if !allowed {
+			return http.StatusForbidden, ErrTokenNotAllowed
+		}
+		if !token.HasScope(scope) {
+			return http.StatusForbidden, ErrInsufficientScope
+		}
+
+		if err := repo.TouchAPIToken(token.ID, c.ClientIP()); err != nil {
+			log.Printf("Ошибка обновления токена API: %v", err)
+		}
+	}
+
+	setUser(c, user)
+	c.Set("api_token_id", token.ID)
+	return 0, ""
+}
+
+// apiTokenRequest - новый персональный токен
+type apiTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty" doc:"0 - бессрочный"`
+}
+
+// apiTokenCreated - токен показывается один раз, в БД только хэш
+type apiTokenCreated struct {
+	Token    string          `json:"token"`
+	APIToken models.APIToken `json:"api_token"`
+}
+
+// GetAPITokens - токены текущего пользователя
+func GetAPITokens(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		tokens, err := repo.GetAPITokens(user.ID)
+		if err != nil {
+			log.Printf("Ошибка получения токенов API: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		if tokens == nil {
+			tokens = []models.APIToken{}
+		}
+		respond(c, http.StatusOK, tokens)
+	}
+}
+
+// CreateAPIToken - выпуск персонального токена
+func CreateAPIToken(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		var req apiTokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		var invalid []string
+		if req.Name == "" || len([]rune(req.Name)) > apiTokenMaxNameLen {
+			invalid = append(invalid, "name")
+		}
+		if len(req.Scopes) == 0 {
+			invalid = append(invalid, "scopes")
+		}
+		for _, scope := range req.Scopes {
+			if !validScope(scope) {
+				invalid = append(invalid, "scopes")
+				break
+			}
+		}
+		if req.ExpiresInDays < 0 || req.ExpiresInDays > apiTokenMaxLifetime {
+			invalid = append(invalid, "expires_in_days")
+		}
+		if len(invalid) > 0 {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": invalid})
+			return
+		}
+
+		count, err := repo.CountAPITokens(user.ID)
+		if err != nil {
+			log.Printf("Ошибка подсчёта токенов API: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		if count >= apiTokenMaxPerUser {
+			respondError(c, http.StatusConflict, ErrTooManyTokens)
+			return
+		}
+
+		raw, err := generateAPIToken()
+		if err != nil {
+			log.Printf("Ошибка генерации токена API: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		prefix := raw[:len(apiTokenPrefix)+8]
+
+		id, err := repo.CreateAPIToken(user.ID, req.Name, prefix, hashAPIToken(raw), req.Scopes, req.ExpiresInDays)
+		if err != nil {
+			log.Printf("Ошибка создания токена API: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		token, err := repo.GetActiveAPIToken(hashAPIToken(raw))
+		if err != nil || token.ID != id {
+			log.Printf("Ошибка чтения токена API %d: %v", id, err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		respond(c, http.StatusCreated, apiTokenCreated{Token: raw, APIToken: *token})
+	}
+}
+
+// RevokeAPIToken - отзыв токена
+func RevokeAPIToken(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		tokenID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+
+		if err := repo.RevokeAPIToken(tokenID, user.ID); err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				respondError(c, http.StatusNotFound, ErrNotFound)
+				return
+			}
+			log.Printf("Ошибка отзыва токена API: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		respond(c, http.StatusOK, gin.H{"revoked": true})
+	}
+}
+
+// APITokensPage - страница управления токенами
+func APITokensPage(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := repo.GetUserByUsername(c.GetString("username"))
+		if err != nil {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+
+		tokens, err := repo.GetAPITokens(user.ID)
+		if err != nil {
+			log.Printf("Ошибка получения токенов API: %v", err)
+		}
+
+		renderHTML(c, http.StatusOK, "account_tokens.html", gin.H{
+			"title":  "Токены API",
+			"user":   user,
+			"tokens": tokens,
+			"scopes": apiTokenScopes,
+		})
+	}
+}
@@ -4,144 +4,206 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 	"unitycn/internal/auth"
 	"unitycn/internal/models"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(repo *models.Repository, secret string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var tokenString string
+// isAPIRequest - запрос от API-клиента (JSON), а не браузерной страницы
+func isAPIRequest(c *gin.Context) bool {
+	return strings.Contains(c.Request.Header.Get("Content-Type"), "application/json") ||
+		strings.Contains(c.Request.Header.Get("Accept"), "application/json") ||
+		strings.HasPrefix(c.Request.URL.Path, "/api/")
+}
 
-		// 1. Проверяем заголовок Authorization (для API)
-		tokenString = c.GetHeader("Authorization")
+// sessionCookieKey - пользователь вошёл по куке сессии браузера, а не по
+// токену в заголовке Authorization
+const sessionCookieKey = "session_cookie"
+
+// requestToken - токен из заголовка Authorization (API) или куки (веб-страницы);
+// fromCookie - токен взят из куки
+func requestToken(c *gin.Context) (tokenString string, fromCookie bool) {
+	tokenString = c.GetHeader("Authorization")
+	if tokenString == "" {
+		tokenString, _ = c.Cookie("token")
+		fromCookie = tokenString != ""
+	}
 
-		// 2. Если нет в заголовке - проверяем куки (для веб-страниц)
-		if tokenString == "" {
-			tokenString, _ = c.Cookie("token")
-		}
+	// Удаляем префикс "Bearer " если есть
+	return strings.TrimPrefix(tokenString, "Bearer "), fromCookie
+}
 
-		// 3. Если вообще нет токена - ошибка
-		if tokenString == "" {
-			// Определяем тип запроса
-			isAPI := strings.Contains(c.Request.Header.Get("Content-Type"), "application/json") ||
-				strings.Contains(c.Request.Header.Get("Accept"), "application/json") ||
-				strings.HasPrefix(c.Request.URL.Path, "/api/")
+// cookieSessionUserID - пользователь сессии из куки браузера; 0 - гость или
+// вход по заголовку Authorization (токен сессии или персональный токен API)
+func cookieSessionUserID(c *gin.Context) int {
+	if _, ok := c.Get("api_token_id"); ok || !c.GetBool(sessionCookieKey) {
+		return 0
+	}
+	return c.GetInt("user_id")
+}
+
+// setUserContext - пользователь токена в контексте запроса
+func setUserContext(c *gin.Context, repo *models.Repository, claims map[string]interface{}) (*models.User, bool) {
+	username, _ := claims["username"].(string)
+	role, _ := claims["role"].(string)
+
+	user, err := repo.GetUserByUsername(username)
+	if err != nil {
+		log.Printf("Предупреждение: не удалось получить пользователя %s: %v", username, err)
+		c.Set("username", username)
+		c.Set("role", role)
+		c.Set("user_id", 0)
+		return nil, true
+	}
+
+	// Заблокированный пользователь теряет сессию
+	if user.BannedAt != nil {
+		return user, false
+	}
 
-			if isAPI {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется авторизация"})
+	c.Set("username", username)
+	c.Set("role", role)
+	c.Set("user_id", user.ID)
+	c.Set("user", user)
+	if iat, ok := claims["iat"].(float64); ok {
+		c.Set(sessionIssuedAtKey, time.Unix(int64(iat), 0))
+	}
+	return user, true
+}
+
+// setUser - пользователь персонального токена в контексте запроса (роль - из БД)
+func setUser(c *gin.Context, user *models.User) {
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("user_id", user.ID)
+	c.Set("user", user)
+}
+
+func AuthMiddleware(repo *models.Repository, tokens *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, fromCookie := requestToken(c)
+
+		// Если вообще нет токена - ошибка
+		if tokenString == "" {
+			if isAPIRequest(c) {
+				abortError(c, http.StatusUnauthorized, ErrUnauthorized)
 			} else {
 				// Для веб-страниц перенаправляем на логин
 				c.Redirect(http.StatusFound, "/login")
+				c.Abort()
 			}
-			c.Abort()
 			return
 		}
 
-		// Удаляем префикс "Bearer " если есть
-		if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
-			tokenString = tokenString[7:]
+		// Персональный токен API: доступ ограничен его областями
+		if isAPIToken(tokenString) {
+			if status, code := authenticateAPIToken(c, repo, tokenString, true); code != "" {
+				abortError(c, status, code)
+				return
+			}
+			c.Next()
+			return
 		}
 
-		claims, err := auth.VerifyToken(tokenString)
+		claims, err := tokens.VerifyToken(tokenString)
 		if err != nil {
 			// Удаляем невалидную куку
-			c.SetCookie("token", "", -1, "/", "", false, true)
-
-			isAPI := strings.Contains(c.Request.Header.Get("Content-Type"), "application/json") ||
-				strings.Contains(c.Request.Header.Get("Accept"), "application/json") ||
-				strings.HasPrefix(c.Request.URL.Path, "/api/")
+			setCookie(c, "token", "", -1, "/")
 
-			if isAPI {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный токен"})
+			if isAPIRequest(c) {
+				abortError(c, http.StatusUnauthorized, ErrInvalidToken)
 			} else {
 				c.Redirect(http.StatusFound, "/login")
+				c.Abort()
 			}
-			c.Abort()
 			return
 		}
 
-		username := claims["username"].(string)
-		role := claims["role"].(string)
+		if _, ok := setUserContext(c, repo, claims); !ok {
+			setCookie(c, "token", "", -1, "/")
 
-		user, err := repo.GetUserByUsername(username)
-		if err != nil {
-			log.Printf("Предупреждение: не удалось получить пользователя %s: %v", username, err)
-			c.Set("username", username)
-			c.Set("role", role)
-			c.Set("user_id", 0)
-		} else {
-			c.Set("username", username)
-			c.Set("role", role)
-			c.Set("user_id", user.ID)
-			c.Set("user", user)
+			if isAPIRequest(c) {
+				abortError(c, http.StatusForbidden, ErrAccountBanned)
+			} else {
+				c.Redirect(http.StatusFound, "/login")
+				c.Abort()
+			}
+			return
 		}
+		c.Set(sessionCookieKey, fromCookie)
 
 		c.Next()
 	}
 }
 
 // OptionalAuthMiddleware - НЕОБЯЗАТЕЛЬНАЯ аутентификация (не прерывает для гостей)
-func OptionalAuthMiddleware(repo *models.Repository, secret string) gin.HandlerFunc {
+func OptionalAuthMiddleware(repo *models.Repository, tokens *auth.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var tokenString string
+		tokenString, fromCookie := requestToken(c)
 
-		// 1. Проверяем заголовок Authorization (для API)
-		tokenString = c.GetHeader("Authorization")
-
-		// 2. Если нет в заголовке - проверяем куки (для веб-страниц)
-		if tokenString == "" {
-			tokenString, _ = c.Cookie("token")
-		}
-
-		// 3. Если нет токена - просто продолжаем как гость
+		// Если нет токена - просто продолжаем как гость
 		if tokenString == "" {
 			c.Next()
 			return
 		}
 
-		// Удаляем префикс "Bearer " если есть
-		if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
-			tokenString = tokenString[7:]
+		if isAPIToken(tokenString) {
+			// Персональный токен представляет пользователя только в API: страницы
+			// и вход через OIDC открываются им как гостю. Недействительный токен - гость
+			if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+				authenticateAPIToken(c, repo, tokenString, false)
+			}
+			c.Next()
+			return
 		}
 
-		claims, err := auth.VerifyToken(tokenString)
+		claims, err := tokens.VerifyToken(tokenString)
 		if err != nil {
 			// Невалидный токен - удаляем куку и продолжаем как гость
-			c.SetCookie("token", "", -1, "/", "", false, true)
+			setCookie(c, "token", "", -1, "/")
 			c.Next()
 			return
 		}
 
-		username := claims["username"].(string)
-		role := claims["role"].(string)
-
-		user, err := repo.GetUserByUsername(username)
-		if err != nil {
-			log.Printf("Предупреждение: не удалось получить пользователя %s: %v", username, err)
-			c.Set("username", username)
-			c.Set("role", role)
-			c.Set("user_id", 0)
+		if _, ok := setUserContext(c, repo, claims); !ok {
+			// Заблокированный пользователь продолжает как гость
+			setCookie(c, "token", "", -1, "/")
 		} else {
-			c.Set("username", username)
-			c.Set("role", role)
-			c.Set("user_id", user.ID)
-			c.Set("user", user)
+			c.Set(sessionCookieKey, fromCookie)
 		}
 
 		c.Next()
 	}
 }
 
+// JWKS - открытые ключи подписи, по которым другие сервисы проверяют токены сессии
+func JWKS(tokens *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.Header("Content-Type", "application/jwk-set+json")
+		c.JSON(http.StatusOK, tokens.JWKS())
+	}
+}
+
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, exists := c.Get("role")
 		if !exists || role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Требуются права администратора"})
-			c.Abort()
+			abortError(c, http.StatusForbidden, ErrAdminRequired)
 			return
 		}
 		c.Next()
 	}
 }
+
+// DeprecatedAPI - заголовки устаревшего алиаса /api (преемник - /api/v1)
+func DeprecatedAPI() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		successor := "/api/v1" + strings.TrimPrefix(c.Request.URL.Path, "/api")
+		c.Header("Deprecation", "true")
+		c.Header("Link", "<"+successor+`>; rel="successor-version"`)
+		c.Next()
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"unitycn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === БЛОКИРОВКА И СКРЫТИЕ ПОЛЬЗОВАТЕЛЕЙ ===
+
+// relationResult - отношения с пользователем после изменения
+type relationResult struct {
+	Username string `json:"username"`
+	models.Relation
+}
+
+// interactablePost - пост, который пользователь может лайкать и комментировать:
+// 404, если поста нет или он в недоступном сообществе, 403, если между
+// пользователем и автором есть блокировка
+func interactablePost(c *gin.Context, repo *models.Repository, postID, userID int) (*models.Post, bool) {
+	post, err := repo.GetPost(postID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(c, http.StatusNotFound, ErrNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Ошибка получения поста: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return nil, false
+	}
+	if hiddenInCommunity(c, repo, post, userID) {
+		return nil, false
+	}
+
+	blocked, err := repo.IsBlockedBetween(userID, post.UserID)
+	if err != nil {
+		log.Printf("Ошибка проверки блокировки: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return nil, false
+	}
+	if blocked {
+		respondError(c, http.StatusForbidden, ErrUserBlocked)
+		return nil, false
+	}
+	return post, true
+}
+
+// visiblePost - пост, видимый зрителю: 404, если поста нет, он в недоступном
+// сообществе или между зрителем и автором есть блокировка
+func visiblePost(c *gin.Context, repo *models.Repository, postID, viewerID int) (*models.Post, bool) {
+	post, err := repo.GetPost(postID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(c, http.StatusNotFound, ErrNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Ошибка получения поста: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return nil, false
+	}
+	if blocked, err := repo.IsBlockedBetween(viewerID, post.UserID); err != nil || blocked {
+		respondError(c, http.StatusNotFound, ErrNotFound)
+		return nil, false
+	}
+	if hiddenInCommunity(c, repo, post, viewerID) {
+		return nil, false
+	}
+	return post, true
+}
+
+// relationTarget - пользователь :username для блокировки или скрытия; себя нельзя
+func relationTarget(c *gin.Context, repo *models.Repository, user *models.User) (*models.UserProfile, bool) {
+	target, ok := findProfile(c, repo)
+	if !ok {
+		return nil, false
+	}
+	if target.ID == user.ID {
+		respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"username"}})
+		return nil, false
+	}
+	return target, true
+}
+
+// changeRelation - общий обработчик блокировки, скрытия и их отмены
+func changeRelation(repo *models.Repository, action string, apply func(userID, targetID int) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		target, ok := relationTarget(c, repo, user)
+		if !ok {
+			return
+		}
+
+		if err := apply(user.ID, target.ID); err != nil {
+			log.Printf("Ошибка (%s %s): %v", action, target.Username, err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		rel, err := repo.GetRelation(user.ID, target.ID)
+		if err != nil {
+			log.Printf("Ошибка получения отношений: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, relationResult{Username: target.Username, Relation: rel})
+	}
+}
+
+// BlockUser - блокировка: заблокированный не комментирует и не лайкает посты,
+// посты и комментарии обоих скрыты друг от друга
+func BlockUser(repo *models.Repository) gin.HandlerFunc {
+	return changeRelation(repo, "блокировка", repo.BlockUser)
+}
+
+// UnblockUser - снятие блокировки
+func UnblockUser(repo *models.Repository) gin.HandlerFunc {
+	return changeRelation(repo, "снятие блокировки", repo.UnblockUser)
+}
+
+// MuteUser - скрыть посты пользователя из своей ленты
+func MuteUser(repo *models.Repository) gin.HandlerFunc {
+	return changeRelation(repo, "скрытие", repo.MuteUser)
+}
+
+// UnmuteUser - вернуть посты пользователя в ленту
+func UnmuteUser(repo *models.Repository) gin.HandlerFunc {
+	return changeRelation(repo, "отмена скрытия", repo.UnmuteUser)
+}
+
+// GetMyBlocks - заблокированные пользователи
+func GetMyBlocks(repo *models.Repository) gin.HandlerFunc {
+	return listRelated(repo, repo.GetBlockedUsers)
+}
+
+// GetMyMutes - скрытые пользователи
+func GetMyMutes(repo *models.Repository) gin.HandlerFunc {
+	return listRelated(repo, repo.GetMutedUsers)
+}
+
+func listRelated(repo *models.Repository, list func(userID int) ([]models.RelatedUser, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		users, err := list(user.ID)
+		if err != nil {
+			log.Printf("Ошибка получения списка пользователей: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, users)
+	}
+}
+
+// BlocksPage - управление блокировками и скрытыми пользователями
+func BlocksPage(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := repo.GetUserByUsername(c.GetString("username"))
+		if err != nil {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+
+		blocked, err := repo.GetBlockedUsers(user.ID)
+		if err != nil {
+			log.Printf("Ошибка получения блокировок: %v", err)
+		}
+		muted, err := repo.GetMutedUsers(user.ID)
+		if err != nil {
+			log.Printf("Ошибка получения скрытых пользователей: %v", err)
+		}
+
+		renderHTML(c, http.StatusOK, "account_blocks.html", gin.H{
+			"title":   "Блокировки и скрытие",
+			"user":    user,
+			"blocked": blocked,
+			"muted":   muted,
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unitycn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === ЗАКЛАДКИ ===
+
+const maxCollectionNameLen = 100
+
+// bookmarkRequest - подборка для закладки; тело можно не передавать
+type bookmarkRequest struct {
+	CollectionID int `json:"collection_id,omitempty" doc:"подборка; нет или 0 - без подборки"`
+}
+
+// bookmarkResult - состояние закладки после изменения
+type bookmarkResult struct {
+	PostID       int  `json:"post_id"`
+	Bookmarked   bool `json:"bookmarked"`
+	CollectionID *int `json:"collection_id" doc:"подборка; null - без подборки"`
+}
+
+// collectionRequest - название подборки
+type collectionRequest struct {
+	Name string `json:"name" doc:"1-100 символов"`
+}
+
+// collectionName - название подборки из тела запроса; иначе 400
+func collectionName(c *gin.Context) (string, bool) {
+	var req collectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+		return "", false
+	}
+	name := strings.TrimSpace(req.Name)
+	if !validCommunityText(name, maxCollectionNameLen, true) || strings.ContainsAny(name, "\r\n") {
+		respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"name"}})
+		return "", false
+	}
+	return name, true
+}
+
+// ownCollection - подборка пользователя с идентификатором id; чужая или отсутствующая - 404
+func ownCollection(c *gin.Context, repo *models.Repository, userID, id int) (*models.BookmarkCollection, bool) {
+	collection, err := repo.GetBookmarkCollection(userID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(c, http.StatusNotFound, ErrNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Ошибка получения подборки: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return nil, false
+	}
+	return collection, true
+}
+
+// collectionFilter - ?collection= для списка закладок; 0 - все подборки
+func collectionFilter(c *gin.Context, repo *models.Repository, userID int) (int, bool) {
+	raw := c.Query("collection")
+	if raw == "" {
+		return 0, true
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id < 1 {
+		respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"collection"}})
+		return 0, false
+	}
+	if _, ok := ownCollection(c, repo, userID, id); !ok {
+		return 0, false
+	}
+	return id, true
+}
+
+// GetMyBookmarks - закладки пользователя (?collection= - одна подборка), последние сверху.
+// Посты, которые больше не видны пользователю, не показываются.
+func GetMyBookmarks(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		collectionID, ok := collectionFilter(c, repo, user.ID)
+		if !ok {
+			return
+		}
+
+		page, perPage := pageParams(c)
+		bookmarks, err := repo.GetBookmarks(user.ID, collectionID, perPage, (page-1)*perPage)
+		if err != nil {
+			log.Printf("Ошибка получения закладок: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		total, err := repo.CountBookmarks(user.ID, collectionID)
+		if err != nil {
+			log.Printf("Ошибка подсчёта закладок: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		posts := make([]models.Post, len(bookmarks))
+		for i := range bookmarks {
+			posts[i] = bookmarks[i].Post
+		}
+		fillViewer(c, repo, posts)
+		for i := range bookmarks {
+			bookmarks[i].Post.Viewer = posts[i].Viewer
+		}
+		respondPage(c, bookmarks, page, perPage, total)
+	}
+}
+
+// BookmarkPost - добавить пост в закладки или переложить в другую подборку
+func BookmarkPost(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		postID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+
+		var req bookmarkRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+		if req.CollectionID < 0 {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"collection_id"}})
+			return
+		}
+		if _, ok := visiblePost(c, repo, postID, user.ID); !ok {
+			return
+		}
+		if req.CollectionID != 0 {
+			if _, ok := ownCollection(c, repo, user.ID, req.CollectionID); !ok {
+				return
+			}
+		}
+
+		if err := repo.BookmarkPost(user.ID, postID, req.CollectionID); err != nil {
+			log.Printf("Ошибка добавления закладки: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		result := bookmarkResult{PostID: postID, Bookmarked: true}
+		if req.CollectionID != 0 {
+			result.CollectionID = &req.CollectionID
+		}
+		respond(c, http.StatusOK, result)
+	}
+}
+
+// UnbookmarkPost - убрать пост из закладок; повторное удаление ничего не меняет
+func UnbookmarkPost(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		postID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+
+		if err := repo.UnbookmarkPost(user.ID, postID); err != nil {
+			log.Printf("Ошибка удаления закладки: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, bookmarkResult{PostID: postID})
+	}
+}
+
+// GetBookmarkCollections - подборки закладок пользователя
+func GetBookmarkCollections(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		collections, err := repo.GetBookmarkCollections(user.ID)
+		if err != nil {
+			log.Printf("Ошибка получения подборок: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, collections)
+	}
+}
+
+// CreateBookmarkCollection - новая подборка
+func CreateBookmarkCollection(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		name, ok := collectionName(c)
+		if !ok {
+			return
+		}
+
+		id, err := repo.CreateBookmarkCollection(user.ID, name)
+		if errors.Is(err, models.ErrCollectionExists) {
+			respondError(c, http.StatusConflict, ErrCollectionExists)
+			return
+		}
+		if err != nil {
+			log.Printf("Ошибка создания подборки: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		collection, ok := ownCollection(c, repo, user.ID, id)
+		if !ok {
+			return
+		}
+		respond(c, http.StatusCreated, collection)
+	}
+}
+
+// RenameBookmarkCollection - новое название подборки
+func RenameBookmarkCollection(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		id, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+		collection, ok := ownCollection(c, repo, user.ID, id)
+		if !ok {
+			return
+		}
+		name, ok := collectionName(c)
+		if !ok {
+			return
+		}
+
+		err := repo.RenameBookmarkCollection(user.ID, id, name)
+		if errors.Is(err, models.ErrCollectionExists) {
+			respondError(c, http.StatusConflict, ErrCollectionExists)
+			return
+		}
+		if err != nil {
+			log.Printf("Ошибка изменения подборки: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		collection.Name = name
+		respond(c, http.StatusOK, collection)
+	}
+}
+
+// DeleteBookmarkCollection - удалить подборку; её закладки остаются без подборки
+func DeleteBookmarkCollection(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		id, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+		if _, ok := ownCollection(c, repo, user.ID, id); !ok {
+			return
+		}
+
+		if err := repo.DeleteBookmarkCollection(user.ID, id); err != nil {
+			log.Printf("Ошибка удаления подборки: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, gin.H{"id": id, "deleted": true})
+	}
+}
+
+// BookmarksPage - закладки и подборки пользователя
+func BookmarksPage(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := repo.GetUserByUsername(c.GetString("username"))
+		if err != nil {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+
+		collections, err := repo.GetBookmarkCollections(user.ID)
+		if err != nil {
+			log.Printf("Ошибка получения подборок: %v", err)
+		}
+		var current *models.BookmarkCollection
+		if id, err := strconv.Atoi(c.Query("collection")); err == nil {
+			for i := range collections {
+				if collections[i].ID == id {
+					current = &collections[i]
+				}
+			}
+		}
+		collectionID := 0
+		if current != nil {
+			collectionID = current.ID
+		}
+
+		page, perPage := pageParams(c)
+		bookmarks, err := repo.GetBookmarks(user.ID, collectionID, perPage, (page-1)*perPage)
+		if err != nil {
+			log.Printf("Ошибка получения закладок: %v", err)
+		}
+		total, err := repo.CountBookmarks(user.ID, collectionID)
+		if err != nil {
+			log.Printf("Ошибка подсчёта закладок: %v", err)
+		}
+
+		prevPage, nextPage := 0, 0
+		if page > 1 {
+			prevPage = page - 1
+		}
+		if page*perPage < total {
+			nextPage = page + 1
+		}
+
+		renderHTML(c, http.StatusOK, "account_bookmarks.html", gin.H{
+			"title":       "Закладки",
+			"user":        user,
+			"collections": collections,
+			"current":     current,
+			"bookmarks":   bookmarks,
+			"total":       total,
+			"prevPage":    prevPage,
+			"nextPage":    nextPage,
+		})
+	}
+}
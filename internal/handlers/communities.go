@@ -0,0 +1,737 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"unitycn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === СООБЩЕСТВА ===
+
+const (
+	minCommunitySlugLen        = 3
+	maxCommunitySlugLen        = 50
+	maxCommunityNameLen        = 100
+	maxCommunityDescriptionLen = 1000
+)
+
+// communityRequest - новое сообщество
+type communityRequest struct {
+	Slug        string `json:"slug" doc:"адрес: 3-50 строчных латинских букв, цифр и дефисов"`
+	Name        string `json:"name" doc:"1-100 символов"`
+	Description string `json:"description,omitempty" doc:"до 1000 символов"`
+	Visibility  string `json:"visibility,omitempty" doc:"public (по умолчанию), private или invite"`
+}
+
+// communityUpdateRequest - изменение сообщества; отсутствующие поля не меняются
+type communityUpdateRequest struct {
+	Name        *string `json:"name,omitempty" doc:"1-100 символов"`
+	Description *string `json:"description,omitempty" doc:"до 1000 символов"`
+	Visibility  *string `json:"visibility,omitempty" doc:"public, private или invite"`
+}
+
+// membershipResult - участие пользователя после изменения; membership нет - не состоит
+type membershipResult struct {
+	Username   string                      `json:"username"`
+	Membership *models.CommunityMembership `json:"membership,omitempty"`
+}
+
+// validCommunitySlug - адрес из строчных латинских букв, цифр и дефисов, без дефиса по краям
+func validCommunitySlug(slug string) bool {
+	if len(slug) < minCommunitySlugLen || len(slug) > maxCommunitySlugLen {
+		return false
+	}
+	for i, r := range slug {
+		alnum := (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
+		if (i == 0 || i == len(slug)-1) && !alnum {
+			return false
+		}
+		if !alnum && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// validCommunityText - непустой (если required) текст не длиннее max без управляющих символов,
+// кроме переводов строк
+func validCommunityText(text string, max int, required bool) bool {
+	if (required && text == "") || utf8.RuneCountInString(text) > max {
+		return false
+	}
+	return strings.IndexFunc(text, func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n' && r != '\r'
+	}) < 0
+}
+
+// findCommunity - сообщество :slug глазами зрителя. Чужие сообщества по
+// приглашениям не раскрываются: 404, как и для несуществующих.
+func findCommunity(c *gin.Context, repo *models.Repository, viewerID int) (*models.Community, bool) {
+	community, err := repo.GetCommunity(c.Param("slug"), viewerID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !community.Listed()) {
+		respondError(c, http.StatusNotFound, ErrNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Ошибка получения сообщества: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return nil, false
+	}
+	return community, true
+}
+
+// canModerate - владелец и модераторы сообщества, а также администраторы сайта
+func canModerate(user *models.User, community *models.Community) bool {
+	return community.Membership.CanModerate() || user.Role == "admin"
+}
+
+// moderatedCommunity - сообщество :slug, которым пользователь может управлять
+func moderatedCommunity(c *gin.Context, repo *models.Repository, user *models.User) (*models.Community, bool) {
+	community, ok := findCommunity(c, repo, user.ID)
+	if !ok {
+		return nil, false
+	}
+	if !canModerate(user, community) {
+		respondError(c, http.StatusForbidden, ErrForbidden)
+		return nil, false
+	}
+	return community, true
+}
+
+// ownedCommunity - сообщество :slug, владельцем которого является пользователь
+func ownedCommunity(c *gin.Context, repo *models.Repository, user *models.User) (*models.Community, bool) {
+	community, ok := findCommunity(c, repo, user.ID)
+	if !ok {
+		return nil, false
+	}
+	if !community.Membership.IsOwner() {
+		respondError(c, http.StatusForbidden, ErrForbidden)
+		return nil, false
+	}
+	return community, true
+}
+
+// hiddenInCommunity - пост из сообщества, посты которого зрителю не видны:
+// отвечает 404 и возвращает true
+func hiddenInCommunity(c *gin.Context, repo *models.Repository, post *models.Post, viewerID int) bool {
+	if post.Community == nil {
+		return false
+	}
+	readable, err := repo.CommunityReadable(post.Community.ID, viewerID)
+	if err != nil {
+		log.Printf("Ошибка проверки доступа к сообществу: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return true
+	}
+	if !readable {
+		respondError(c, http.StatusNotFound, ErrNotFound)
+		return true
+	}
+	return false
+}
+
+// postCommunity - сообщество для нового поста: автор должен в нём состоять
+func postCommunity(c *gin.Context, repo *models.Repository, slug string, userID int) (*models.CommunityRef, bool) {
+	community, err := repo.GetCommunity(slug, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !community.Listed()) {
+		respondError(c, http.StatusNotFound, ErrNotFound, gin.H{"fields": []string{"community"}})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Ошибка получения сообщества: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return nil, false
+	}
+	if !community.Membership.Active() {
+		respondError(c, http.StatusForbidden, ErrNotCommunityMember)
+		return nil, false
+	}
+	return &models.CommunityRef{ID: community.ID, Slug: community.Slug, Name: community.Name}, true
+}
+
+// communityTarget - участник :username и его участие в сообществе
+func communityTarget(c *gin.Context, repo *models.Repository, community *models.Community) (*models.UserProfile, *models.CommunityMembership, bool) {
+	target, ok := findProfile(c, repo)
+	if !ok {
+		return nil, nil, false
+	}
+	view, err := repo.GetCommunity(community.Slug, target.ID)
+	if err != nil {
+		log.Printf("Ошибка получения участия в сообществе: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return nil, nil, false
+	}
+	return target, view.Membership, true
+}
+
+// CreateCommunity - новое сообщество; создатель - владелец
+func CreateCommunity(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		var req communityRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+		req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+		req.Name = strings.TrimSpace(req.Name)
+		req.Description = strings.TrimSpace(req.Description)
+		if req.Visibility == "" {
+			req.Visibility = models.CommunityPublic
+		}
+
+		var invalid []string
+		if !validCommunitySlug(req.Slug) {
+			invalid = append(invalid, "slug")
+		}
+		if !validCommunityText(req.Name, maxCommunityNameLen, true) {
+			invalid = append(invalid, "name")
+		}
+		if !validCommunityText(req.Description, maxCommunityDescriptionLen, false) {
+			invalid = append(invalid, "description")
+		}
+		if !models.ValidCommunityVisibility(req.Visibility) {
+			invalid = append(invalid, "visibility")
+		}
+		if len(invalid) > 0 {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": invalid})
+			return
+		}
+
+		_, err := repo.CreateCommunity(user.ID, req.Slug, req.Name, req.Description, req.Visibility)
+		if errors.Is(err, models.ErrCommunityExists) {
+			respondError(c, http.StatusConflict, ErrCommunityExists)
+			return
+		}
+		if err != nil {
+			log.Printf("Ошибка создания сообщества: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		community, err := repo.GetCommunity(req.Slug, user.ID)
+		if err != nil {
+			log.Printf("Ошибка получения сообщества: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusCreated, community)
+	}
+}
+
+// GetCommunities - сообщества, новые сверху; чужие по приглашениям не показываются
+func GetCommunities(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, perPage := pageParams(c)
+		viewerID := c.GetInt("user_id")
+
+		communities, err := repo.GetCommunities(viewerID, perPage, (page-1)*perPage)
+		if err != nil {
+			log.Printf("Ошибка получения сообществ: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		total, err := repo.CountCommunities(viewerID)
+		if err != nil {
+			log.Printf("Ошибка подсчёта сообществ: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respondPage(c, communities, page, perPage, total)
+	}
+}
+
+// GetMyCommunities - сообщества пользователя, заявки и приглашения
+func GetMyCommunities(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		communities, err := repo.GetUserCommunities(user.ID)
+		if err != nil {
+			log.Printf("Ошибка получения сообществ: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, communities)
+	}
+}
+
+// GetCommunity - сообщество с участием зрителя
+func GetCommunity(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		community, ok := findCommunity(c, repo, c.GetInt("user_id"))
+		if !ok {
+			return
+		}
+		respond(c, http.StatusOK, community)
+	}
+}
+
+// UpdateCommunity - название, описание и режим; только владелец
+func UpdateCommunity(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		community, ok := ownedCommunity(c, repo, user)
+		if !ok {
+			return
+		}
+
+		var req communityUpdateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+
+		var invalid []string
+		if req.Name != nil {
+			community.Name = strings.TrimSpace(*req.Name)
+			if !validCommunityText(community.Name, maxCommunityNameLen, true) {
+				invalid = append(invalid, "name")
+			}
+		}
+		if req.Description != nil {
+			community.Description = strings.TrimSpace(*req.Description)
+			if !validCommunityText(community.Description, maxCommunityDescriptionLen, false) {
+				invalid = append(invalid, "description")
+			}
+		}
+		if req.Visibility != nil {
+			community.Visibility = *req.Visibility
+			if !models.ValidCommunityVisibility(community.Visibility) {
+				invalid = append(invalid, "visibility")
+			}
+		}
+		if len(invalid) > 0 {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": invalid})
+			return
+		}
+
+		if err := repo.UpdateCommunity(community.ID, community.Name, community.Description, community.Visibility); err != nil {
+			log.Printf("Ошибка изменения сообщества: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, community)
+	}
+}
+
+// GetCommunityPosts - лента сообщества; закрытых - только участникам
+func GetCommunityPosts(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		viewerID := c.GetInt("user_id")
+		community, ok := findCommunity(c, repo, viewerID)
+		if !ok {
+			return
+		}
+		if !community.Readable() {
+			respondError(c, http.StatusForbidden, ErrNotCommunityMember)
+			return
+		}
+
+		page, perPage := pageParams(c)
+		filter := models.PostFilter{ViewerID: viewerID, CommunityID: community.ID, HideMuted: true}
+		posts, err := repo.GetPostsWithUsers(filter, perPage, (page-1)*perPage)
+		if err != nil {
+			log.Printf("Ошибка получения постов сообщества: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		total, err := repo.CountPosts(filter)
+		if err != nil {
+			log.Printf("Ошибка подсчёта постов: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if posts == nil {
+			posts = []models.Post{}
+		}
+		fillViewer(c, repo, posts)
+		respondPage(c, posts, page, perPage, total)
+	}
+}
+
+// JoinCommunity - вступление: в открытое сразу, в закрытое - заявка,
+// в сообщество по приглашениям - принятие приглашения
+func JoinCommunity(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		community, ok := findCommunity(c, repo, user.ID)
+		if !ok {
+			return
+		}
+
+		status := ""
+		switch {
+		case community.Membership.Active():
+		case community.Visibility == models.CommunityPublic,
+			community.Membership != nil && community.Membership.Status == models.MemberInvited:
+			status = models.MemberActive
+		case community.Visibility == models.CommunityPrivate:
+			status = models.MemberRequested
+		default:
+			respondError(c, http.StatusForbidden, ErrNotCommunityMember)
+			return
+		}
+
+		if status != "" {
+			if err := repo.SetCommunityMembership(community.ID, user.ID, status); err != nil {
+				log.Printf("Ошибка вступления в сообщество %s: %v", community.Slug, err)
+				respondError(c, http.StatusInternalServerError, ErrInternal)
+				return
+			}
+			community.Membership = &models.CommunityMembership{Role: models.CommunityRoleMember, Status: status}
+		}
+		respond(c, http.StatusOK, membershipResult{Username: user.Username, Membership: community.Membership})
+	}
+}
+
+// LeaveCommunity - выход, отзыв заявки или отказ от приглашения.
+// Владелец выйти не может.
+func LeaveCommunity(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		community, ok := findCommunity(c, repo, user.ID)
+		if !ok {
+			return
+		}
+		if community.Membership.IsOwner() {
+			respondError(c, http.StatusConflict, ErrCommunityOwner)
+			return
+		}
+
+		err := repo.RemoveCommunityMember(community.ID, user.ID)
+		if err != nil && !errors.Is(err, models.ErrNotFound) {
+			log.Printf("Ошибка выхода из сообщества %s: %v", community.Slug, err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, membershipResult{Username: user.Username})
+	}
+}
+
+// GetCommunityMembers - участники; заявки (?status=requested) и приглашения
+// (?status=invited) видят только модераторы
+func GetCommunityMembers(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		community, ok := findCommunity(c, repo, c.GetInt("user_id"))
+		if !ok {
+			return
+		}
+
+		status := c.DefaultQuery("status", models.MemberActive)
+		switch status {
+		case models.MemberActive:
+			if !community.Readable() {
+				respondError(c, http.StatusForbidden, ErrNotCommunityMember)
+				return
+			}
+		case models.MemberRequested, models.MemberInvited:
+			user, ok := currentUser(c, repo)
+			if !ok {
+				return
+			}
+			if !canModerate(user, community) {
+				respondError(c, http.StatusForbidden, ErrForbidden)
+				return
+			}
+		default:
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"status"}})
+			return
+		}
+
+		page, perPage := pageParams(c)
+		members, err := repo.GetCommunityMembers(community.ID, status, perPage, (page-1)*perPage)
+		if err != nil {
+			log.Printf("Ошибка получения участников сообщества: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		total, err := repo.CountCommunityMembers(community.ID, status)
+		if err != nil {
+			log.Printf("Ошибка подсчёта участников сообщества: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respondPage(c, members, page, perPage, total)
+	}
+}
+
+// AddCommunityMember - модератор одобряет заявку или приглашает пользователя
+func AddCommunityMember(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		community, ok := moderatedCommunity(c, repo, user)
+		if !ok {
+			return
+		}
+		target, membership, ok := communityTarget(c, repo, community)
+		if !ok {
+			return
+		}
+
+		status := ""
+		switch {
+		case membership == nil:
+			blocked, err := repo.IsBlockedBetween(user.ID, target.ID)
+			if err != nil {
+				log.Printf("Ошибка проверки блокировки: %v", err)
+				respondError(c, http.StatusInternalServerError, ErrInternal)
+				return
+			}
+			if blocked {
+				respondError(c, http.StatusForbidden, ErrUserBlocked)
+				return
+			}
+			status = models.MemberInvited
+		case membership.Status == models.MemberRequested:
+			status = models.MemberActive
+		}
+
+		if status != "" {
+			if err := repo.SetCommunityMembership(community.ID, target.ID, status); err != nil {
+				log.Printf("Ошибка добавления в сообщество %s: %v", community.Slug, err)
+				respondError(c, http.StatusInternalServerError, ErrInternal)
+				return
+			}
+			membership = &models.CommunityMembership{Role: models.CommunityRoleMember, Status: status}
+		}
+		respond(c, http.StatusOK, membershipResult{Username: target.Username, Membership: membership})
+	}
+}
+
+// RemoveCommunityMember - исключение, отклонение заявки или отзыв приглашения.
+// Модераторов исключает только владелец, владельца - никто.
+func RemoveCommunityMember(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		community, ok := moderatedCommunity(c, repo, user)
+		if !ok {
+			return
+		}
+		target, membership, ok := communityTarget(c, repo, community)
+		if !ok {
+			return
+		}
+		if membership == nil {
+			respondError(c, http.StatusNotFound, ErrNotFound)
+			return
+		}
+		if membership.IsOwner() || (membership.CanModerate() && !community.Membership.IsOwner()) {
+			respondError(c, http.StatusForbidden, ErrForbidden)
+			return
+		}
+
+		if err := repo.RemoveCommunityMember(community.ID, target.ID); err != nil && !errors.Is(err, models.ErrNotFound) {
+			log.Printf("Ошибка исключения из сообщества %s: %v", community.Slug, err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, membershipResult{Username: target.Username})
+	}
+}
+
+// AddCommunityModerator - назначение модератора из участников; только владелец
+func AddCommunityModerator(repo *models.Repository) gin.HandlerFunc {
+	return setCommunityRole(repo, models.CommunityRoleModerator)
+}
+
+// RemoveCommunityModerator - снятие модератора; только владелец
+func RemoveCommunityModerator(repo *models.Repository) gin.HandlerFunc {
+	return setCommunityRole(repo, models.CommunityRoleMember)
+}
+
+func setCommunityRole(repo *models.Repository, role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		community, ok := ownedCommunity(c, repo, user)
+		if !ok {
+			return
+		}
+		target, ok := findProfile(c, repo)
+		if !ok {
+			return
+		}
+
+		err := repo.SetCommunityRole(community.ID, target.ID, role)
+		if errors.Is(err, models.ErrNotFound) {
+			// Не участник или сам владелец
+			respondError(c, http.StatusNotFound, ErrNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Ошибка назначения роли в сообществе %s: %v", community.Slug, err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, membershipResult{
+			Username:   target.Username,
+			Membership: &models.CommunityMembership{Role: role, Status: models.MemberActive},
+		})
+	}
+}
+
+// DeleteCommunityPost - удаление поста модератором сообщества
+func DeleteCommunityPost(repo *models.Repository) gin.HandlerFunc {
+	return deleteInCommunity(repo, "поста", repo.DeleteCommunityPost)
+}
+
+// DeleteCommunityComment - удаление комментария к посту сообщества модератором
+func DeleteCommunityComment(repo *models.Repository) gin.HandlerFunc {
+	return deleteInCommunity(repo, "комментария", repo.DeleteCommunityComment)
+}
+
+func deleteInCommunity(repo *models.Repository, what string, remove func(communityID, id int) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		community, ok := moderatedCommunity(c, repo, user)
+		if !ok {
+			return
+		}
+		id, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+
+		err := remove(community.ID, id)
+		if errors.Is(err, models.ErrNotFound) {
+			respondError(c, http.StatusNotFound, ErrNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Ошибка удаления %s в сообществе %s: %v", what, community.Slug, err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, gin.H{"id": id, "deleted": true})
+	}
+}
+
+// CommunitiesPage - список сообществ и создание нового
+func CommunitiesPage(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		viewer, _ := c.Get("user")
+		viewerID := c.GetInt("user_id")
+		page, perPage := pageParams(c)
+
+		communities, err := repo.GetCommunities(viewerID, perPage, (page-1)*perPage)
+		if err != nil {
+			log.Printf("Ошибка получения сообществ: %v", err)
+		}
+		total, err := repo.CountCommunities(viewerID)
+		if err != nil {
+			log.Printf("Ошибка подсчёта сообществ: %v", err)
+		}
+		var mine []models.Community
+		if viewerID != 0 {
+			if mine, err = repo.GetUserCommunities(viewerID); err != nil {
+				log.Printf("Ошибка получения сообществ пользователя: %v", err)
+			}
+		}
+
+		renderHTML(c, http.StatusOK, "communities.html", gin.H{
+			"title":       "Сообщества",
+			"communities": communities,
+			"mine":        mine,
+			"page":        page,
+			"prevPage":    page - 1,
+			"nextPage":    page + 1,
+			"hasMore":     page*perPage < total,
+			"user":        viewer,
+		})
+	}
+}
+
+// CommunityPage - страница сообщества: описание, участие и лента
+func CommunityPage(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		viewer, _ := c.Get("user")
+		viewerID := c.GetInt("user_id")
+
+		community, err := repo.GetCommunity(c.Param("slug"), viewerID)
+		if err != nil || !community.Listed() {
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Ошибка получения сообщества: %v", err)
+			}
+			renderHTML(c, http.StatusNotFound, "community.html", gin.H{
+				"title": "Сообщество",
+				"error": message(c, ErrNotFound),
+				"user":  viewer,
+			})
+			return
+		}
+
+		moderator := false
+		if u, ok := viewer.(*models.User); ok {
+			moderator = canModerate(u, community)
+		}
+
+		page, perPage := pageParams(c)
+		var posts []models.Post
+		total := 0
+		if community.Readable() {
+			filter := models.PostFilter{ViewerID: viewerID, CommunityID: community.ID, HideMuted: true}
+			if posts, err = repo.GetPostsWithUsers(filter, perPage, (page-1)*perPage); err != nil {
+				log.Printf("Ошибка получения постов сообщества: %v", err)
+			}
+			if total, err = repo.CountPosts(filter); err != nil {
+				log.Printf("Ошибка подсчёта постов: %v", err)
+			}
+		}
+
+		var requests []models.CommunityMember
+		if moderator {
+			if requests, err = repo.GetCommunityMembers(community.ID, models.MemberRequested, 50, 0); err != nil {
+				log.Printf("Ошибка получения заявок: %v", err)
+			}
+		}
+
+		renderHTML(c, http.StatusOK, "community.html", gin.H{
+			"title":     community.Name,
+			"community": community,
+			"posts":     posts,
+			"requests":  requests,
+			"moderator": moderator,
+			"page":      page,
+			"prevPage":  page - 1,
+			"nextPage":  page + 1,
+			"hasMore":   page*perPage < total,
+			"user":      viewer,
+		})
+	}
+}
@@ -0,0 +1,466 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"unitycn/internal/models"
+	"unitycn/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === ЛИЧНЫЕ СООБЩЕНИЯ ===
+
+const (
+	maxGroupMembers         = 10 // вместе с создателем
+	maxConversationTitleLen = 100
+	maxMessageLen           = 1000
+	// eventsHeartbeat - комментарий в потоке событий, чтобы прокси не закрыли соединение
+	eventsHeartbeat = 25 * time.Second
+)
+
+// Типы событий потока /me/events
+const (
+	EventUnread       = "unread"
+	EventMessage      = "message"
+	EventConversation = "conversation"
+	EventRead         = "read"
+)
+
+// conversationRequest - новый диалог или группа
+type conversationRequest struct {
+	Usernames []string `json:"usernames" doc:"один собеседник - личный диалог (существующий вернётся), больше - группа до 10 человек"`
+	Title     string   `json:"title,omitempty" doc:"название группы, до 100 символов"`
+}
+
+// messageRequest - текст сообщения
+type messageRequest struct {
+	Content string `json:"content" doc:"1-1000 символов"`
+}
+
+// unreadResult - непрочитанные сообщения
+type unreadResult struct {
+	Messages      int `json:"messages"`
+	Conversations int `json:"conversations" doc:"диалоги с непрочитанными сообщениями"`
+}
+
+// conversationEvent - диалог, в котором что-то изменилось
+type conversationEvent struct {
+	ConversationID int `json:"conversation_id"`
+}
+
+// validMessage - непустой текст без управляющих символов, кроме переводов строк и табуляции
+func validMessage(content string) bool {
+	if strings.TrimSpace(content) == "" || utf8.RuneCountInString(content) > maxMessageLen {
+		return false
+	}
+	return strings.IndexFunc(content, func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n' && r != '\t' && r != '\r'
+	}) < 0
+}
+
+// publish - событие пользователям с открытым потоком; ошибка доставки не мешает ответу
+func publish(broker realtime.Broker, userIDs []int, typ string, data interface{}) {
+	if len(userIDs) == 0 {
+		return
+	}
+	event, err := realtime.NewEvent(typ, data)
+	if err == nil {
+		err = broker.Publish(userIDs, event)
+	}
+	if err != nil {
+		log.Printf("Ошибка доставки события %s: %v", typ, err)
+	}
+}
+
+// findConversation - диалог :id, если пользователь в нём участвует; false - ответ уже отправлен
+func findConversation(c *gin.Context, repo *models.Repository, user *models.User) (*models.Conversation, bool) {
+	conversationID, ok := paramID(c, "id")
+	if !ok {
+		return nil, false
+	}
+	conversation, err := repo.GetConversation(conversationID, user.ID)
+	if errors.Is(err, models.ErrNotFound) {
+		respondError(c, http.StatusNotFound, ErrNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Ошибка получения диалога: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return nil, false
+	}
+	return conversation, true
+}
+
+// conversationMembers - участники нового диалога без создателя и повторов.
+// 404 - пользователя нет, 403 - с ним блокировка.
+func conversationMembers(c *gin.Context, repo *models.Repository, user *models.User, usernames []string) ([]int, bool) {
+	seen := make(map[string]bool)
+	var ids []int
+	for _, username := range usernames {
+		username = strings.TrimSpace(username)
+		if username == "" || seen[username] || username == user.Username {
+			continue
+		}
+		seen[username] = true
+
+		member, err := repo.GetUserProfile(username)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(c, http.StatusNotFound, ErrNotFound, gin.H{"username": username})
+			return nil, false
+		}
+		if err != nil {
+			log.Printf("Ошибка получения профиля: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return nil, false
+		}
+		blocked, err := repo.IsBlockedBetween(user.ID, member.ID)
+		if err != nil {
+			log.Printf("Ошибка проверки блокировки: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return nil, false
+		}
+		if blocked {
+			respondError(c, http.StatusForbidden, ErrUserBlocked, gin.H{"username": username})
+			return nil, false
+		}
+		ids = append(ids, member.ID)
+	}
+	return ids, true
+}
+
+// CreateConversation - личный диалог или группа
+func CreateConversation(repo *models.Repository, broker realtime.Broker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		var req conversationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+		req.Title = strings.TrimSpace(req.Title)
+		if req.Title != "" && !validTitle(req.Title) {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"title"}})
+			return
+		}
+
+		memberIDs, ok := conversationMembers(c, repo, user, req.Usernames)
+		if !ok {
+			return
+		}
+		if len(memberIDs) == 0 || len(memberIDs) >= maxGroupMembers {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"usernames"}})
+			return
+		}
+
+		var conversationID int
+		var created bool
+		var err error
+		if len(memberIDs) == 1 && req.Title == "" {
+			conversationID, created, err = repo.GetOrCreateDirectConversation(user.ID, memberIDs[0])
+		} else {
+			conversationID, err = repo.CreateGroupConversation(user.ID, memberIDs, req.Title)
+			created = true
+		}
+		if err != nil {
+			log.Printf("Ошибка создания диалога: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		conversation, err := repo.GetConversation(conversationID, user.ID)
+		if err != nil {
+			log.Printf("Ошибка получения диалога: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+			publish(broker, memberIDs, EventConversation, conversationEvent{ConversationID: conversationID})
+		}
+		respond(c, status, conversation)
+	}
+}
+
+// validTitle - название группы без управляющих символов
+func validTitle(title string) bool {
+	return utf8.RuneCountInString(title) <= maxConversationTitleLen &&
+		strings.IndexFunc(title, unicode.IsControl) < 0
+}
+
+// GetConversations - диалоги пользователя с последним сообщением и непрочитанными
+func GetConversations(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		page, perPage := pageParams(c)
+		conversations, err := repo.GetConversations(user.ID, perPage, (page-1)*perPage)
+		if err != nil {
+			log.Printf("Ошибка получения диалогов: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		total, err := repo.CountConversations(user.ID)
+		if err != nil {
+			log.Printf("Ошибка подсчёта диалогов: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respondPage(c, conversations, page, perPage, total)
+	}
+}
+
+// GetConversation - один диалог
+func GetConversation(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		conversation, ok := findConversation(c, repo, user)
+		if !ok {
+			return
+		}
+		respond(c, http.StatusOK, conversation)
+	}
+}
+
+// DeleteConversation - удаление диалога для себя: у остальных участников он остаётся
+func DeleteConversation(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		conversation, ok := findConversation(c, repo, user)
+		if !ok {
+			return
+		}
+
+		if err := repo.ClearConversation(conversation.ID, user.ID); err != nil {
+			log.Printf("Ошибка удаления диалога: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, gin.H{"id": conversation.ID, "deleted": true})
+	}
+}
+
+// GetMessages - сообщения диалога, новые сверху
+func GetMessages(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		conversation, ok := findConversation(c, repo, user)
+		if !ok {
+			return
+		}
+
+		page, perPage := pageParams(c)
+		messages, err := repo.GetMessages(conversation.ID, user.ID, perPage, (page-1)*perPage)
+		if err != nil {
+			log.Printf("Ошибка получения сообщений: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		total, err := repo.CountMessages(conversation.ID, user.ID)
+		if err != nil {
+			log.Printf("Ошибка подсчёта сообщений: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respondPage(c, messages, page, perPage, total)
+	}
+}
+
+// SendMessage - сообщение в диалог. В личный диалог нельзя писать при
+// блокировке; в группе сообщение не видят те, у кого блокировка с автором.
+func SendMessage(repo *models.Repository, broker realtime.Broker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		conversation, ok := findConversation(c, repo, user)
+		if !ok {
+			return
+		}
+
+		var req messageRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+		if !validMessage(req.Content) {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"content"}})
+			return
+		}
+
+		if !conversation.IsGroup {
+			for _, member := range conversation.Members {
+				if member.ID == user.ID {
+					continue
+				}
+				blocked, err := repo.IsBlockedBetween(user.ID, member.ID)
+				if err != nil {
+					log.Printf("Ошибка проверки блокировки: %v", err)
+					respondError(c, http.StatusInternalServerError, ErrInternal)
+					return
+				}
+				if blocked {
+					respondError(c, http.StatusForbidden, ErrUserBlocked)
+					return
+				}
+			}
+		}
+
+		msg, recipients, err := repo.SendMessage(conversation.ID, user.ID, req.Content)
+		if err != nil {
+			log.Printf("Ошибка отправки сообщения: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		msg.User = user
+
+		// Отправителю - для других его вкладок
+		publish(broker, append(recipients, user.ID), EventMessage, msg)
+		respond(c, http.StatusCreated, msg)
+	}
+}
+
+// MarkConversationRead - диалог прочитан; в ответе - оставшиеся непрочитанные
+func MarkConversationRead(repo *models.Repository, broker realtime.Broker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		conversation, ok := findConversation(c, repo, user)
+		if !ok {
+			return
+		}
+
+		if err := repo.MarkConversationRead(conversation.ID, user.ID); err != nil {
+			log.Printf("Ошибка отметки прочтения: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		publish(broker, []int{user.ID}, EventRead, conversationEvent{ConversationID: conversation.ID})
+
+		respondUnread(c, repo, user)
+	}
+}
+
+// GetUnreadMessages - количество непрочитанных сообщений
+func GetUnreadMessages(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		respondUnread(c, repo, user)
+	}
+}
+
+func respondUnread(c *gin.Context, repo *models.Repository, user *models.User) {
+	messages, conversations, err := repo.UnreadMessages(user.ID)
+	if err != nil {
+		log.Printf("Ошибка подсчёта непрочитанных: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+	respond(c, http.StatusOK, unreadResult{Messages: messages, Conversations: conversations})
+}
+
+// StreamEvents - поток событий (text/event-stream): сначала unread, затем
+// message, conversation и read по мере появления. Пропущенное при обрыве
+// клиент дочитывает обычными запросами.
+func StreamEvents(repo *models.Repository, broker realtime.Broker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		sub := broker.Subscribe(user.ID)
+		defer sub.Close()
+
+		var unread unreadResult
+		var err error
+		unread.Messages, unread.Conversations, err = repo.UnreadMessages(user.ID)
+		if err != nil {
+			log.Printf("Ошибка подсчёта непрочитанных: %v", err)
+		}
+		initial, err := realtime.NewEvent(EventUnread, unread)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		// nginx не должен буферизовать поток
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		writeEvent(c, initial)
+
+		heartbeat := time.NewTicker(eventsHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case event, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				writeEvent(c, event)
+			case <-heartbeat.C:
+				fmt.Fprint(c.Writer, ": ping\n\n")
+				c.Writer.Flush()
+			}
+		}
+	}
+}
+
+func writeEvent(c *gin.Context, event realtime.Event) {
+	fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Type, event.Data)
+	c.Writer.Flush()
+}
+
+// MessagesPage - диалоги и переписка
+func MessagesPage(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := repo.GetUserByUsername(c.GetString("username"))
+		if err != nil {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+
+		renderHTML(c, http.StatusOK, "messages.html", gin.H{
+			"title":         "Сообщения",
+			"user":          user,
+			"maxMessageLen": maxMessageLen,
+			"maxMembers":    maxGroupMembers - 1,
+		})
+	}
+}
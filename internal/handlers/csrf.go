@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === CSRF И АТРИБУТЫ КУК ===
+
+const (
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+	csrfField  = "csrf_token"
+	// csrfCookieTTL - токен живёт дольше сессии, чтобы открытые вкладки не ломались
+	csrfCookieTTL = 30 * 24 * 3600
+
+	csrfContextKey         = "csrf_token"
+	cookieSecureContextKey = "cookie_secure"
+)
+
+// CookieOptions - атрибуты кук сессии, CSRF и OIDC (секция server.cookies)
+type CookieOptions struct {
+	// Secure - куки только по HTTPS
+	Secure bool `yaml:"secure"`
+	// SameSite - lax (по умолчанию), strict или none (только вместе с secure)
+	SameSite string `yaml:"same_site"`
+}
+
+// Validate - проверка same_site
+func (o CookieOptions) Validate() error {
+	switch strings.ToLower(o.SameSite) {
+	case "", "lax", "strict":
+		return nil
+	case "none":
+		if !o.Secure {
+			return fmt.Errorf("same_site: none требует secure: true")
+		}
+		return nil
+	}
+	return fmt.Errorf("неизвестное значение same_site %q (lax, strict, none)", o.SameSite)
+}
+
+func (o CookieOptions) sameSite() http.SameSite {
+	switch strings.ToLower(o.SameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
+
+// setCookie - HttpOnly кука с атрибутами из CookieOptions текущего запроса
+func setCookie(c *gin.Context, name, value string, maxAge int, path string) {
+	c.SetCookie(name, value, maxAge, path, "", c.GetBool(cookieSecureContextKey), true)
+}
+
+// safeMethod - метод без побочных эффектов
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// csrfRequired - изменяющий запрос, авторизованный кукой браузера.
+// Заголовок Authorization чужая страница подставить не может, поэтому
+// клиенты с Bearer-токеном не проверяются. Веб-формы проверяются и без
+// сессии (подмена входа).
+func csrfRequired(c *gin.Context) bool {
+	if safeMethod(c.Request.Method) || c.GetHeader("Authorization") != "" {
+		return false
+	}
+	// Отчёты CSP отправляет сам браузер, без токена
+	if c.Request.URL.Path == cspReportPath {
+		return false
+	}
+	if _, err := c.Cookie("token"); err == nil {
+		return true
+	}
+	return !strings.HasPrefix(c.Request.URL.Path, "/api/")
+}
+
+func newCSRFToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// CSRFMiddleware - атрибуты кук и защита от подделки запросов (double submit):
+// значение куки csrf_token должно прийти в заголовке X-CSRF-Token или поле
+// формы csrf_token. Страницы получают токен через renderHTML.
+func CSRFMiddleware(cookies CookieOptions) gin.HandlerFunc {
+	sameSite := cookies.sameSite()
+	return func(c *gin.Context) {
+		c.SetSameSite(sameSite)
+		c.Set(cookieSecureContextKey, cookies.Secure)
+
+		token, err := c.Cookie(csrfCookie)
+		if err != nil || token == "" {
+			token, err = newCSRFToken()
+			if err != nil {
+				abortError(c, http.StatusInternalServerError, ErrInternal)
+				return
+			}
+			setCookie(c, csrfCookie, token, csrfCookieTTL, "/")
+		}
+		c.Set(csrfContextKey, token)
+
+		if csrfRequired(c) {
+			sent := c.GetHeader(csrfHeader)
+			if sent == "" {
+				sent = c.PostForm(csrfField)
+			}
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				abortError(c, http.StatusForbidden, ErrCSRFFailed)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// renderHTML - страница с CSRF токеном для форм (csrf_token) и fetch (meta csrf-token)
+// и nonce для встроенных скриптов (csp_nonce)
+func renderHTML(c *gin.Context, status int, name string, data gin.H) {
+	if data == nil {
+		data = gin.H{}
+	}
+	data["csrf_token"] = c.GetString(csrfContextKey)
+	data["csp_nonce"] = c.GetString(cspNonceContextKey)
+	c.HTML(status, name, data)
+}
@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unitycn/internal/auth"
+	"unitycn/internal/mailer"
+	"unitycn/internal/models"
+	"unitycn/internal/oidc"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// === EMAIL: ПОДТВЕРЖДЕНИЕ АДРЕСА И ВОССТАНОВЛЕНИЕ ПАРОЛЯ ===
+
+const (
+	passwordResetTTL = time.Hour
+	emailVerifyTTL   = 48 * time.Hour
+	// emailsPerHour - писем одного вида одному пользователю в час
+	emailsPerHour   = 3
+	mailSendTimeout = time.Minute
+)
+
+// issueEmailToken - подписанная одноразовая ссылка; в БД - её jti и срок
+func issueEmailToken(repo *models.Repository, tokens *auth.Service, user *models.User, purpose, email string, ttl time.Duration) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	jti := hex.EncodeToString(buf)
+
+	token, err := tokens.GenerateTypedToken(purpose, jwt.MapClaims{
+		"uid": user.ID,
+		"jti": jti,
+	}, ttl)
+	if err != nil {
+		return "", err
+	}
+	if err := repo.CreateEmailToken(jti, user.ID, purpose, email, ttl); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// parseEmailToken - jti и пользователь подписанной ссылки нужного назначения
+func parseEmailToken(tokens *auth.Service, raw, purpose string) (string, int, bool) {
+	claims, err := tokens.VerifyTypedToken(raw, purpose)
+	if err != nil {
+		return "", 0, false
+	}
+	jti, _ := claims["jti"].(string)
+	uid, _ := claims["uid"].(float64)
+	if jti == "" || uid <= 0 {
+		return "", 0, false
+	}
+	return jti, int(uid), true
+}
+
+// mailLink - абсолютная ссылка на сайт (адрес берётся из конфига, не из Host запроса)
+func mailLink(baseURL, path, token string) string {
+	return strings.TrimSuffix(baseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// mailData - данные шаблонов писем
+type mailData struct {
+	Username string
+	Email    string
+	Link     string
+	Hours    int
+	Days     int
+}
+
+// sendMail - письмо по шаблону на языке запроса. Отправляется в фоне:
+// время ответа не должно выдавать, существует ли адрес.
+func sendMail(c *gin.Context, m mailer.Mailer, to, name string, data mailData) {
+	msg, err := mailer.Render(name, locale(c), data)
+	if err != nil {
+		log.Printf("Ошибка шаблона письма %s: %v", name, err)
+		return
+	}
+	msg.To = to
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := m.Send(ctx, msg); err != nil {
+			log.Printf("Ошибка отправки письма %s для %s: %v", name, to, err)
+		}
+	}()
+}
+
+// emailLimitReached - исчерпан ли лимит писем пользователю
+func emailLimitReached(repo *models.Repository, userID int, purpose string) (bool, error) {
+	count, err := repo.CountRecentEmailTokens(userID, purpose, time.Hour)
+	if err != nil {
+		return false, err
+	}
+	return count >= emailsPerHour, nil
+}
+
+// sendVerificationEmail - ссылка подтверждения на текущий адрес пользователя.
+// При отказе - статус и код ошибки.
+func sendVerificationEmail(c *gin.Context, repo *models.Repository, tokens *auth.Service, opts Options, user *models.User) (int, string) {
+	limited, err := emailLimitReached(repo, user.ID, models.TokenEmailVerify)
+	if err != nil {
+		log.Printf("Ошибка подсчёта писем: %v", err)
+		return http.StatusInternalServerError, ErrInternal
+	}
+	if limited {
+		return http.StatusTooManyRequests, ErrTooManyEmails
+	}
+
+	token, err := issueEmailToken(repo, tokens, user, models.TokenEmailVerify, user.Email, emailVerifyTTL)
+	if err != nil {
+		log.Printf("Ошибка выдачи ссылки подтверждения: %v", err)
+		return http.StatusInternalServerError, ErrInternal
+	}
+
+	sendMail(c, opts.Mailer, user.Email, "verify_email", mailData{
+		Username: user.Username,
+		Email:    user.Email,
+		Link:     mailLink(opts.BaseURL, "/verify-email", token),
+		Hours:    int(emailVerifyTTL / time.Hour),
+	})
+	return 0, ""
+}
+
+// requestPasswordReset - письмо со ссылкой сброса, если логину или email соответствует
+// пользователь с подтверждённым адресом. Ответ клиенту не зависит от результата.
+func requestPasswordReset(c *gin.Context, repo *models.Repository, tokens *auth.Service, opts Options, login string) {
+	login = strings.TrimSpace(login)
+	if login == "" {
+		return
+	}
+
+	user, err := repo.GetUserByUsername(login)
+	if err != nil {
+		user, err = repo.GetUserByEmail(login)
+	}
+	if err != nil || !user.EmailVerified() || user.BannedAt != nil {
+		return
+	}
+
+	limited, err := emailLimitReached(repo, user.ID, models.TokenPasswordReset)
+	if err != nil {
+		log.Printf("Ошибка подсчёта писем: %v", err)
+		return
+	}
+	if limited {
+		log.Printf("Лимит писем сброса пароля для %s исчерпан", user.Username)
+		return
+	}
+
+	token, err := issueEmailToken(repo, tokens, user, models.TokenPasswordReset, user.Email, passwordResetTTL)
+	if err != nil {
+		log.Printf("Ошибка выдачи ссылки сброса пароля: %v", err)
+		return
+	}
+
+	sendMail(c, opts.Mailer, user.Email, "reset_password", mailData{
+		Username: user.Username,
+		Email:    user.Email,
+		Link:     mailLink(opts.BaseURL, "/reset-password", token),
+		Hours:    int(passwordResetTTL / time.Hour),
+	})
+}
+
+// resetPassword - новый пароль по ссылке; при неудаче - статус и код ошибки
+func resetPassword(c *gin.Context, repo *models.Repository, tokens *auth.Service, passwords *auth.Passwords, token, password string) (int, string) {
+	jti, userID, ok := parseEmailToken(tokens, token, models.TokenPasswordReset)
+	if !ok {
+		return http.StatusBadRequest, ErrInvalidLinkToken
+	}
+	user, err := repo.GetUserByID(userID)
+	if err != nil {
+		return http.StatusBadRequest, ErrInvalidLinkToken
+	}
+	if err := passwords.Validate(password, user.Username); err != nil {
+		code, _ := passwordPolicyError(passwords, err)
+		return http.StatusBadRequest, code
+	}
+
+	hashedPassword, err := passwords.Hash(password)
+	if err != nil {
+		log.Printf("Ошибка хэширования пароля: %v", err)
+		return http.StatusInternalServerError, ErrInternal
+	}
+
+	if err := repo.ResetPasswordWithToken(jti, userID, hashedPassword); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return http.StatusBadRequest, ErrInvalidLinkToken
+		}
+		log.Printf("Ошибка сброса пароля: %v", err)
+		return http.StatusInternalServerError, ErrInternal
+	}
+
+	// Владелец адреса подтвердил себя - временная блокировка входа снимается
+	recordLogin(c, repo, user.ID, user.Username, models.LoginUnlocked)
+	return 0, ""
+}
+
+// verifyEmail - подтверждение адреса по ссылке; при неудаче - статус и код ошибки
+func verifyEmail(repo *models.Repository, tokens *auth.Service, token string) (int, string) {
+	jti, userID, ok := parseEmailToken(tokens, token, models.TokenEmailVerify)
+	if !ok {
+		return http.StatusBadRequest, ErrInvalidLinkToken
+	}
+
+	user, err := repo.GetUserByID(userID)
+	if err != nil {
+		return http.StatusBadRequest, ErrInvalidLinkToken
+	}
+	if owner, err := repo.GetUserByEmail(user.Email); err == nil && owner.ID != user.ID {
+		return http.StatusConflict, ErrEmailTaken
+	}
+
+	if err := repo.VerifyEmailWithToken(jti, userID); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return http.StatusBadRequest, ErrInvalidLinkToken
+		}
+		log.Printf("Ошибка подтверждения email: %v", err)
+		return http.StatusInternalServerError, ErrInternal
+	}
+	return 0, ""
+}
+
+// emailStatus - адрес текущего пользователя
+type emailStatus struct {
+	Email            string `json:"email"`
+	Verified         bool   `json:"verified"`
+	VerificationSent bool   `json:"verification_sent,omitempty"`
+}
+
+// emailRequest - новый адрес
+type emailRequest struct {
+	Email string `json:"email"`
+}
+
+// emailTokenRequest - токен из ссылки в письме
+type emailTokenRequest struct {
+	Token string `json:"token"`
+}
+
+// forgotPasswordRequest - логин или email
+type forgotPasswordRequest struct {
+	Login string `json:"login" doc:"имя пользователя или подтверждённый email"`
+}
+
+// resetPasswordRequest - новый пароль по ссылке из письма
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// GetMyEmail - адрес текущего пользователя
+func GetMyEmail(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		respond(c, http.StatusOK, emailStatus{Email: user.Email, Verified: user.EmailVerified()})
+	}
+}
+
+// SetMyEmail - смена адреса и письмо для подтверждения (повторный вызов - повторное письмо)
+func SetMyEmail(repo *models.Repository, tokens *auth.Service, opts Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		var req emailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+		req.Email = strings.TrimSpace(req.Email)
+		if !mailer.ValidAddress(req.Email) {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"email"}})
+			return
+		}
+
+		if strings.EqualFold(req.Email, user.Email) && user.EmailVerified() {
+			respond(c, http.StatusOK, emailStatus{Email: user.Email, Verified: true})
+			return
+		}
+		if owner, err := repo.GetUserByEmail(req.Email); err == nil && owner.ID != user.ID {
+			respondError(c, http.StatusConflict, ErrEmailTaken)
+			return
+		}
+
+		if req.Email != user.Email {
+			if err := repo.SetUserEmail(user.ID, req.Email); err != nil {
+				log.Printf("Ошибка смены email: %v", err)
+				respondError(c, http.StatusInternalServerError, ErrInternal)
+				return
+			}
+			user.Email = req.Email
+		}
+
+		if status, code := sendVerificationEmail(c, repo, tokens, opts, user); code != "" {
+			respondError(c, status, code)
+			return
+		}
+		respond(c, http.StatusOK, emailStatus{Email: user.Email, VerificationSent: true})
+	}
+}
+
+// VerifyEmail - подтверждение адреса через API
+func VerifyEmail(repo *models.Repository, tokens *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req emailTokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+
+		if status, code := verifyEmail(repo, tokens, req.Token); code != "" {
+			respondError(c, status, code)
+			return
+		}
+		respond(c, http.StatusOK, gin.H{"verified": true})
+	}
+}
+
+// ForgotPassword - запрос письма для сброса пароля через API
+func ForgotPassword(repo *models.Repository, tokens *auth.Service, opts Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req forgotPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+
+		requestPasswordReset(c, repo, tokens, opts, req.Login)
+		respond(c, http.StatusAccepted, gin.H{"requested": true})
+	}
+}
+
+// ResetPassword - новый пароль по ссылке через API
+func ResetPassword(repo *models.Repository, tokens *auth.Service, passwords *auth.Passwords) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req resetPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+
+		if status, code := resetPassword(c, repo, tokens, passwords, req.Token, req.Password); code != "" {
+			if code == ErrValidationFailed {
+				respondError(c, status, code, gin.H{"fields": []string{"password"}})
+				return
+			}
+			respondError(c, status, code)
+			return
+		}
+		respond(c, http.StatusOK, gin.H{"reset": true})
+	}
+}
+
+// ForgotPasswordPage - форма запроса сброса пароля
+func ForgotPasswordPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		renderHTML(c, http.StatusOK, "forgot_password.html", nil)
+	}
+}
+
+// ForgotPasswordForm - запрос сброса пароля через веб-форму
+func ForgotPasswordForm(repo *models.Repository, tokens *auth.Service, opts Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestPasswordReset(c, repo, tokens, opts, c.PostForm("login"))
+		renderHTML(c, http.StatusOK, "forgot_password.html", gin.H{
+			"success": "Если аккаунт с подтверждённым email существует, мы отправили на него ссылку для сброса пароля.",
+		})
+	}
+}
+
+// ResetPasswordPage - форма нового пароля по ссылке из письма
+func ResetPasswordPage(tokens *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if _, _, ok := parseEmailToken(tokens, token, models.TokenPasswordReset); !ok {
+			renderHTML(c, http.StatusBadRequest, "reset_password.html", gin.H{"error": message(c, ErrInvalidLinkToken)})
+			return
+		}
+		renderHTML(c, http.StatusOK, "reset_password.html", gin.H{"token": token})
+	}
+}
+
+// ResetPasswordForm - новый пароль через веб-форму
+func ResetPasswordForm(repo *models.Repository, tokens *auth.Service, passwords *auth.Passwords, providers *oidc.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.PostForm("token")
+		if status, code := resetPassword(c, repo, tokens, passwords, token, c.PostForm("password")); code != "" {
+			data := gin.H{"error": message(c, code)}
+			if code == ErrValidationFailed {
+				data["token"] = token
+			}
+			renderHTML(c, status, "reset_password.html", data)
+			return
+		}
+
+		renderAuthPage(c, http.StatusOK, "login.html", providers, gin.H{
+			"success": "Пароль изменён. Войдите с новым паролем.",
+		})
+	}
+}
+
+// VerifyEmailPage - подтверждение адреса по ссылке из письма
+func VerifyEmailPage(repo *models.Repository, tokens *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if status, code := verifyEmail(repo, tokens, c.Query("token")); code != "" {
+			renderHTML(c, status, "verify_email.html", gin.H{"error": message(c, code)})
+			return
+		}
+		renderHTML(c, http.StatusOK, "verify_email.html", gin.H{"success": "Email подтверждён."})
+	}
+}
+
+// EmailPage - страница адреса для восстановления пароля
+func EmailPage(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := repo.GetUserByUsername(c.GetString("username"))
+		if err != nil {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+
+		renderHTML(c, http.StatusOK, "account_email.html", gin.H{
+			"title": "Email",
+			"user":  user,
+		})
+	}
+}
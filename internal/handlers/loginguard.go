@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+	"unitycn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === ЗАЩИТА ВХОДА ===
+
+const (
+	loginFailureWindow = 15 * time.Minute // окно подсчёта неудачных попыток
+	loginDelayAfter    = 3                // с какой неудачи по логину начинаются задержки
+	loginMaxDelay      = time.Minute
+	loginLockAfter     = 10 // неудач по логину до временной блокировки
+	loginIPLimit       = 50 // неудач с одного IP за окно
+)
+
+// loginEvents - история попыток входа (models.Repository)
+type loginEvents interface {
+	LoginFailuresByIP(ip string, window time.Duration) ([]time.Duration, error)
+	LoginFailuresByUsername(username string, window time.Duration) ([]time.Duration, error)
+	RecordLoginEvent(userID int, username, ip, userAgent, result string) error
+}
+
+// TrustProxies - от каких прокси принимать X-Forwarded-For. IP клиента
+// ключ ограничений и блокировки входа: поверив заголовку от кого угодно,
+// клиент обнулял бы свой счётчик неудач. nil - заголовок игнорируется
+func TrustProxies(r *gin.Engine, proxies []string) error {
+	return r.SetTrustedProxies(proxies)
+}
+
+// throttleLogin - loginThrottle для IP запроса; при отказе попытка пишется
+// в историю и ставится Retry-After. Возвращает HTTP статус и код ошибки
+func throttleLogin(c *gin.Context, events loginEvents, userID int, username string) (int, string) {
+	code, result, retryAfter := loginThrottle(events, username, c.ClientIP())
+	if code == "" {
+		return 0, ""
+	}
+	recordLogin(c, events, userID, username, result)
+	c.Header("Retry-After", ceilSeconds(retryAfter))
+	return http.StatusTooManyRequests, code
+}
+
+// loginThrottle - можно ли сейчас пробовать войти. При отказе - код ошибки,
+// результат для истории и через сколько повторить. Решение принимается только
+// по истории попыток, поэтому одинаково для существующих и несуществующих логинов.
+func loginThrottle(events loginEvents, username, ip string) (string, string, time.Duration) {
+	ipFailures, err := events.LoginFailuresByIP(ip, loginFailureWindow)
+	if err != nil {
+		log.Printf("Ошибка чтения истории входов: %v", err)
+		return "", "", 0
+	}
+	if len(ipFailures) >= loginIPLimit {
+		return ErrTooManyAttempts, models.LoginThrottled, slidingRetry(ipFailures, loginIPLimit)
+	}
+
+	failures, err := events.LoginFailuresByUsername(username, loginFailureWindow)
+	if err != nil {
+		log.Printf("Ошибка чтения истории входов: %v", err)
+		return "", "", 0
+	}
+	n := len(failures)
+	if n >= loginLockAfter {
+		return ErrAccountLocked, models.LoginLocked, slidingRetry(failures, loginLockAfter)
+	}
+	if n >= loginDelayAfter {
+		// failures - от старых к новым, последний элемент - возраст свежей неудачи
+		if wait := loginDelay(n) - failures[n-1]; wait > 0 {
+			return ErrTooManyAttempts, models.LoginThrottled, wait
+		}
+	}
+
+	return "", "", 0
+}
+
+// loginDelay - 1с, 2с, 4с... начиная с loginDelayAfter неудач, не больше loginMaxDelay
+func loginDelay(failures int) time.Duration {
+	shift := failures - loginDelayAfter
+	if shift > 6 {
+		return loginMaxDelay
+	}
+	return min(time.Second<<shift, loginMaxDelay)
+}
+
+// slidingRetry - через сколько в окне останется меньше limit неудач
+func slidingRetry(ages []time.Duration, limit int) time.Duration {
+	return loginFailureWindow - ages[len(ages)-limit]
+}
+
+// recordLogin - запись попытки входа в историю
+func recordLogin(c *gin.Context, events loginEvents, userID int, username, result string) {
+	err := events.RecordLoginEvent(userID, username, c.ClientIP(), c.Request.UserAgent(), result)
+	if err != nil {
+		log.Printf("Ошибка записи истории входов: %v", err)
+	}
+}
+
+// GetMyLoginEvents - история входов текущего пользователя
+func GetMyLoginEvents(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		page, perPage := pageParams(c)
+
+		events, err := repo.GetLoginEvents(user.ID, perPage, (page-1)*perPage)
+		if err != nil {
+			log.Printf("Ошибка получения истории входов: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		total, err := repo.CountLoginEvents(user.ID)
+		if err != nil {
+			log.Printf("Ошибка подсчёта истории входов: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if events == nil {
+			events = []models.LoginEvent{}
+		}
+		respondPage(c, events, page, perPage, total)
+	}
+}
+
+// UnlockUserLogin - снятие временной блокировки входа (админка)
+func UnlockUserLogin(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+
+		user, err := repo.GetUserByID(userID)
+		if err != nil {
+			respondError(c, http.StatusNotFound, ErrNotFound)
+			return
+		}
+
+		if err := repo.RecordLoginEvent(user.ID, user.Username, c.ClientIP(), c.Request.UserAgent(), models.LoginUnlocked); err != nil {
+			log.Printf("Ошибка снятия блокировки входа: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		respond(c, http.StatusOK, gin.H{"unlocked": true})
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"unitycn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginRecord - запись истории входов в memoryLoginEvents
+type loginRecord struct {
+	username, ip, result string
+}
+
+// memoryLoginEvents - история входов в памяти; все попытки "только что"
+type memoryLoginEvents struct {
+	mu     sync.Mutex
+	events []loginRecord
+}
+
+func (m *memoryLoginEvents) failures(match func(loginRecord) bool) []time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ages []time.Duration
+	for _, e := range m.events {
+		switch e.result {
+		case models.LoginBadPassword, models.LoginUnknownUser, models.LoginMFAFailed:
+			if match(e) {
+				ages = append(ages, 0)
+			}
+		}
+	}
+	return ages
+}
+
+func (m *memoryLoginEvents) LoginFailuresByIP(ip string, _ time.Duration) ([]time.Duration, error) {
+	return m.failures(func(e loginRecord) bool { return e.ip == ip }), nil
+}
+
+func (m *memoryLoginEvents) LoginFailuresByUsername(username string, _ time.Duration) ([]time.Duration, error) {
+	return m.failures(func(e loginRecord) bool { return e.username == username }), nil
+}
+
+func (m *memoryLoginEvents) RecordLoginEvent(userID int, username, ip, userAgent, result string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, loginRecord{username: username, ip: ip, result: result})
+	return nil
+}
+
+// loginGuardRouter - вход, в котором любой пароль неверен
+func loginGuardRouter(t *testing.T, proxies []string, events loginEvents) *gin.Engine {
+	t.Helper()
+	r := gin.New()
+	if err := TrustProxies(r, proxies); err != nil {
+		t.Fatalf("TrustProxies: %v", err)
+	}
+	r.POST("/login", func(c *gin.Context) {
+		username := c.PostForm("username")
+		if status, code := throttleLogin(c, events, 0, username); code != "" {
+			respondError(c, status, code)
+			return
+		}
+		recordLogin(c, events, 0, username, models.LoginUnknownUser)
+		respondError(c, http.StatusUnauthorized, ErrInvalidCredentials)
+	})
+	return r
+}
+
+// failLogins - n неудачных входов с одного адреса, каждый раз с новым
+// логином и новым X-Forwarded-For; статус последнего ответа
+func failLogins(r *gin.Engine, n int) int {
+	code := 0
+	for i := 0; i < n; i++ {
+		form := url.Values{"username": {fmt.Sprintf("user%d", i)}}
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = "203.0.113.7:40000"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i%250+1))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		code = w.Code
+	}
+	return code
+}
+
+// TestLoginThrottleIgnoresForgedForwardedFor - поддельный X-Forwarded-For
+// не даёт начать счётчик неудач по IP заново
+func TestLoginThrottleIgnoresForgedForwardedFor(t *testing.T) {
+	events := &memoryLoginEvents{}
+	r := loginGuardRouter(t, nil, events)
+
+	if code := failLogins(r, loginIPLimit); code != http.StatusUnauthorized {
+		t.Fatalf("статус %d до исчерпания лимита", code)
+	}
+	if code := failLogins(r, 1); code != http.StatusTooManyRequests {
+		t.Fatalf("статус %d, ожидался 429: счётчик IP сброшен заголовком", code)
+	}
+	for _, e := range events.events {
+		if e.ip != "203.0.113.7" {
+			t.Fatalf("в историю записан IP %s из заголовка", e.ip)
+		}
+	}
+}
+
+// TestLoginThrottleTrustedProxy - за доверенным прокси IP клиента берётся
+// из X-Forwarded-For, и разные клиенты считаются отдельно
+func TestLoginThrottleTrustedProxy(t *testing.T) {
+	events := &memoryLoginEvents{}
+	r := loginGuardRouter(t, []string{"203.0.113.7"}, events)
+
+	if code := failLogins(r, loginIPLimit+1); code != http.StatusUnauthorized {
+		t.Fatalf("статус %d, клиенты за прокси не должны делить счётчик", code)
+	}
+	if ip := events.events[0].ip; ip != "198.51.100.1" {
+		t.Fatalf("IP %s, ожидался адрес из X-Forwarded-For", ip)
+	}
+}
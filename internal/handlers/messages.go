@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"strings"
+	"unitycn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Коды ошибок API. Код стабилен, сообщение зависит от языка клиента.
+const (
+	ErrInvalidRequest     = "invalid_request"
+	ErrInvalidContentType = "invalid_content_type"
+	ErrInvalidID          = "invalid_id"
+	ErrInvalidDate        = "invalid_date"
+	ErrValidationFailed   = "validation_failed"
+	ErrInvalidCredentials = "invalid_credentials"
+	ErrAccountBanned      = "account_banned"
+	ErrAccountLocked      = "account_locked"
+	ErrTooManyAttempts    = "too_many_attempts"
+	ErrInvalid2FACode     = "invalid_2fa_code"
+	ErrTwoFactorRequired  = "two_factor_required"
+	ErrTwoFactorEnabled   = "two_factor_enabled"
+	ErrTwoFactorNotSetup  = "two_factor_not_setup"
+	ErrUnauthorized       = "unauthorized"
+	ErrInvalidToken       = "invalid_token"
+	ErrTokenNotAllowed    = "token_not_allowed"
+	ErrInsufficientScope  = "insufficient_scope"
+	ErrTooManyTokens      = "too_many_tokens"
+	ErrSSOFailed          = "sso_failed"
+	ErrSSONoAccount       = "sso_no_account"
+	ErrIdentityLinked     = "identity_linked"
+	ErrLastSignInMethod   = "last_sign_in_method"
+	ErrEmailTaken         = "email_taken"
+	ErrInvalidLinkToken   = "invalid_link_token"
+	ErrTooManyEmails      = "too_many_emails"
+	ErrCSRFFailed         = "csrf_failed"
+	ErrInvalidUsername    = "invalid_username"
+	ErrPasswordTooShort   = "password_too_short"
+	ErrPasswordTooLong    = "password_too_long"
+	ErrPasswordBreached   = "password_breached"
+	ErrPasswordUsername   = "password_same_as_username"
+	ErrReauthRequired     = "reauth_required"
+	ErrUserBlocked        = "user_blocked"
+	ErrCommunityExists    = "community_exists"
+	ErrNotCommunityMember = "not_community_member"
+	ErrCommunityOwner     = "community_owner"
+	ErrUnknownReaction    = "unknown_reaction"
+	ErrCollectionExists   = "collection_exists"
+	ErrForbidden          = "forbidden"
+	ErrAdminRequired      = "admin_required"
+	ErrNotFound           = "not_found"
+	ErrUserExists         = "user_exists"
+	ErrRateLimited        = "rate_limited"
+	ErrInternal           = "internal_error"
+)
+
+const defaultLocale = "ru"
+
+// messages - сообщения по коду и языку
+var messages = map[string]map[string]string{
+	ErrInvalidRequest: {
+		"ru": "Неверный формат запроса",
+		"en": "Malformed request",
+	},
+	ErrInvalidContentType: {
+		"ru": "Неверный Content-Type",
+		"en": "Unsupported Content-Type",
+	},
+	ErrInvalidID: {
+		"ru": "Неверный ID",
+		"en": "Invalid ID",
+	},
+	ErrInvalidDate: {
+		"ru": "Неверный формат даты. Используйте YYYY-MM-DD",
+		"en": "Invalid date format, use YYYY-MM-DD",
+	},
+	ErrValidationFailed: {
+		"ru": "Данные не прошли проверку",
+		"en": "Validation failed",
+	},
+	ErrInvalidCredentials: {
+		"ru": "Неверные учетные данные",
+		"en": "Invalid username or password",
+	},
+	ErrAccountBanned: {
+		"ru": "Аккаунт заблокирован",
+		"en": "Account is banned",
+	},
+	ErrAccountLocked: {
+		"ru": "Вход временно заблокирован из-за множества неудачных попыток",
+		"en": "Sign-in is temporarily locked after too many failed attempts",
+	},
+	ErrTooManyAttempts: {
+		"ru": "Слишком много неудачных попыток входа, повторите позже",
+		"en": "Too many failed sign-in attempts, try again later",
+	},
+	ErrInvalid2FACode: {
+		"ru": "Неверный код подтверждения",
+		"en": "Invalid verification code",
+	},
+	ErrTwoFactorRequired: {
+		"ru": "Для вашей роли требуется двухфакторная аутентификация",
+		"en": "Two-factor authentication is required for your role",
+	},
+	ErrTwoFactorEnabled: {
+		"ru": "Двухфакторная аутентификация уже включена",
+		"en": "Two-factor authentication is already enabled",
+	},
+	ErrTwoFactorNotSetup: {
+		"ru": "Двухфакторная аутентификация не настроена",
+		"en": "Two-factor authentication is not set up",
+	},
+	ErrUnauthorized: {
+		"ru": "Требуется авторизация",
+		"en": "Authentication required",
+	},
+	ErrInvalidToken: {
+		"ru": "Неверный токен",
+		"en": "Invalid token",
+	},
+	ErrTokenNotAllowed: {
+		"ru": "Этот запрос недоступен по токену API, войдите в аккаунт",
+		"en": "This request is not available with an API token, sign in instead",
+	},
+	ErrInsufficientScope: {
+		"ru": "У токена API нет нужной области доступа",
+		"en": "The API token lacks the required scope",
+	},
+	ErrTooManyTokens: {
+		"ru": "Слишком много токенов API, отзовите ненужные",
+		"en": "Too many API tokens, revoke unused ones",
+	},
+	ErrSSOFailed: {
+		"ru": "Не удалось войти через внешний сервис, попробуйте ещё раз",
+		"en": "Single sign-on failed, please try again",
+	},
+	ErrSSONoAccount: {
+		"ru": "Нет аккаунта, связанного с этой учётной записью",
+		"en": "No account is linked to this identity",
+	},
+	ErrIdentityLinked: {
+		"ru": "Эта учётная запись уже привязана к другому аккаунту",
+		"en": "This identity is already linked to another account",
+	},
+	ErrLastSignInMethod: {
+		"ru": "Нельзя отвязать единственный способ входа",
+		"en": "Cannot unlink the only sign-in method",
+	},
+	ErrEmailTaken: {
+		"ru": "Этот email уже подтверждён другим пользователем",
+		"en": "This email is already verified by another user",
+	},
+	ErrInvalidLinkToken: {
+		"ru": "Ссылка недействительна, устарела или уже использована",
+		"en": "The link is invalid, expired or already used",
+	},
+	ErrTooManyEmails: {
+		"ru": "Слишком много писем, повторите позже",
+		"en": "Too many emails sent, try again later",
+	},
+	ErrInvalidUsername: {
+		"ru": "Логин: от 3 до 50 символов, буквы, цифры и _ . -, начинается и заканчивается буквой или цифрой",
+		"en": "Username: 3 to 50 characters, letters, digits and _ . -, starting and ending with a letter or digit",
+	},
+	ErrPasswordTooShort: {
+		"ru": "Пароль слишком короткий",
+		"en": "Password is too short",
+	},
+	ErrPasswordTooLong: {
+		"ru": "Пароль слишком длинный",
+		"en": "Password is too long",
+	},
+	ErrPasswordBreached: {
+		"ru": "Этот пароль слишком распространён или утёк, выберите другой",
+		"en": "This password is too common or has been breached, choose another one",
+	},
+	ErrPasswordUsername: {
+		"ru": "Пароль не должен совпадать с логином",
+		"en": "Password must not match the username",
+	},
+	ErrReauthRequired: {
+		"ru": "Войдите заново, чтобы подтвердить действие",
+		"en": "Sign in again to confirm this action",
+	},
+	ErrUserBlocked: {
+		"ru": "Недоступно: один из вас заблокировал другого",
+		"en": "Not available: one of you has blocked the other",
+	},
+	ErrCommunityExists: {
+		"ru": "Сообщество с таким адресом уже есть",
+		"en": "A community with this address already exists",
+	},
+	ErrNotCommunityMember: {
+		"ru": "Доступно только участникам сообщества",
+		"en": "Available to community members only",
+	},
+	ErrCommunityOwner: {
+		"ru": "Владелец не может покинуть сообщество",
+		"en": "The owner cannot leave the community",
+	},
+	ErrUnknownReaction: {
+		"ru": "Такой реакции нет",
+		"en": "Unknown reaction",
+	},
+	ErrCollectionExists: {
+		"ru": "Подборка с таким названием уже есть",
+		"en": "A collection with this name already exists",
+	},
+	ErrCSRFFailed: {
+		"ru": "Запрос отклонён: обновите страницу и повторите",
+		"en": "Request rejected: reload the page and try again",
+	},
+	ErrForbidden: {
+		"ru": "Недостаточно прав",
+		"en": "Permission denied",
+	},
+	ErrAdminRequired: {
+		"ru": "Требуются права администратора",
+		"en": "Administrator rights required",
+	},
+	ErrNotFound: {
+		"ru": "Не найдено",
+		"en": "Not found",
+	},
+	ErrUserExists: {
+		"ru": "Пользователь уже существует",
+		"en": "User already exists",
+	},
+	ErrRateLimited: {
+		"ru": "Слишком много запросов, попробуйте позже",
+		"en": "Too many requests, try again later",
+	},
+	ErrInternal: {
+		"ru": "Внутренняя ошибка сервера",
+		"en": "Internal server error",
+	},
+}
+
+// locale - язык клиента: ?lang=, затем язык из профиля, Accept-Language, иначе русский
+func locale(c *gin.Context) string {
+	if lang := c.Query("lang"); lang != "" {
+		if supportedLocale(lang) {
+			return lang
+		}
+	}
+
+	if user, ok := c.Get("user"); ok {
+		if u, ok := user.(*models.User); ok && supportedLocale(u.Locale) {
+			return u.Locale
+		}
+	}
+
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		lang := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if supportedLocale(lang) {
+			return lang
+		}
+	}
+
+	return defaultLocale
+}
+
+func supportedLocale(lang string) bool {
+	return lang == "ru" || lang == "en"
+}
+
+// message - локализованное сообщение для кода ошибки
+func message(c *gin.Context, code string) string {
+	texts, ok := messages[code]
+	if !ok {
+		return code
+	}
+	if text, ok := texts[locale(c)]; ok {
+		return text
+	}
+	return texts[defaultLocale]
+}
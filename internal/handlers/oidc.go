@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"unitycn/internal/auth"
+	"unitycn/internal/models"
+	"unitycn/internal/oidc"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// === ВХОД ЧЕРЕЗ OPENID CONNECT ===
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStatePath   = "/auth/oidc"
+	oidcStateTTL    = 10 * time.Minute
+	oidcStateType   = "oidc_state"
+
+	minUsernameLen = 3
+	maxUsernameLen = 50
+)
+
+// ssoButton - кнопка входа через провайдера на страницах входа и регистрации
+type ssoButton struct {
+	Name        string
+	DisplayName string
+}
+
+func ssoButtons(providers *oidc.Registry) []ssoButton {
+	var buttons []ssoButton
+	for _, p := range providers.List() {
+		buttons = append(buttons, ssoButton{Name: p.Config.Name, DisplayName: p.Config.DisplayName})
+	}
+	return buttons
+}
+
+// renderAuthPage - login.html или register.html с кнопками внешнего входа
+func renderAuthPage(c *gin.Context, status int, page string, providers *oidc.Registry, data gin.H) {
+	if data == nil {
+		data = gin.H{}
+	}
+	data["sso"] = ssoButtons(providers)
+	renderHTML(c, status, page, data)
+}
+
+// OIDCLogin - переход на страницу входа провайдера.
+// ?link=1 - привязка учётной записи к текущему пользователю; только для
+// сессии в куке браузера, не для токенов в заголовке Authorization.
+func OIDCLogin(tokens *auth.Service, providers *oidc.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := providers.Get(c.Param("provider"))
+		if !ok {
+			renderAuthPage(c, http.StatusNotFound, "login.html", providers, gin.H{"error": message(c, ErrNotFound)})
+			return
+		}
+
+		linkUserID := 0
+		if c.Query("link") == "1" {
+			linkUserID = cookieSessionUserID(c)
+			if linkUserID == 0 {
+				c.Redirect(http.StatusFound, "/login")
+				return
+			}
+		}
+
+		state, err1 := oidc.RandomString()
+		nonce, err2 := oidc.RandomString()
+		verifier, err3 := oidc.RandomString()
+		if err := errors.Join(err1, err2, err3); err != nil {
+			log.Printf("Ошибка генерации состояния OIDC: %v", err)
+			renderAuthPage(c, http.StatusInternalServerError, "login.html", providers, gin.H{"error": message(c, ErrInternal)})
+			return
+		}
+
+		target, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, oidc.Challenge(verifier))
+		if err != nil {
+			log.Printf("Ошибка OIDC: %v", err)
+			renderAuthPage(c, http.StatusBadGateway, "login.html", providers, gin.H{"error": message(c, ErrSSOFailed)})
+			return
+		}
+
+		// Состояние входа - в подписанной куке, доступной только обратному вызову
+		cookie, err := tokens.GenerateTypedToken(oidcStateType, jwt.MapClaims{
+			"provider": provider.Config.Name,
+			"state":    state,
+			"nonce":    nonce,
+			"verifier": verifier,
+			"link":     linkUserID,
+		}, oidcStateTTL)
+		if err != nil {
+			log.Printf("Ошибка подписи состояния OIDC: %v", err)
+			renderAuthPage(c, http.StatusInternalServerError, "login.html", providers, gin.H{"error": message(c, ErrInternal)})
+			return
+		}
+		setCookie(c, oidcStateCookie, cookie, int(oidcStateTTL/time.Second), oidcStatePath)
+
+		c.Redirect(http.StatusFound, target)
+	}
+}
+
+// oidcState - проверенное состояние входа из куки
+type oidcState struct {
+	nonce      string
+	verifier   string
+	linkUserID int
+}
+
+// readOIDCState - состояние из куки; кука одноразовая и удаляется
+func readOIDCState(c *gin.Context, tokens *auth.Service, provider string) (*oidcState, bool) {
+	raw, err := c.Cookie(oidcStateCookie)
+	setCookie(c, oidcStateCookie, "", -1, oidcStatePath)
+	if err != nil {
+		return nil, false
+	}
+
+	claims, err := tokens.VerifyTypedToken(raw, oidcStateType)
+	if err != nil {
+		return nil, false
+	}
+	stateProvider, _ := claims["provider"].(string)
+	state, _ := claims["state"].(string)
+	if stateProvider != provider || state == "" ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		return nil, false
+	}
+
+	result := &oidcState{}
+	result.nonce, _ = claims["nonce"].(string)
+	result.verifier, _ = claims["verifier"].(string)
+	if link, ok := claims["link"].(float64); ok {
+		result.linkUserID = int(link)
+	}
+	return result, true
+}
+
+// OIDCCallback - возврат от провайдера: проверка, поиск или создание пользователя, вход
+func OIDCCallback(repo *models.Repository, tokens *auth.Service, providers *oidc.Registry, twoFactor TwoFactorOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fail := func(status int, code string) {
+			renderAuthPage(c, status, "login.html", providers, gin.H{"error": message(c, code)})
+		}
+
+		provider, ok := providers.Get(c.Param("provider"))
+		if !ok {
+			fail(http.StatusNotFound, ErrNotFound)
+			return
+		}
+
+		state, ok := readOIDCState(c, tokens, provider.Config.Name)
+		if !ok {
+			fail(http.StatusBadRequest, ErrSSOFailed)
+			return
+		}
+		if errCode := c.Query("error"); errCode != "" {
+			log.Printf("OIDC %s вернул ошибку: %s %s", provider.Config.Name, errCode, c.Query("error_description"))
+			fail(http.StatusUnauthorized, ErrSSOFailed)
+			return
+		}
+
+		claims, err := provider.Exchange(c.Request.Context(), c.Query("code"), state.verifier, state.nonce)
+		if err != nil {
+			log.Printf("Ошибка OIDC: %v", err)
+			fail(http.StatusUnauthorized, ErrSSOFailed)
+			return
+		}
+
+		// Привязка к текущему аккаунту из настроек
+		if state.linkUserID != 0 {
+			if cookieSessionUserID(c) != state.linkUserID {
+				fail(http.StatusUnauthorized, ErrUnauthorized)
+				return
+			}
+			status, code := linkIdentity(repo, provider, claims, state.linkUserID)
+			if code != "" {
+				fail(status, code)
+				return
+			}
+			c.Redirect(http.StatusFound, "/account/identities")
+			return
+		}
+
+		user, status, code := resolveOIDCUser(repo, provider, claims)
+		if user == nil {
+			fail(status, code)
+			return
+		}
+
+		if role, ok := provider.MapRole(claims); ok && role != user.Role {
+			if err := repo.UpdateUserRole(user.ID, role); err != nil {
+				log.Printf("Ошибка обновления роли из OIDC: %v", err)
+				fail(http.StatusInternalServerError, ErrInternal)
+				return
+			}
+			log.Printf("Роль %s изменена провайдером %s: %s -> %s", user.Username, provider.Config.Name, user.Role, role)
+			user.Role = role
+		}
+
+		if user.BannedAt != nil {
+			recordLogin(c, repo, user.ID, user.Username, models.LoginBanned)
+			fail(http.StatusForbidden, ErrAccountBanned)
+			return
+		}
+
+		// Внешний вход заменяет пароль, но не второй фактор
+		if user.TwoFactorEnabled() {
+			recordLogin(c, repo, user.ID, user.Username, models.LoginMFARequired)
+			mfaToken, err := tokens.GenerateMFAToken(user.ID, user.Username)
+			if err != nil {
+				log.Printf("Ошибка генерации токена: %v", err)
+				fail(http.StatusInternalServerError, ErrInternal)
+				return
+			}
+			renderHTML(c, http.StatusOK, "login_2fa.html", gin.H{"mfa_token": mfaToken})
+			return
+		}
+		recordLogin(c, repo, user.ID, user.Username, models.LoginSuccess)
+
+		redirect := "/"
+		if twoFactor.requiredFor(user.Role) {
+			redirect = "/account/2fa"
+		}
+
+		token, err := startSession(c, tokens, user)
+		if err != nil {
+			log.Printf("Ошибка генерации токена: %v", err)
+			fail(http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		renderHTML(c, http.StatusOK, "auth_redirect.html", gin.H{
+			"token":    token,
+			"username": user.Username,
+			"role":     user.Role,
+			"user_id":  user.ID,
+			"redirect": redirect,
+		})
+	}
+}
+
+// oidcUsers - хранилище пользователей и внешних учётных записей (models.Repository)
+type oidcUsers interface {
+	GetUserIdentity(provider, subject string) (*models.UserIdentity, error)
+	CreateUserIdentity(userID int, provider, subject, email string) error
+	TouchUserIdentity(identityID int, email string) error
+	GetUserByID(id int) (*models.User, error)
+	GetUserByEmail(email string) (*models.User, error)
+	CreateExternalUser(username, displayName, email, role string) (*models.User, error)
+	UsernameTaken(username string) (bool, error)
+}
+
+// resolveOIDCUser - пользователь внешней учётной записи: уже привязанный,
+// найденный по подтверждённому email или новый
+func resolveOIDCUser(repo oidcUsers, provider *oidc.Provider, claims *oidc.Claims) (*models.User, int, string) {
+	name := provider.Config.Name
+
+	identity, err := repo.GetUserIdentity(name, claims.Subject)
+	if err == nil {
+		if err := repo.TouchUserIdentity(identity.ID, claims.Email); err != nil {
+			log.Printf("Ошибка обновления учётной записи OIDC: %v", err)
+		}
+		user, err := repo.GetUserByID(identity.UserID)
+		if err != nil {
+			log.Printf("Ошибка получения пользователя %d: %v", identity.UserID, err)
+			return nil, http.StatusInternalServerError, ErrInternal
+		}
+		return user, 0, ""
+	}
+	if !errors.Is(err, models.ErrNotFound) {
+		log.Printf("Ошибка поиска учётной записи OIDC: %v", err)
+		return nil, http.StatusInternalServerError, ErrInternal
+	}
+
+	// Непроверенному email доверять нельзя: иначе чужой аккаунт можно захватить
+	verifiedEmail := ""
+	if claims.EmailVerified {
+		verifiedEmail = claims.Email
+	}
+
+	if provider.Config.LinkByEmail && verifiedEmail != "" {
+		user, err := repo.GetUserByEmail(verifiedEmail)
+		if err == nil {
+			if err := repo.CreateUserIdentity(user.ID, name, claims.Subject, claims.Email); err != nil {
+				log.Printf("Ошибка привязки учётной записи OIDC: %v", err)
+				return nil, http.StatusInternalServerError, ErrInternal
+			}
+			log.Printf("Учётная запись %s привязана к %s по email", name, user.Username)
+			return user, 0, ""
+		}
+		if !errors.Is(err, models.ErrNotFound) {
+			log.Printf("Ошибка поиска пользователя по email: %v", err)
+			return nil, http.StatusInternalServerError, ErrInternal
+		}
+	}
+
+	if !provider.Config.AllowSignup {
+		return nil, http.StatusForbidden, ErrSSONoAccount
+	}
+
+	username, err := uniqueUsername(repo, claims)
+	if err != nil {
+		log.Printf("Ошибка подбора имени пользователя: %v", err)
+		return nil, http.StatusInternalServerError, ErrInternal
+	}
+
+	// Email сохраняется, только если подтверждён и не занят
+	email := verifiedEmail
+	if email != "" {
+		if _, err := repo.GetUserByEmail(email); err == nil {
+			email = ""
+		}
+	}
+
+	role := "user"
+	if mapped, ok := provider.MapRole(claims); ok {
+		role = mapped
+	}
+
+	user, err := repo.CreateExternalUser(username, truncateRunes(claims.Name, maxUsernameLen), email, role)
+	if err != nil {
+		log.Printf("Ошибка создания пользователя OIDC: %v", err)
+		return nil, http.StatusInternalServerError, ErrInternal
+	}
+	if err := repo.CreateUserIdentity(user.ID, name, claims.Subject, claims.Email); err != nil {
+		log.Printf("Ошибка привязки учётной записи OIDC: %v", err)
+		return nil, http.StatusInternalServerError, ErrInternal
+	}
+
+	log.Printf("Создан пользователь %s через %s", user.Username, name)
+	return user, 0, ""
+}
+
+// linkIdentity - привязка учётной записи провайдера к пользователю userID
+func linkIdentity(repo oidcUsers, provider *oidc.Provider, claims *oidc.Claims, userID int) (int, string) {
+	identity, err := repo.GetUserIdentity(provider.Config.Name, claims.Subject)
+	if err == nil {
+		if identity.UserID != userID {
+			return http.StatusConflict, ErrIdentityLinked
+		}
+		return 0, ""
+	}
+	if !errors.Is(err, models.ErrNotFound) {
+		log.Printf("Ошибка поиска учётной записи OIDC: %v", err)
+		return http.StatusInternalServerError, ErrInternal
+	}
+
+	if err := repo.CreateUserIdentity(userID, provider.Config.Name, claims.Subject, claims.Email); err != nil {
+		log.Printf("Ошибка привязки учётной записи OIDC: %v", err)
+		return http.StatusInternalServerError, ErrInternal
+	}
+	return 0, ""
+}
+
+// uniqueUsername - свободный логин из preferred_username, email или sub
+func uniqueUsername(repo oidcUsers, claims *oidc.Claims) (string, error) {
+	base := sanitizeUsername(claims.PreferredUsername)
+	if base == "" {
+		base = sanitizeUsername(strings.SplitN(claims.Email, "@", 2)[0])
+	}
+	if utf8.RuneCountInString(base) < minUsernameLen {
+		base = "user"
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			suffix := fmt.Sprintf("_%d", i)
+			candidate = truncateRunes(base, maxUsernameLen-len(suffix)) + suffix
+		}
+		taken, err := repo.UsernameTaken(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("нет свободного логина для %q", base)
+}
+
+// sanitizeUsername - буквы, цифры, _ . -; остальное заменяется на _
+func sanitizeUsername(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '_', r == '.', r == '-':
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	return truncateRunes(strings.Trim(sb.String(), "_.-"), maxUsernameLen)
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+// identitiesResult - привязанные учётные записи и доступные провайдеры
+type identitiesResult struct {
+	Identities  []models.UserIdentity `json:"identities"`
+	Providers   []string              `json:"providers" doc:"провайдеры, которые можно привязать"`
+	HasPassword bool                  `json:"has_password"`
+}
+
+// GetIdentities - привязанные внешние учётные записи текущего пользователя
+func GetIdentities(repo *models.Repository, providers *oidc.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		identities, err := repo.GetUserIdentities(user.ID)
+		if err != nil {
+			log.Printf("Ошибка получения учётных записей OIDC: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		if identities == nil {
+			identities = []models.UserIdentity{}
+		}
+
+		names := []string{}
+		for _, p := range providers.List() {
+			names = append(names, p.Config.Name)
+		}
+
+		respond(c, http.StatusOK, identitiesResult{
+			Identities:  identities,
+			Providers:   names,
+			HasPassword: user.Password != models.ExternalPassword,
+		})
+	}
+}
+
+// UnlinkIdentity - отвязка внешней учётной записи; последний способ входа не отвязывается
+func UnlinkIdentity(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		identityID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+
+		if user.Password == models.ExternalPassword {
+			count, err := repo.CountUserIdentities(user.ID)
+			if err != nil {
+				log.Printf("Ошибка подсчёта учётных записей OIDC: %v", err)
+				respondError(c, http.StatusInternalServerError, ErrInternal)
+				return
+			}
+			if count <= 1 {
+				respondError(c, http.StatusConflict, ErrLastSignInMethod)
+				return
+			}
+		}
+
+		if err := repo.DeleteUserIdentity(identityID, user.ID); err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				respondError(c, http.StatusNotFound, ErrNotFound)
+				return
+			}
+			log.Printf("Ошибка отвязки учётной записи OIDC: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		respond(c, http.StatusOK, gin.H{"unlinked": true})
+	}
+}
+
+// IdentitiesPage - страница привязанных учётных записей
+func IdentitiesPage(repo *models.Repository, providers *oidc.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := repo.GetUserByUsername(c.GetString("username"))
+		if err != nil {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+
+		identities, err := repo.GetUserIdentities(user.ID)
+		if err != nil {
+			log.Printf("Ошибка получения учётных записей OIDC: %v", err)
+		}
+
+		renderHTML(c, http.StatusOK, "account_identities.html", gin.H{
+			"title":       "Внешние аккаунты",
+			"user":        user,
+			"identities":  identities,
+			"sso":         ssoButtons(providers),
+			"hasPassword": user.Password != models.ExternalPassword,
+		})
+	}
+}
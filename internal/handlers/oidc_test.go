@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"unitycn/internal/auth"
+	"unitycn/internal/models"
+	"unitycn/internal/oidc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeOIDCUsers - пользователи и внешние учётные записи в памяти
+type fakeOIDCUsers struct {
+	users      []*models.User
+	identities []*models.UserIdentity
+	touched    []int
+}
+
+func (f *fakeOIDCUsers) GetUserIdentity(provider, subject string) (*models.UserIdentity, error) {
+	for _, identity := range f.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeOIDCUsers) CreateUserIdentity(userID int, provider, subject, email string) error {
+	f.identities = append(f.identities, &models.UserIdentity{
+		ID: len(f.identities) + 1, UserID: userID, Provider: provider, Subject: subject, Email: email,
+	})
+	return nil
+}
+
+func (f *fakeOIDCUsers) TouchUserIdentity(identityID int, email string) error {
+	f.touched = append(f.touched, identityID)
+	return nil
+}
+
+func (f *fakeOIDCUsers) GetUserByID(id int) (*models.User, error) {
+	for _, user := range f.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeOIDCUsers) GetUserByEmail(email string) (*models.User, error) {
+	for _, user := range f.users {
+		if user.EmailVerifiedAt != nil && strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeOIDCUsers) CreateExternalUser(username, displayName, email, role string) (*models.User, error) {
+	user := &models.User{
+		ID: len(f.users) + 1, Username: username, DisplayName: displayName,
+		Password: models.ExternalPassword, Role: role, Email: email,
+	}
+	if email != "" {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	f.users = append(f.users, user)
+	return user, nil
+}
+
+func (f *fakeOIDCUsers) UsernameTaken(username string) (bool, error) {
+	for _, user := range f.users {
+		if user.Username == username {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newFakeOIDCUsers - один пользователь comrade с подтверждённым email
+func newFakeOIDCUsers() *fakeOIDCUsers {
+	verified := time.Now()
+	return &fakeOIDCUsers{users: []*models.User{{
+		ID: 1, Username: "comrade", Role: "user", Email: "Comrade@Example.com", EmailVerifiedAt: &verified,
+	}}}
+}
+
+func testOIDCClaims(email string, verified bool) *oidc.Claims {
+	return &oidc.Claims{
+		Subject:           "subject-1",
+		Email:             email,
+		EmailVerified:     verified,
+		PreferredUsername: "comrade",
+		Raw:               map[string]interface{}{"groups": []interface{}{"staff"}},
+	}
+}
+
+func TestResolveOIDCUserLinksVerifiedEmail(t *testing.T) {
+	users := newFakeOIDCUsers()
+	provider := &oidc.Provider{Config: oidc.ProviderConfig{Name: "mock", LinkByEmail: true}}
+
+	user, status, code := resolveOIDCUser(users, provider, testOIDCClaims("comrade@example.com", true))
+	if user == nil || user.ID != 1 {
+		t.Fatalf("пользователь %+v (%d %s), ожидалась привязка к comrade", user, status, code)
+	}
+	if len(users.identities) != 1 || users.identities[0].UserID != 1 || users.identities[0].Subject != "subject-1" {
+		t.Fatalf("учётные записи: %+v", users.identities)
+	}
+
+	// Повторный вход находит привязанную учётную запись
+	user, _, _ = resolveOIDCUser(users, provider, testOIDCClaims("comrade@example.com", true))
+	if user == nil || user.ID != 1 || len(users.identities) != 1 || len(users.touched) != 1 {
+		t.Fatalf("повторный вход: %+v, учётные записи %d, обновлений %d", user, len(users.identities), len(users.touched))
+	}
+}
+
+func TestResolveOIDCUserIgnoresUnverifiedEmail(t *testing.T) {
+	users := newFakeOIDCUsers()
+	provider := &oidc.Provider{Config: oidc.ProviderConfig{Name: "mock", LinkByEmail: true}}
+
+	user, status, code := resolveOIDCUser(users, provider, testOIDCClaims("comrade@example.com", false))
+	if user != nil || status != http.StatusForbidden || code != ErrSSONoAccount {
+		t.Fatalf("неподтверждённый email: %+v (%d %s), ожидался отказ", user, status, code)
+	}
+	if len(users.identities) != 0 {
+		t.Fatalf("учётная запись привязана по неподтверждённому email: %+v", users.identities)
+	}
+
+	// С регистрацией создаётся новый пользователь, email без подтверждения не сохраняется
+	provider.Config.AllowSignup = true
+	user, _, _ = resolveOIDCUser(users, provider, testOIDCClaims("comrade@example.com", false))
+	if user == nil || user.ID == 1 || user.Email != "" || user.Username != "comrade_2" {
+		t.Fatalf("новый пользователь: %+v", user)
+	}
+}
+
+func TestResolveOIDCUserWithoutLinkByEmail(t *testing.T) {
+	users := newFakeOIDCUsers()
+	provider := &oidc.Provider{Config: oidc.ProviderConfig{Name: "mock", AllowSignup: true}}
+
+	user, _, _ := resolveOIDCUser(users, provider, testOIDCClaims("comrade@example.com", true))
+	if user == nil || user.ID == 1 {
+		t.Fatalf("привязка по email без link_by_email: %+v", user)
+	}
+	// Занятый email новому пользователю не достаётся
+	if user.Email != "" {
+		t.Fatalf("email %q занят другим пользователем", user.Email)
+	}
+}
+
+func TestResolveOIDCUserMapsRole(t *testing.T) {
+	users := newFakeOIDCUsers()
+	provider := &oidc.Provider{Config: oidc.ProviderConfig{
+		Name:        "mock",
+		AllowSignup: true,
+		RoleClaim:   "groups",
+		RoleMapping: map[string]string{"staff": "moderator"},
+		DefaultRole: "user",
+	}}
+
+	claims := testOIDCClaims("new@example.com", true)
+	claims.Subject = "subject-2"
+	user, _, _ := resolveOIDCUser(users, provider, claims)
+	if user == nil || user.Role != "moderator" || user.Email != "new@example.com" {
+		t.Fatalf("новый пользователь: %+v, ожидалась роль moderator", user)
+	}
+
+	claims.Subject = "subject-3"
+	claims.Raw = map[string]interface{}{"groups": []interface{}{"other"}}
+	user, _, _ = resolveOIDCUser(users, provider, claims)
+	if user == nil || user.Role != "user" {
+		t.Fatalf("без сопоставленной группы: %+v, ожидалась роль по умолчанию", user)
+	}
+}
+
+func TestLinkIdentityConflict(t *testing.T) {
+	users := newFakeOIDCUsers()
+	provider := &oidc.Provider{Config: oidc.ProviderConfig{Name: "mock"}}
+	claims := testOIDCClaims("comrade@example.com", true)
+
+	if status, code := linkIdentity(users, provider, claims, 1); code != "" {
+		t.Fatalf("привязка: %d %s", status, code)
+	}
+	if status, code := linkIdentity(users, provider, claims, 1); code != "" {
+		t.Fatalf("повторная привязка к тому же пользователю: %d %s", status, code)
+	}
+	if status, code := linkIdentity(users, provider, claims, 2); status != http.StatusConflict || code != ErrIdentityLinked {
+		t.Fatalf("привязка к другому пользователю: %d %s", status, code)
+	}
+}
+
+// newTestTokens - сервис токенов с временным ключом
+func newTestTokens(t *testing.T) *auth.Service {
+	t.Helper()
+	key, err := auth.GenerateKey(t.TempDir(), auth.AlgEdDSA)
+	if err != nil {
+		t.Fatalf("ключ: %v", err)
+	}
+	tokens, err := auth.NewServiceWithKeys(auth.Config{}, []*auth.Key{key})
+	if err != nil {
+		t.Fatalf("сервис токенов: %v", err)
+	}
+	return tokens
+}
+
+// newTestProviders - провайдеры mock и other с общим документом discovery
+func newTestProviders(t *testing.T) *oidc.Registry {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/jwks",
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	var configs []oidc.ProviderConfig
+	for _, name := range []string{"mock", "other"} {
+		configs = append(configs, oidc.ProviderConfig{
+			Name: name, Issuer: server.URL, ClientID: "unitycn",
+			RedirectURL: "https://unitycn.example/auth/oidc/" + name + "/callback",
+		})
+	}
+	providers, err := oidc.NewRegistry(oidc.Config{Providers: configs})
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	return providers
+}
+
+// startOIDCLogin - переход на вход провайдера; кука состояния и параметры адреса входа
+func startOIDCLogin(t *testing.T, tokens *auth.Service, providers *oidc.Registry) (*http.Cookie, url.Values) {
+	t.Helper()
+	r := gin.New()
+	r.GET("/auth/oidc/:provider", OIDCLogin(tokens, providers))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("статус %d, ожидался переход к провайдеру", w.Code)
+	}
+	target, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("адрес входа: %v", err)
+	}
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			if cookie.Path != oidcStatePath || !cookie.HttpOnly {
+				t.Fatalf("кука состояния: %+v", cookie)
+			}
+			return cookie, target.Query()
+		}
+	}
+	t.Fatal("нет куки состояния")
+	return nil, nil
+}
+
+// callbackState - readOIDCState для обратного вызова с параметром state
+func callbackState(tokens *auth.Service, provider, state string, cookie *http.Cookie) (*oidcState, bool, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet,
+		"/auth/oidc/"+provider+"/callback?code=x&state="+url.QueryEscape(state), nil)
+	if cookie != nil {
+		c.Request.AddCookie(cookie)
+	}
+	result, ok := readOIDCState(c, tokens, provider)
+	return result, ok, w
+}
+
+func TestOIDCState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens := newTestTokens(t)
+	providers := newTestProviders(t)
+	cookie, query := startOIDCLogin(t, tokens, providers)
+
+	state, ok, w := callbackState(tokens, "mock", query.Get("state"), cookie)
+	if !ok {
+		t.Fatal("верное состояние отклонено")
+	}
+	if state.nonce != query.Get("nonce") || oidc.Challenge(state.verifier) != query.Get("code_challenge") {
+		t.Fatalf("состояние не совпадает с запросом входа: %+v, %v", state, query)
+	}
+	if cleared := w.Header().Get("Set-Cookie"); !strings.Contains(cleared, oidcStateCookie+"=;") {
+		t.Fatalf("кука состояния не удалена: %q", cleared)
+	}
+}
+
+func TestOIDCStateMismatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens := newTestTokens(t)
+	providers := newTestProviders(t)
+	cookie, query := startOIDCLogin(t, tokens, providers)
+
+	// Кука, подписанная другим ключом, с совпадающим state
+	foreign, foreignQuery := startOIDCLogin(t, newTestTokens(t), providers)
+
+	tests := []struct {
+		name     string
+		provider string
+		state    string
+		cookie   *http.Cookie
+	}{
+		{"другой state", "mock", "attacker-state", cookie},
+		{"пустой state", "mock", "", cookie},
+		{"нет куки", "mock", query.Get("state"), nil},
+		{"другой провайдер", "other", query.Get("state"), cookie},
+		{"чужая подпись", "mock", foreignQuery.Get("state"), foreign},
+	}
+	for _, tt := range tests {
+		if _, ok, _ := callbackState(tokens, tt.provider, tt.state, tt.cookie); ok {
+			t.Errorf("%s: состояние принято", tt.name)
+		}
+	}
+}
+
+// TestOIDCLinkRequiresCookieSession - привязку начинает только сессия в куке
+// браузера; персональный токен API или токен в заголовке ведут на /login
+func TestOIDCLinkRequiresCookieSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens := newTestTokens(t)
+	providers := newTestProviders(t)
+
+	tests := []struct {
+		name    string
+		context map[string]any
+		linked  bool
+	}{
+		{"гость", nil, false},
+		{"сессия в куке", map[string]any{"user_id": 7, sessionCookieKey: true}, true},
+		{"токен сессии в заголовке", map[string]any{"user_id": 7, sessionCookieKey: false}, false},
+		{"персональный токен API", map[string]any{"user_id": 7, "api_token_id": 3}, false},
+	}
+	for _, tt := range tests {
+		r := gin.New()
+		r.GET("/auth/oidc/:provider", func(c *gin.Context) {
+			for k, v := range tt.context {
+				c.Set(k, v)
+			}
+		}, OIDCLogin(tokens, providers))
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock?link=1", nil))
+		toLogin := w.Header().Get("Location") == "/login"
+		if w.Code != http.StatusFound || toLogin == tt.linked {
+			t.Errorf("%s: статус %d, переход на %q", tt.name, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
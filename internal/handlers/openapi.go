@@ -0,0 +1,504 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"unitycn/internal/archive"
+	"unitycn/internal/models"
+	"unitycn/internal/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeDoc - описание маршрута для OpenAPI. Схемы берутся из типов,
+// которые обработчики реально принимают и возвращают.
+type routeDoc struct {
+	method   string
+	path     string // путь gin
+	summary  string
+	tag      string
+	auth     bool        // нужен токен
+	request  interface{} // тело JSON
+	form     []string    // поля веб-формы (application/x-www-form-urlencoded)
+	response interface{} // содержимое data
+	paged    bool        // список с пагинацией
+	html     bool        // веб-страница
+	query    []string    // query-параметры
+}
+
+// apiRouteDocs - маршруты registerAPIRoutes (пути относительно /api/v1)
+var apiRouteDocs = []routeDoc{
+	{method: "POST", path: "/login", summary: "Вход по логину и паролю", tag: "auth",
+		request: loginRequest{}, response: sessionResult{}},
+	{method: "POST", path: "/register", summary: "Регистрация с автоматическим входом", tag: "auth",
+		request: registerRequest{}, response: sessionResult{}},
+	{method: "POST", path: "/login/2fa", summary: "Второй шаг входа: код 2FA по mfa_token", tag: "auth",
+		request: twoFactorLoginRequest{}, response: sessionResult{}},
+	{method: "POST", path: "/logout", summary: "Выход (удаление куки)", tag: "auth"},
+	{method: "POST", path: "/password/forgot", summary: "Письмо со ссылкой сброса пароля (ответ не зависит от наличия аккаунта)", tag: "auth",
+		request: forgotPasswordRequest{}},
+	{method: "POST", path: "/password/reset", summary: "Новый пароль по ссылке из письма", tag: "auth",
+		request: resetPasswordRequest{}},
+	{method: "POST", path: "/email/verify", summary: "Подтверждение email по ссылке из письма", tag: "auth",
+		request: emailTokenRequest{}},
+	{method: "GET", path: "/posts", summary: "Лента постов (без заблокированных и скрытых авторов и недоступных сообществ)", tag: "posts",
+		response: []models.Post{}, paged: true},
+	{method: "GET", path: "/posts/:id", summary: "Пост с автором", tag: "posts",
+		response: models.Post{}},
+	{method: "GET", path: "/reactions", summary: "Реакции, которые можно ставить", tag: "reactions",
+		response: Reactions{}},
+	{method: "GET", path: "/posts/:id/reactions", summary: "Кто поставил реакции на пост (?reaction= - одну)", tag: "reactions",
+		response: []models.Reactor{}, paged: true, query: []string{"reaction"}},
+	{method: "GET", path: "/comments/:id/reactions", summary: "Кто поставил реакции на комментарий", tag: "reactions",
+		response: []models.Reactor{}, paged: true, query: []string{"reaction"}},
+	{method: "GET", path: "/heroes", summary: "Герои", tag: "heroes",
+		response: []models.Hero{}},
+	{method: "GET", path: "/users/:username", summary: "Профиль пользователя со счётчиками", tag: "users",
+		response: models.UserProfile{}},
+	{method: "GET", path: "/users/:username/posts", summary: "Посты пользователя", tag: "users",
+		response: []models.Post{}, paged: true},
+	{method: "GET", path: "/communities", summary: "Сообщества (чужие по приглашениям не показываются)", tag: "communities",
+		response: []models.Community{}, paged: true},
+	{method: "GET", path: "/communities/:slug", summary: "Сообщество и участие в нём", tag: "communities",
+		response: models.Community{}},
+	{method: "GET", path: "/communities/:slug/posts", summary: "Лента сообщества (закрытого - только участникам)", tag: "communities",
+		response: []models.Post{}, paged: true},
+	{method: "GET", path: "/communities/:slug/members", summary: "Участники; заявки и приглашения - модераторам", tag: "communities",
+		response: []models.CommunityMember{}, paged: true, query: []string{"status"}},
+	{method: "GET", path: "/me", summary: "Свой профиль", tag: "users", auth: true,
+		response: myProfile{}},
+	{method: "PATCH", path: "/me", summary: "Изменить имя, о себе, аватар или язык", tag: "users", auth: true,
+		request: profileRequest{}, response: myProfile{}},
+	{method: "GET", path: "/me/export", summary: "Архив своих данных (tar.gz): профиль, посты, комментарии, реакции, закладки, входы", tag: "users", auth: true},
+	{method: "GET", path: "/me/deletion", summary: "Запрошено ли удаление аккаунта", tag: "users", auth: true,
+		response: deletionStatus{}},
+	{method: "POST", path: "/me/deletion", summary: "Удалить аккаунт после отсрочки (пароль и код 2FA)", tag: "users", auth: true,
+		request: deletionRequest{}, response: deletionStatus{}},
+	{method: "DELETE", path: "/me/deletion", summary: "Отменить удаление аккаунта", tag: "users", auth: true,
+		response: deletionStatus{}},
+	{method: "GET", path: "/me/blocks", summary: "Заблокированные пользователи", tag: "users", auth: true,
+		response: []models.RelatedUser{}},
+	{method: "GET", path: "/me/mutes", summary: "Пользователи, скрытые из ленты", tag: "users", auth: true,
+		response: []models.RelatedUser{}},
+	{method: "GET", path: "/me/bookmarks", summary: "Закладки, последние сверху (?collection= - одна подборка)", tag: "bookmarks", auth: true,
+		response: []models.Bookmark{}, paged: true, query: []string{"collection"}},
+	{method: "GET", path: "/me/bookmarks/collections", summary: "Подборки закладок", tag: "bookmarks", auth: true,
+		response: []models.BookmarkCollection{}},
+	{method: "POST", path: "/me/bookmarks/collections", summary: "Создать подборку", tag: "bookmarks", auth: true,
+		request: collectionRequest{}, response: models.BookmarkCollection{}},
+	{method: "PATCH", path: "/me/bookmarks/collections/:id", summary: "Переименовать подборку", tag: "bookmarks", auth: true,
+		request: collectionRequest{}, response: models.BookmarkCollection{}},
+	{method: "DELETE", path: "/me/bookmarks/collections/:id", summary: "Удалить подборку (закладки остаются без подборки)", tag: "bookmarks", auth: true},
+	{method: "POST", path: "/users/:username/block", summary: "Заблокировать пользователя", tag: "users", auth: true,
+		response: relationResult{}},
+	{method: "DELETE", path: "/users/:username/block", summary: "Разблокировать пользователя", tag: "users", auth: true,
+		response: relationResult{}},
+	{method: "POST", path: "/users/:username/mute", summary: "Скрыть посты пользователя из ленты", tag: "users", auth: true,
+		response: relationResult{}},
+	{method: "DELETE", path: "/users/:username/mute", summary: "Вернуть посты пользователя в ленту", tag: "users", auth: true,
+		response: relationResult{}},
+	{method: "GET", path: "/me/events", summary: "Поток событий text/event-stream: unread, message, conversation, read", tag: "messages", auth: true},
+	{method: "GET", path: "/me/login-events", summary: "История входов текущего пользователя", tag: "auth", auth: true,
+		response: []models.LoginEvent{}, paged: true},
+	{method: "GET", path: "/me/2fa", summary: "Состояние 2FA", tag: "auth", auth: true,
+		response: twoFactorStatus{}},
+	{method: "POST", path: "/me/2fa/setup", summary: "Новый секрет TOTP и otpauth:// ссылка", tag: "auth", auth: true,
+		response: twoFactorSetup{}},
+	{method: "POST", path: "/me/2fa/enable", summary: "Включить 2FA первым кодом", tag: "auth", auth: true,
+		request: twoFactorCodeRequest{}, response: recoveryCodesResult{}},
+	{method: "POST", path: "/me/2fa/disable", summary: "Отключить 2FA (пароль и код)", tag: "auth", auth: true,
+		request: twoFactorDisableRequest{}},
+	{method: "POST", path: "/me/2fa/recovery-codes", summary: "Новые коды восстановления", tag: "auth", auth: true,
+		request: twoFactorCodeRequest{}, response: recoveryCodesResult{}},
+	{method: "GET", path: "/me/tokens", summary: "Персональные токены API", tag: "auth", auth: true,
+		response: []models.APIToken{}},
+	{method: "POST", path: "/me/tokens", summary: "Выпустить токен (показывается один раз)", tag: "auth", auth: true,
+		request: apiTokenRequest{}, response: apiTokenCreated{}},
+	{method: "DELETE", path: "/me/tokens/:id", summary: "Отозвать токен", tag: "auth", auth: true},
+	{method: "GET", path: "/me/identities", summary: "Привязанные внешние учётные записи (OIDC)", tag: "auth", auth: true,
+		response: identitiesResult{}},
+	{method: "DELETE", path: "/me/identities/:id", summary: "Отвязать внешнюю учётную запись", tag: "auth", auth: true},
+	{method: "GET", path: "/me/email", summary: "Email текущего пользователя", tag: "auth", auth: true,
+		response: emailStatus{}},
+	{method: "POST", path: "/me/email", summary: "Сменить email и отправить письмо для подтверждения", tag: "auth", auth: true,
+		request: emailRequest{}, response: emailStatus{}},
+	{method: "POST", path: "/posts", summary: "Создание поста (с quote - цитаты)", tag: "posts", auth: true,
+		request: postRequest{}, response: models.Post{}},
+	{method: "POST", path: "/posts/:id/like", summary: "Поставить или убрать лайк (реакция like)", tag: "posts", auth: true,
+		response: likeResult{}},
+	{method: "POST", path: "/posts/:id/repost", summary: "Репост в общую ленту (репост репоста - репост исходного)", tag: "posts", auth: true,
+		response: repostResult{}},
+	{method: "DELETE", path: "/posts/:id/repost", summary: "Отменить свой репост", tag: "posts", auth: true,
+		response: repostResult{}},
+	{method: "POST", path: "/posts/:id/reactions/:reaction", summary: "Поставить или снять реакцию на пост", tag: "reactions", auth: true,
+		response: reactionResult{}},
+	{method: "POST", path: "/comments/:id/reactions/:reaction", summary: "Поставить или снять реакцию на комментарий", tag: "reactions", auth: true,
+		response: reactionResult{}},
+	{method: "PUT", path: "/posts/:id/bookmark", summary: "Добавить пост в закладки или переложить в другую подборку", tag: "bookmarks", auth: true,
+		request: bookmarkRequest{}, response: bookmarkResult{}},
+	{method: "DELETE", path: "/posts/:id/bookmark", summary: "Убрать пост из закладок", tag: "bookmarks", auth: true,
+		response: bookmarkResult{}},
+	{method: "POST", path: "/posts/:id/comments", summary: "Комментарий к посту", tag: "comments", auth: true,
+		request: commentRequest{}, response: models.Comment{}},
+	{method: "GET", path: "/posts/:id/comments", summary: "Комментарии поста (?sort=top - по лайкам)", tag: "comments", auth: true,
+		response: []models.Comment{}, query: []string{"sort"}},
+	{method: "POST", path: "/comments/:id/like", summary: "Поставить или убрать лайк комментария (реакция like)", tag: "comments", auth: true,
+		response: commentLikeResult{}},
+	{method: "DELETE", path: "/comments/:id", summary: "Удаление своего комментария", tag: "comments", auth: true},
+	{method: "GET", path: "/me/communities", summary: "Свои сообщества, заявки и приглашения", tag: "communities", auth: true,
+		response: []models.Community{}},
+	{method: "POST", path: "/communities", summary: "Создать сообщество (создатель - владелец)", tag: "communities", auth: true,
+		request: communityRequest{}, response: models.Community{}},
+	{method: "PATCH", path: "/communities/:slug", summary: "Изменить название, описание или режим (владелец)", tag: "communities", auth: true,
+		request: communityUpdateRequest{}, response: models.Community{}},
+	{method: "POST", path: "/communities/:slug/join", summary: "Вступить, подать заявку или принять приглашение", tag: "communities", auth: true,
+		response: membershipResult{}},
+	{method: "POST", path: "/communities/:slug/leave", summary: "Выйти, отозвать заявку или отклонить приглашение", tag: "communities", auth: true,
+		response: membershipResult{}},
+	{method: "POST", path: "/communities/:slug/members/:username", summary: "Одобрить заявку или пригласить (модератор)", tag: "communities", auth: true,
+		response: membershipResult{}},
+	{method: "DELETE", path: "/communities/:slug/members/:username", summary: "Исключить, отклонить заявку или отозвать приглашение (модератор)", tag: "communities", auth: true,
+		response: membershipResult{}},
+	{method: "PUT", path: "/communities/:slug/moderators/:username", summary: "Назначить модератора (владелец)", tag: "communities", auth: true,
+		response: membershipResult{}},
+	{method: "DELETE", path: "/communities/:slug/moderators/:username", summary: "Снять модератора (владелец)", tag: "communities", auth: true,
+		response: membershipResult{}},
+	{method: "DELETE", path: "/communities/:slug/posts/:id", summary: "Удалить пост сообщества (модератор)", tag: "communities", auth: true},
+	{method: "DELETE", path: "/communities/:slug/comments/:id", summary: "Удалить комментарий к посту сообщества (модератор)", tag: "communities", auth: true},
+	{method: "GET", path: "/conversations", summary: "Свои диалоги: последнее сообщение и непрочитанные", tag: "messages", auth: true,
+		response: []models.Conversation{}, paged: true},
+	{method: "POST", path: "/conversations", summary: "Личный диалог (существующий вернётся) или группа", tag: "messages", auth: true,
+		request: conversationRequest{}, response: models.Conversation{}},
+	{method: "GET", path: "/conversations/unread", summary: "Количество непрочитанных сообщений", tag: "messages", auth: true,
+		response: unreadResult{}},
+	{method: "GET", path: "/conversations/:id", summary: "Диалог (только для участников)", tag: "messages", auth: true,
+		response: models.Conversation{}},
+	{method: "DELETE", path: "/conversations/:id", summary: "Удалить диалог для себя (у остальных остаётся)", tag: "messages", auth: true},
+	{method: "GET", path: "/conversations/:id/messages", summary: "Сообщения диалога, новые сверху", tag: "messages", auth: true,
+		response: []models.Message{}, paged: true},
+	{method: "POST", path: "/conversations/:id/messages", summary: "Отправить сообщение", tag: "messages", auth: true,
+		request: messageRequest{}, response: models.Message{}},
+	{method: "POST", path: "/conversations/:id/read", summary: "Отметить диалог прочитанным", tag: "messages", auth: true,
+		response: unreadResult{}},
+}
+
+// siteRouteDocs - веб-страницы, админка и документация (полные пути)
+var siteRouteDocs = []routeDoc{
+	{method: "GET", path: "/", summary: "Главная страница", tag: "web", html: true},
+	{method: "GET", path: "/login", summary: "Страница входа", tag: "web", html: true},
+	{method: "GET", path: "/register", summary: "Страница регистрации", tag: "web", html: true},
+	{method: "GET", path: "/logout", summary: "Выход с переходом на главную", tag: "web", html: true},
+	{method: "GET", path: "/u/:username", summary: "Страница пользователя с его постами", tag: "web", html: true,
+		query: []string{"page"}},
+	{method: "GET", path: "/c", summary: "Сообщества: список, свои и создание", tag: "web", html: true,
+		query: []string{"page"}},
+	{method: "GET", path: "/c/:slug", summary: "Страница сообщества с лентой", tag: "web", html: true,
+		query: []string{"page"}},
+	{method: "POST", path: "/login", summary: "Вход через веб-форму", tag: "web", html: true,
+		form: []string{"username", "password"}},
+	{method: "POST", path: "/register", summary: "Регистрация через веб-форму", tag: "web", html: true,
+		form: []string{"username", "password", "display_name", "email"}},
+	{method: "GET", path: "/forgot-password", summary: "Форма восстановления пароля", tag: "web", html: true},
+	{method: "POST", path: "/forgot-password", summary: "Запрос письма для сброса пароля", tag: "web", html: true,
+		form: []string{"login"}},
+	{method: "GET", path: "/reset-password", summary: "Форма нового пароля по ссылке из письма", tag: "web", html: true,
+		query: []string{"token"}},
+	{method: "POST", path: "/reset-password", summary: "Сохранение нового пароля", tag: "web", html: true,
+		form: []string{"token", "password"}},
+	{method: "GET", path: "/verify-email", summary: "Подтверждение email по ссылке из письма", tag: "web", html: true,
+		query: []string{"token"}},
+	{method: "POST", path: "/login/2fa", summary: "Второй шаг входа через веб-форму", tag: "web", html: true,
+		form: []string{"mfa_token", "code"}},
+	{method: "GET", path: "/account/profile", summary: "Редактирование профиля", tag: "web", auth: true, html: true},
+	{method: "GET", path: "/account/delete", summary: "Выгрузка данных и удаление аккаунта", tag: "web", auth: true, html: true},
+	{method: "GET", path: "/messages", summary: "Личные сообщения", tag: "web", auth: true, html: true,
+		query: []string{"c"}},
+	{method: "GET", path: "/account/blocks", summary: "Заблокированные и скрытые пользователи", tag: "web", auth: true, html: true},
+	{method: "GET", path: "/account/bookmarks", summary: "Закладки и подборки", tag: "web", auth: true, html: true,
+		query: []string{"collection", "page"}},
+	{method: "GET", path: "/account/2fa", summary: "Подключение двухфакторной аутентификации", tag: "web", auth: true, html: true},
+	{method: "GET", path: "/account/tokens", summary: "Управление токенами API", tag: "web", auth: true, html: true},
+	{method: "GET", path: "/account/identities", summary: "Привязанные внешние учётные записи", tag: "web", auth: true, html: true},
+	{method: "GET", path: "/account/email", summary: "Email для восстановления пароля", tag: "web", auth: true, html: true},
+	{method: "GET", path: "/auth/oidc/:provider", summary: "Переход ко входу через провайдера OIDC (link=1 - привязка)", tag: "web", html: true,
+		query: []string{"link"}},
+	{method: "GET", path: "/auth/oidc/:provider/callback", summary: "Возврат от провайдера OIDC", tag: "web", html: true,
+		query: []string{"code", "state", "error"}},
+
+	{method: "POST", path: "/csp-report", summary: "Отчёт браузера о нарушении CSP (application/csp-report или application/reports+json)", tag: "docs"},
+	{method: "GET", path: "/.well-known/jwks.json", summary: "Открытые ключи для проверки токенов сессии (JWKS)", tag: "docs"},
+	{method: "GET", path: "/api/openapi.json", summary: "Этот документ", tag: "docs"},
+	{method: "GET", path: "/api/docs", summary: "Просмотр документации", tag: "docs", html: true},
+
+	{method: "GET", path: "/admin/", summary: "Дашборд", tag: "admin", auth: true, html: true},
+	{method: "GET", path: "/admin/export", summary: "Скачать архив всех данных", tag: "admin", auth: true,
+		query: []string{"include_passwords"}},
+	{method: "POST", path: "/admin/import", summary: "Загрузить архив (multipart, поле archive)", tag: "admin", auth: true,
+		form: []string{"archive", "dry_run"}, response: archive.Report{}},
+	{method: "GET", path: "/admin/ratelimits", summary: "Ограничения запросов и клиенты с отказами", tag: "admin", auth: true, html: true},
+	{method: "POST", path: "/admin/ratelimits/reset", summary: "Сбросить счётчики отказов", tag: "admin", auth: true},
+	{method: "GET", path: "/admin/csp", summary: "Нарушения Content-Security-Policy", tag: "admin", auth: true, html: true},
+	{method: "POST", path: "/admin/csp/reset", summary: "Очистить список нарушений CSP", tag: "admin", auth: true},
+	{method: "GET", path: "/admin/users", summary: "Пользователи", tag: "admin", auth: true, html: true},
+	{method: "PUT", path: "/admin/users/:id/role", summary: "Смена роли", tag: "admin", auth: true,
+		request: roleRequest{}},
+	{method: "DELETE", path: "/admin/users/:id", summary: "Удаление пользователя", tag: "admin", auth: true},
+	{method: "POST", path: "/admin/users/:id/unlock", summary: "Снять временную блокировку входа", tag: "admin", auth: true},
+	{method: "GET", path: "/admin/posts", summary: "Посты", tag: "admin", auth: true, html: true},
+	{method: "GET", path: "/admin/posts/:id/edit", summary: "Редактирование поста", tag: "admin", auth: true, html: true},
+	{method: "POST", path: "/admin/posts/:id", summary: "Сохранение поста", tag: "admin", auth: true,
+		request: postRequest{}},
+	{method: "DELETE", path: "/admin/posts/:id", summary: "Удаление поста", tag: "admin", auth: true},
+	{method: "GET", path: "/admin/comments", summary: "Комментарии", tag: "admin", auth: true, html: true},
+	{method: "DELETE", path: "/admin/comments/:id", summary: "Удаление комментария", tag: "admin", auth: true},
+	{method: "GET", path: "/admin/heroes", summary: "Герои", tag: "admin", auth: true, html: true},
+	{method: "POST", path: "/admin/heroes", summary: "Создание героя", tag: "admin", auth: true,
+		request: heroRequest{}},
+	{method: "PUT", path: "/admin/heroes/:id", summary: "Обновление героя", tag: "admin", auth: true,
+		request: heroRequest{}},
+	{method: "DELETE", path: "/admin/heroes/:id", summary: "Удаление героя", tag: "admin", auth: true},
+	{method: "GET", path: "/admin/heroes/:id", summary: "Герой по ID (не реализовано)", tag: "admin", auth: true},
+}
+
+var (
+	specOnce sync.Once
+	spec     *openapi.Document
+)
+
+// OpenAPIDocument - OpenAPI 3 описание всех маршрутов RegisterRoutes
+func OpenAPIDocument() *openapi.Document {
+	specOnce.Do(func() {
+		spec = buildOpenAPI()
+	})
+	return spec
+}
+
+func buildOpenAPI() *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:   "Единство 团结 API",
+		Version: "1.0.0",
+		Description: "Ответы JSON имеют вид {data, error{code, message, details}, pagination}. " +
+			"Пути /api/... - устаревший алиас /api/v1/....",
+	})
+	doc.Tags = []openapi.Tag{
+		{Name: "auth"}, {Name: "users"}, {Name: "posts"}, {Name: "comments"}, {Name: "reactions"}, {Name: "bookmarks"}, {Name: "communities"}, {Name: "messages"}, {Name: "heroes"},
+		{Name: "web", Description: "HTML страницы"}, {Name: "admin"}, {Name: "docs"},
+	}
+	doc.Components.SecuritySchemes["bearerAuth"] = &openapi.SecurityScheme{
+		Type: "http", Scheme: "bearer", BearerFormat: "JWT",
+	}
+	doc.Components.SecuritySchemes["cookieAuth"] = &openapi.SecurityScheme{
+		Type: "apiKey", In: "cookie", Name: "token",
+		Description: "Сессия браузера. Изменяющие запросы с этой кукой (и веб-формы) " +
+			"передают значение куки csrf_token в заголовке X-CSRF-Token или поле csrf_token.",
+	}
+	doc.Components.SecuritySchemes["apiToken"] = &openapi.SecurityScheme{
+		Type: "http", Scheme: "bearer", BearerFormat: "ucn_...",
+		Description: "Персональный токен API (/account/tokens). Открывает только маршруты, " +
+			"где указан, и только с нужной областью доступа.",
+	}
+	doc.SchemaOf(APIError{})
+	doc.Components.Schemas["ErrorEnvelope"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"data":  {Nullable: true},
+			"error": {Ref: "#/components/schemas/APIError"},
+		},
+		Required: []string{"data", "error"},
+	}
+
+	for _, rd := range apiRouteDocs {
+		addOperation(doc, "/api/v1", rd, false)
+		addOperation(doc, "/api", rd, true)
+	}
+	for _, rd := range siteRouteDocs {
+		addOperation(doc, "", rd, false)
+	}
+
+	return doc
+}
+
+func addOperation(doc *openapi.Document, prefix string, rd routeDoc, deprecated bool) {
+	ginPath := prefix + rd.path
+	op := &openapi.Operation{
+		Summary:     rd.summary,
+		OperationID: operationID(rd.method, ginPath),
+		Tags:        []string{rd.tag},
+		Deprecated:  deprecated,
+		Responses:   make(map[string]*openapi.Response),
+	}
+
+	for _, name := range openapi.PathParams(ginPath) {
+		schema := &openapi.Schema{Type: "string"}
+		if name == "id" {
+			schema = &openapi.Schema{Type: "integer"}
+		}
+		op.Parameters = append(op.Parameters, openapi.Parameter{
+			Name: name, In: "path", Required: true, Schema: schema,
+		})
+	}
+	if rd.paged {
+		for _, name := range []string{"page", "per_page"} {
+			op.Parameters = append(op.Parameters, openapi.Parameter{
+				Name: name, In: "query", Schema: &openapi.Schema{Type: "integer"},
+			})
+		}
+	}
+	for _, name := range rd.query {
+		op.Parameters = append(op.Parameters, openapi.Parameter{
+			Name: name, In: "query", Schema: &openapi.Schema{Type: "string"},
+		})
+	}
+	if !rd.html {
+		op.Parameters = append(op.Parameters, openapi.Parameter{
+			Name: "lang", In: "query", Description: "язык сообщений об ошибках",
+			Schema: &openapi.Schema{Type: "string", Enum: []string{"ru", "en"}},
+		})
+	}
+
+	if rd.request != nil {
+		op.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content: map[string]*openapi.MediaType{
+				"application/json": {Schema: doc.SchemaOf(rd.request)},
+			},
+		}
+	}
+	if len(rd.form) > 0 {
+		form := &openapi.Schema{Type: "object", Properties: make(map[string]*openapi.Schema)}
+		for _, field := range rd.form {
+			form.Properties[field] = &openapi.Schema{Type: "string"}
+		}
+		contentType := "application/x-www-form-urlencoded"
+		if rd.response != nil {
+			contentType = "multipart/form-data"
+		}
+		op.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]*openapi.MediaType{contentType: {Schema: form}},
+		}
+	}
+
+	switch {
+	case rd.html:
+		op.Responses["200"] = &openapi.Response{
+			Description: "HTML страница",
+			Content:     map[string]*openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}},
+		}
+	case ginPath == "/admin/export":
+		op.Responses["200"] = &openapi.Response{
+			Description: "tar.gz архив",
+			Content: map[string]*openapi.MediaType{
+				"application/gzip": {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+			},
+		}
+	case ginPath == "/csp-report":
+		op.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content: map[string]*openapi.MediaType{
+				"application/csp-report":   {Schema: &openapi.Schema{Type: "object"}},
+				"application/reports+json": {Schema: &openapi.Schema{Type: "array"}},
+			},
+		}
+		op.Responses["204"] = &openapi.Response{Description: "Отчёт принят"}
+	case ginPath == "/.well-known/jwks.json":
+		op.Responses["200"] = &openapi.Response{
+			Description: "JSON Web Key Set (RFC 7517)",
+			Content:     map[string]*openapi.MediaType{"application/jwk-set+json": {Schema: &openapi.Schema{Type: "object"}}},
+		}
+	case ginPath == "/api/openapi.json":
+		op.Responses["200"] = &openapi.Response{
+			Description: "OpenAPI 3 документ",
+			Content:     map[string]*openapi.MediaType{"application/json": {Schema: &openapi.Schema{Type: "object"}}},
+		}
+	default:
+		op.Responses["200"] = &openapi.Response{
+			Description: "Успешный ответ",
+			Content: map[string]*openapi.MediaType{
+				"application/json": {Schema: envelopeSchema(doc, rd)},
+			},
+		}
+	}
+	if !rd.html {
+		op.Responses["default"] = &openapi.Response{
+			Description: "Ошибка",
+			Content: map[string]*openapi.MediaType{
+				"application/json": {Schema: &openapi.Schema{Ref: "#/components/schemas/ErrorEnvelope"}},
+			},
+		}
+	}
+
+	if rd.auth {
+		op.Security = []map[string][]string{{"bearerAuth": {}}, {"cookieAuth": {}}}
+		if scope, ok := apiTokenRouteScopes[rd.method+" "+rd.path]; ok && prefix != "" {
+			op.Security = append(op.Security, map[string][]string{"apiToken": {}})
+			op.Description = "Токен API: область " + scope
+		}
+	}
+
+	doc.AddOperation(rd.method, openapi.PathFromGin(ginPath), op)
+}
+
+func envelopeSchema(doc *openapi.Document, rd routeDoc) *openapi.Schema {
+	schema := &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"data":  doc.SchemaOf(rd.response),
+			"error": {Nullable: true, AllOf: []*openapi.Schema{{Ref: "#/components/schemas/APIError"}}},
+		},
+		Required: []string{"data", "error"},
+	}
+	if rd.paged {
+		schema.Properties["pagination"] = doc.SchemaOf(Pagination{})
+	}
+	return schema
+}
+
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == ':' || r == '.' || r == '*'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// UndocumentedRoutes - зарегистрированные маршруты, которых нет в OpenAPI документе
+func UndocumentedRoutes(routes gin.RoutesInfo) []string {
+	doc := OpenAPIDocument()
+
+	var missing []string
+	for _, route := range routes {
+		if route.Method == http.MethodHead || strings.HasPrefix(route.Path, "/static/") {
+			continue
+		}
+		if !doc.HasOperation(route.Method, openapi.PathFromGin(route.Path)) {
+			missing = append(missing, fmt.Sprintf("%s %s", route.Method, route.Path))
+		}
+	}
+
+	sort.Strings(missing)
+	return missing
+}
+
+// OpenAPISpec - /api/openapi.json
+func OpenAPISpec() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, OpenAPIDocument())
+	}
+}
+
+// APIDocsPage - просмотр документации (Swagger UI)
+func APIDocsPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		renderHTML(c, http.StatusOK, "api_docs.html", gin.H{
+			"title":   "Единство 团结 API",
+			"specURL": "/api/openapi.json",
+		})
+	}
+}
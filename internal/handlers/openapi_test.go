@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"unitycn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestRoutesDocumented - каждый зарегистрированный маршрут описан в OpenAPI
+func TestRoutesDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutes(r, models.NewRepository(nil), nil, Options{})
+
+	if missing := UndocumentedRoutes(r.Routes()); len(missing) > 0 {
+		t.Fatalf("маршруты без описания в OpenAPI (%d):\n%s", len(missing), strings.Join(missing, "\n"))
+	}
+}
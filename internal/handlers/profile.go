@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"unitycn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === ПРОФИЛИ ПОЛЬЗОВАТЕЛЕЙ ===
+
+const (
+	maxDisplayNameLen = 50
+	maxBioLen         = 500
+	maxAvatarURLLen   = 500
+)
+
+// profileRequest - изменение профиля; поля, которых нет в запросе, не меняются
+type profileRequest struct {
+	DisplayName *string `json:"display_name,omitempty" doc:"1-50 символов"`
+	Bio         *string `json:"bio,omitempty" doc:"до 500 символов"`
+	AvatarURL   *string `json:"avatar_url,omitempty" doc:"адрес https:// или пустая строка"`
+	Locale      *string `json:"locale,omitempty" doc:"ru, en или пустая строка (язык по Accept-Language)"`
+}
+
+// myProfile - свой профиль: публичная часть и настройки
+type myProfile struct {
+	models.UserProfile
+	Locale string `json:"locale"`
+}
+
+// validDisplayName - непустое имя без управляющих символов
+func validDisplayName(name string) bool {
+	n := utf8.RuneCountInString(name)
+	if n == 0 || n > maxDisplayNameLen {
+		return false
+	}
+	return strings.IndexFunc(name, unicode.IsControl) < 0
+}
+
+// validAvatarURL - только https: страницы не загружают картинки по http (CSP img-src)
+func validAvatarURL(raw string) bool {
+	if raw == "" {
+		return true
+	}
+	if len(raw) > maxAvatarURLLen {
+		return false
+	}
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// applyProfile - изменения запроса поверх текущего профиля; при ошибке - неверные поля
+func applyProfile(user *models.User, req profileRequest) []string {
+	var invalid []string
+	if req.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*req.DisplayName)
+		if !validDisplayName(user.DisplayName) {
+			invalid = append(invalid, "display_name")
+		}
+	}
+	if req.Bio != nil {
+		user.Bio = strings.TrimSpace(*req.Bio)
+		if utf8.RuneCountInString(user.Bio) > maxBioLen {
+			invalid = append(invalid, "bio")
+		}
+	}
+	if req.AvatarURL != nil {
+		user.AvatarURL = strings.TrimSpace(*req.AvatarURL)
+		if !validAvatarURL(user.AvatarURL) {
+			invalid = append(invalid, "avatar_url")
+		}
+	}
+	if req.Locale != nil {
+		user.Locale = strings.ToLower(strings.TrimSpace(*req.Locale))
+		if user.Locale != "" && !supportedLocale(user.Locale) {
+			invalid = append(invalid, "locale")
+		}
+	}
+	return invalid
+}
+
+// findProfile - профиль по :username; false - ответ уже отправлен
+func findProfile(c *gin.Context, repo *models.Repository) (*models.UserProfile, bool) {
+	profile, err := repo.GetUserProfile(c.Param("username"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(c, http.StatusNotFound, ErrNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Ошибка получения профиля: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return nil, false
+	}
+	return profile, true
+}
+
+// GetUserProfile - публичный профиль со счётчиками
+func GetUserProfile(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profile, ok := findProfile(c, repo)
+		if !ok {
+			return
+		}
+		respond(c, http.StatusOK, profile)
+	}
+}
+
+// GetUserPosts - посты пользователя с пагинацией
+func GetUserPosts(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profile, ok := findProfile(c, repo)
+		if !ok {
+			return
+		}
+
+		blocked, err := repo.IsBlockedBetween(c.GetInt("user_id"), profile.ID)
+		if err != nil {
+			log.Printf("Ошибка проверки блокировки: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		if blocked {
+			respondError(c, http.StatusForbidden, ErrUserBlocked)
+			return
+		}
+
+		page, perPage := pageParams(c)
+		filter := models.PostFilter{ViewerID: c.GetInt("user_id"), AuthorID: profile.ID}
+		posts, err := repo.GetPostsWithUsers(filter, perPage, (page-1)*perPage)
+		if err != nil {
+			log.Printf("Ошибка получения постов пользователя: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		// Посты закрытых сообществ в счётчике профиля есть, а зрителю не видны
+		total, err := repo.CountPosts(filter)
+		if err != nil {
+			log.Printf("Ошибка подсчёта постов: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if posts == nil {
+			posts = []models.Post{}
+		}
+		fillViewer(c, repo, posts)
+		respondPage(c, posts, page, perPage, total)
+	}
+}
+
+// ownProfile - свой профиль с настройками
+func ownProfile(repo *models.Repository, user *models.User) (*myProfile, error) {
+	profile, err := repo.GetUserProfile(user.Username)
+	if err != nil {
+		return nil, err
+	}
+	return &myProfile{UserProfile: *profile, Locale: user.Locale}, nil
+}
+
+// GetMyProfile - профиль текущего пользователя
+func GetMyProfile(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		profile, err := ownProfile(repo, user)
+		if err != nil {
+			log.Printf("Ошибка получения профиля: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, profile)
+	}
+}
+
+// UpdateMyProfile - изменение имени, о себе, аватара и языка
+func UpdateMyProfile(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		var req profileRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+
+		if invalid := applyProfile(user, req); len(invalid) > 0 {
+			respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": invalid})
+			return
+		}
+
+		if err := repo.UpdateUserProfile(user.ID, user.DisplayName, user.Bio, user.AvatarURL, user.Locale); err != nil {
+			log.Printf("Ошибка изменения профиля: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		profile, err := ownProfile(repo, user)
+		if err != nil {
+			log.Printf("Ошибка получения профиля: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, profile)
+	}
+}
+
+// ProfilePage - страница пользователя: профиль и его посты
+func ProfilePage(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		viewer, _ := c.Get("user")
+
+		profile, err := repo.GetUserProfile(c.Param("username"))
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Ошибка получения профиля: %v", err)
+			}
+			renderHTML(c, http.StatusNotFound, "profile.html", gin.H{
+				"title": "Профиль",
+				"error": message(c, ErrNotFound),
+				"user":  viewer,
+			})
+			return
+		}
+
+		isOwner := false
+		if u, ok := viewer.(*models.User); ok {
+			isOwner = u.ID == profile.ID
+		}
+
+		rel, err := repo.GetRelation(c.GetInt("user_id"), profile.ID)
+		if err != nil {
+			log.Printf("Ошибка получения отношений: %v", err)
+		}
+
+		// При блокировке в любую сторону посты не показываются
+		page, perPage := pageParams(c)
+		var posts []models.Post
+		total := 0
+		if !rel.Blocking() {
+			filter := models.PostFilter{ViewerID: c.GetInt("user_id"), AuthorID: profile.ID}
+			posts, err = repo.GetPostsWithUsers(filter, perPage, (page-1)*perPage)
+			if err != nil {
+				log.Printf("Ошибка получения постов пользователя: %v", err)
+			}
+			if total, err = repo.CountPosts(filter); err != nil {
+				log.Printf("Ошибка подсчёта постов: %v", err)
+			}
+		}
+
+		renderHTML(c, http.StatusOK, "profile.html", gin.H{
+			"title":    profile.DisplayName,
+			"profile":  profile,
+			"posts":    posts,
+			"page":     page,
+			"prevPage": page - 1,
+			"nextPage": page + 1,
+			"hasMore":  page*perPage < total,
+			"isOwner":  isOwner,
+			"relation": rel,
+			"user":     viewer,
+		})
+	}
+}
+
+// ProfileSettingsPage - редактирование своего профиля
+func ProfileSettingsPage(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := repo.GetUserByUsername(c.GetString("username"))
+		if err != nil {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+
+		renderHTML(c, http.StatusOK, "account_profile.html", gin.H{
+			"title": "Профиль",
+			"user":  user,
+		})
+	}
+}
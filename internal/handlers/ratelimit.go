@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"unitycn/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === RATE LIMITING ===
+
+// RateLimitMiddleware - ограничение частоты запросов по политикам маршрутов.
+// Ставится после OptionalAuthMiddleware, чтобы знать пользователя.
+func RateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		policy := limiter.PolicyFor(c.Request.Method, c.FullPath())
+		if policy == nil {
+			c.Next()
+			return
+		}
+
+		route := c.Request.Method + " " + c.FullPath()
+		res := limiter.Allow(c.Request.Context(), policy, rateLimitKey(c, policy), route)
+
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", ceilSeconds(res.ResetAfter))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Max, int(policy.Period.Seconds())))
+
+		if !res.Allowed {
+			c.Header("Retry-After", ceilSeconds(res.RetryAfter))
+			if isAPIRequest(c) {
+				abortError(c, http.StatusTooManyRequests, ErrRateLimited)
+			} else {
+				c.String(http.StatusTooManyRequests, message(c, ErrRateLimited))
+				c.Abort()
+			}
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// rateLimitKey - клиент для политики: пользователь (если вошёл) или IP
+func rateLimitKey(c *gin.Context, policy *ratelimit.Policy) string {
+	if policy.KeyBy == "user" {
+		if userID := c.GetInt("user_id"); userID > 0 {
+			return "user:" + strconv.Itoa(userID)
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// AdminRateLimits - клиенты, упёршиеся в лимиты
+func AdminRateLimits(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data := gin.H{
+			"title":   "Ограничения запросов",
+			"enabled": limiter != nil,
+		}
+		if limiter != nil {
+			data["policies"] = limiter.Policies()
+			data["throttled"] = limiter.Throttled()
+		}
+		renderHTML(c, http.StatusOK, "admin/ratelimits.html", data)
+	}
+}
+
+// ResetRateLimits - обнуление счётчиков отказов
+func ResetRateLimits(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter != nil {
+			limiter.ResetThrottled()
+		}
+		respond(c, http.StatusOK, gin.H{"reset": true})
+	}
+}
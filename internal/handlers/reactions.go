@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"unitycn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === РЕАКЦИИ ===
+
+// Reaction - реакция на посты и комментарии (элемент секции reactions)
+type Reaction struct {
+	Name  string `yaml:"name" json:"name" doc:"код реакции в API"`
+	Emoji string `yaml:"emoji" json:"emoji"`
+}
+
+// Reactions - набор реакций, которые можно ставить. Убранная из набора
+// реакция остаётся в счётчиках, но поставить её больше нельзя.
+type Reactions []Reaction
+
+// DefaultReactions - набор, если секция reactions пуста
+var DefaultReactions = Reactions{
+	{Name: models.ReactionLike, Emoji: "👍"},
+	{Name: "fist", Emoji: "✊"},
+	{Name: "fire", Emoji: "🔥"},
+	{Name: "heart", Emoji: "❤️"},
+	{Name: "laugh", Emoji: "😂"},
+	{Name: "sad", Emoji: "😢"},
+}
+
+var reactionNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// Validate - имена уникальны и допустимы, like обязателен (в него перенесены лайки)
+func (rs Reactions) Validate() error {
+	if len(rs) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, r := range rs {
+		if !reactionNamePattern.MatchString(r.Name) {
+			return fmt.Errorf("недопустимое имя реакции %q (латинские буквы, цифры, _; до 32 символов)", r.Name)
+		}
+		if r.Emoji == "" {
+			return fmt.Errorf("реакция %s без emoji", r.Name)
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("реакция %s повторяется", r.Name)
+		}
+		seen[r.Name] = true
+	}
+	if !seen[models.ReactionLike] {
+		return fmt.Errorf("в наборе нет реакции %s", models.ReactionLike)
+	}
+	return nil
+}
+
+// Has - реакцию можно поставить
+func (rs Reactions) Has(name string) bool {
+	for _, r := range rs {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// reactionResult - состояние реакции после переключения
+type reactionResult struct {
+	ID        int                   `json:"id" doc:"пост или комментарий"`
+	Reaction  string                `json:"reaction"`
+	Reacted   bool                  `json:"reacted" doc:"реакция стоит после запроса"`
+	Reactions models.ReactionCounts `json:"reactions"`
+}
+
+// reactionParam - реакция :reaction из набора; иначе 400
+func reactionParam(c *gin.Context, reactions Reactions) (string, bool) {
+	name := c.Param("reaction")
+	if !reactions.Has(name) {
+		respondError(c, http.StatusBadRequest, ErrUnknownReaction)
+		return "", false
+	}
+	return name, true
+}
+
+// reactionFilter - ?reaction= для списка поставивших; пусто - все реакции
+func reactionFilter(c *gin.Context) (string, bool) {
+	name := c.Query("reaction")
+	if name != "" && !reactionNamePattern.MatchString(name) {
+		respondError(c, http.StatusBadRequest, ErrValidationFailed, gin.H{"fields": []string{"reaction"}})
+		return "", false
+	}
+	return name, true
+}
+
+// interactableComment - комментарий, на который пользователь может реагировать:
+// доступ как к его посту, плюс блокировка с автором комментария
+func interactableComment(c *gin.Context, repo *models.Repository, commentID, userID int) (*models.Comment, bool) {
+	comment, ok := visibleComment(c, repo, commentID, userID)
+	if !ok {
+		return nil, false
+	}
+	if _, ok := interactablePost(c, repo, comment.PostID, userID); !ok {
+		return nil, false
+	}
+	return comment, true
+}
+
+// visibleComment - комментарий, видимый зрителю; иначе 404
+func visibleComment(c *gin.Context, repo *models.Repository, commentID, viewerID int) (*models.Comment, bool) {
+	comment, err := repo.GetComment(commentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(c, http.StatusNotFound, ErrNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Ошибка получения комментария: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return nil, false
+	}
+	blocked, err := repo.IsBlockedBetween(viewerID, comment.UserID)
+	if err != nil {
+		log.Printf("Ошибка проверки блокировки: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return nil, false
+	}
+	if blocked {
+		respondError(c, http.StatusNotFound, ErrNotFound)
+		return nil, false
+	}
+	return comment, true
+}
+
+// GetReactions - набор реакций, которые можно ставить
+func GetReactions(reactions Reactions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		respond(c, http.StatusOK, reactions)
+	}
+}
+
+// ReactToPost - поставить реакцию на пост или снять её
+func ReactToPost(repo *models.Repository, reactions Reactions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		postID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+		reaction, ok := reactionParam(c, reactions)
+		if !ok {
+			return
+		}
+		if _, ok := interactablePost(c, repo, postID, user.ID); !ok {
+			return
+		}
+
+		reacted, err := repo.TogglePostReaction(postID, user.ID, reaction)
+		if err != nil {
+			log.Printf("Ошибка реакции на пост: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		counts, err := repo.GetPostReactionCounts(postID)
+		if err != nil {
+			log.Printf("Ошибка подсчёта реакций: %v", err)
+		}
+		respond(c, http.StatusOK, reactionResult{ID: postID, Reaction: reaction, Reacted: reacted, Reactions: counts})
+	}
+}
+
+// ReactToComment - поставить реакцию на комментарий или снять её
+func ReactToComment(repo *models.Repository, reactions Reactions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		commentID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+		reaction, ok := reactionParam(c, reactions)
+		if !ok {
+			return
+		}
+		if _, ok := interactableComment(c, repo, commentID, user.ID); !ok {
+			return
+		}
+
+		reacted, err := repo.ToggleCommentReaction(commentID, user.ID, reaction)
+		if err != nil {
+			log.Printf("Ошибка реакции на комментарий: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		counts, err := repo.GetCommentReactionCounts(commentID)
+		if err != nil {
+			log.Printf("Ошибка подсчёта реакций: %v", err)
+		}
+		respond(c, http.StatusOK, reactionResult{ID: commentID, Reaction: reaction, Reacted: reacted, Reactions: counts})
+	}
+}
+
+// GetPostReactors - кто поставил реакции на пост (?reaction= - только одну), новые сверху
+func GetPostReactors(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		postID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+		reaction, ok := reactionFilter(c)
+		if !ok {
+			return
+		}
+		viewerID := c.GetInt("user_id")
+		if _, ok := visiblePost(c, repo, postID, viewerID); !ok {
+			return
+		}
+		listReactors(c,
+			func(limit, offset int) ([]models.Reactor, error) {
+				return repo.GetPostReactors(postID, viewerID, reaction, limit, offset)
+			},
+			func() (int, error) { return repo.CountPostReactors(postID, viewerID, reaction) })
+	}
+}
+
+// GetCommentReactors - кто поставил реакции на комментарий
+func GetCommentReactors(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		commentID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+		reaction, ok := reactionFilter(c)
+		if !ok {
+			return
+		}
+		viewerID := c.GetInt("user_id")
+		comment, ok := visibleComment(c, repo, commentID, viewerID)
+		if !ok {
+			return
+		}
+		if _, ok := visiblePost(c, repo, comment.PostID, viewerID); !ok {
+			return
+		}
+		listReactors(c,
+			func(limit, offset int) ([]models.Reactor, error) {
+				return repo.GetCommentReactors(commentID, viewerID, reaction, limit, offset)
+			},
+			func() (int, error) { return repo.CountCommentReactors(commentID, viewerID, reaction) })
+	}
+}
+
+func listReactors(c *gin.Context, list func(limit, offset int) ([]models.Reactor, error), count func() (int, error)) {
+	page, perPage := pageParams(c)
+	reactors, err := list(perPage, (page-1)*perPage)
+	if err != nil {
+		log.Printf("Ошибка получения реакций: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+	total, err := count()
+	if err != nil {
+		log.Printf("Ошибка подсчёта реакций: %v", err)
+		respondError(c, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+	respondPage(c, reactors, page, perPage, total)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"unitycn/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === РЕПОСТЫ И ЦИТАТЫ ===
+
+// repostResult - репост зрителя и счётчики исходного поста после изменения
+type repostResult struct {
+	PostID       int  `json:"post_id" doc:"исходный пост; если он удалён - снятый репост"`
+	Reposted     bool `json:"reposted"`
+	RepostID     int  `json:"repost_id,omitempty" doc:"пост-репост зрителя"`
+	RepostsCount int  `json:"reposts_count"`
+	QuotesCount  int  `json:"quotes_count"`
+}
+
+// sharedOriginal - пост, который пользователь репостит или цитирует: репост
+// заменяется своим исходным постом. Доступ - как для реакций (interactablePost);
+// репост удалённого поста - 404.
+func sharedOriginal(c *gin.Context, repo *models.Repository, postID, userID int) (*models.Post, bool) {
+	post, ok := interactablePost(c, repo, postID, userID)
+	if !ok {
+		return nil, false
+	}
+	if post.Kind != models.PostKindRepost {
+		return post, true
+	}
+	if post.OriginalID == nil {
+		respondError(c, http.StatusNotFound, ErrNotFound)
+		return nil, false
+	}
+	return interactablePost(c, repo, *post.OriginalID, userID)
+}
+
+// repostState - ответ с репостом пользователя и счётчиками поста originalID
+func repostState(c *gin.Context, repo *models.Repository, status, originalID, repostID int) {
+	result := repostResult{PostID: originalID, Reposted: repostID != 0, RepostID: repostID}
+	var err error
+	result.RepostsCount, result.QuotesCount, err = repo.GetRepostCounts(originalID)
+	if err != nil {
+		log.Printf("Ошибка подсчёта репостов: %v", err)
+	}
+	respond(c, status, result)
+}
+
+// RepostPost - репост поста в общую ленту; повторный запрос возвращает уже сделанный репост
+func RepostPost(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		postID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+		original, ok := sharedOriginal(c, repo, postID, user.ID)
+		if !ok {
+			return
+		}
+
+		repostID, created, err := repo.CreateRepost(user.ID, original.ID, postSlogan)
+		if err != nil {
+			log.Printf("Ошибка репоста: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		repostState(c, repo, status, original.ID, repostID)
+	}
+}
+
+// UnrepostPost - отменить свой репост; повторная отмена ничего не меняет
+func UnrepostPost(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		postID, ok := paramID(c, "id")
+		if !ok {
+			return
+		}
+		// Вместо исходного поста можно передать сам репост
+		if post, err := repo.GetPost(postID); err == nil && post.Kind == models.PostKindRepost {
+			if post.OriginalID != nil {
+				postID = *post.OriginalID
+			} else if post.UserID == user.ID {
+				// Исходный пост удалён: свой репост снимается по его id
+				if err := repo.DeleteRepostByID(user.ID, post.ID); err != nil {
+					log.Printf("Ошибка отмены репоста: %v", err)
+					respondError(c, http.StatusInternalServerError, ErrInternal)
+					return
+				}
+				respond(c, http.StatusOK, repostResult{PostID: post.ID})
+				return
+			}
+		}
+
+		if err := repo.DeleteRepost(user.ID, postID); err != nil {
+			log.Printf("Ошибка отмены репоста: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		repostState(c, repo, http.StatusOK, postID, 0)
+	}
+}
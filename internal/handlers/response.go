@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Envelope - единый формат ответа API: либо data, либо error
+type Envelope struct {
+	Data       interface{} `json:"data"`
+	Error      *APIError   `json:"error"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// APIError - машиночитаемый код, локализованное сообщение и подробности
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Pagination - параметры страницы для списков
+type Pagination struct {
+	Page    int  `json:"page"`
+	PerPage int  `json:"per_page"`
+	Total   int  `json:"total"`
+	HasMore bool `json:"has_more"`
+}
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// respond - успешный ответ
+func respond(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, Envelope{Data: data})
+}
+
+// respondPage - успешный ответ со списком и пагинацией
+func respondPage(c *gin.Context, data interface{}, page, perPage, total int) {
+	c.JSON(http.StatusOK, Envelope{
+		Data: data,
+		Pagination: &Pagination{
+			Page:    page,
+			PerPage: perPage,
+			Total:   total,
+			HasMore: page*perPage < total,
+		},
+	})
+}
+
+// respondError - ошибка с кодом из messages.go; details необязательны
+func respondError(c *gin.Context, status int, code string, details ...interface{}) {
+	apiErr := &APIError{
+		Code:    code,
+		Message: message(c, code),
+	}
+	if len(details) > 0 {
+		apiErr.Details = details[0]
+	}
+	c.JSON(status, Envelope{Error: apiErr})
+}
+
+// abortError - ошибка с прерыванием цепочки (для middleware)
+func abortError(c *gin.Context, status int, code string, details ...interface{}) {
+	respondError(c, status, code, details...)
+	c.Abort()
+}
+
+// pageParams - ?page=1&per_page=20 с ограничениями
+func pageParams(c *gin.Context) (page, perPage int) {
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	perPage, err = strconv.Atoi(c.Query("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+
+	return page, perPage
+}
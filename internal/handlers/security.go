@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === ЗАГОЛОВКИ БЕЗОПАСНОСТИ И CSP ===
+
+const (
+	cspNonceContextKey = "csp_nonce"
+	cspReportPath      = "/csp-report"
+	cspReportEndpoint  = "csp-endpoint"
+
+	// cspReportMaxBody - отчёты больше этого отбрасываются
+	cspReportMaxBody = 64 << 10
+	// cspReportsKept - сколько разных нарушений хранится в памяти
+	cspReportsKept = 200
+)
+
+// SecurityOptions - заголовки безопасности (секция server.security)
+type SecurityOptions struct {
+	// CSPReportOnly - политика только сообщает о нарушениях, не блокируя их
+	CSPReportOnly bool `yaml:"csp_report_only"`
+	// HSTSMaxAge - Strict-Transport-Security; 0 - не отправлять (включать только за HTTPS)
+	HSTSMaxAge time.Duration `yaml:"hsts_max_age"`
+	// HSTSIncludeSubdomains - HSTS и для поддоменов
+	HSTSIncludeSubdomains bool `yaml:"hsts_include_subdomains"`
+}
+
+// contentSecurityPolicy - политика с nonce запроса. Встроенные скрипты
+// разрешены только с nonce, скрипты с CDN - тоже по nonce ('strict-dynamic').
+// Встроенные стили разрешены: шаблоны используют атрибут style.
+func contentSecurityPolicy(nonce string) string {
+	return strings.Join([]string{
+		"default-src 'self'",
+		"script-src 'nonce-" + nonce + "' 'strict-dynamic'",
+		"style-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net",
+		"img-src 'self' data: https:",
+		"font-src 'self' data: https://cdn.jsdelivr.net",
+		"connect-src 'self'",
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+		"report-uri " + cspReportPath,
+		"report-to " + cspReportEndpoint,
+	}, "; ")
+}
+
+func newCSPNonce() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// SecurityHeaders - CSP с nonce для шаблонов (csp_nonce), HSTS, nosniff,
+// Referrer-Policy и запрет встраивания во фреймы
+func SecurityHeaders(opts SecurityOptions) gin.HandlerFunc {
+	cspHeader := "Content-Security-Policy"
+	if opts.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	hsts := ""
+	if opts.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(opts.HSTSMaxAge.Seconds()))
+		if opts.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(c *gin.Context) {
+		nonce, err := newCSPNonce()
+		if err != nil {
+			abortError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		c.Set(cspNonceContextKey, nonce)
+
+		h := c.Writer.Header()
+		h.Set(cspHeader, contentSecurityPolicy(nonce))
+		h.Set("Reporting-Endpoints", cspReportEndpoint+`="`+cspReportPath+`"`)
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		h.Set("X-Frame-Options", "DENY")
+		if hsts != "" {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+
+		c.Next()
+	}
+}
+
+// === ОТЧЁТЫ О НАРУШЕНИЯХ CSP ===
+
+// CSPViolation - нарушение политики, одинаковые отчёты складываются
+type CSPViolation struct {
+	Directive   string
+	BlockedURI  string
+	DocumentURI string
+	SourceFile  string
+	Line        int
+	Count       int
+	FirstAt     time.Time
+	LastAt      time.Time
+}
+
+// CSPReports - последние нарушения CSP в памяти процесса
+type CSPReports struct {
+	mu         sync.Mutex
+	violations map[string]*CSPViolation
+}
+
+func NewCSPReports() *CSPReports {
+	return &CSPReports{violations: map[string]*CSPViolation{}}
+}
+
+func (r *CSPReports) add(v CSPViolation) {
+	key := v.Directive + "\x00" + v.BlockedURI + "\x00" + v.DocumentURI + "\x00" +
+		v.SourceFile + "\x00" + strconv.Itoa(v.Line)
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.violations[key]; ok {
+		existing.Count++
+		existing.LastAt = now
+		return
+	}
+	// Вытесняется самое давнее нарушение
+	if len(r.violations) >= cspReportsKept {
+		oldestKey := ""
+		for k, e := range r.violations {
+			if oldestKey == "" || e.LastAt.Before(r.violations[oldestKey].LastAt) {
+				oldestKey = k
+			}
+		}
+		delete(r.violations, oldestKey)
+	}
+	v.Count, v.FirstAt, v.LastAt = 1, now, now
+	r.violations[key] = &v
+}
+
+// List - нарушения, последние сверху
+func (r *CSPReports) List() []CSPViolation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]CSPViolation, 0, len(r.violations))
+	for _, v := range r.violations {
+		list = append(list, *v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastAt.After(list[j].LastAt) })
+	return list
+}
+
+// Reset - очистка списка
+func (r *CSPReports) Reset() {
+	r.mu.Lock()
+	r.violations = map[string]*CSPViolation{}
+	r.mu.Unlock()
+}
+
+// cspReportURI - отчёт report-uri (application/csp-report)
+type cspReportURI struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		BlockedURI         string `json:"blocked-uri"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+	} `json:"csp-report"`
+}
+
+// cspReportTo - отчёт Reporting API (application/reports+json)
+type cspReportTo struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		BlockedURL         string `json:"blockedURL"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+	} `json:"body"`
+}
+
+// parseCSPReports - нарушения из тела отчёта в любом из двух форматов
+func parseCSPReports(contentType string, body []byte) []CSPViolation {
+	var violations []CSPViolation
+
+	if strings.HasPrefix(contentType, "application/reports+json") {
+		var reports []cspReportTo
+		if json.Unmarshal(body, &reports) != nil {
+			return nil
+		}
+		for _, r := range reports {
+			if r.Type != "csp-violation" {
+				continue
+			}
+			violations = append(violations, CSPViolation{
+				Directive:   r.Body.EffectiveDirective,
+				BlockedURI:  r.Body.BlockedURL,
+				DocumentURI: r.Body.DocumentURL,
+				SourceFile:  r.Body.SourceFile,
+				Line:        r.Body.LineNumber,
+			})
+		}
+		return violations
+	}
+
+	var r cspReportURI
+	if json.Unmarshal(body, &r) != nil {
+		return nil
+	}
+	directive := r.Report.EffectiveDirective
+	if directive == "" {
+		directive = r.Report.ViolatedDirective
+	}
+	if directive == "" {
+		return nil
+	}
+	return append(violations, CSPViolation{
+		Directive:   directive,
+		BlockedURI:  r.Report.BlockedURI,
+		DocumentURI: r.Report.DocumentURI,
+		SourceFile:  r.Report.SourceFile,
+		Line:        r.Report.LineNumber,
+	})
+}
+
+// truncateReportField - поля отчёта присылает браузер, их длина не ограничена
+func truncateReportField(v *CSPViolation) {
+	v.Directive = truncateRunes(v.Directive, 100)
+	v.BlockedURI = truncateRunes(v.BlockedURI, 300)
+	v.DocumentURI = truncateRunes(v.DocumentURI, 300)
+	v.SourceFile = truncateRunes(v.SourceFile, 300)
+}
+
+// CSPReport - приём отчётов браузера о нарушениях CSP
+func CSPReport(reports *CSPReports) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, cspReportMaxBody))
+		if err != nil {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		for _, v := range parseCSPReports(c.ContentType(), body) {
+			truncateReportField(&v)
+			log.Printf("CSP: %s заблокировал %q на %s (%s:%d)",
+				v.Directive, v.BlockedURI, v.DocumentURI, v.SourceFile, v.Line)
+			reports.add(v)
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// AdminCSPReports - страница нарушений CSP
+func AdminCSPReports(reports *CSPReports, opts SecurityOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		renderHTML(c, http.StatusOK, "admin/csp.html", gin.H{
+			"title":      "Нарушения CSP",
+			"reportOnly": opts.CSPReportOnly,
+			"violations": reports.List(),
+		})
+	}
+}
+
+// ResetCSPReports - очистка списка нарушений
+func ResetCSPReports(reports *CSPReports) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reports.Reset()
+		respond(c, http.StatusOK, gin.H{"reset": true})
+	}
+}
@@ -0,0 +1,458 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unitycn/internal/auth"
+	"unitycn/internal/models"
+	"unitycn/internal/oidc"
+	"unitycn/internal/totp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === ДВУХФАКТОРНАЯ АУТЕНТИФИКАЦИЯ ===
+
+// TwoFactorOptions - настройки 2FA
+type TwoFactorOptions struct {
+	// Issuer - имя сервиса в приложении-аутентификаторе
+	Issuer string
+	// RequiredRoles - роли, которым 2FA обязательна
+	RequiredRoles []string
+}
+
+const (
+	defaultTOTPIssuer  = "Единство"
+	recoveryCodesCount = 10
+)
+
+// requiredFor - обязательна ли 2FA для роли
+func (o TwoFactorOptions) requiredFor(role string) bool {
+	for _, r := range o.RequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (o TwoFactorOptions) issuer() string {
+	if o.Issuer == "" {
+		return defaultTOTPIssuer
+	}
+	return o.Issuer
+}
+
+// TwoFactorEnrollment - пользователь роли с обязательной 2FA без подключённой 2FA
+// может только подключить её или выйти
+func TwoFactorEnrollment(twoFactor TwoFactorOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("user")
+		user, _ := value.(*models.User)
+		if !exists || user == nil || user.TwoFactorEnabled() ||
+			!twoFactor.requiredFor(user.Role) || twoFactorExempt(c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		if isAPIRequest(c) {
+			abortError(c, http.StatusForbidden, ErrTwoFactorRequired)
+		} else {
+			c.Redirect(http.StatusFound, "/account/2fa")
+			c.Abort()
+		}
+	}
+}
+
+// twoFactorExempt - маршруты, доступные до подключения обязательной 2FA
+func twoFactorExempt(path string) bool {
+	return path == "" || path == "/account/2fa" ||
+		strings.HasSuffix(path, "/logout") ||
+		strings.Contains(path, "/me/2fa") ||
+		strings.HasPrefix(path, "/static/")
+}
+
+// verifySecondFactor - код приложения или неиспользованный код восстановления
+func verifySecondFactor(repo *models.Repository, user *models.User, code string) (bool, error) {
+	if step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		return repo.UseTOTPStep(user.ID, step)
+	}
+	return repo.UseRecoveryCode(user.ID, totp.HashRecoveryCode(code))
+}
+
+// newRecoveryCodes - коды для пользователя и их хэши для БД
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = totp.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// completeTwoFactor - второй шаг входа: частичный токен и код 2FA
+func completeTwoFactor(c *gin.Context, repo *models.Repository, tokens *auth.Service, mfaToken, code string) (*models.User, int, string) {
+	claims, err := tokens.VerifyMFAToken(mfaToken)
+	if err != nil {
+		return nil, http.StatusUnauthorized, ErrInvalidToken
+	}
+	username, _ := claims["username"].(string)
+
+	user, err := repo.GetUserByUsername(username)
+	if err != nil || !user.TwoFactorEnabled() {
+		return nil, http.StatusUnauthorized, ErrInvalidToken
+	}
+
+	// Подбор кода ограничивается так же, как подбор пароля
+	if status, errCode := throttleLogin(c, repo, user.ID, username); errCode != "" {
+		return nil, status, errCode
+	}
+
+	ok, err := verifySecondFactor(repo, user, code)
+	if err != nil {
+		log.Printf("Ошибка проверки кода 2FA: %v", err)
+		return nil, http.StatusInternalServerError, ErrInternal
+	}
+	if !ok {
+		recordLogin(c, repo, user.ID, username, models.LoginMFAFailed)
+		return nil, http.StatusUnauthorized, ErrInvalid2FACode
+	}
+
+	if user.BannedAt != nil {
+		recordLogin(c, repo, user.ID, username, models.LoginBanned)
+		return nil, http.StatusForbidden, ErrAccountBanned
+	}
+
+	recordLogin(c, repo, user.ID, username, models.LoginSuccess)
+	return user, 0, ""
+}
+
+// twoFactorLoginRequest - второй шаг входа
+type twoFactorLoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code" doc:"код из приложения или код восстановления"`
+}
+
+// LoginTwoFactor - второй шаг входа через API
+func LoginTwoFactor(repo *models.Repository, tokens *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req twoFactorLoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+
+		user, status, code := completeTwoFactor(c, repo, tokens, req.MFAToken, req.Code)
+		if user == nil {
+			respondError(c, status, code)
+			return
+		}
+
+		token, err := startSession(c, tokens, user)
+		if err != nil {
+			log.Printf("Ошибка генерации токена: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		respond(c, http.StatusOK, sessionResponse(token, user))
+	}
+}
+
+// LoginTwoFactorForm - второй шаг входа через веб-форму
+func LoginTwoFactorForm(repo *models.Repository, tokens *auth.Service, providers *oidc.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mfaToken := c.PostForm("mfa_token")
+
+		user, status, code := completeTwoFactor(c, repo, tokens, mfaToken, c.PostForm("code"))
+		if user == nil {
+			if code == ErrInvalidToken {
+				// Частичный токен истёк - вход заново
+				renderAuthPage(c, status, "login.html", providers, gin.H{"error": message(c, code)})
+				return
+			}
+			renderHTML(c, status, "login_2fa.html", gin.H{
+				"mfa_token": mfaToken,
+				"error":     message(c, code),
+			})
+			return
+		}
+
+		token, err := startSession(c, tokens, user)
+		if err != nil {
+			log.Printf("Ошибка генерации токена: %v", err)
+			renderAuthPage(c, http.StatusInternalServerError, "login.html", providers, gin.H{
+				"error": message(c, ErrInternal),
+			})
+			return
+		}
+
+		renderHTML(c, http.StatusOK, "auth_redirect.html", gin.H{
+			"token":    token,
+			"username": user.Username,
+			"role":     user.Role,
+			"user_id":  user.ID,
+			"redirect": "/",
+		})
+	}
+}
+
+// twoFactorStatus - состояние 2FA текущего пользователя
+type twoFactorStatus struct {
+	Enabled             bool `json:"enabled"`
+	Required            bool `json:"required" doc:"обязательна для роли пользователя"`
+	RecoveryCodesLeft   int  `json:"recovery_codes_left"`
+	PendingConfirmation bool `json:"pending_confirmation" doc:"секрет выдан, но не подтверждён кодом"`
+}
+
+// twoFactorSetup - секрет для приложения-аутентификатора
+type twoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri" doc:"otpauth:// ссылка для QR-кода"`
+}
+
+// twoFactorCodeRequest - код из приложения (или код восстановления)
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// twoFactorDisableRequest - отключение 2FA требует пароль и код
+type twoFactorDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// recoveryCodesResult - коды восстановления (показываются один раз)
+type recoveryCodesResult struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func loadTwoFactorStatus(repo *models.Repository, user *models.User, twoFactor TwoFactorOptions) (twoFactorStatus, error) {
+	status := twoFactorStatus{
+		Enabled:             user.TwoFactorEnabled(),
+		Required:            twoFactor.requiredFor(user.Role),
+		PendingConfirmation: !user.TwoFactorEnabled() && user.TOTPSecret != "",
+	}
+	if status.Enabled {
+		left, err := repo.CountRecoveryCodes(user.ID)
+		if err != nil {
+			return status, err
+		}
+		status.RecoveryCodesLeft = left
+	}
+	return status, nil
+}
+
+// GetTwoFactorStatus - состояние 2FA
+func GetTwoFactorStatus(repo *models.Repository, twoFactor TwoFactorOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		status, err := loadTwoFactorStatus(repo, user, twoFactor)
+		if err != nil {
+			log.Printf("Ошибка получения состояния 2FA: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		respond(c, http.StatusOK, status)
+	}
+}
+
+// SetupTwoFactor - новый секрет; 2FA включается после подтверждения кодом
+func SetupTwoFactor(repo *models.Repository, twoFactor TwoFactorOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+		if user.TwoFactorEnabled() {
+			respondError(c, http.StatusConflict, ErrTwoFactorEnabled)
+			return
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			log.Printf("Ошибка генерации секрета TOTP: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		if err := repo.SetTOTPSecret(user.ID, secret); err != nil {
+			log.Printf("Ошибка сохранения секрета TOTP: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		respond(c, http.StatusOK, twoFactorSetup{
+			Secret: secret,
+			URI:    totp.ProvisioningURI(secret, twoFactor.issuer(), user.Username),
+		})
+	}
+}
+
+// EnableTwoFactor - подтверждение секрета первым кодом и выдача кодов восстановления
+func EnableTwoFactor(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		var req twoFactorCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+
+		if user.TwoFactorEnabled() {
+			respondError(c, http.StatusConflict, ErrTwoFactorEnabled)
+			return
+		}
+		if user.TOTPSecret == "" {
+			respondError(c, http.StatusBadRequest, ErrTwoFactorNotSetup)
+			return
+		}
+
+		step, valid := totp.Validate(user.TOTPSecret, req.Code, time.Now(), 0)
+		if !valid {
+			respondError(c, http.StatusBadRequest, ErrInvalid2FACode)
+			return
+		}
+
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			log.Printf("Ошибка генерации кодов восстановления: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		if err := repo.EnableTOTP(user.ID, step, hashes); err != nil {
+			log.Printf("Ошибка включения 2FA: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		respond(c, http.StatusOK, recoveryCodesResult{RecoveryCodes: codes})
+	}
+}
+
+// DisableTwoFactor - отключение 2FA (пароль и код)
+func DisableTwoFactor(repo *models.Repository, passwords *auth.Passwords, twoFactor TwoFactorOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		var req twoFactorDisableRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+
+		if twoFactor.requiredFor(user.Role) {
+			respondError(c, http.StatusForbidden, ErrTwoFactorRequired)
+			return
+		}
+		if !user.TwoFactorEnabled() {
+			respondError(c, http.StatusBadRequest, ErrTwoFactorNotSetup)
+			return
+		}
+		if ok, _ := passwords.Verify(req.Password, user.Password); !ok {
+			respondError(c, http.StatusUnauthorized, ErrInvalidCredentials)
+			return
+		}
+
+		valid, err := verifySecondFactor(repo, user, req.Code)
+		if err != nil {
+			log.Printf("Ошибка проверки кода 2FA: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		if !valid {
+			respondError(c, http.StatusUnauthorized, ErrInvalid2FACode)
+			return
+		}
+
+		if err := repo.DisableTOTP(user.ID); err != nil {
+			log.Printf("Ошибка отключения 2FA: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		respond(c, http.StatusOK, gin.H{"enabled": false})
+	}
+}
+
+// RegenerateRecoveryCodes - новый набор кодов восстановления (старые перестают действовать)
+func RegenerateRecoveryCodes(repo *models.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c, repo)
+		if !ok {
+			return
+		}
+
+		var req twoFactorCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+		if !user.TwoFactorEnabled() {
+			respondError(c, http.StatusBadRequest, ErrTwoFactorNotSetup)
+			return
+		}
+
+		valid, err := verifySecondFactor(repo, user, req.Code)
+		if err != nil {
+			log.Printf("Ошибка проверки кода 2FA: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		if !valid {
+			respondError(c, http.StatusUnauthorized, ErrInvalid2FACode)
+			return
+		}
+
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			log.Printf("Ошибка генерации кодов восстановления: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		if err := repo.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+			log.Printf("Ошибка сохранения кодов восстановления: %v", err)
+			respondError(c, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		respond(c, http.StatusOK, recoveryCodesResult{RecoveryCodes: codes})
+	}
+}
+
+// TwoFactorPage - страница подключения 2FA
+func TwoFactorPage(repo *models.Repository, twoFactor TwoFactorOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := repo.GetUserByUsername(c.GetString("username"))
+		if err != nil {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+
+		status, err := loadTwoFactorStatus(repo, user, twoFactor)
+		if err != nil {
+			log.Printf("Ошибка получения состояния 2FA: %v", err)
+		}
+
+		renderHTML(c, http.StatusOK, "account_2fa.html", gin.H{
+			"title":  "Двухфакторная аутентификация",
+			"user":   user,
+			"status": status,
+		})
+	}
+}
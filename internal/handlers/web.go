@@ -1,59 +1,160 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
+	"time"
+	"unitycn/internal/auth"
+	"unitycn/internal/mailer"
 	"unitycn/internal/models"
+	"unitycn/internal/oidc"
+	"unitycn/internal/ratelimit"
+	"unitycn/internal/realtime"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(r *gin.Engine, repo *models.Repository, secret string) {
-	// Применяем OptionalAuthMiddleware глобально ко всем маршрутам
-	r.Use(OptionalAuthMiddleware(repo, secret))
+// Options - необязательные зависимости маршрутов
+type Options struct {
+	// Limiter - ограничение частоты запросов; nil отключает лимиты
+	Limiter *ratelimit.Limiter
+	// TwoFactor - настройки двухфакторной аутентификации
+	TwoFactor TwoFactorOptions
+	// OIDC - провайдеры внешнего входа; nil - вход только по паролю
+	OIDC *oidc.Registry
+	// Mailer - отправка писем; nil - письма только в журнал
+	Mailer mailer.Mailer
+	// BaseURL - адрес сайта для ссылок в письмах
+	BaseURL string
+	// Passwords - политика и хэширование паролей; nil - настройки по умолчанию
+	Passwords *auth.Passwords
+	// DeletionGrace - отсрочка удаления аккаунта по запросу пользователя
+	DeletionGrace time.Duration
+	// Cookies - атрибуты Secure и SameSite для кук
+	Cookies CookieOptions
+	// Security - CSP и HSTS
+	Security SecurityOptions
+	// Events - доставка событий открытым соединениям; nil - только этот экземпляр
+	Events realtime.Broker
+	// Reactions - реакции на посты и комментарии; пусто - DefaultReactions
+	Reactions Reactions
+}
+
+const defaultBaseURL = "http://localhost:8080"
+
+func RegisterRoutes(r *gin.Engine, repo *models.Repository, tokens *auth.Service, opts Options) {
+	if opts.Mailer == nil {
+		opts.Mailer = mailer.NewLogMailer("")
+	}
+	if opts.BaseURL == "" {
+		opts.BaseURL = defaultBaseURL
+	}
+	if opts.Passwords == nil {
+		opts.Passwords = auth.DefaultPasswords()
+	}
+	if opts.DeletionGrace <= 0 {
+		opts.DeletionGrace = defaultDeletionGrace
+	}
+	if opts.Events == nil {
+		opts.Events = realtime.NewMemoryBroker()
+	}
+	if len(opts.Reactions) == 0 {
+		opts.Reactions = DefaultReactions
+	}
+
+	cspReports := NewCSPReports()
+
+	// Заголовки безопасности, атрибуты кук и CSRF - до всего, что ставит куки.
+	// OptionalAuthMiddleware применяем глобально ко всем маршрутам,
+	// лимиты - после него, чтобы различать пользователей
+	r.Use(SecurityHeaders(opts.Security))
+	r.Use(CSRFMiddleware(opts.Cookies))
+	r.Use(OptionalAuthMiddleware(repo, tokens))
+	r.Use(RateLimitMiddleware(opts.Limiter))
+	r.Use(TwoFactorEnrollment(opts.TwoFactor))
 
 	// Веб-страницы
-	r.GET("/", HomePage(repo))
-	r.GET("/login", LoginPage())
-	r.GET("/register", RegisterPage())
+	r.GET("/", HomePage(repo, opts.Reactions))
+	r.GET("/login", LoginPage(opts.OIDC))
+	r.GET("/register", RegisterPage(opts.OIDC))
 	r.GET("/logout", Logout())
+	r.GET("/u/:username", ProfilePage(repo))
+	r.GET("/c", CommunitiesPage(repo))
+	r.GET("/c/:slug", CommunityPage(repo))
 
-	// ВЕБ-форма логина
-	r.POST("/login", Login(repo, secret))
+	// ВЕБ-форма логина и второй шаг (код 2FA)
+	r.POST("/login", LoginForm(repo, tokens, opts))
+	r.POST("/login/2fa", LoginTwoFactorForm(repo, tokens, opts.OIDC))
 
 	// ВЕБ-форма регистрации
-	r.POST("/register", Register(repo, secret))
+	r.POST("/register", RegisterForm(repo, tokens, opts))
+
+	// Восстановление пароля и подтверждение email по ссылкам из писем
+	r.GET("/forgot-password", ForgotPasswordPage())
+	r.POST("/forgot-password", ForgotPasswordForm(repo, tokens, opts))
+	r.GET("/reset-password", ResetPasswordPage(tokens))
+	r.POST("/reset-password", ResetPasswordForm(repo, tokens, opts.Passwords, opts.OIDC))
+	r.GET("/verify-email", VerifyEmailPage(repo, tokens))
+
+	// Вход через внешних провайдеров (OpenID Connect)
+	r.GET("/auth/oidc/:provider", OIDCLogin(tokens, opts.OIDC))
+	r.GET("/auth/oidc/:provider/callback", OIDCCallback(repo, tokens, opts.OIDC, opts.TwoFactor))
+
+	// Открытые ключи подписи токенов для других сервисов
+	r.GET("/.well-known/jwks.json", JWKS(tokens))
+
+	// Отчёты браузеров о нарушениях Content-Security-Policy
+	r.POST("/csp-report", CSPReport(cspReports))
 
-	// API endpoints
-	api := r.Group("/api")
+	// Документация API
+	r.GET("/api/openapi.json", OpenAPISpec())
+	r.GET("/api/docs", APIDocsPage())
+
+	// API endpoints: /api/v1 - текущая версия, /api - устаревший алиас
+	registerAPIRoutes(r.Group("/api/v1"), repo, tokens, opts)
+	registerAPIRoutes(r.Group("/api", DeprecatedAPI()), repo, tokens, opts)
+
+	// Настройки аккаунта
+	account := r.Group("/account")
+	account.Use(AuthMiddleware(repo, tokens))
 	{
-		api.POST("/login", Login(repo, secret))
-		api.POST("/register", Register(repo, secret))
-		api.GET("/posts", GetPosts(repo))
-		api.GET("/heroes", GetHeroes(repo))
-
-		// Требуется авторизация (используем строгий AuthMiddleware)
-		authApi := api.Group("")
-		authApi.Use(AuthMiddleware(repo, secret))
-		{
-			authApi.POST("/posts", CreatePost(repo))
-			authApi.POST("/posts/:id/like", LikePost(repo))
-			authApi.POST("/posts/:id/comments", CreateComment(repo))
-			authApi.GET("/posts/:id/comments", GetComments(repo))
-			authApi.DELETE("/comments/:id", DeleteComment(repo))
-		}
+		account.GET("/profile", ProfileSettingsPage(repo))
+		account.GET("/2fa", TwoFactorPage(repo, opts.TwoFactor))
+		account.GET("/tokens", APITokensPage(repo))
+		account.GET("/identities", IdentitiesPage(repo, opts.OIDC))
+		account.GET("/email", EmailPage(repo))
+		account.GET("/delete", AccountDeletionPage(repo, opts))
+		account.GET("/blocks", BlocksPage(repo))
+		account.GET("/bookmarks", BookmarksPage(repo))
 	}
 
+	// Личные сообщения
+	r.GET("/messages", AuthMiddleware(repo, tokens), MessagesPage(repo))
+
 	// Админка требует строгой авторизации
 	admin := r.Group("/admin")
-	admin.Use(AuthMiddleware(repo, secret), AdminMiddleware())
+	admin.Use(AuthMiddleware(repo, tokens), AdminMiddleware())
 	{
 		// Дашборд
 		admin.GET("/", AdminDashboard(repo))
 
+		// Выгрузка и загрузка данных
+		admin.GET("/export", AdminExport(repo))
+		admin.POST("/import", AdminImport(repo))
+
+		// Ограничения запросов
+		admin.GET("/ratelimits", AdminRateLimits(opts.Limiter))
+		admin.POST("/ratelimits/reset", ResetRateLimits(opts.Limiter))
+
+		// Нарушения CSP
+		admin.GET("/csp", AdminCSPReports(cspReports, opts.Security))
+		admin.POST("/csp/reset", ResetCSPReports(cspReports))
+
 		// Пользователи
 		admin.GET("/users", AdminUsers(repo))
 		admin.PUT("/users/:id/role", UpdateUserRole(repo))
 		admin.DELETE("/users/:id", DeleteUserAdmin(repo))
+		admin.POST("/users/:id/unlock", UnlockUserLogin(repo))
 
 		// Посты
 		admin.GET("/posts", AdminPosts(repo))
@@ -74,7 +175,98 @@ func RegisterRoutes(r *gin.Engine, repo *models.Repository, secret string) {
 	}
 }
 
-func HomePage(repo *models.Repository) gin.HandlerFunc {
+// registerAPIRoutes - маршруты публичного API (одинаковые для /api/v1 и /api)
+func registerAPIRoutes(api *gin.RouterGroup, repo *models.Repository, tokens *auth.Service, opts Options) {
+	api.POST("/login", Login(repo, tokens, opts))
+	api.POST("/login/2fa", LoginTwoFactor(repo, tokens))
+	api.POST("/register", Register(repo, tokens, opts))
+	api.POST("/password/forgot", ForgotPassword(repo, tokens, opts))
+	api.POST("/password/reset", ResetPassword(repo, tokens, opts.Passwords))
+	api.POST("/email/verify", VerifyEmail(repo, tokens))
+	api.POST("/logout", Logout())
+	api.GET("/posts", GetPosts(repo))
+	api.GET("/posts/:id", GetPost(repo))
+	api.GET("/posts/:id/reactions", GetPostReactors(repo))
+	api.GET("/comments/:id/reactions", GetCommentReactors(repo))
+	api.GET("/reactions", GetReactions(opts.Reactions))
+	api.GET("/heroes", GetHeroes(repo))
+	api.GET("/users/:username", GetUserProfile(repo))
+	api.GET("/users/:username/posts", GetUserPosts(repo))
+	api.GET("/communities", GetCommunities(repo))
+	api.GET("/communities/:slug", GetCommunity(repo))
+	api.GET("/communities/:slug/posts", GetCommunityPosts(repo))
+	api.GET("/communities/:slug/members", GetCommunityMembers(repo))
+
+	// Требуется авторизация (используем строгий AuthMiddleware)
+	authApi := api.Group("")
+	authApi.Use(AuthMiddleware(repo, tokens))
+	{
+		authApi.GET("/me", GetMyProfile(repo))
+		authApi.PATCH("/me", UpdateMyProfile(repo))
+		authApi.GET("/me/export", ExportMyData(repo))
+		authApi.GET("/me/deletion", GetAccountDeletion(repo, opts))
+		authApi.POST("/me/deletion", ScheduleAccountDeletion(repo, opts))
+		authApi.DELETE("/me/deletion", CancelAccountDeletion(repo, opts))
+		authApi.GET("/me/blocks", GetMyBlocks(repo))
+		authApi.GET("/me/mutes", GetMyMutes(repo))
+		authApi.GET("/me/bookmarks", GetMyBookmarks(repo))
+		authApi.GET("/me/bookmarks/collections", GetBookmarkCollections(repo))
+		authApi.POST("/me/bookmarks/collections", CreateBookmarkCollection(repo))
+		authApi.PATCH("/me/bookmarks/collections/:id", RenameBookmarkCollection(repo))
+		authApi.DELETE("/me/bookmarks/collections/:id", DeleteBookmarkCollection(repo))
+		authApi.POST("/users/:username/block", BlockUser(repo))
+		authApi.DELETE("/users/:username/block", UnblockUser(repo))
+		authApi.POST("/users/:username/mute", MuteUser(repo))
+		authApi.DELETE("/users/:username/mute", UnmuteUser(repo))
+		authApi.GET("/me/events", StreamEvents(repo, opts.Events))
+		authApi.GET("/me/login-events", GetMyLoginEvents(repo))
+		authApi.GET("/me/2fa", GetTwoFactorStatus(repo, opts.TwoFactor))
+		authApi.POST("/me/2fa/setup", SetupTwoFactor(repo, opts.TwoFactor))
+		authApi.POST("/me/2fa/enable", EnableTwoFactor(repo))
+		authApi.POST("/me/2fa/disable", DisableTwoFactor(repo, opts.Passwords, opts.TwoFactor))
+		authApi.POST("/me/2fa/recovery-codes", RegenerateRecoveryCodes(repo))
+		authApi.GET("/me/tokens", GetAPITokens(repo))
+		authApi.POST("/me/tokens", CreateAPIToken(repo))
+		authApi.DELETE("/me/tokens/:id", RevokeAPIToken(repo))
+		authApi.GET("/me/identities", GetIdentities(repo, opts.OIDC))
+		authApi.DELETE("/me/identities/:id", UnlinkIdentity(repo))
+		authApi.GET("/me/email", GetMyEmail(repo))
+		authApi.POST("/me/email", SetMyEmail(repo, tokens, opts))
+		authApi.POST("/posts", CreatePost(repo))
+		authApi.POST("/posts/:id/like", LikePost(repo))
+		authApi.POST("/posts/:id/repost", RepostPost(repo))
+		authApi.DELETE("/posts/:id/repost", UnrepostPost(repo))
+		authApi.POST("/posts/:id/reactions/:reaction", ReactToPost(repo, opts.Reactions))
+		authApi.PUT("/posts/:id/bookmark", BookmarkPost(repo))
+		authApi.DELETE("/posts/:id/bookmark", UnbookmarkPost(repo))
+		authApi.POST("/comments/:id/reactions/:reaction", ReactToComment(repo, opts.Reactions))
+		authApi.POST("/posts/:id/comments", CreateComment(repo))
+		authApi.GET("/posts/:id/comments", GetComments(repo))
+		authApi.DELETE("/comments/:id", DeleteComment(repo))
+		authApi.POST("/comments/:id/like", LikeComment(repo))
+		authApi.GET("/me/communities", GetMyCommunities(repo))
+		authApi.POST("/communities", CreateCommunity(repo))
+		authApi.PATCH("/communities/:slug", UpdateCommunity(repo))
+		authApi.POST("/communities/:slug/join", JoinCommunity(repo))
+		authApi.POST("/communities/:slug/leave", LeaveCommunity(repo))
+		authApi.POST("/communities/:slug/members/:username", AddCommunityMember(repo))
+		authApi.DELETE("/communities/:slug/members/:username", RemoveCommunityMember(repo))
+		authApi.PUT("/communities/:slug/moderators/:username", AddCommunityModerator(repo))
+		authApi.DELETE("/communities/:slug/moderators/:username", RemoveCommunityModerator(repo))
+		authApi.DELETE("/communities/:slug/posts/:id", DeleteCommunityPost(repo))
+		authApi.DELETE("/communities/:slug/comments/:id", DeleteCommunityComment(repo))
+		authApi.GET("/conversations", GetConversations(repo))
+		authApi.POST("/conversations", CreateConversation(repo, opts.Events))
+		authApi.GET("/conversations/unread", GetUnreadMessages(repo))
+		authApi.GET("/conversations/:id", GetConversation(repo))
+		authApi.DELETE("/conversations/:id", DeleteConversation(repo))
+		authApi.GET("/conversations/:id/messages", GetMessages(repo))
+		authApi.POST("/conversations/:id/messages", SendMessage(repo, opts.Events))
+		authApi.POST("/conversations/:id/read", MarkConversationRead(repo, opts.Events))
+	}
+}
+
+func HomePage(repo *models.Repository, reactions Reactions) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var userObj *models.User
 		if userData, exists := c.Get("user"); exists {
@@ -95,27 +287,37 @@ func HomePage(repo *models.Repository) gin.HandlerFunc {
 			}
 		}
 
-		posts, _ := repo.GetPostsWithUsers(10, 0)
+		viewerID, unreadMessages := 0, 0
+		if userObj != nil {
+			viewerID = userObj.ID
+			unreadMessages, _, _ = repo.UnreadMessages(userObj.ID)
+		}
+		posts, _ := repo.GetPostsWithUsers(models.PostFilter{ViewerID: viewerID, HideMuted: true}, 10, 0)
+		if err := repo.FillPostViewer(userObj, posts); err != nil {
+			log.Printf("Ошибка получения состояния постов для зрителя: %v", err)
+		}
 		heroes, _ := repo.GetHeroes()
 
-		c.HTML(http.StatusOK, "index.html", gin.H{
-			"title":  "Единство 团结 - Пролетарская платформа",
-			"slogan": "Пролетарии всех стран, соединяйтесь!",
-			"posts":  posts,
-			"heroes": heroes,
-			"user":   userObj,
+		renderHTML(c, http.StatusOK, "index.html", gin.H{
+			"title":          "Единство 团结 - Пролетарская платформа",
+			"slogan":         "Пролетарии всех стран, соединяйтесь!",
+			"posts":          posts,
+			"heroes":         heroes,
+			"reactions":      reactions,
+			"user":           userObj,
+			"unreadMessages": unreadMessages,
 		})
 	}
 }
 
-func LoginPage() gin.HandlerFunc {
+func LoginPage(providers *oidc.Registry) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.HTML(http.StatusOK, "login.html", nil)
+		renderAuthPage(c, http.StatusOK, "login.html", providers, nil)
 	}
 }
 
-func RegisterPage() gin.HandlerFunc {
+func RegisterPage(providers *oidc.Registry) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.HTML(http.StatusOK, "register.html", nil)
+		renderAuthPage(c, http.StatusOK, "register.html", providers, nil)
 	}
 }
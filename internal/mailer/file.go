@@ -0,0 +1,68 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultMailDir = "./mail"
+
+// FileMailer - письма сохраняются в каталог файлами .eml (разработка, тесты)
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+// NewFileMailer - каталог создаётся при необходимости
+func NewFileMailer(from, dir string) (*FileMailer, error) {
+	if dir == "" {
+		dir = defaultMailDir
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("каталог писем %s: %v", dir, err)
+	}
+	return &FileMailer{from: from, dir: dir}, nil
+}
+
+// Send - запись письма в <dir>/<время>-<случайное>.eml
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := msg.render(m.from)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix) + ".eml"
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o640)
+}
+
+// LogMailer - письма только пишутся в журнал (по умолчанию, без почтового сервера)
+type LogMailer struct {
+	from string
+}
+
+// NewLogMailer - from может быть пустым
+func NewLogMailer(from string) *LogMailer {
+	if from == "" {
+		from = defaultFrom
+	}
+	return &LogMailer{from: from}
+}
+
+// Send - текст письма в журнал
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if _, err := msg.render(m.from); err != nil {
+		return err
+	}
+	log.Printf("Письмо для %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
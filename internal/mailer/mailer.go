@@ -0,0 +1,175 @@
+// Package mailer - отправка писем: SMTP, файлы .eml или журнал (для работы без почтового сервера)
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Message - письмо (только текст)
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer - способ доставки писем
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config - раздел mail в config.yaml
+type Config struct {
+	// Backend - smtp, file или log (по умолчанию)
+	Backend string     `yaml:"backend"`
+	From    string     `yaml:"from"`
+	SMTP    SMTPConfig `yaml:"smtp"`
+	// Dir - каталог для писем при backend: file
+	Dir string `yaml:"dir"`
+}
+
+const defaultFrom = "Единство <noreply@localhost>"
+
+// New - отправитель писем по конфигу
+func New(config Config) (Mailer, error) {
+	from := config.From
+	if from == "" {
+		from = defaultFrom
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("неверный адрес отправителя %q: %v", from, err)
+	}
+
+	switch config.Backend {
+	case "", "log":
+		return NewLogMailer(from), nil
+	case "file":
+		return NewFileMailer(from, config.Dir)
+	case "smtp":
+		return NewSMTPMailer(from, config.SMTP)
+	}
+	return nil, fmt.Errorf("неизвестный backend почты: %s", config.Backend)
+}
+
+// ValidAddress - адрес вида user@example.org без имени и лишних символов
+func ValidAddress(address string) bool {
+	parsed, err := mail.ParseAddress(address)
+	return err == nil && parsed.Address == address && len(address) <= 255
+}
+
+// render - письмо в формате RFC 5322 (UTF-8, quoted-printable)
+func (m Message) render(from string) ([]byte, error) {
+	if strings.ContainsAny(m.To+m.Subject, "\r\n") {
+		return nil, fmt.Errorf("перевод строки в заголовке письма")
+	}
+	if !ValidAddress(m.To) {
+		return nil, fmt.Errorf("неверный адрес получателя %q", m.To)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at >= 0 {
+			domain = addr.Address[at+1:]
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", encodeAddress(from))
+	fmt.Fprintf(&buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(m.Text, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeAddress - адрес с именем не в ASCII
+func encodeAddress(address string) string {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return address
+	}
+	return parsed.String()
+}
+
+// envelopeAddress - адрес для SMTP MAIL FROM
+func envelopeAddress(address string) string {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return address
+	}
+	return parsed.Address
+}
+
+// === ШАБЛОНЫ ПИСЕМ ===
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// templates - шаблон по имени и языку ("reset_password.ru")
+var templates = loadTemplates()
+
+const defaultLocale = "ru"
+
+func loadTemplates() map[string]*template.Template {
+	files, err := fs.Glob(templateFS, "templates/*.tmpl")
+	if err != nil {
+		panic(err)
+	}
+	result := map[string]*template.Template{}
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".tmpl")
+		result[name] = template.Must(template.ParseFS(templateFS, file))
+	}
+	return result
+}
+
+// Render - письмо по шаблону на языке locale (если перевода нет - на русском).
+// Шаблон определяет блоки "subject" и "body".
+func Render(name, locale string, data interface{}) (Message, error) {
+	tmpl, ok := templates[name+"."+locale]
+	if !ok {
+		tmpl, ok = templates[name+"."+defaultLocale]
+	}
+	if !ok {
+		return Message{}, fmt.Errorf("нет шаблона письма %s", name)
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(body.String()) + "\n",
+	}, nil
+}
@@ -0,0 +1,118 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPConfig - почтовый сервер
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// TLS - starttls (по умолчанию), tls (порт 465) или none (только для локального relay)
+	TLS     string        `yaml:"tls"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// SMTPMailer - отправка через SMTP
+type SMTPMailer struct {
+	from   string
+	config SMTPConfig
+}
+
+// NewSMTPMailer - проверка настроек SMTP
+func NewSMTPMailer(from string, config SMTPConfig) (*SMTPMailer, error) {
+	if config.Host == "" {
+		return nil, fmt.Errorf("не указан mail.smtp.host")
+	}
+	switch config.TLS {
+	case "":
+		config.TLS = "starttls"
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("неизвестный mail.smtp.tls: %s", config.TLS)
+	}
+	if config.Port == 0 {
+		config.Port = 587
+		if config.TLS == "tls" {
+			config.Port = 465
+		}
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &SMTPMailer{from: from, config: config}, nil
+}
+
+// Send - отправка одного письма в отдельном соединении
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := msg.render(m.from)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	tlsConfig := &tls.Config{ServerName: m.config.Host}
+
+	var conn net.Conn
+	dialer := &net.Dialer{}
+	if m.config.TLS == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("SMTP %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if m.config.TLS == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("SMTP STARTTLS: %w", err)
+		}
+	}
+	if m.config.Username != "" {
+		// PlainAuth сам отказывается отправлять пароль без TLS (кроме localhost)
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP AUTH: %w", err)
+		}
+	}
+
+	if err := client.Mail(envelopeAddress(m.from)); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("SMTP RCPT TO: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("SMTP DATA: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP DATA: %w", err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// === УДАЛЕНИЕ АККАУНТА ===
+
+// Способы удаления аккаунта
+const (
+	// DeletionAnonymize - посты и комментарии остаются от имени «Удален»
+	DeletionAnonymize = "anonymize"
+	// DeletionRemove - посты и комментарии удаляются вместе с аккаунтом
+	DeletionRemove = "remove"
+)
+
+// DeletedDisplayName - имя автора обезличенных постов и комментариев
+const DeletedDisplayName = "Удален"
+
+// ValidDeletionMode - известный способ удаления
+func ValidDeletionMode(mode string) bool {
+	return mode == DeletionAnonymize || mode == DeletionRemove
+}
+
+// PendingDeletion - аккаунт, срок удаления которого наступил
+type PendingDeletion struct {
+	UserID   int
+	Username string
+	Mode     string
+}
+
+// ScheduleAccountDeletion - удаление через grace; до этого запрос можно отменить
+func (r *Repository) ScheduleAccountDeletion(userID int, mode string, grace time.Duration) (time.Time, error) {
+	var at time.Time
+	err := r.db.QueryRow(`
+		UPDATE users SET deletion_scheduled_at = LOCALTIMESTAMP + $1::float8 * INTERVAL '1 second', deletion_mode = $2
+		WHERE id = $3 AND deleted_at IS NULL
+		RETURNING deletion_scheduled_at`,
+		grace.Seconds(), mode, userID,
+	).Scan(&at)
+	return at, err
+}
+
+// CancelAccountDeletion - отмена запроса на удаление
+func (r *Repository) CancelAccountDeletion(userID int) error {
+	_, err := r.db.Exec(
+		"UPDATE users SET deletion_scheduled_at = NULL, deletion_mode = NULL WHERE id = $1", userID,
+	)
+	return err
+}
+
+// DueAccountDeletions - аккаунты, срок удаления которых наступил
+func (r *Repository) DueAccountDeletions() ([]PendingDeletion, error) {
+	rows, err := r.db.Query(`
+		SELECT id, username, deletion_mode FROM users
+		WHERE deletion_scheduled_at <= LOCALTIMESTAMP AND deleted_at IS NULL
+		ORDER BY deletion_scheduled_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []PendingDeletion
+	for rows.Next() {
+		var d PendingDeletion
+		if err := rows.Scan(&d.UserID, &d.Username, &d.Mode); err != nil {
+			return nil, err
+		}
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+// DeleteAccount - удаление аккаунта. Реакции пользователя снимаются и его
+// сообщества передаются другим участникам в обоих случаях; при DeletionRemove
+// удаляются его посты и комментарии, при DeletionAnonymize строка
+// пользователя остаётся без личных данных и входа.
+func (r *Repository) DeleteAccount(userID int, mode string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var username string
+	if err := tx.QueryRow("SELECT username FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&username); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE posts SET likes = likes - 1
+		WHERE id IN (SELECT post_id FROM post_reactions WHERE user_id = $1 AND reaction = $2)`, userID, ReactionLike)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM post_reactions WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE comments SET likes = likes - 1
+		WHERE id IN (SELECT comment_id FROM comment_reactions WHERE user_id = $1 AND reaction = $2)`, userID, ReactionLike)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM comment_reactions WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	// Попытки входа с этим логином, в том числе до регистрации
+	if _, err := tx.Exec("DELETE FROM login_events WHERE user_id = $1 OR username = $2", userID, username); err != nil {
+		return err
+	}
+	if err := transferCommunities(tx, userID); err != nil {
+		return err
+	}
+
+	if mode == DeletionRemove {
+		// Счётчики комментариев чужих постов уменьшает триггер
+		for _, query := range []string{
+			"DELETE FROM comments WHERE user_id = $1",
+			"DELETE FROM posts WHERE user_id = $1",
+			"DELETE FROM users WHERE id = $1",
+		} {
+			if _, err := tx.Exec(query, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}
+
+	for _, query := range []string{
+		"DELETE FROM api_tokens WHERE user_id = $1",
+		"DELETE FROM user_identities WHERE user_id = $1",
+		"DELETE FROM email_tokens WHERE user_id = $1",
+		"DELETE FROM recovery_codes WHERE user_id = $1",
+		"DELETE FROM user_blocks WHERE blocker_id = $1 OR blocked_id = $1",
+		"DELETE FROM user_mutes WHERE user_id = $1 OR muted_id = $1",
+		// Сообщения остаются у собеседников от имени «Удален»
+		"DELETE FROM conversation_members WHERE user_id = $1",
+		// Посты в сообществах остаются, участие и заявки - нет
+		"DELETE FROM community_members WHERE user_id = $1",
+		"DELETE FROM bookmarks WHERE user_id = $1",
+		"DELETE FROM bookmark_collections WHERE user_id = $1",
+	} {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return err
+		}
+	}
+
+	// ~ не проходит проверку логина при регистрации: имя не займут
+	_, err = tx.Exec(`
+		UPDATE users SET username = '~deleted' || id, display_name = $1, password = $2, role = 'user',
+		       email = NULL, email_verified_at = NULL, bio = NULL, avatar_url = NULL, locale = NULL,
+		       totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0,
+		       banned_at = NULL, ban_reason = NULL,
+		       deletion_scheduled_at = NULL, deletion_mode = NULL, deleted_at = CURRENT_TIMESTAMP
+		WHERE id = $3`,
+		DeletedDisplayName, ExternalPassword, userID,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// transferCommunities - сообщества владельца userID переходят к модератору,
+// вступившему раньше других, а без модераторов - к самому давнему участнику.
+// Сообщество, где кроме владельца никого нет, удаляется: без владельца им
+// некому управлять.
+func transferCommunities(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(`
+		UPDATE community_members m SET role = 'owner'
+		FROM (
+			SELECT DISTINCT ON (h.community_id) h.community_id, h.user_id
+			FROM community_members o
+			JOIN community_members h ON h.community_id = o.community_id
+			WHERE o.user_id = $1 AND o.role = 'owner'
+			  AND h.user_id <> $1 AND h.status = 'active'
+			ORDER BY h.community_id, h.role = 'moderator' DESC, h.created_at, h.user_id
+		) heirs
+		WHERE m.community_id = heirs.community_id AND m.user_id = heirs.user_id`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM communities c
+		WHERE EXISTS (SELECT 1 FROM community_members WHERE community_id = c.id AND user_id = $1 AND role = 'owner')
+		  AND NOT EXISTS (SELECT 1 FROM community_members WHERE community_id = c.id AND user_id <> $1 AND role = 'owner')`,
+		userID)
+	return err
+}
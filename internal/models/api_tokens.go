@@ -0,0 +1,106 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// === API TOKENS ===
+
+// Сроки считаются в БД (LOCALTIMESTAMP), как и created_at по умолчанию
+
+const apiTokenColumns = `id, user_id, name, prefix, scopes, expires_at,
+	expires_at IS NOT NULL AND expires_at <= LOCALTIMESTAMP,
+	last_used_at, COALESCE(last_used_ip, ''), created_at`
+
+func scanAPIToken(scan func(dest ...interface{}) error) (*APIToken, error) {
+	var t APIToken
+	var scopes string
+	err := scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &scopes, &t.ExpiresAt,
+		&t.Expired, &t.LastUsedAt, &t.LastUsedIP, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	t.Scopes = strings.Fields(scopes)
+	return &t, nil
+}
+
+// CreateAPIToken - новый токен; expiresInDays = 0 - бессрочный
+func (r *Repository) CreateAPIToken(userID int, name, prefix, hash string, scopes []string, expiresInDays int) (int, error) {
+	var expires sql.NullInt64
+	if expiresInDays > 0 {
+		expires = sql.NullInt64{Int64: int64(expiresInDays), Valid: true}
+	}
+
+	var id int
+	err := r.db.QueryRow(`
+		INSERT INTO api_tokens (user_id, name, prefix, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, LOCALTIMESTAMP + $6::int * INTERVAL '1 day')
+		RETURNING id`,
+		userID, name, prefix, hash, strings.Join(scopes, " "), expires,
+	).Scan(&id)
+	return id, err
+}
+
+// GetActiveAPIToken - действующий (не отозванный и не истёкший) токен по хэшу
+func (r *Repository) GetActiveAPIToken(hash string) (*APIToken, error) {
+	row := r.db.QueryRow(`SELECT `+apiTokenColumns+` FROM api_tokens
+		WHERE token_hash = $1 AND revoked_at IS NULL
+		  AND (expires_at IS NULL OR expires_at > LOCALTIMESTAMP)`, hash)
+	return scanAPIToken(row.Scan)
+}
+
+// GetAPITokens - неотозванные токены пользователя, новые сначала
+func (r *Repository) GetAPITokens(userID int) ([]APIToken, error) {
+	rows, err := r.db.Query(`SELECT `+apiTokenColumns+` FROM api_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+// CountAPITokens - число неотозванных токенов пользователя
+func (r *Repository) CountAPITokens(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM api_tokens WHERE user_id = $1 AND revoked_at IS NULL", userID,
+	).Scan(&count)
+	return count, err
+}
+
+// RevokeAPIToken - отзыв токена владельцем; ErrNotFound, если токена нет
+func (r *Repository) RevokeAPIToken(tokenID, userID int) error {
+	res, err := r.db.Exec(
+		"UPDATE api_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		tokenID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TouchAPIToken - отметка использования (не чаще раза в минуту, чтобы не писать на каждый запрос)
+func (r *Repository) TouchAPIToken(tokenID int, ip string) error {
+	_, err := r.db.Exec(`
+		UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP, last_used_ip = $2
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < LOCALTIMESTAMP - INTERVAL '1 minute')`,
+		tokenID, ip,
+	)
+	return err
+}
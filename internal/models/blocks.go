@@ -0,0 +1,131 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// === БЛОКИРОВКА И СКРЫТИЕ ПОЛЬЗОВАТЕЛЕЙ ===
+
+// RelatedUser - заблокированный или скрытый пользователь
+type RelatedUser struct {
+	ID          int       `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	CreatedAt   time.Time `json:"created_at" doc:"когда заблокирован или скрыт"`
+}
+
+// Relation - отношения зрителя с пользователем
+type Relation struct {
+	Blocked   bool `json:"blocked" doc:"зритель заблокировал пользователя"`
+	BlockedBy bool `json:"blocked_by" doc:"пользователь заблокировал зрителя"`
+	Muted     bool `json:"muted" doc:"зритель скрыл посты пользователя из ленты"`
+}
+
+// Blocking - блокировка в любую сторону
+func (rel Relation) Blocking() bool {
+	return rel.Blocked || rel.BlockedBy
+}
+
+// visibleTo - условие SQL: автор (столбец author) не заблокирован зрителем
+// (параметр viewer) и не заблокировал его, а при withMutes ещё и не скрыт им.
+// Гость (id 0) не совпадает ни с одной записью и видит всё.
+func visibleTo(viewer, author string, withMutes bool) string {
+	cond := fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM user_blocks ub
+            WHERE (ub.blocker_id = %[1]s AND ub.blocked_id = %[2]s)
+               OR (ub.blocker_id = %[2]s AND ub.blocked_id = %[1]s))`, viewer, author)
+	if withMutes {
+		cond += fmt.Sprintf(`
+          AND NOT EXISTS (SELECT 1 FROM user_mutes um WHERE um.user_id = %s AND um.muted_id = %s)`, viewer, author)
+	}
+	return cond
+}
+
+// BlockUser - блокировка; повторная блокировка ничего не меняет
+func (r *Repository) BlockUser(blockerID, blockedID int) error {
+	_, err := r.db.Exec(
+		"INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		blockerID, blockedID,
+	)
+	return err
+}
+
+// UnblockUser - снятие блокировки
+func (r *Repository) UnblockUser(blockerID, blockedID int) error {
+	_, err := r.db.Exec("DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2", blockerID, blockedID)
+	return err
+}
+
+// MuteUser - скрыть посты пользователя из своей ленты
+func (r *Repository) MuteUser(userID, mutedID int) error {
+	_, err := r.db.Exec(
+		"INSERT INTO user_mutes (user_id, muted_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		userID, mutedID,
+	)
+	return err
+}
+
+// UnmuteUser - вернуть посты пользователя в ленту
+func (r *Repository) UnmuteUser(userID, mutedID int) error {
+	_, err := r.db.Exec("DELETE FROM user_mutes WHERE user_id = $1 AND muted_id = $2", userID, mutedID)
+	return err
+}
+
+// GetBlockedUsers - пользователи, заблокированные userID, последние сверху
+func (r *Repository) GetBlockedUsers(userID int) ([]RelatedUser, error) {
+	return r.relatedUsers(`
+        SELECT u.id, u.username, u.display_name, b.created_at
+        FROM user_blocks b
+        JOIN users u ON u.id = b.blocked_id
+        WHERE b.blocker_id = $1
+        ORDER BY b.created_at DESC`, userID)
+}
+
+// GetMutedUsers - пользователи, скрытые userID, последние сверху
+func (r *Repository) GetMutedUsers(userID int) ([]RelatedUser, error) {
+	return r.relatedUsers(`
+        SELECT u.id, u.username, u.display_name, m.created_at
+        FROM user_mutes m
+        JOIN users u ON u.id = m.muted_id
+        WHERE m.user_id = $1
+        ORDER BY m.created_at DESC`, userID)
+}
+
+func (r *Repository) relatedUsers(query string, userID int) ([]RelatedUser, error) {
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []RelatedUser{}
+	for rows.Next() {
+		var u RelatedUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.DisplayName, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// GetRelation - блокировки и скрытие между зрителем и пользователем
+func (r *Repository) GetRelation(viewerID, userID int) (Relation, error) {
+	var rel Relation
+	if viewerID == 0 || viewerID == userID {
+		return rel, nil
+	}
+	err := r.db.QueryRow(`
+        SELECT EXISTS(SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2),
+               EXISTS(SELECT 1 FROM user_blocks WHERE blocker_id = $2 AND blocked_id = $1),
+               EXISTS(SELECT 1 FROM user_mutes WHERE user_id = $1 AND muted_id = $2)`,
+		viewerID, userID,
+	).Scan(&rel.Blocked, &rel.BlockedBy, &rel.Muted)
+	return rel, err
+}
+
+// IsBlockedBetween - есть ли блокировка между пользователями в любую сторону
+func (r *Repository) IsBlockedBetween(a, b int) (bool, error) {
+	rel, err := r.GetRelation(a, b)
+	return rel.Blocking(), err
+}
@@ -0,0 +1,198 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// === ЗАКЛАДКИ ===
+
+// ErrCollectionExists - подборка с таким названием у пользователя уже есть
+var ErrCollectionExists = errors.New("подборка с таким названием уже есть")
+
+// Bookmark - пост в закладках пользователя
+type Bookmark struct {
+	Post         Post      `json:"post"`
+	CollectionID *int      `json:"collection_id" doc:"подборка; null - без подборки"`
+	CreatedAt    time.Time `json:"created_at" doc:"когда добавлен в закладки"`
+}
+
+// InCollection - закладка лежит в подборке id
+func (b Bookmark) InCollection(id int) bool {
+	return b.CollectionID != nil && *b.CollectionID == id
+}
+
+// BookmarkCollection - именованная подборка закладок; видна только владельцу
+type BookmarkCollection struct {
+	ID             int       `json:"id"`
+	Name           string    `json:"name"`
+	BookmarksCount int       `json:"bookmarks_count"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// bookmarksWhere - закладки пользователя ($1, он же зритель PostFilter) без
+// постов, которые ему больше не видны; collectionID = 0 - все подборки
+func bookmarksWhere(userID, collectionID int) (string, []interface{}) {
+	where, args := PostFilter{ViewerID: userID}.where()
+	where = "b.user_id = $1\n          AND " + where
+	if collectionID != 0 {
+		args = append(args, collectionID)
+		where += fmt.Sprintf("\n          AND b.collection_id = $%d", len(args))
+	}
+	return where, args
+}
+
+// GetBookmarks - закладки пользователя, последние добавленные сверху
+func (r *Repository) GetBookmarks(userID, collectionID, limit, offset int) ([]Bookmark, error) {
+	where, args := bookmarksWhere(userID, collectionID)
+	query := fmt.Sprintf(`
+        SELECT `+postColumns+`, b.collection_id, b.created_at
+        `+postFrom+`
+        JOIN bookmarks b ON b.post_id = p.id
+        WHERE %s
+        ORDER BY b.created_at DESC, p.id DESC
+        LIMIT $%d OFFSET $%d
+    `, where, len(args)+1, len(args)+2)
+
+	rows, err := r.queryRead(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarks := []Bookmark{}
+	for rows.Next() {
+		var b Bookmark
+		var collectionID sql.NullInt64
+		post, err := scanPost(func(dest ...interface{}) error {
+			return rows.Scan(append(dest, &collectionID, &b.CreatedAt)...)
+		})
+		if err != nil {
+			return nil, err
+		}
+		b.Post = *post
+		if collectionID.Valid {
+			id := int(collectionID.Int64)
+			b.CollectionID = &id
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	posts := make([]Post, len(bookmarks))
+	for i := range bookmarks {
+		posts[i] = bookmarks[i].Post
+	}
+	if err := r.FillOriginals(userID, posts); err != nil {
+		return nil, err
+	}
+	for i := range bookmarks {
+		bookmarks[i].Post = posts[i]
+	}
+	return bookmarks, nil
+}
+
+// CountBookmarks - количество закладок для пагинации GetBookmarks
+func (r *Repository) CountBookmarks(userID, collectionID int) (int, error) {
+	where, args := bookmarksWhere(userID, collectionID)
+	var count int
+	err := r.reader().QueryRow(
+		"SELECT COUNT(*) FROM posts p JOIN bookmarks b ON b.post_id = p.id WHERE "+where, args...,
+	).Scan(&count)
+	return count, err
+}
+
+// BookmarkPost - добавить пост в закладки или переложить в другую подборку;
+// collectionID = 0 - без подборки. Время добавления при переносе не меняется.
+func (r *Repository) BookmarkPost(userID, postID, collectionID int) error {
+	_, err := r.db.Exec(`
+        INSERT INTO bookmarks (user_id, post_id, collection_id) VALUES ($1, $2, NULLIF($3, 0))
+        ON CONFLICT (user_id, post_id) DO UPDATE SET collection_id = EXCLUDED.collection_id`,
+		userID, postID, collectionID,
+	)
+	return err
+}
+
+// UnbookmarkPost - убрать пост из закладок
+func (r *Repository) UnbookmarkPost(userID, postID int) error {
+	_, err := r.db.Exec("DELETE FROM bookmarks WHERE user_id = $1 AND post_id = $2", userID, postID)
+	return err
+}
+
+// GetBookmarkCollections - подборки пользователя по названию
+func (r *Repository) GetBookmarkCollections(userID int) ([]BookmarkCollection, error) {
+	rows, err := r.db.Query(`
+        SELECT bc.id, bc.name, COUNT(b.post_id), bc.created_at
+        FROM bookmark_collections bc
+        LEFT JOIN bookmarks b ON b.collection_id = bc.id
+        WHERE bc.user_id = $1
+        GROUP BY bc.id
+        ORDER BY bc.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []BookmarkCollection{}
+	for rows.Next() {
+		var bc BookmarkCollection
+		if err := rows.Scan(&bc.ID, &bc.Name, &bc.BookmarksCount, &bc.CreatedAt); err != nil {
+			return nil, err
+		}
+		collections = append(collections, bc)
+	}
+	return collections, rows.Err()
+}
+
+// GetBookmarkCollection - подборка пользователя; чужая - sql.ErrNoRows
+func (r *Repository) GetBookmarkCollection(userID, id int) (*BookmarkCollection, error) {
+	var bc BookmarkCollection
+	err := r.db.QueryRow(`
+        SELECT bc.id, bc.name, (SELECT COUNT(*) FROM bookmarks b WHERE b.collection_id = bc.id), bc.created_at
+        FROM bookmark_collections bc
+        WHERE bc.id = $1 AND bc.user_id = $2`, id, userID,
+	).Scan(&bc.ID, &bc.Name, &bc.BookmarksCount, &bc.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &bc, nil
+}
+
+// CreateBookmarkCollection - новая подборка; ErrCollectionExists, если название занято
+func (r *Repository) CreateBookmarkCollection(userID int, name string) (int, error) {
+	var id int
+	err := r.db.QueryRow(`
+        INSERT INTO bookmark_collections (user_id, name) VALUES ($1, $2)
+        ON CONFLICT (user_id, name) DO NOTHING
+        RETURNING id`, userID, name,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrCollectionExists
+	}
+	return id, err
+}
+
+// RenameBookmarkCollection - новое название подборки; ErrCollectionExists, если оно занято
+func (r *Repository) RenameBookmarkCollection(userID, id int, name string) error {
+	_, err := r.db.Exec(
+		"UPDATE bookmark_collections SET name = $1 WHERE id = $2 AND user_id = $3",
+		name, id, userID,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrCollectionExists
+	}
+	return err
+}
+
+// DeleteBookmarkCollection - удалить подборку; её закладки остаются без подборки
+func (r *Repository) DeleteBookmarkCollection(userID, id int) error {
+	_, err := r.db.Exec("DELETE FROM bookmark_collections WHERE id = $1 AND user_id = $2", id, userID)
+	return err
+}
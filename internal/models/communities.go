@@ -0,0 +1,358 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// === СООБЩЕСТВА ===
+
+// Режимы сообщества
+const (
+	// CommunityPublic - посты видны всем, вступить может любой
+	CommunityPublic = "public"
+	// CommunityPrivate - в списке виден всем, посты - только участникам; вступление по заявке
+	CommunityPrivate = "private"
+	// CommunityInvite - посторонним не виден вовсе; вступление по приглашению модератора
+	CommunityInvite = "invite"
+)
+
+// Роли участников
+const (
+	CommunityRoleOwner     = "owner"
+	CommunityRoleModerator = "moderator"
+	CommunityRoleMember    = "member"
+)
+
+// Состояние участия
+const (
+	MemberActive    = "active"
+	MemberRequested = "requested"
+	MemberInvited   = "invited"
+)
+
+// ErrCommunityExists - адрес сообщества уже занят
+var ErrCommunityExists = errors.New("сообщество с таким адресом уже есть")
+
+// ValidCommunityVisibility - известный режим сообщества
+func ValidCommunityVisibility(visibility string) bool {
+	switch visibility {
+	case CommunityPublic, CommunityPrivate, CommunityInvite:
+		return true
+	}
+	return false
+}
+
+// CommunityRef - сообщество поста
+type CommunityRef struct {
+	ID   int    `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// CommunityMembership - участие зрителя в сообществе
+type CommunityMembership struct {
+	Role   string `json:"role" doc:"owner, moderator или member"`
+	Status string `json:"status" doc:"active, requested (заявка) или invited (приглашение)"`
+}
+
+// Active - состоит в сообществе
+func (m *CommunityMembership) Active() bool {
+	return m != nil && m.Status == MemberActive
+}
+
+// CanModerate - владелец или модератор
+func (m *CommunityMembership) CanModerate() bool {
+	return m.Active() && (m.Role == CommunityRoleOwner || m.Role == CommunityRoleModerator)
+}
+
+// IsOwner - владелец сообщества
+func (m *CommunityMembership) IsOwner() bool {
+	return m.Active() && m.Role == CommunityRoleOwner
+}
+
+// Community - сообщество глазами зрителя
+type Community struct {
+	ID           int                  `json:"id"`
+	Slug         string               `json:"slug"`
+	Name         string               `json:"name"`
+	Description  string               `json:"description"`
+	Visibility   string               `json:"visibility" doc:"public, private или invite"`
+	MembersCount int                  `json:"members_count"`
+	CreatedAt    time.Time            `json:"created_at"`
+	Membership   *CommunityMembership `json:"membership,omitempty" doc:"участие зрителя; нет - не состоит"`
+}
+
+// Readable - зритель видит посты сообщества
+func (c *Community) Readable() bool {
+	return c.Visibility == CommunityPublic || c.Membership.Active()
+}
+
+// Listed - сообщество видно зрителю в списках и по адресу
+func (c *Community) Listed() bool {
+	return c.Visibility != CommunityInvite || c.Membership != nil
+}
+
+// CommunityMember - участник, заявка или приглашение
+type CommunityMember struct {
+	ID          int       `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Role        string    `json:"role"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at" doc:"когда вступил, подал заявку или приглашён"`
+}
+
+// communityReadable - условие SQL: посты сообщества (столбец community, NULL -
+// пост вне сообществ) видны зрителю (параметр viewer)
+func communityReadable(viewer, community string) string {
+	return fmt.Sprintf(`(%[2]s IS NULL
+            OR EXISTS (SELECT 1 FROM communities cv WHERE cv.id = %[2]s AND cv.visibility = 'public')
+            OR EXISTS (SELECT 1 FROM community_members mv
+                WHERE mv.community_id = %[2]s AND mv.user_id = %[1]s AND mv.status = 'active'))`, viewer, community)
+}
+
+// communityColumns - сообщество с участием зрителя $1 (LEFT JOIN community_members cm)
+const communityColumns = `co.id, co.slug, co.name, co.description, co.visibility, co.created_at,
+        (SELECT COUNT(*) FROM community_members WHERE community_id = co.id AND status = 'active'),
+        cm.role, cm.status`
+
+const communityFrom = `FROM communities co
+        LEFT JOIN community_members cm ON cm.community_id = co.id AND cm.user_id = $1`
+
+func scanCommunity(scan func(dest ...interface{}) error) (*Community, error) {
+	var c Community
+	var role, status sql.NullString
+	err := scan(&c.ID, &c.Slug, &c.Name, &c.Description, &c.Visibility, &c.CreatedAt,
+		&c.MembersCount, &role, &status)
+	if err != nil {
+		return nil, err
+	}
+	if status.Valid {
+		c.Membership = &CommunityMembership{Role: role.String, Status: status.String}
+	}
+	return &c, nil
+}
+
+// CreateCommunity - новое сообщество; создатель становится владельцем.
+// ErrCommunityExists, если адрес занят.
+func (r *Repository) CreateCommunity(ownerID int, slug, name, description, visibility string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+        INSERT INTO communities (slug, name, description, visibility, created_by)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (slug) DO NOTHING
+        RETURNING id`,
+		slug, name, description, visibility, ownerID,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrCommunityExists
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO community_members (community_id, user_id, role, status) VALUES ($1, $2, $3, $4)",
+		id, ownerID, CommunityRoleOwner, MemberActive,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// UpdateCommunity - название, описание и режим
+func (r *Repository) UpdateCommunity(id int, name, description, visibility string) error {
+	_, err := r.db.Exec(
+		"UPDATE communities SET name = $1, description = $2, visibility = $3 WHERE id = $4",
+		name, description, visibility, id,
+	)
+	return err
+}
+
+// GetCommunity - сообщество по адресу с участием зрителя viewerID
+func (r *Repository) GetCommunity(slug string, viewerID int) (*Community, error) {
+	row := r.reader().QueryRow(`
+        SELECT `+communityColumns+`
+        `+communityFrom+`
+        WHERE co.slug = $2`, viewerID, slug)
+	return scanCommunity(row.Scan)
+}
+
+// GetCommunities - сообщества, видимые зрителю: все, кроме чужих по приглашениям
+func (r *Repository) GetCommunities(viewerID, limit, offset int) ([]Community, error) {
+	return r.communities(`
+        SELECT `+communityColumns+`
+        `+communityFrom+`
+        WHERE co.visibility <> 'invite' OR cm.user_id IS NOT NULL
+        ORDER BY co.created_at DESC
+        LIMIT $2 OFFSET $3`, viewerID, limit, offset)
+}
+
+// CountCommunities - количество сообществ для GetCommunities
+func (r *Repository) CountCommunities(viewerID int) (int, error) {
+	var count int
+	err := r.reader().QueryRow(`
+        SELECT COUNT(*)
+        `+communityFrom+`
+        WHERE co.visibility <> 'invite' OR cm.user_id IS NOT NULL`, viewerID,
+	).Scan(&count)
+	return count, err
+}
+
+// GetUserCommunities - сообщества пользователя, включая заявки и приглашения
+func (r *Repository) GetUserCommunities(userID int) ([]Community, error) {
+	return r.communities(`
+        SELECT `+communityColumns+`
+        `+communityFrom+`
+        WHERE cm.user_id IS NOT NULL
+        ORDER BY cm.created_at DESC`, userID)
+}
+
+func (r *Repository) communities(query string, args ...interface{}) ([]Community, error) {
+	rows, err := r.queryRead(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	communities := []Community{}
+	for rows.Next() {
+		c, err := scanCommunity(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		communities = append(communities, *c)
+	}
+	return communities, rows.Err()
+}
+
+// CommunityReadable - видны ли зрителю посты сообщества communityID
+func (r *Repository) CommunityReadable(communityID, viewerID int) (bool, error) {
+	var readable bool
+	err := r.reader().QueryRow(
+		"SELECT "+communityReadable("$1", "$2::int"), viewerID, communityID,
+	).Scan(&readable)
+	return readable, err
+}
+
+// SetCommunityMembership - вступление, заявка или приглашение; у существующего
+// участника меняется только состояние, роль сохраняется
+func (r *Repository) SetCommunityMembership(communityID, userID int, status string) error {
+	_, err := r.db.Exec(`
+        INSERT INTO community_members (community_id, user_id, role, status)
+        VALUES ($1, $2, 'member', $3)
+        ON CONFLICT (community_id, user_id) DO UPDATE SET status = EXCLUDED.status`,
+		communityID, userID, status,
+	)
+	return err
+}
+
+// SetCommunityRole - назначение или снятие модератора. ErrNotFound, если
+// пользователь не участник или владелец.
+func (r *Repository) SetCommunityRole(communityID, userID int, role string) error {
+	result, err := r.db.Exec(`
+        UPDATE community_members SET role = $3
+        WHERE community_id = $1 AND user_id = $2 AND status = 'active' AND role <> 'owner'`,
+		communityID, userID, role,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RemoveCommunityMember - выход, исключение, отклонение заявки или отзыв
+// приглашения. Владельца не удалить; ErrNotFound, если записи нет.
+func (r *Repository) RemoveCommunityMember(communityID, userID int) error {
+	result, err := r.db.Exec(
+		"DELETE FROM community_members WHERE community_id = $1 AND user_id = $2 AND role <> 'owner'",
+		communityID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetCommunityMembers - участники в состоянии status: сначала владелец и модераторы
+func (r *Repository) GetCommunityMembers(communityID int, status string, limit, offset int) ([]CommunityMember, error) {
+	rows, err := r.queryRead(`
+        SELECT u.id, u.username, u.display_name, m.role, m.status, m.created_at
+        FROM community_members m
+        JOIN users u ON u.id = m.user_id
+        WHERE m.community_id = $1 AND m.status = $2
+        ORDER BY CASE m.role WHEN 'owner' THEN 0 WHEN 'moderator' THEN 1 ELSE 2 END, m.created_at
+        LIMIT $3 OFFSET $4`,
+		communityID, status, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []CommunityMember{}
+	for rows.Next() {
+		var m CommunityMember
+		if err := rows.Scan(&m.ID, &m.Username, &m.DisplayName, &m.Role, &m.Status, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// CountCommunityMembers - количество для GetCommunityMembers
+func (r *Repository) CountCommunityMembers(communityID int, status string) (int, error) {
+	var count int
+	err := r.reader().QueryRow(
+		"SELECT COUNT(*) FROM community_members WHERE community_id = $1 AND status = $2",
+		communityID, status,
+	).Scan(&count)
+	return count, err
+}
+
+// DeleteCommunityPost - удаление поста модератором. ErrNotFound, если пост
+// не из этого сообщества; лайки и комментарии удаляются каскадом.
+func (r *Repository) DeleteCommunityPost(communityID, postID int) error {
+	result, err := r.db.Exec("DELETE FROM posts WHERE id = $1 AND community_id = $2", postID, communityID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteCommunityComment - удаление комментария модератором. ErrNotFound,
+// если комментарий не к посту этого сообщества.
+func (r *Repository) DeleteCommunityComment(communityID, commentID int) error {
+	result, err := r.db.Exec(`
+        DELETE FROM comments c USING posts p
+        WHERE c.id = $1 AND p.id = c.post_id AND p.community_id = $2`,
+		commentID, communityID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// === ССЫЛКИ ИЗ ПИСЕМ ===
+
+// Назначение одноразовых ссылок (совпадает с типом подписанного токена)
+const (
+	TokenPasswordReset = "password_reset"
+	TokenEmailVerify   = "email_verify"
+)
+
+// CreateEmailToken - запись о выданной ссылке; срок считается в БД
+func (r *Repository) CreateEmailToken(jti string, userID int, purpose, email string, ttl time.Duration) error {
+	_, err := r.db.Exec(`
+		INSERT INTO email_tokens (jti, user_id, purpose, email, expires_at)
+		VALUES ($1, $2, $3, $4, LOCALTIMESTAMP + $5::float8 * INTERVAL '1 second')`,
+		jti, userID, purpose, email, ttl.Seconds(),
+	)
+	return err
+}
+
+// CountRecentEmailTokens - сколько ссылок выдано пользователю за окно (защита от рассылки)
+func (r *Repository) CountRecentEmailTokens(userID int, purpose string, window time.Duration) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM email_tokens
+		WHERE user_id = $1 AND purpose = $2
+		  AND created_at > LOCALTIMESTAMP - $3::float8 * INTERVAL '1 second'`,
+		userID, purpose, window.Seconds(),
+	).Scan(&count)
+	return count, err
+}
+
+// useEmailToken - отметка использования; ErrNotFound, если ссылка неизвестна,
+// использована или истекла. Возвращает email, на который она была выдана.
+func useEmailToken(tx *sql.Tx, jti string, userID int, purpose string) (string, error) {
+	var email string
+	err := tx.QueryRow(`
+		UPDATE email_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE jti = $1 AND user_id = $2 AND purpose = $3
+		  AND used_at IS NULL AND expires_at > LOCALTIMESTAMP
+		RETURNING email`,
+		jti, userID, purpose,
+	).Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return email, err
+}
+
+// ResetPasswordWithToken - новый пароль по ссылке; остальные ссылки сброса гасятся
+func (r *Repository) ResetPasswordWithToken(jti string, userID int, hashedPassword string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := useEmailToken(tx, jti, userID, TokenPasswordReset); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET password = $1 WHERE id = $2", hashedPassword, userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE email_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		userID, TokenPasswordReset,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// VerifyEmailWithToken - подтверждение адреса по ссылке. ErrNotFound, если ссылка
+// недействительна или адрес пользователя с тех пор сменился.
+func (r *Repository) VerifyEmailWithToken(jti string, userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	email, err := useEmailToken(tx, jti, userID, TokenEmailVerify)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`
+		UPDATE users SET email_verified_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND LOWER(email) = LOWER($2)`,
+		userID, email,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	return tx.Commit()
+}
+
+// SetUserEmail - новый адрес (неподтверждённый); пустой - удалить адрес
+func (r *Repository) SetUserEmail(userID int, email string) error {
+	_, err := r.db.Exec(
+		"UPDATE users SET email = NULLIF($1, ''), email_verified_at = NULL WHERE id = $2",
+		email, userID,
+	)
+	return err
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// === ВНЕШНИЕ УЧЁТНЫЕ ЗАПИСИ (OIDC) ===
+
+// ExternalPassword - пароль пользователя, созданного через внешний вход.
+// Не является bcrypt-хэшем, поэтому войти по паролю нельзя.
+const ExternalPassword = "!"
+
+const identityColumns = `id, user_id, provider, subject, COALESCE(email, ''), created_at, last_login_at`
+
+func scanUserIdentity(scan func(dest ...interface{}) error) (*UserIdentity, error) {
+	var i UserIdentity
+	err := scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt, &i.LastLoginAt)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// GetUserIdentity - привязка по провайдеру и subject; ErrNotFound, если её нет
+func (r *Repository) GetUserIdentity(provider, subject string) (*UserIdentity, error) {
+	row := r.db.QueryRow(`SELECT `+identityColumns+` FROM user_identities
+		WHERE provider = $1 AND subject = $2`, provider, subject)
+	identity, err := scanUserIdentity(row.Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return identity, err
+}
+
+// CreateUserIdentity - привязка внешней учётной записи к пользователю
+func (r *Repository) CreateUserIdentity(userID int, provider, subject, email string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), CURRENT_TIMESTAMP)`,
+		userID, provider, subject, email,
+	)
+	return err
+}
+
+// TouchUserIdentity - отметка входа и актуальный email провайдера
+func (r *Repository) TouchUserIdentity(identityID int, email string) error {
+	_, err := r.db.Exec(`
+		UPDATE user_identities SET last_login_at = CURRENT_TIMESTAMP, email = NULLIF($2, '')
+		WHERE id = $1`,
+		identityID, email,
+	)
+	return err
+}
+
+// GetUserIdentities - привязанные учётные записи пользователя
+func (r *Repository) GetUserIdentities(userID int) ([]UserIdentity, error) {
+	rows, err := r.db.Query(`SELECT `+identityColumns+` FROM user_identities
+		WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []UserIdentity
+	for rows.Next() {
+		i, err := scanUserIdentity(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, *i)
+	}
+	return identities, rows.Err()
+}
+
+// CountUserIdentities - число привязанных учётных записей
+func (r *Repository) CountUserIdentities(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM user_identities WHERE user_id = $1", userID).Scan(&count)
+	return count, err
+}
+
+// DeleteUserIdentity - отвязка учётной записи владельцем; ErrNotFound, если её нет
+func (r *Repository) DeleteUserIdentity(identityID, userID int) error {
+	res, err := r.db.Exec("DELETE FROM user_identities WHERE id = $1 AND user_id = $2", identityID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetUserByEmail - пользователь с подтверждённым email (без учёта регистра); ErrNotFound, если его нет
+func (r *Repository) GetUserByEmail(email string) (*User, error) {
+	var username string
+	err := r.db.QueryRow(
+		"SELECT username FROM users WHERE LOWER(email) = LOWER($1) AND email_verified_at IS NOT NULL", email,
+	).Scan(&username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.GetUserByUsername(username)
+}
+
+// CreateExternalUser - пользователь внешнего входа (без пароля); email может быть пустым,
+// непустой считается подтверждённым провайдером
+func (r *Repository) CreateExternalUser(username, displayName, email, role string) (*User, error) {
+	if displayName == "" {
+		displayName = username
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO users (username, password, role, display_name, email, email_verified_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), CASE WHEN $5 = '' THEN NULL ELSE CURRENT_TIMESTAMP END)`,
+		username, ExternalPassword, role, displayName, email,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetUserByUsername(username)
+}
+
+// UsernameTaken - занят ли логин
+func (r *Repository) UsernameTaken(username string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)", username).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// === LOGIN EVENTS ===
+
+// maxLoginUsernameLen - длина логина в login_events в символах (VARCHAR считает
+// символы, не байты; попытки с мусорными логинами)
+const maxLoginUsernameLen = 255
+
+// RecordLoginEvent - запись попытки входа; userID = 0 для неизвестного логина
+func (r *Repository) RecordLoginEvent(userID int, username, ip, userAgent, result string) error {
+	// Срез по байтам мог бы разрезать символ и дать невалидный UTF-8
+	if runes := []rune(username); len(runes) > maxLoginUsernameLen {
+		username = string(runes[:maxLoginUsernameLen])
+	}
+
+	var uid sql.NullInt64
+	if userID > 0 {
+		uid = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+
+	_, err := r.db.Exec(
+		`INSERT INTO login_events (user_id, username, ip, user_agent, result) VALUES ($1, $2, $3, $4, $5)`,
+		uid, username, ip, userAgent, result,
+	)
+	return err
+}
+
+// Время считается на стороне БД (created_at - TIMESTAMP без зоны), наружу
+// отдаётся возраст попыток: так не важен часовой пояс сервера БД.
+
+// LoginFailuresByUsername - возраст неудачных попыток по логину за window
+// после последнего успешного входа или снятия блокировки (старые сначала)
+func (r *Repository) LoginFailuresByUsername(username string, window time.Duration) ([]time.Duration, error) {
+	return r.loginFailureAges(`
+		SELECT EXTRACT(EPOCH FROM LOCALTIMESTAMP - created_at) FROM login_events
+		WHERE username = $1 AND result IN ($3, $4, $5)
+		  AND created_at > LOCALTIMESTAMP - $2::float8 * INTERVAL '1 second'
+		  AND created_at > COALESCE((
+		      SELECT MAX(created_at) FROM login_events
+		      WHERE username = $1 AND result IN ($6, $7)
+		  ), '-infinity')
+		ORDER BY created_at`,
+		username, window.Seconds(), LoginBadPassword, LoginUnknownUser, LoginMFAFailed, LoginSuccess, LoginUnlocked)
+}
+
+// LoginFailuresByIP - возраст неудачных попыток с IP за window (старые сначала)
+func (r *Repository) LoginFailuresByIP(ip string, window time.Duration) ([]time.Duration, error) {
+	return r.loginFailureAges(`
+		SELECT EXTRACT(EPOCH FROM LOCALTIMESTAMP - created_at) FROM login_events
+		WHERE ip = $1 AND result IN ($3, $4, $5)
+		  AND created_at > LOCALTIMESTAMP - $2::float8 * INTERVAL '1 second'
+		ORDER BY created_at`,
+		ip, window.Seconds(), LoginBadPassword, LoginUnknownUser, LoginMFAFailed)
+}
+
+func (r *Repository) loginFailureAges(query string, args ...interface{}) ([]time.Duration, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ages []time.Duration
+	for rows.Next() {
+		var seconds float64
+		if err := rows.Scan(&seconds); err != nil {
+			return nil, err
+		}
+		ages = append(ages, time.Duration(seconds*float64(time.Second)))
+	}
+	return ages, rows.Err()
+}
+
+// LockedUsernames - логины, у которых за window не меньше threshold неудачных попыток
+func (r *Repository) LockedUsernames(threshold int, window time.Duration) (map[string]bool, error) {
+	rows, err := r.db.Query(`
+		SELECT e.username FROM login_events e
+		WHERE e.result IN ($3, $4, $5)
+		  AND e.created_at > LOCALTIMESTAMP - $2::float8 * INTERVAL '1 second'
+		  AND e.created_at > COALESCE((
+		      SELECT MAX(r.created_at) FROM login_events r
+		      WHERE r.username = e.username AND r.result IN ($6, $7)
+		  ), '-infinity')
+		GROUP BY e.username
+		HAVING COUNT(*) >= $1`,
+		threshold, window.Seconds(), LoginBadPassword, LoginUnknownUser, LoginMFAFailed, LoginSuccess, LoginUnlocked)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locked := make(map[string]bool)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		locked[username] = true
+	}
+	return locked, rows.Err()
+}
+
+// GetLoginEvents - история входов пользователя, новые сначала
+func (r *Repository) GetLoginEvents(userID, limit, offset int) ([]LoginEvent, error) {
+	rows, err := r.db.Query(`
+		SELECT id, result, ip, user_agent, created_at FROM login_events
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3`,
+		userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []LoginEvent
+	for rows.Next() {
+		var e LoginEvent
+		if err := rows.Scan(&e.ID, &e.Result, &e.IP, &e.UserAgent, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// CountLoginEvents - размер истории входов пользователя
+func (r *Repository) CountLoginEvents(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM login_events WHERE user_id = $1", userID).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,396 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// === ЛИЧНЫЕ СООБЩЕНИЯ ===
+
+// ConversationMember - участник диалога
+type ConversationMember struct {
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+}
+
+// Conversation - диалог или группа глазами участника
+type Conversation struct {
+	ID          int                  `json:"id"`
+	Title       string               `json:"title,omitempty"`
+	IsGroup     bool                 `json:"is_group"`
+	Members     []ConversationMember `json:"members"`
+	LastMessage *Message             `json:"last_message,omitempty"`
+	UnreadCount int                  `json:"unread_count"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at" doc:"время последнего сообщения"`
+}
+
+// Message - сообщение в диалоге
+type Message struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversation_id"`
+	UserID         int       `json:"user_id"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+	User           *User     `json:"user,omitempty"`
+}
+
+// messageVisible - сообщение m видно участнику cm: не удалено им для себя
+// и написано не тем, с кем у него блокировка
+var messageVisible = "m.id > cm.cleared_message_id AND " + visibleTo("cm.user_id", "m.user_id", false)
+
+// unreadCount - непрочитанные участником cm сообщения диалога c
+var unreadCount = `(SELECT COUNT(*) FROM messages m
+        WHERE m.conversation_id = c.id AND m.id > cm.last_read_message_id AND m.user_id <> cm.user_id
+          AND ` + messageVisible + `)`
+
+// GetOrCreateDirectConversation - диалог двух пользователей; created - создан сейчас
+func (r *Repository) GetOrCreateDirectConversation(userID, otherID int) (int, bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	// Два одновременных запроса не создадут второй диалог той же пары
+	a, b := userID, otherID
+	if a > b {
+		a, b = b, a
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1, $2)", a, b); err != nil {
+		return 0, false, err
+	}
+
+	var id int
+	err = tx.QueryRow(`
+        SELECT c.id FROM conversations c
+        WHERE NOT c.is_group
+          AND EXISTS (SELECT 1 FROM conversation_members WHERE conversation_id = c.id AND user_id = $1)
+          AND EXISTS (SELECT 1 FROM conversation_members WHERE conversation_id = c.id AND user_id = $2)
+        LIMIT 1`, userID, otherID,
+	).Scan(&id)
+	if err == nil {
+		// Удалённый для себя диалог снова в списке того, кто его открыл
+		_, err = tx.Exec(
+			"UPDATE conversation_members SET hidden = FALSE WHERE conversation_id = $1 AND user_id = $2", id, userID,
+		)
+		if err != nil {
+			return 0, false, err
+		}
+		return id, false, tx.Commit()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+
+	id, err = createConversation(tx, userID, []int{userID, otherID}, "", false)
+	if err != nil {
+		return 0, false, err
+	}
+	return id, true, tx.Commit()
+}
+
+// CreateGroupConversation - группа из создателя и memberIDs
+func (r *Repository) CreateGroupConversation(creatorID int, memberIDs []int, title string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := createConversation(tx, creatorID, append([]int{creatorID}, memberIDs...), title, true)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func createConversation(tx *sql.Tx, creatorID int, memberIDs []int, title string, isGroup bool) (int, error) {
+	var id int
+	err := tx.QueryRow(
+		"INSERT INTO conversations (created_by, title, is_group) VALUES ($1, NULLIF($2, ''), $3) RETURNING id",
+		creatorID, title, isGroup,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	for _, memberID := range memberIDs {
+		_, err := tx.Exec(
+			"INSERT INTO conversation_members (conversation_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			id, memberID,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// GetConversations - диалоги пользователя (кроме удалённых им), последние сверху
+func (r *Repository) GetConversations(userID, limit, offset int) ([]Conversation, error) {
+	rows, err := r.db.Query(`
+        SELECT c.id, COALESCE(c.title, ''), c.is_group, c.created_at, c.updated_at, `+unreadCount+`
+        FROM conversation_members cm
+        JOIN conversations c ON c.id = cm.conversation_id
+        WHERE cm.user_id = $1 AND NOT cm.hidden
+        ORDER BY c.updated_at DESC, c.id DESC
+        LIMIT $2 OFFSET $3`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	for rows.Next() {
+		var c Conversation
+		if err := rows.Scan(&c.ID, &c.Title, &c.IsGroup, &c.CreatedAt, &c.UpdatedAt, &c.UnreadCount); err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return conversations, r.fillConversations(userID, conversations)
+}
+
+// CountConversations - количество диалогов пользователя (для пагинации)
+func (r *Repository) CountConversations(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM conversation_members WHERE user_id = $1 AND NOT hidden", userID,
+	).Scan(&count)
+	return count, err
+}
+
+// GetConversation - диалог, если пользователь в нём участвует, иначе ErrNotFound
+func (r *Repository) GetConversation(conversationID, userID int) (*Conversation, error) {
+	var c Conversation
+	err := r.db.QueryRow(`
+        SELECT c.id, COALESCE(c.title, ''), c.is_group, c.created_at, c.updated_at, `+unreadCount+`
+        FROM conversation_members cm
+        JOIN conversations c ON c.id = cm.conversation_id
+        WHERE cm.user_id = $1 AND c.id = $2`, userID, conversationID,
+	).Scan(&c.ID, &c.Title, &c.IsGroup, &c.CreatedAt, &c.UpdatedAt, &c.UnreadCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := []Conversation{c}
+	if err := r.fillConversations(userID, conversations); err != nil {
+		return nil, err
+	}
+	return &conversations[0], nil
+}
+
+// fillConversations - участники и последнее видимое сообщение диалогов
+func (r *Repository) fillConversations(userID int, conversations []Conversation) error {
+	if len(conversations) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(conversations))
+	byID := make(map[int]*Conversation, len(conversations))
+	for i := range conversations {
+		ids[i] = int64(conversations[i].ID)
+		byID[conversations[i].ID] = &conversations[i]
+		conversations[i].Members = []ConversationMember{}
+	}
+
+	rows, err := r.db.Query(`
+        SELECT cm.conversation_id, u.id, u.username, u.display_name
+        FROM conversation_members cm
+        JOIN users u ON u.id = cm.user_id
+        WHERE cm.conversation_id = ANY($1)
+        ORDER BY cm.joined_at, u.id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var conversationID int
+		var m ConversationMember
+		if err := rows.Scan(&conversationID, &m.ID, &m.Username, &m.DisplayName); err != nil {
+			return err
+		}
+		c := byID[conversationID]
+		c.Members = append(c.Members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = r.db.Query(`
+        SELECT DISTINCT ON (m.conversation_id)
+               m.id, m.conversation_id, m.user_id, m.content, m.created_at,
+               u.id, u.username, u.display_name, u.role, u.created_at
+        FROM messages m
+        JOIN users u ON u.id = m.user_id
+        JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = $2
+        WHERE m.conversation_id = ANY($1) AND `+messageVisible+`
+        ORDER BY m.conversation_id, m.id DESC`, pq.Array(ids), userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return err
+		}
+		byID[msg.ConversationID].LastMessage = msg
+	}
+	return rows.Err()
+}
+
+func scanMessage(rows *sql.Rows) (*Message, error) {
+	var m Message
+	var user User
+	err := rows.Scan(
+		&m.ID, &m.ConversationID, &m.UserID, &m.Content, &m.CreatedAt,
+		&user.ID, &user.Username, &user.DisplayName, &user.Role, &user.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.User = &user
+	return &m, nil
+}
+
+// GetMessages - видимые пользователю сообщения диалога, новые сверху
+func (r *Repository) GetMessages(conversationID, userID, limit, offset int) ([]Message, error) {
+	rows, err := r.db.Query(`
+        SELECT m.id, m.conversation_id, m.user_id, m.content, m.created_at,
+               u.id, u.username, u.display_name, u.role, u.created_at
+        FROM messages m
+        JOIN users u ON u.id = m.user_id
+        JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = $2
+        WHERE m.conversation_id = $1 AND `+messageVisible+`
+        ORDER BY m.id DESC
+        LIMIT $3 OFFSET $4`, conversationID, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+	return messages, rows.Err()
+}
+
+// CountMessages - количество видимых пользователю сообщений диалога
+func (r *Repository) CountMessages(conversationID, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+        SELECT COUNT(*) FROM messages m
+        JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = $2
+        WHERE m.conversation_id = $1 AND `+messageVisible, conversationID, userID,
+	).Scan(&count)
+	return count, err
+}
+
+// SendMessage - новое сообщение. Диалог возвращается в списки участников,
+// у отправителя он прочитан. recipients - участники, которым сообщение видно.
+func (r *Repository) SendMessage(conversationID, userID int, content string) (msg *Message, recipients []int, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	msg = &Message{ConversationID: conversationID, UserID: userID, Content: content}
+	err = tx.QueryRow(
+		"INSERT INTO messages (conversation_id, user_id, content) VALUES ($1, $2, $3) RETURNING id, created_at",
+		conversationID, userID, content,
+	).Scan(&msg.ID, &msg.CreatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := tx.Exec("UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = $1", conversationID); err != nil {
+		return nil, nil, err
+	}
+	// Тем, у кого блокировка с отправителем, сообщение не видно - диалог у них не всплывает
+	_, err = tx.Exec(`
+        UPDATE conversation_members SET hidden = FALSE
+        WHERE conversation_id = $1 AND `+visibleTo("user_id", "$2", false), conversationID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = tx.Exec(
+		"UPDATE conversation_members SET last_read_message_id = $1 WHERE conversation_id = $2 AND user_id = $3",
+		msg.ID, conversationID, userID,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := tx.Query(`
+        SELECT user_id FROM conversation_members
+        WHERE conversation_id = $1 AND user_id <> $2 AND `+visibleTo("user_id", "$2", false),
+		conversationID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, nil, err
+		}
+		recipients = append(recipients, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return msg, recipients, tx.Commit()
+}
+
+// MarkConversationRead - все сообщения диалога прочитаны пользователем
+func (r *Repository) MarkConversationRead(conversationID, userID int) error {
+	_, err := r.db.Exec(`
+        UPDATE conversation_members
+        SET last_read_message_id = COALESCE((SELECT MAX(id) FROM messages WHERE conversation_id = $1), 0)
+        WHERE conversation_id = $1 AND user_id = $2`, conversationID, userID)
+	return err
+}
+
+// ClearConversation - удаление диалога для себя: история скрыта, диалог
+// пропадает из списка до следующего сообщения. У других участников всё остаётся.
+func (r *Repository) ClearConversation(conversationID, userID int) error {
+	_, err := r.db.Exec(`
+        UPDATE conversation_members
+        SET cleared_message_id = COALESCE((SELECT MAX(id) FROM messages WHERE conversation_id = $1), 0),
+            last_read_message_id = COALESCE((SELECT MAX(id) FROM messages WHERE conversation_id = $1), 0),
+            hidden = TRUE
+        WHERE conversation_id = $1 AND user_id = $2`, conversationID, userID)
+	return err
+}
+
+// UnreadMessages - непрочитанные сообщения пользователя и диалоги, где они есть
+func (r *Repository) UnreadMessages(userID int) (messages, conversations int, err error) {
+	err = r.db.QueryRow(`
+        SELECT COALESCE(SUM(n), 0), COUNT(*) FILTER (WHERE n > 0)
+        FROM (
+            SELECT `+unreadCount+` AS n
+            FROM conversation_members cm
+            JOIN conversations c ON c.id = cm.conversation_id
+            WHERE cm.user_id = $1 AND NOT cm.hidden
+        ) t`, userID,
+	).Scan(&messages, &conversations)
+	return messages, conversations, err
+}
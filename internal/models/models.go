@@ -5,23 +5,110 @@ import (
 )
 
 type User struct {
-	ID          int       `json:"id"`
-	Username    string    `json:"username"`
-	DisplayName string    `json:"display_name"`
-	Password    string    `json:"-"`
-	Role        string    `json:"role"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int        `json:"id"`
+	Username    string     `json:"username"`
+	DisplayName string     `json:"display_name"`
+	Password    string     `json:"-"`
+	Role        string     `json:"role"`
+	BannedAt    *time.Time `json:"banned_at,omitempty"`
+	BanReason   string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Email       string     `json:"-"`
+	Bio         string     `json:"bio,omitempty"`
+	AvatarURL   string     `json:"avatar_url,omitempty"`
+	Locale      string     `json:"-"`
+
+	// Запрошенное удаление аккаунта: когда и как (DeletionAnonymize, DeletionRemove)
+	DeletionScheduledAt *time.Time `json:"-"`
+	DeletionMode        string     `json:"-"`
+
+	EmailVerifiedAt *time.Time `json:"-"`
+
+	// TOTP: секрет есть и до подтверждения, включено - когда TOTPEnabledAt задано
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"-"`
+	TOTPLastStep  int64      `json:"-"`
 }
 
-type Post struct {
+// EmailVerified - есть подтверждённый email (на него можно слать сброс пароля)
+func (u *User) EmailVerified() bool {
+	return u.Email != "" && u.EmailVerifiedAt != nil
+}
+
+// TwoFactorEnabled - включена ли двухфакторная аутентификация
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil && u.TOTPSecret != ""
+}
+
+// UserProfile - публичная страница пользователя со счётчиками
+type UserProfile struct {
 	ID            int       `json:"id"`
-	UserID        int       `json:"user_id"`
-	Content       string    `json:"content"`
-	Slogan        string    `json:"slogan"` // 团结 (Единство)
-	Likes         int       `json:"likes"`
+	Username      string    `json:"username"`
+	DisplayName   string    `json:"display_name"`
+	Role          string    `json:"role"`
+	Bio           string    `json:"bio"`
+	AvatarURL     string    `json:"avatar_url"`
+	CreatedAt     time.Time `json:"created_at" doc:"дата регистрации"`
+	PostsCount    int       `json:"posts_count"`
+	LikesCount    int       `json:"likes_count" doc:"лайки, полученные постами пользователя"`
 	CommentsCount int       `json:"comments_count"`
-	CreatedAt     time.Time `json:"created_at"`
-	User          *User     `json:"user,omitempty"`
+}
+
+// Виды постов
+const (
+	PostKindPost   = "post"
+	PostKindRepost = "repost" // репост исходного поста без своего текста
+	PostKindQuote  = "quote"  // цитата: свой текст и исходный пост
+)
+
+type Post struct {
+	ID                  int            `json:"id"`
+	UserID              int            `json:"user_id"`
+	Kind                string         `json:"kind" doc:"post, repost (репост без своего текста) или quote (цитата с комментарием)"`
+	Content             string         `json:"content" doc:"у репоста пустой"`
+	Slogan              string         `json:"slogan"` // 团结 (Единство)
+	Likes               int            `json:"likes" doc:"количество реакций like"`
+	Reactions           ReactionCounts `json:"reactions" doc:"количество реакций каждого вида"`
+	CommentsCount       int            `json:"comments_count"`
+	RepostsCount        int            `json:"reposts_count"`
+	QuotesCount         int            `json:"quotes_count"`
+	CreatedAt           time.Time      `json:"created_at"`
+	User                *User          `json:"user,omitempty"`
+	Community           *CommunityRef  `json:"community,omitempty" doc:"сообщество; нет - пост вне сообществ"`
+	OriginalID          *int           `json:"original_id,omitempty" doc:"исходный пост репоста или цитаты; нет - удалён"`
+	Original            *Post          `json:"original,omitempty" doc:"исходный пост, если он виден зрителю"`
+	OriginalUnavailable bool           `json:"original_unavailable,omitempty" doc:"исходный пост удалён или скрыт от зрителя"`
+	Viewer              *PostViewer    `json:"viewer,omitempty" doc:"отношение зрителя к посту; нет для гостей"`
+}
+
+// Shared - репост или цитата
+func (p *Post) Shared() bool {
+	return p.Kind == PostKindRepost || p.Kind == PostKindQuote
+}
+
+// PostViewer - пост глазами вошедшего пользователя
+type PostViewer struct {
+	Liked          bool     `json:"liked" doc:"поставил реакцию like"`
+	Reactions      []string `json:"reactions" doc:"поставленные реакции"`
+	IsAuthor       bool     `json:"is_author"`
+	CanEdit        bool     `json:"can_edit" doc:"может изменить пост (администратор)"`
+	HasCommented   bool     `json:"has_commented" doc:"оставил комментарий"`
+	Reposted       bool     `json:"reposted" doc:"сделал репост поста"`
+	Bookmarked     bool     `json:"bookmarked" doc:"пост в закладках зрителя"`
+	BookmarksCount *int     `json:"bookmarks_count,omitempty" doc:"сколько раз пост добавлен в закладки; только для автора"`
+}
+
+// Reacted - зритель поставил реакцию name; для гостя (nil) false
+func (v *PostViewer) Reacted(name string) bool {
+	if v == nil {
+		return false
+	}
+	for _, r := range v.Reactions {
+		if r == name {
+			return true
+		}
+	}
+	return false
 }
 
 type Hero struct {
@@ -34,10 +121,69 @@ type Hero struct {
 }
 
 type Comment struct {
+	ID        int            `json:"id"`
+	PostID    int            `json:"post_id"`
+	UserID    int            `json:"user_id"`
+	Content   string         `json:"content"`
+	Likes     int            `json:"likes" doc:"количество реакций like"`
+	Liked     bool           `json:"liked" doc:"зритель поставил лайк; для гостей false"`
+	Reactions ReactionCounts `json:"reactions" doc:"количество реакций каждого вида"`
+	CreatedAt time.Time      `json:"created_at"`
+	User      *User          `json:"user,omitempty"`
+}
+
+// Результаты попыток входа (login_events.result)
+const (
+	LoginSuccess     = "success"
+	LoginBadPassword = "bad_password"
+	LoginUnknownUser = "unknown_user"
+	LoginThrottled   = "throttled"
+	LoginLocked      = "locked"
+	LoginBanned      = "banned"
+	LoginMFARequired = "mfa_required" // пароль верный, ждём второй фактор
+	LoginMFAFailed   = "mfa_failed"
+	LoginUnlocked    = "unlocked" // снятие блокировки администратором
+)
+
+type LoginEvent struct {
 	ID        int       `json:"id"`
-	PostID    int       `json:"post_id"`
-	UserID    int       `json:"user_id"`
-	Content   string    `json:"content"`
+	Result    string    `json:"result"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
 	CreatedAt time.Time `json:"created_at"`
-	User      *User     `json:"user,omitempty"`
+}
+
+// APIToken - персональный токен API (сам токен не хранится, только хэш)
+type APIToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix" doc:"начало токена, чтобы отличать токены друг от друга"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	Expired    bool       `json:"expired"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope - разрешена ли токену область
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// UserIdentity - учётная запись внешнего провайдера (OIDC), привязанная к пользователю
+type UserIdentity struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"-"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
 }
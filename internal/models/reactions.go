@@ -0,0 +1,212 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// === РЕАКЦИИ ===
+
+// ReactionLike - реакция, в которую перенесены прежние лайки; её количество
+// хранится в posts.likes и comments.likes
+const ReactionLike = "like"
+
+// ReactionCounts - количество реакций каждого вида; реакций без голосов в ней нет
+type ReactionCounts map[string]int
+
+// Scan - разбор json_object_agg из запроса
+func (rc *ReactionCounts) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*rc = ReactionCounts{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("реакции: неожиданный тип %T", src)
+	}
+	counts := ReactionCounts{}
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return err
+	}
+	*rc = counts
+	return nil
+}
+
+// MarshalJSON - пустой объект вместо null
+func (rc ReactionCounts) MarshalJSON() ([]byte, error) {
+	if rc == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]int(rc))
+}
+
+// Reactor - пользователь, поставивший реакцию
+type Reactor struct {
+	ID          int       `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Reaction    string    `json:"reaction"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// reactionTable - таблица реакций на посты или комментарии
+type reactionTable struct {
+	table  string
+	column string // столбец цели реакции
+	// counter - таблица цели, где реакция like дублируется в столбце likes; "" - нет
+	counter string
+}
+
+var (
+	postReactions    = reactionTable{table: "post_reactions", column: "post_id", counter: "posts"}
+	commentReactions = reactionTable{table: "comment_reactions", column: "comment_id", counter: "comments"}
+)
+
+// postReactionCounts и commentReactionCounts - подзапросы ReactionCounts для p.id и c.id
+const (
+	postReactionCounts = `(SELECT COALESCE(json_object_agg(rc.reaction, rc.n), '{}')
+                FROM (SELECT reaction, COUNT(*) AS n FROM post_reactions
+                      WHERE post_id = p.id GROUP BY reaction) rc)`
+	commentReactionCounts = `(SELECT COALESCE(json_object_agg(rc.reaction, rc.n), '{}')
+                FROM (SELECT reaction, COUNT(*) AS n FROM comment_reactions
+                      WHERE comment_id = c.id GROUP BY reaction) rc)`
+)
+
+// toggle - поставить реакцию или снять уже поставленную; true - реакция стоит
+func (t reactionTable) toggle(db *sql.DB, targetID, userID int, reaction string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		fmt.Sprintf("DELETE FROM %s WHERE %s = $1 AND user_id = $2 AND reaction = $3", t.table, t.column),
+		targetID, userID, reaction,
+	)
+	if err != nil {
+		return false, err
+	}
+	removed, _ := res.RowsAffected()
+
+	delta := -1
+	if removed == 0 {
+		res, err = tx.Exec(
+			fmt.Sprintf("INSERT INTO %s (%s, user_id, reaction) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", t.table, t.column),
+			targetID, userID, reaction,
+		)
+		if err != nil {
+			return false, err
+		}
+		// Параллельный запрос уже поставил ту же реакцию - счётчик не трогаем
+		if added, _ := res.RowsAffected(); added == 0 {
+			return true, tx.Commit()
+		}
+		delta = 1
+	}
+
+	if t.counter != "" && reaction == ReactionLike {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET likes = likes + $1 WHERE id = $2", t.counter), delta, targetID); err != nil {
+			return false, err
+		}
+	}
+	return delta > 0, tx.Commit()
+}
+
+// reactorsWhere - условие выборки поставивших реакцию: цель $1, вид $2 ("" - любой),
+// без пользователей, с которыми у зрителя $3 блокировка
+func (t reactionTable) reactorsWhere() string {
+	return fmt.Sprintf(`r.%s = $1 AND ($2 = '' OR r.reaction = $2) AND %s`,
+		t.column, visibleTo("$3", "r.user_id", false))
+}
+
+func (t reactionTable) reactors(r *Repository, targetID, viewerID int, reaction string, limit, offset int) ([]Reactor, error) {
+	rows, err := r.queryRead(fmt.Sprintf(`
+        SELECT u.id, u.username, u.display_name, r.reaction, r.created_at
+        FROM %s r
+        JOIN users u ON u.id = r.user_id
+        WHERE %s
+        ORDER BY r.created_at DESC, u.id
+        LIMIT $4 OFFSET $5`, t.table, t.reactorsWhere()),
+		targetID, reaction, viewerID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactors := []Reactor{}
+	for rows.Next() {
+		var rr Reactor
+		if err := rows.Scan(&rr.ID, &rr.Username, &rr.DisplayName, &rr.Reaction, &rr.CreatedAt); err != nil {
+			return nil, err
+		}
+		reactors = append(reactors, rr)
+	}
+	return reactors, rows.Err()
+}
+
+func (t reactionTable) countReactors(r *Repository, targetID, viewerID int, reaction string) (int, error) {
+	var count int
+	err := r.reader().QueryRow(
+		fmt.Sprintf("SELECT COUNT(*) FROM %s r WHERE %s", t.table, t.reactorsWhere()),
+		targetID, reaction, viewerID,
+	).Scan(&count)
+	return count, err
+}
+
+func (t reactionTable) counts(r *Repository, targetID int) (ReactionCounts, error) {
+	var counts ReactionCounts
+	err := r.reader().QueryRow(
+		fmt.Sprintf(`SELECT COALESCE(json_object_agg(reaction, n), '{}')
+            FROM (SELECT reaction, COUNT(*) AS n FROM %s WHERE %s = $1 GROUP BY reaction) rc`, t.table, t.column),
+		targetID,
+	).Scan(&counts)
+	return counts, err
+}
+
+// TogglePostReaction - поставить или снять реакцию на пост; true - реакция стоит
+func (r *Repository) TogglePostReaction(postID, userID int, reaction string) (bool, error) {
+	return postReactions.toggle(r.db, postID, userID, reaction)
+}
+
+// ToggleCommentReaction - поставить или снять реакцию на комментарий; true - реакция стоит
+func (r *Repository) ToggleCommentReaction(commentID, userID int, reaction string) (bool, error) {
+	return commentReactions.toggle(r.db, commentID, userID, reaction)
+}
+
+// GetPostReactionCounts - количество реакций на пост
+func (r *Repository) GetPostReactionCounts(postID int) (ReactionCounts, error) {
+	return postReactions.counts(r, postID)
+}
+
+// GetCommentReactionCounts - количество реакций на комментарий
+func (r *Repository) GetCommentReactionCounts(commentID int) (ReactionCounts, error) {
+	return commentReactions.counts(r, commentID)
+}
+
+// GetPostReactors - поставившие реакцию reaction ("" - любую) на пост, новые сверху
+func (r *Repository) GetPostReactors(postID, viewerID int, reaction string, limit, offset int) ([]Reactor, error) {
+	return postReactions.reactors(r, postID, viewerID, reaction, limit, offset)
+}
+
+// CountPostReactors - количество реакций для пагинации GetPostReactors
+func (r *Repository) CountPostReactors(postID, viewerID int, reaction string) (int, error) {
+	return postReactions.countReactors(r, postID, viewerID, reaction)
+}
+
+// GetCommentReactors - поставившие реакцию reaction ("" - любую) на комментарий
+func (r *Repository) GetCommentReactors(commentID, viewerID int, reaction string, limit, offset int) ([]Reactor, error) {
+	return commentReactions.reactors(r, commentID, viewerID, reaction, limit, offset)
+}
+
+// CountCommentReactors - количество реакций для пагинации GetCommentReactors
+func (r *Repository) CountCommentReactors(commentID, viewerID int, reaction string) (int, error) {
+	return commentReactions.countReactors(r, commentID, viewerID, reaction)
+}
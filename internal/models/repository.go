@@ -2,19 +2,62 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
+// ErrNotFound - запись не найдена или нет прав на изменение
+var ErrNotFound = errors.New("не найдено")
+
 type Repository struct {
-	db *sql.DB
+	db     *sql.DB
+	router ReadRouter
+}
+
+// ReadRouter - выбор соединения для запросов только на чтение (реплики)
+type ReadRouter interface {
+	Reader() *sql.DB
 }
 
 func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// WithReader - направлять чтение лент, комментариев, героев и статистики на реплики
+func (r *Repository) WithReader(router ReadRouter) *Repository {
+	r.router = router
+	return r
+}
+
+// DB - основное соединение (для выгрузки и загрузки архивов)
+func (r *Repository) DB() *sql.DB {
+	return r.db
+}
+
+// reader - соединение для чтения (реплика или основная БД)
+func (r *Repository) reader() *sql.DB {
+	if r.router != nil {
+		return r.router.Reader()
+	}
+	return r.db
+}
+
+// queryRead - запрос на реплике с откатом на основную БД при ошибке
+func (r *Repository) queryRead(query string, args ...interface{}) (*sql.Rows, error) {
+	db := r.reader()
+	rows, err := db.Query(query, args...)
+	if err != nil && db != r.db {
+		log.Printf("Ошибка запроса к реплике, повтор на основной БД: %v", err)
+		return r.db.Query(query, args...)
+	}
+	return rows, err
+}
+
 // === USERS ===
 func (r *Repository) CreateUser(username, password, role, displayName string) error {
 	if displayName == "" {
@@ -27,11 +70,18 @@ func (r *Repository) CreateUser(username, password, role, displayName string) er
 }
 
 func (r *Repository) GetUserByUsername(username string) (*User, error) {
-	query := `SELECT id, username, display_name, password, role, created_at FROM users WHERE username = $1`
+	query := `SELECT id, username, display_name, password, role, banned_at, COALESCE(ban_reason, ''), created_at,
+	                 COALESCE(email, ''), email_verified_at, COALESCE(totp_secret, ''), totp_enabled_at, totp_last_step,
+	                 COALESCE(bio, ''), COALESCE(avatar_url, ''), COALESCE(locale, ''),
+	                 deletion_scheduled_at, COALESCE(deletion_mode, '')
+	          FROM users WHERE username = $1`
 	row := r.db.QueryRow(query, username)
 
 	var user User
-	err := row.Scan(&user.ID, &user.Username, &user.DisplayName, &user.Password, &user.Role, &user.CreatedAt)
+	err := row.Scan(&user.ID, &user.Username, &user.DisplayName, &user.Password, &user.Role,
+		&user.BannedAt, &user.BanReason, &user.CreatedAt,
+		&user.Email, &user.EmailVerifiedAt, &user.TOTPSecret, &user.TOTPEnabledAt, &user.TOTPLastStep,
+		&user.Bio, &user.AvatarURL, &user.Locale, &user.DeletionScheduledAt, &user.DeletionMode)
 	if err != nil {
 		return nil, err
 	}
@@ -40,12 +90,17 @@ func (r *Repository) GetUserByUsername(username string) (*User, error) {
 
 func (r *Repository) GetUserByID(id int) (*User, error) {
 	var user User
-	query := `SELECT id, username, password, role, display_name, created_at 
+	query := `SELECT id, username, password, role, display_name, banned_at, COALESCE(ban_reason, ''), created_at,
+	                 COALESCE(email, ''), email_verified_at, COALESCE(totp_secret, ''), totp_enabled_at, totp_last_step,
+	                 COALESCE(bio, ''), COALESCE(avatar_url, ''), COALESCE(locale, ''),
+	                 deletion_scheduled_at, COALESCE(deletion_mode, '')
 	          FROM users WHERE id = $1`
 
 	err := r.db.QueryRow(query, id).Scan(
 		&user.ID, &user.Username, &user.Password, &user.Role,
-		&user.DisplayName, &user.CreatedAt,
+		&user.DisplayName, &user.BannedAt, &user.BanReason, &user.CreatedAt,
+		&user.Email, &user.EmailVerifiedAt, &user.TOTPSecret, &user.TOTPEnabledAt, &user.TOTPLastStep,
+		&user.Bio, &user.AvatarURL, &user.Locale, &user.DeletionScheduledAt, &user.DeletionMode,
 	)
 
 	if err != nil {
@@ -55,13 +110,200 @@ func (r *Repository) GetUserByID(id int) (*User, error) {
 	return &user, nil
 }
 
+// UpdateUserPassword - смена хэша пароля
+func (r *Repository) UpdateUserPassword(userID int, hashedPassword string) error {
+	_, err := r.db.Exec("UPDATE users SET password = $1 WHERE id = $2", hashedPassword, userID)
+	return err
+}
+
+// RehashUserPassword - замена хэша тем же паролем (новый алгоритм или параметры).
+// Если пароль успели сменить, старый хэш уже не совпадёт и замены не будет.
+func (r *Repository) RehashUserPassword(userID int, oldHash, newHash string) error {
+	_, err := r.db.Exec("UPDATE users SET password = $1 WHERE id = $2 AND password = $3",
+		newHash, userID, oldHash)
+	return err
+}
+
+// UpdateUserProfile - имя, о себе, аватар и язык; пустые bio, avatar_url и locale хранятся как NULL
+func (r *Repository) UpdateUserProfile(userID int, displayName, bio, avatarURL, locale string) error {
+	_, err := r.db.Exec(`
+		UPDATE users SET display_name = $1, bio = NULLIF($2, ''), avatar_url = NULLIF($3, ''), locale = NULLIF($4, '')
+		WHERE id = $5`,
+		displayName, bio, avatarURL, locale, userID,
+	)
+	return err
+}
+
+// GetUserProfile - публичный профиль со счётчиками постов, полученных лайков и комментариев
+func (r *Repository) GetUserProfile(username string) (*UserProfile, error) {
+	query := `
+        SELECT u.id, u.username, u.display_name, u.role, COALESCE(u.bio, ''), COALESCE(u.avatar_url, ''), u.created_at,
+               (SELECT COUNT(*) FROM posts WHERE user_id = u.id),
+               (SELECT COALESCE(SUM(likes), 0) FROM posts WHERE user_id = u.id),
+               (SELECT COUNT(*) FROM comments WHERE user_id = u.id)
+        FROM users u
+        WHERE u.username = $1 AND u.deleted_at IS NULL
+    `
+
+	var p UserProfile
+	err := r.reader().QueryRow(query, username).Scan(
+		&p.ID, &p.Username, &p.DisplayName, &p.Role, &p.Bio, &p.AvatarURL, &p.CreatedAt,
+		&p.PostsCount, &p.LikesCount, &p.CommentsCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SetUserBanned - блокировка (banned = true) или разблокировка пользователя
+func (r *Repository) SetUserBanned(userID int, banned bool, reason string) error {
+	var err error
+	if banned {
+		_, err = r.db.Exec(
+			"UPDATE users SET banned_at = CURRENT_TIMESTAMP, ban_reason = $1 WHERE id = $2",
+			reason, userID,
+		)
+	} else {
+		_, err = r.db.Exec("UPDATE users SET banned_at = NULL, ban_reason = NULL WHERE id = $1", userID)
+	}
+	return err
+}
+
 // === POSTS ===
-func (r *Repository) CreatePost(userID int, content, slogan string) error {
-	query := `INSERT INTO posts (user_id, content, slogan) VALUES ($1, $2, $3)`
-	_, err := r.db.Exec(query, userID, content, slogan)
+// CreatePost - новый пост; communityID = 0 - вне сообществ, quoteOf - цитируемый пост (0 - нет)
+func (r *Repository) CreatePost(userID int, content, slogan string, communityID, quoteOf int) (int, error) {
+	query := `INSERT INTO posts (user_id, content, slogan, community_id, kind, original_id)
+              VALUES ($1, $2, $3, NULLIF($4, 0), CASE WHEN $5 = 0 THEN 'post' ELSE 'quote' END, NULLIF($5, 0))
+              RETURNING id`
+	var id int
+	err := r.db.QueryRow(query, userID, content, slogan, communityID, quoteOf).Scan(&id)
+	return id, err
+}
+
+// CreateRepost - репост поста originalID вне сообществ; повторный репост
+// возвращает уже существующий (created = false)
+func (r *Repository) CreateRepost(userID, originalID int, slogan string) (id int, created bool, err error) {
+	err = r.db.QueryRow(`
+        INSERT INTO posts (user_id, content, slogan, kind, original_id) VALUES ($1, '', $2, 'repost', $3)
+        ON CONFLICT (user_id, original_id) WHERE kind = 'repost' DO NOTHING
+        RETURNING id`, userID, slogan, originalID,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = r.db.QueryRow(
+			"SELECT id FROM posts WHERE user_id = $1 AND original_id = $2 AND kind = 'repost'", userID, originalID,
+		).Scan(&id)
+		return id, false, err
+	}
+	return id, err == nil, err
+}
+
+// DeleteRepost - отменить свой репост поста originalID
+func (r *Repository) DeleteRepost(userID, originalID int) error {
+	_, err := r.db.Exec(
+		"DELETE FROM posts WHERE user_id = $1 AND original_id = $2 AND kind = 'repost'", userID, originalID,
+	)
 	return err
 }
 
+// DeleteRepostByID - отменить свой репост repostID; для репоста удалённого
+// поста, у которого original_id уже NULL
+func (r *Repository) DeleteRepostByID(userID, repostID int) error {
+	_, err := r.db.Exec(
+		"DELETE FROM posts WHERE id = $1 AND user_id = $2 AND kind = 'repost'", repostID, userID,
+	)
+	return err
+}
+
+// GetRepostCounts - счётчики репостов и цитат поста
+func (r *Repository) GetRepostCounts(postID int) (reposts, quotes int, err error) {
+	err = r.db.QueryRow("SELECT reposts_count, quotes_count FROM posts WHERE id = $1", postID).Scan(&reposts, &quotes)
+	return reposts, quotes, err
+}
+
+// PostFilter - выборка постов для ленты. Зритель не видит постов тех, с кем
+// у него блокировка, и постов сообществ, которые ему не видны, а также
+// репостов таких постов.
+type PostFilter struct {
+	ViewerID    int
+	AuthorID    int  // только посты автора; 0 - все
+	CommunityID int  // только посты сообщества; 0 - все
+	HideMuted   bool // без постов авторов, скрытых зрителем
+}
+
+// where - условие и параметры запроса; параметры начинаются с $1
+func (f PostFilter) where() (string, []interface{}) {
+	args := []interface{}{f.ViewerID}
+	conds := []string{
+		visibleTo("$1", "p.user_id", f.HideMuted), communityReadable("$1", "p.community_id"),
+		`(p.kind <> 'repost' OR p.original_id IS NULL OR EXISTS (SELECT 1 FROM posts op
+            WHERE op.id = p.original_id
+              AND ` + visibleTo("$1", "op.user_id", f.HideMuted) + `
+              AND ` + communityReadable("$1", "op.community_id") + `))`,
+	}
+	if f.AuthorID != 0 {
+		args = append(args, f.AuthorID)
+		conds = append(conds, fmt.Sprintf("p.user_id = $%d", len(args)))
+	}
+	if f.CommunityID != 0 {
+		args = append(args, f.CommunityID)
+		conds = append(conds, fmt.Sprintf("p.community_id = $%d", len(args)))
+	}
+	return strings.Join(conds, "\n          AND "), args
+}
+
+// postFeedItem - что показывает пост в ленте: репост - исходный пост, остальные - себя.
+// Лента выводит каждый элемент один раз - самой новой записью: несколько
+// репостов одного поста (и сам пост) сворачиваются в одну.
+const postFeedItem = `CASE WHEN p.kind = 'repost' AND p.original_id IS NOT NULL THEN p.original_id ELSE p.id END`
+
+// CountPosts - количество элементов ленты выборки (для пагинации)
+func (r *Repository) CountPosts(filter PostFilter) (int, error) {
+	where, args := filter.where()
+	var count int
+	err := r.reader().QueryRow("SELECT COUNT(DISTINCT "+postFeedItem+") FROM posts p WHERE "+where, args...).Scan(&count)
+	return count, err
+}
+
+// postColumns - пост с реакциями, автором (JOIN users u) и сообществом (LEFT JOIN communities co)
+const postColumns = `p.id, p.user_id, p.kind, p.content, p.slogan, p.likes, p.comments_count,
+               p.reposts_count, p.quotes_count, p.original_id, p.created_at,
+               ` + postReactionCounts + `,
+               u.id, u.username, u.display_name, u.role, u.created_at,
+               co.id, co.slug, co.name`
+
+const postFrom = `FROM posts p
+        JOIN users u ON p.user_id = u.id
+        LEFT JOIN communities co ON co.id = p.community_id`
+
+func scanPost(scan func(dest ...interface{}) error) (*Post, error) {
+	var post Post
+	var user User
+	var communityID sql.NullInt64
+	var communitySlug, communityName sql.NullString
+	var originalID sql.NullInt64
+	err := scan(
+		&post.ID, &post.UserID, &post.Kind, &post.Content, &post.Slogan, &post.Likes, &post.CommentsCount,
+		&post.RepostsCount, &post.QuotesCount, &originalID, &post.CreatedAt,
+		&post.Reactions,
+		&user.ID, &user.Username, &user.DisplayName, &user.Role, &user.CreatedAt,
+		&communityID, &communitySlug, &communityName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	post.User = &user
+	if communityID.Valid {
+		post.Community = &CommunityRef{ID: int(communityID.Int64), Slug: communitySlug.String, Name: communityName.String}
+	}
+	if originalID.Valid {
+		id := int(originalID.Int64)
+		post.OriginalID = &id
+	}
+	post.OriginalUnavailable = post.Shared() && post.OriginalID == nil
+	return &post, nil
+}
+
 func (r *Repository) GetPosts(limit, offset int) ([]Post, error) {
 	query := `
         SELECT p.id, p.user_id, p.content, p.slogan, p.likes, p.created_at,
@@ -72,7 +314,7 @@ func (r *Repository) GetPosts(limit, offset int) ([]Post, error) {
         LIMIT $1 OFFSET $2
     `
 
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.queryRead(query, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -107,132 +349,242 @@ func (r *Repository) DeletePost(id int) error {
 	return err
 }
 
+// LikePost - переключение реакции like; true - лайк поставлен
 func (r *Repository) LikePost(postID, userID int) (bool, error) {
-	tx, err := r.db.Begin()
-	if err != nil {
-		return false, err
-	}
-	defer tx.Rollback()
+	return r.TogglePostReaction(postID, userID, ReactionLike)
+}
 
-	// Проверяем, ставил ли пользователь уже лайк
+// Получить статус лайка пользователя
+func (r *Repository) GetUserLikeStatus(postID, userID int) (bool, error) {
 	var exists bool
-	err = tx.QueryRow(
-		"SELECT EXISTS(SELECT 1 FROM post_likes WHERE post_id = $1 AND user_id = $2)",
-		postID, userID,
+	err := r.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM post_reactions WHERE post_id = $1 AND user_id = $2 AND reaction = $3)",
+		postID, userID, ReactionLike,
 	).Scan(&exists)
 
+	return exists, err
+}
+
+// Получить количество лайков поста
+func (r *Repository) GetPostLikesCount(postID int) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT likes FROM posts WHERE id = $1", postID).Scan(&count)
+	return count, err
+}
+
+// GetPostsWithUsers - лента выборки с авторами и исходными постами репостов
+// и цитат, новые сверху; повторы одного поста сворачиваются (postFeedItem)
+func (r *Repository) GetPostsWithUsers(filter PostFilter, limit, offset int) ([]Post, error) {
+	where, args := filter.where()
+	query := fmt.Sprintf(`
+        SELECT `+postColumns+`
+        `+postFrom+`
+        JOIN (SELECT DISTINCT ON (`+postFeedItem+`) p.id
+              FROM posts p
+              WHERE %s
+              ORDER BY `+postFeedItem+`, p.created_at DESC, p.id DESC) feed ON feed.id = p.id
+        ORDER BY p.created_at DESC, p.id DESC
+        LIMIT $%d OFFSET $%d
+    `, where, len(args)+1, len(args)+2)
+
+	rows, err := r.queryRead(query, append(args, limit, offset)...)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	if exists {
-		// Убираем лайк
-		_, err = tx.Exec("DELETE FROM post_likes WHERE post_id = $1 AND user_id = $2", postID, userID)
+	var posts []Post
+	for rows.Next() {
+		post, err := scanPost(rows.Scan)
 		if err != nil {
-			return false, err
+			return nil, err
 		}
+		posts = append(posts, *post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return posts, r.FillOriginals(filter.ViewerID, posts)
+}
 
-		// Уменьшаем счётчик лайков
-		_, err = tx.Exec("UPDATE posts SET likes = likes - 1 WHERE id = $1", postID)
-		if err != nil {
-			return false, err
+// FillOriginals - исходные посты репостов и цитат страницы одним запросом;
+// удалённый или недоступный зрителю исходный пост отмечается OriginalUnavailable
+func (r *Repository) FillOriginals(viewerID int, posts []Post) error {
+	var ids []int64
+	for i := range posts {
+		if posts[i].OriginalID != nil {
+			ids = append(ids, int64(*posts[i].OriginalID))
 		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
 
-		err = tx.Commit()
-		return false, err // false = лайк убран
+	where, args := PostFilter{ViewerID: viewerID}.where()
+	rows, err := r.queryRead(fmt.Sprintf(`
+        SELECT `+postColumns+`
+        `+postFrom+`
+        WHERE %s
+          AND p.id = ANY($%d)`, where, len(args)+1), append(args, pq.Array(ids))...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-	} else {
-		// Добавляем лайк
-		_, err = tx.Exec(
-			"INSERT INTO post_likes (post_id, user_id) VALUES ($1, $2)",
-			postID, userID,
-		)
+	originals := make(map[int]*Post, len(ids))
+	for rows.Next() {
+		post, err := scanPost(rows.Scan)
 		if err != nil {
-			return false, err
+			return err
 		}
+		originals[post.ID] = post
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
-		// Увеличиваем счётчик лайков
-		_, err = tx.Exec("UPDATE posts SET likes = likes + 1 WHERE id = $1", postID)
-		if err != nil {
-			return false, err
+	for i := range posts {
+		if posts[i].OriginalID == nil {
+			continue
 		}
-
-		err = tx.Commit()
-		return true, err // true = лайк добавлен
+		posts[i].Original = originals[*posts[i].OriginalID]
+		posts[i].OriginalUnavailable = posts[i].Original == nil
 	}
+	return nil
 }
 
-// Получить статус лайка пользователя
-func (r *Repository) GetUserLikeStatus(postID, userID int) (bool, error) {
-	var exists bool
-	err := r.db.QueryRow(
-		"SELECT EXISTS(SELECT 1 FROM post_likes WHERE post_id = $1 AND user_id = $2)",
-		postID, userID,
-	).Scan(&exists)
+// FillPostViewer - поля Viewer постов страницы и их исходных постов для
+// пользователя viewer; для гостя (nil) ничего не делает. Собственные
+// действия зрителя читаются с основной БД: сразу после лайка или закладки
+// реплика может ещё не знать о них.
+func (r *Repository) FillPostViewer(viewer *User, posts []Post) error {
+	if viewer == nil || len(posts) == 0 {
+		return nil
+	}
+	var ids, authored []int64
+	byID := make(map[int][]*Post, len(posts))
+	add := func(post *Post) {
+		ids = append(ids, int64(post.ID))
+		byID[post.ID] = append(byID[post.ID], post)
+		post.Viewer = &PostViewer{
+			Reactions: []string{},
+			IsAuthor:  post.UserID == viewer.ID,
+			CanEdit:   viewer.Role == "admin",
+		}
+		if post.Viewer.IsAuthor {
+			authored = append(authored, int64(post.ID))
+		}
+	}
+	for i := range posts {
+		add(&posts[i])
+		if posts[i].Original != nil {
+			add(posts[i].Original)
+		}
+	}
 
-	return exists, err
-}
+	rows, err := r.db.Query(`
+        SELECT p.id,
+               COALESCE((SELECT array_agg(pr.reaction ORDER BY pr.created_at) FROM post_reactions pr
+                         WHERE pr.post_id = p.id AND pr.user_id = $2), '{}'),
+               EXISTS(SELECT 1 FROM comments c WHERE c.post_id = p.id AND c.user_id = $2),
+               EXISTS(SELECT 1 FROM posts rp WHERE rp.original_id = p.id AND rp.user_id = $2 AND rp.kind = 'repost'),
+               EXISTS(SELECT 1 FROM bookmarks b WHERE b.post_id = p.id AND b.user_id = $2)
+        FROM posts p
+        WHERE p.id = ANY($1)`, pq.Array(ids), viewer.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var postID int
+		var reactions []string
+		var commented, reposted, bookmarked bool
+		if err := rows.Scan(&postID, pq.Array(&reactions), &commented, &reposted, &bookmarked); err != nil {
+			return err
+		}
+		if reactions == nil {
+			reactions = []string{}
+		}
+		for _, post := range byID[postID] {
+			post.Viewer.Reactions = reactions
+			post.Viewer.Liked = post.Viewer.Reacted(ReactionLike)
+			post.Viewer.HasCommented = commented
+			post.Viewer.Reposted = reposted
+			post.Viewer.Bookmarked = bookmarked
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
-// Получить количество лайков поста
-func (r *Repository) GetPostLikesCount(postID int) (int, error) {
-	var count int
-	err := r.db.QueryRow("SELECT likes FROM posts WHERE id = $1", postID).Scan(&count)
-	return count, err
+	return r.fillBookmarksCounts(byID, authored)
 }
 
-// Получение по пользователю
-func (r *Repository) GetPostsWithUsers(limit, offset int) ([]Post, error) {
-	query := `
-        SELECT p.id, p.user_id, p.content, p.slogan, p.likes, p.created_at,
-               u.id, u.username, u.display_name, u.role, u.created_at
+// fillBookmarksCounts - сколько раз посты автора добавлены в закладки;
+// чужие закладки, поэтому достаточно реплики
+func (r *Repository) fillBookmarksCounts(byID map[int][]*Post, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	rows, err := r.queryRead(`
+        SELECT p.id, (SELECT COUNT(*) FROM bookmarks b WHERE b.post_id = p.id)
         FROM posts p
-        JOIN users u ON p.user_id = u.id
-        ORDER BY p.created_at DESC
-        LIMIT $1 OFFSET $2
-    `
-
-	rows, err := r.db.Query(query, limit, offset)
+        WHERE p.id = ANY($1)`, pq.Array(ids))
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
-
-	var posts []Post
 	for rows.Next() {
-		var post Post
-		var user User
-		err := rows.Scan(
-			&post.ID, &post.UserID, &post.Content, &post.Slogan, &post.Likes, &post.CreatedAt,
-			&user.ID, &user.Username, &user.DisplayName, &user.Role, &user.CreatedAt,
-		)
-		if err != nil {
-			return nil, err
+		var postID, count int
+		if err := rows.Scan(&postID, &count); err != nil {
+			return err
+		}
+		for _, post := range byID[postID] {
+			post.Viewer.BookmarksCount = &count
 		}
-		post.User = &user
-		posts = append(posts, post)
 	}
-	return posts, nil
+	return rows.Err()
 }
 
 // === COMMENT METHODS ===
 
-func (r *Repository) CreateComment(postID, userID int, content string) error {
-	query := `INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, $3)`
-	_, err := r.db.Exec(query, postID, userID, content)
-	return err
+func (r *Repository) CreateComment(postID, userID int, content string) (int, error) {
+	query := `INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, $3) RETURNING id`
+	var id int
+	err := r.db.QueryRow(query, postID, userID, content).Scan(&id)
+	return id, err
+}
+
+// Порядок комментариев поста
+const (
+	CommentsOldest = "oldest" // по времени, старые сверху
+	CommentsTop    = "top"    // по лайкам, при равенстве - по времени
+)
+
+// ValidCommentOrder - известный порядок комментариев
+func ValidCommentOrder(order string) bool {
+	return order == CommentsOldest || order == CommentsTop
 }
 
-func (r *Repository) GetCommentsByPostID(postID int) ([]Comment, error) {
+// GetCommentsByPostID - комментарии к посту без комментариев пользователей,
+// с которыми у зрителя viewerID блокировка; Liked - лайк зрителя (0 - гость)
+func (r *Repository) GetCommentsByPostID(postID, viewerID int, order string) ([]Comment, error) {
+	orderBy := "c.created_at ASC"
+	if order == CommentsTop {
+		orderBy = "c.likes DESC, c.created_at ASC"
+	}
 	query := `
-        SELECT c.id, c.post_id, c.user_id, c.content, c.created_at,
+        SELECT c.id, c.post_id, c.user_id, c.content, c.likes, c.created_at,
+               EXISTS(SELECT 1 FROM comment_reactions cr
+                      WHERE cr.comment_id = c.id AND cr.user_id = $2 AND cr.reaction = $3),
+               ` + commentReactionCounts + `,
                u.id, u.username, u.display_name, u.role, u.created_at
         FROM comments c
         JOIN users u ON c.user_id = u.id
-        WHERE c.post_id = $1
-        ORDER BY c.created_at ASC
-    `
+        WHERE c.post_id = $1 AND ` + visibleTo("$2", "c.user_id", false) + `
+        ORDER BY ` + orderBy
 
-	rows, err := r.db.Query(query, postID)
+	rows, err := r.queryRead(query, postID, viewerID, ReactionLike)
 	if err != nil {
 		return nil, err
 	}
@@ -243,7 +595,8 @@ func (r *Repository) GetCommentsByPostID(postID int) ([]Comment, error) {
 		var comment Comment
 		var user User
 		err := rows.Scan(
-			&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.CreatedAt,
+			&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.Likes, &comment.CreatedAt,
+			&comment.Liked, &comment.Reactions,
 			&user.ID, &user.Username, &user.DisplayName, &user.Role, &user.CreatedAt,
 		)
 		if err != nil {
@@ -255,6 +608,30 @@ func (r *Repository) GetCommentsByPostID(postID int) ([]Comment, error) {
 	return comments, nil
 }
 
+// LikeComment - переключение реакции like на комментарий; true - лайк поставлен
+func (r *Repository) LikeComment(commentID, userID int) (bool, error) {
+	return r.ToggleCommentReaction(commentID, userID, ReactionLike)
+}
+
+// GetCommentLikesCount - количество лайков комментария
+func (r *Repository) GetCommentLikesCount(commentID int) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT likes FROM comments WHERE id = $1", commentID).Scan(&count)
+	return count, err
+}
+
+// GetComment - комментарий без автора (для проверки доступа к посту)
+func (r *Repository) GetComment(commentID int) (*Comment, error) {
+	var comment Comment
+	err := r.reader().QueryRow(
+		"SELECT id, post_id, user_id, content, likes, created_at FROM comments WHERE id = $1", commentID,
+	).Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.Likes, &comment.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
 func (r *Repository) DeleteComment(commentID, userID int) error {
 	// Только автор комментария может удалить его
 	query := `DELETE FROM comments WHERE id = $1 AND user_id = $2`
@@ -265,7 +642,7 @@ func (r *Repository) DeleteComment(commentID, userID int) error {
 
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("комментарий не найден или нет прав на удаление")
+		return ErrNotFound
 	}
 
 	return nil
@@ -273,31 +650,28 @@ func (r *Repository) DeleteComment(commentID, userID int) error {
 
 func (r *Repository) GetPostWithComments(postID int) (*Post, []Comment, error) {
 	// Получаем пост
-	var post Post
-	var user User
-	err := r.db.QueryRow(`
-        SELECT p.id, p.user_id, p.content, p.slogan, p.likes, p.comments_count, p.created_at,
-               u.id, u.username, u.display_name, u.role, u.created_at
-        FROM posts p
-        JOIN users u ON p.user_id = u.id
-        WHERE p.id = $1
-    `, postID).Scan(
-		&post.ID, &post.UserID, &post.Content, &post.Slogan, &post.Likes, &post.CommentsCount, &post.CreatedAt,
-		&user.ID, &user.Username, &user.DisplayName, &user.Role, &user.CreatedAt,
-	)
-
+	post, err := r.GetPost(postID)
 	if err != nil {
 		return nil, nil, err
 	}
-	post.User = &user
 
 	// Получаем комментарии
-	comments, err := r.GetCommentsByPostID(postID)
+	comments, err := r.GetCommentsByPostID(postID, 0, CommentsOldest)
 	if err != nil {
-		return &post, nil, err
+		return post, nil, err
 	}
 
-	return &post, comments, nil
+	return post, comments, nil
+}
+
+// GetPost - пост с автором и сообществом
+func (r *Repository) GetPost(postID int) (*Post, error) {
+	row := r.reader().QueryRow(`
+        SELECT `+postColumns+`
+        `+postFrom+`
+        WHERE p.id = $1
+    `, postID)
+	return scanPost(row.Scan)
 }
 
 // === HEROES ===
@@ -309,7 +683,7 @@ func (r *Repository) CreateHero(name, description, imageURL string, birthDate ti
 
 func (r *Repository) GetHeroes() ([]Hero, error) {
 	query := `SELECT id, name, description, birth_date, image_url, created_at FROM heroes ORDER BY created_at DESC`
-	rows, err := r.db.Query(query)
+	rows, err := r.queryRead(query)
 	if err != nil {
 		return nil, err
 	}
@@ -341,13 +715,13 @@ func (r *Repository) DeleteHero(id int) error {
 
 // === АДМИН МЕТОДЫ ===
 // GetStats - получение статистики
-// GetStats - получение статистики
 func (r *Repository) GetStats() (map[string]int, error) {
 	stats := make(map[string]int)
+	db := r.reader()
 
 	// Количество пользователей
 	var userCount int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&userCount)
+	err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&userCount)
 	if err != nil {
 		return nil, err
 	}
@@ -355,7 +729,7 @@ func (r *Repository) GetStats() (map[string]int, error) {
 
 	// Количество постов
 	var postCount int
-	err = r.db.QueryRow("SELECT COUNT(*) FROM posts").Scan(&postCount)
+	err = db.QueryRow("SELECT COUNT(*) FROM posts").Scan(&postCount)
 	if err != nil {
 		return nil, err
 	}
@@ -363,7 +737,7 @@ func (r *Repository) GetStats() (map[string]int, error) {
 
 	// Количество комментариев
 	var commentCount int
-	err = r.db.QueryRow("SELECT COUNT(*) FROM comments").Scan(&commentCount)
+	err = db.QueryRow("SELECT COUNT(*) FROM comments").Scan(&commentCount)
 	if err != nil {
 		return nil, err
 	}
@@ -371,7 +745,7 @@ func (r *Repository) GetStats() (map[string]int, error) {
 
 	// Количество героев
 	var heroCount int
-	err = r.db.QueryRow("SELECT COUNT(*) FROM heroes").Scan(&heroCount)
+	err = db.QueryRow("SELECT COUNT(*) FROM heroes").Scan(&heroCount)
 	if err != nil {
 		return nil, err
 	}
@@ -383,7 +757,7 @@ func (r *Repository) GetStats() (map[string]int, error) {
 // GetAllUsers - получение всех пользователей
 func (r *Repository) GetAllUsers() ([]User, error) {
 	rows, err := r.db.Query(`
-		SELECT id, username, role, display_name, created_at 
+		SELECT id, username, role, display_name, banned_at, created_at 
 		FROM users 
 		ORDER BY created_at DESC
 	`)
@@ -397,7 +771,7 @@ func (r *Repository) GetAllUsers() ([]User, error) {
 		var user User
 		err := rows.Scan(
 			&user.ID, &user.Username, &user.Role,
-			&user.DisplayName, &user.CreatedAt,
+			&user.DisplayName, &user.BannedAt, &user.CreatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -420,7 +794,28 @@ func (r *Repository) UpdateUserRole(userID int, role string) error {
 // DeleteUser - удаление пользователя
 func (r *Repository) DeleteUser(userID int) error {
 	// Сначала удаляем связанные данные
-	_, err := r.db.Exec("DELETE FROM post_likes WHERE user_id = $1", userID)
+	_, err := r.db.Exec(`
+		UPDATE posts SET likes = likes - 1
+		WHERE id IN (SELECT post_id FROM post_reactions WHERE user_id = $1 AND reaction = $2)`,
+		userID, ReactionLike)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("DELETE FROM post_reactions WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(`
+		UPDATE comments SET likes = likes - 1
+		WHERE id IN (SELECT comment_id FROM comment_reactions WHERE user_id = $1 AND reaction = $2)`,
+		userID, ReactionLike)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("DELETE FROM comment_reactions WHERE user_id = $1", userID)
 	if err != nil {
 		return err
 	}
@@ -492,8 +887,8 @@ func (r *Repository) GetAllPostsAdmin() ([]Post, error) {
 
 // DeletePostAdmin - удаление поста (админская версия)
 func (r *Repository) DeletePostAdmin(postID int) error {
-	// Удаляем лайки
-	_, err := r.db.Exec("DELETE FROM post_likes WHERE post_id = $1", postID)
+	// Удаляем реакции
+	_, err := r.db.Exec("DELETE FROM post_reactions WHERE post_id = $1", postID)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,123 @@
+package models
+
+import "database/sql"
+
+// === TWO-FACTOR ===
+
+// SetTOTPSecret - новый секрет до подтверждения кодом (2FA ещё выключена)
+func (r *Repository) SetTOTPSecret(userID int, secret string) error {
+	_, err := r.db.Exec(
+		"UPDATE users SET totp_secret = $1, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = $2",
+		secret, userID,
+	)
+	return err
+}
+
+// EnableTOTP - включение 2FA после проверки первого кода и выдача кодов восстановления
+func (r *Repository) EnableTOTP(userID int, step int64, recoveryHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE users SET totp_enabled_at = CURRENT_TIMESTAMP, totp_last_step = $1 WHERE id = $2",
+		step, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP - выключение 2FA и удаление кодов восстановления
+func (r *Repository) DisableTOTP(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = $1",
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep - отметка шага как использованного; false, если он уже был
+// (повтор того же кода или код старше последнего принятого)
+func (r *Repository) UseTOTPStep(userID int, step int64) (bool, error) {
+	res, err := r.db.Exec(
+		"UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1",
+		step, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ReplaceRecoveryCodes - новый набор кодов восстановления взамен старого
+func (r *Repository) ReplaceRecoveryCodes(userID int, hashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, hashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, hashes []string) error {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		_, err := tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode - погашение кода восстановления; false, если кода нет или он использован
+func (r *Repository) UseRecoveryCode(userID int, hash string) (bool, error) {
+	res, err := r.db.Exec(
+		"UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, hash,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// CountRecoveryCodes - сколько неиспользованных кодов восстановления осталось
+func (r *Repository) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL", userID,
+	).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,150 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	// jwksTTL - как долго кэшируются ключи провайдера
+	jwksTTL = time.Hour
+	// jwksMinRefresh - не чаще этого ключи перечитываются из-за неизвестного kid
+	jwksMinRefresh = 30 * time.Second
+)
+
+// supportedAlgs - алгоритмы подписи ID токена (симметричные не принимаются)
+var supportedAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// keySet - ключи провайдера по kid
+type keySet struct {
+	keys     map[string]interface{}
+	loadedAt time.Time
+}
+
+// jwk - ключ из JWKS (RFC 7517)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// key - открытый ключ по kid; при неизвестном kid ключи перечитываются
+// (провайдер мог сменить ключи)
+func (p *Provider) key(ctx context.Context, meta *metadata, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stale := time.Since(p.keys.loadedAt) > jwksTTL
+	if key, ok := p.keys.lookup(kid); ok && !stale {
+		return key, nil
+	}
+	if !stale && time.Since(p.keys.loadedAt) < jwksMinRefresh {
+		return nil, fmt.Errorf("неизвестный ключ %q", kid)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, meta.JWKSURI, &doc); err != nil {
+		return nil, fmt.Errorf("JWKS %s: %w", p.Config.Name, err)
+	}
+
+	keys := map[string]interface{}{}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// Ключи неизвестных типов пропускаются
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	p.keys = keySet{keys: keys, loadedAt: time.Now()}
+
+	if key, ok := p.keys.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("неизвестный ключ %q", kid)
+}
+
+// lookup - ключ по kid; без kid - единственный ключ набора
+func (s keySet) lookup(kid string) (interface{}, bool) {
+	if kid == "" {
+		if len(s.keys) == 1 {
+			for _, key := range s.keys {
+				return key, true
+			}
+		}
+		return nil, false
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if n.BitLen() < 2048 || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("недопустимый RSA ключ")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var size int
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			size, curve = 32, elliptic.P256()
+		case "P-384":
+			size, curve = 48, elliptic.P384()
+		case "P-521":
+			size, curve = 66, elliptic.P521()
+		default:
+			return nil, fmt.Errorf("неизвестная кривая %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != size || len(y) != size {
+			return nil, fmt.Errorf("неверный размер координат")
+		}
+		// Несжатая точка; ParseUncompressedPublicKey проверяет, что она на кривой
+		point := append(append([]byte{4}, x...), y...)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	}
+	return nil, fmt.Errorf("неизвестный тип ключа %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
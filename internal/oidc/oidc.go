@@ -0,0 +1,461 @@
+// Package oidc - вход через внешних провайдеров OpenID Connect
+// (authorization code + PKCE): discovery, обмен кода и проверка ID токена.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// metadataTTL - как долго кэшируется документ discovery
+	metadataTTL = time.Hour
+	// clockSkew - допустимое расхождение часов с провайдером
+	clockSkew = time.Minute
+	// maxResponseSize - ограничение ответов провайдера
+	maxResponseSize = 1 << 20
+)
+
+// Роли платформы в порядке убывания прав
+var rolePriority = []string{"admin", "moderator", "user"}
+
+// Config - раздел oidc в config.yaml
+type Config struct {
+	Providers []ProviderConfig `yaml:"providers"`
+}
+
+// ProviderConfig - настройки одного провайдера
+type ProviderConfig struct {
+	// Name - идентификатор в адресах (/auth/oidc/<name>)
+	Name        string `yaml:"name"`
+	DisplayName string `yaml:"display_name"`
+	// Issuer - адрес, от которого читается /.well-known/openid-configuration
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"`
+	// AllowSignup - создавать пользователя при первом входе
+	AllowSignup bool `yaml:"allow_signup"`
+	// LinkByEmail - привязывать к пользователю с тем же подтверждённым email
+	LinkByEmail bool `yaml:"link_by_email"`
+	// RoleClaim - claim ID токена с ролями (через точку для вложенных: realm_access.roles)
+	RoleClaim string `yaml:"role_claim"`
+	// RoleMapping - значение claim -> роль платформы
+	RoleMapping map[string]string `yaml:"role_mapping"`
+	// DefaultRole - роль, если ни одно значение claim не сопоставлено
+	DefaultRole string `yaml:"default_role"`
+	// TokenEndpointAuth - client_secret_basic (по умолчанию) или client_secret_post
+	TokenEndpointAuth string `yaml:"token_endpoint_auth"`
+}
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// validate - проверка и значения по умолчанию
+func (c *ProviderConfig) validate() error {
+	if !providerNamePattern.MatchString(c.Name) {
+		return fmt.Errorf("неверное имя провайдера %q (a-z, 0-9, _ и -)", c.Name)
+	}
+	if c.Issuer == "" || c.ClientID == "" || c.RedirectURL == "" {
+		return fmt.Errorf("провайдер %s: нужны issuer, client_id и redirect_url", c.Name)
+	}
+	if c.DisplayName == "" {
+		c.DisplayName = c.Name
+	}
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid", "email", "profile"}
+	}
+	hasOpenID := false
+	for _, s := range c.Scopes {
+		if s == "openid" {
+			hasOpenID = true
+		}
+	}
+	if !hasOpenID {
+		c.Scopes = append([]string{"openid"}, c.Scopes...)
+	}
+
+	switch c.TokenEndpointAuth {
+	case "":
+		c.TokenEndpointAuth = "client_secret_basic"
+	case "client_secret_basic", "client_secret_post":
+	default:
+		return fmt.Errorf("провайдер %s: неизвестный token_endpoint_auth %q", c.Name, c.TokenEndpointAuth)
+	}
+
+	if c.DefaultRole == "" {
+		c.DefaultRole = "user"
+	}
+	if !validRole(c.DefaultRole) {
+		return fmt.Errorf("провайдер %s: неверная default_role %q", c.Name, c.DefaultRole)
+	}
+	for value, role := range c.RoleMapping {
+		if !validRole(role) {
+			return fmt.Errorf("провайдер %s: неверная роль %q для %q", c.Name, role, value)
+		}
+	}
+	return nil
+}
+
+func validRole(role string) bool {
+	for _, r := range rolePriority {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry - настроенные провайдеры
+type Registry struct {
+	providers []*Provider
+}
+
+// NewRegistry - провайдеры из конфига; nil, если их нет.
+// Discovery выполняется при первом входе, чтобы недоступный провайдер не мешал запуску.
+func NewRegistry(config Config) (*Registry, error) {
+	if len(config.Providers) == 0 {
+		return nil, nil
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	registry := &Registry{}
+	seen := map[string]bool{}
+	for _, pc := range config.Providers {
+		if err := pc.validate(); err != nil {
+			return nil, err
+		}
+		if seen[pc.Name] {
+			return nil, fmt.Errorf("провайдер %s указан дважды", pc.Name)
+		}
+		seen[pc.Name] = true
+		registry.providers = append(registry.providers, &Provider{Config: pc, client: client})
+	}
+	return registry, nil
+}
+
+// Get - провайдер по имени
+func (r *Registry) Get(name string) (*Provider, bool) {
+	if r == nil {
+		return nil, false
+	}
+	for _, p := range r.providers {
+		if p.Config.Name == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// List - провайдеры в порядке конфига
+func (r *Registry) List() []*Provider {
+	if r == nil {
+		return nil
+	}
+	return r.providers
+}
+
+// Provider - провайдер OpenID Connect
+type Provider struct {
+	Config ProviderConfig
+
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	loadedAt time.Time
+	keys     keySet
+}
+
+// metadata - нужная часть /.well-known/openid-configuration
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	SigningAlgs           []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// Claims - данные пользователя из ID токена
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+	// Raw - все claims, для сопоставления ролей
+	Raw map[string]interface{}
+}
+
+// discover - метаданные провайдера (с кэшем)
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil && time.Since(p.loadedAt) < metadataTTL {
+		return p.metadata, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.Config.Issuer, "/") + "/.well-known/openid-configuration"
+	var meta metadata
+	if err := p.getJSON(ctx, wellKnown, &meta); err != nil {
+		return nil, fmt.Errorf("discovery %s: %w", p.Config.Name, err)
+	}
+
+	// Issuer в документе должен совпадать с настроенным (OpenID Connect Discovery, 4.3)
+	if strings.TrimSuffix(meta.Issuer, "/") != strings.TrimSuffix(p.Config.Issuer, "/") {
+		return nil, fmt.Errorf("discovery %s: issuer %q не совпадает с настроенным", p.Config.Name, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery %s: неполный документ", p.Config.Name)
+	}
+
+	p.metadata = &meta
+	p.loadedAt = time.Now()
+	return p.metadata, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: статус %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// AuthCodeURL - адрес страницы входа провайдера
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.Config.ClientID)
+	params.Set("redirect_uri", p.Config.RedirectURL)
+	params.Set("scope", strings.Join(p.Config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", challenge)
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// tokenResponse - ответ token endpoint
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange - обмен кода авторизации на ID токен и его проверка
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.Config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	if p.Config.TokenEndpointAuth == "client_secret_post" || p.Config.ClientSecret == "" {
+		form.Set("client_id", p.Config.ClientID)
+		if p.Config.ClientSecret != "" {
+			form.Set("client_secret", p.Config.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.Config.TokenEndpointAuth == "client_secret_basic" && p.Config.ClientSecret != "" {
+		// RFC 6749, 2.3.1: логин и пароль кодируются перед Basic
+		req.SetBasicAuth(url.QueryEscape(p.Config.ClientID), url.QueryEscape(p.Config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token endpoint %s: %w", p.Config.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var tr tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&tr); err != nil {
+		return nil, fmt.Errorf("token endpoint %s: статус %d: %w", p.Config.Name, resp.StatusCode, err)
+	}
+	if tr.Error != "" {
+		return nil, fmt.Errorf("token endpoint %s: %s %s", p.Config.Name, tr.Error, tr.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || tr.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint %s: статус %d без id_token", p.Config.Name, resp.StatusCode)
+	}
+
+	return p.verifyIDToken(ctx, meta, tr.IDToken, nonce)
+}
+
+// verifyIDToken - подпись по JWKS, iss, aud, azp, срок и nonce
+func (p *Provider) verifyIDToken(ctx context.Context, meta *metadata, raw, nonce string) (*Claims, error) {
+	algs := supportedAlgs
+	if len(meta.SigningAlgs) > 0 {
+		algs = intersect(meta.SigningAlgs, supportedAlgs)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims,
+		func(t *jwt.Token) (interface{}, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.key(ctx, meta, kid)
+		},
+		jwt.WithValidMethods(algs),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.Config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ID токен %s: %w", p.Config.Name, err)
+	}
+
+	// При нескольких получателях azp обязан указывать на нас
+	aud, _ := claims.GetAudience()
+	azp, _ := claims["azp"].(string)
+	if (len(aud) > 1 || azp != "") && azp != p.Config.ClientID {
+		return nil, fmt.Errorf("ID токен %s: неверный azp %q", p.Config.Name, azp)
+	}
+
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("ID токен %s: nonce не совпадает", p.Config.Name)
+	}
+
+	result := &Claims{Raw: claims}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.PreferredUsername, _ = claims["preferred_username"].(string)
+	result.Name, _ = claims["name"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = v
+	case string:
+		// Некоторые провайдеры отдают строку
+		result.EmailVerified = v == "true"
+	}
+	if result.Subject == "" {
+		return nil, fmt.Errorf("ID токен %s: нет sub", p.Config.Name)
+	}
+	return result, nil
+}
+
+func intersect(a, b []string) []string {
+	var out []string
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				out = append(out, x)
+			}
+		}
+	}
+	return out
+}
+
+// MapRole - роль платформы по claim из role_claim; false, если сопоставление
+// ролей не настроено и роль пользователя менять не нужно.
+// Из нескольких сопоставленных ролей берётся старшая.
+func (p *Provider) MapRole(claims *Claims) (string, bool) {
+	if p.Config.RoleClaim == "" {
+		return "", false
+	}
+
+	mapped := map[string]bool{}
+	for _, value := range claimValues(claims.Raw, p.Config.RoleClaim) {
+		if role, ok := p.Config.RoleMapping[value]; ok {
+			mapped[role] = true
+		}
+	}
+	for _, role := range rolePriority {
+		if mapped[role] {
+			return role, true
+		}
+	}
+	return p.Config.DefaultRole, true
+}
+
+// claimValues - строковые значения claim по пути через точку (строка или массив строк)
+func claimValues(raw map[string]interface{}, path string) []string {
+	var value interface{} = raw
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[part]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// === PKCE И СЛУЧАЙНЫЕ ЗНАЧЕНИЯ ===
+
+// RandomString - 32 случайных байта в base64url (state, nonce, code_verifier)
+func RandomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Challenge - code_challenge для метода S256 (RFC 7636)
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
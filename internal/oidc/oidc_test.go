@@ -0,0 +1,551 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "unitycn"
+	testClientSecret = "s3cret/+"
+	testRedirectURL  = "https://unitycn.example/auth/oidc/mock/callback"
+)
+
+// mockCode - выданный код авторизации
+type mockCode struct {
+	challenge string
+	nonce     string
+}
+
+// mockProvider - провайдер OpenID Connect в процессе: discovery, JWKS,
+// token endpoint с проверкой PKCE и аутентификации клиента
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu      sync.Mutex
+	issuer  string                   // issuer в discovery; пусто - адрес сервера
+	keys    map[string]crypto.Signer // опубликованные в JWKS ключи
+	signKid string                   // ключ подписи ID токенов
+	codes   map[string]mockCode
+	// modify - правка claims ID токена перед подписью
+	modify func(jwt.MapClaims)
+
+	discoveryHits int
+	jwksHits      int
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	m := &mockProvider{t: t, keys: map[string]crypto.Signer{}, codes: map[string]mockCode{}}
+	m.rotate("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// rotate - новый ключ подписи; старые ключи из JWKS убираются
+func (m *mockProvider) rotate(kid string) {
+	m.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		m.t.Fatalf("ключ: %v", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = map[string]crypto.Signer{kid: key}
+	m.signKid = kid
+}
+
+func (m *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.discoveryHits++
+	issuer := m.issuer
+	m.mu.Unlock()
+	if issuer == "" {
+		issuer = m.server.URL
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                m.server.URL + "/authorize",
+		"token_endpoint":                        m.server.URL + "/token",
+		"jwks_uri":                              m.server.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256", "ES256"},
+	})
+}
+
+func (m *mockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jwksHits++
+
+	keys := []map[string]string{}
+	for kid, key := range m.keys {
+		keys = append(keys, publicJWK(kid, key.Public()))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Method != http.MethodPost {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	// client_secret_basic: логин и пароль закодированы до Basic (RFC 6749, 2.3.1)
+	user, pass, ok := r.BasicAuth()
+	clientID, _ := url.QueryUnescape(user)
+	secret, _ := url.QueryUnescape(pass)
+	if !ok || clientID != testClientID || secret != testClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.Form.Get("grant_type") != "authorization_code" || r.Form.Get("redirect_uri") != testRedirectURL {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	m.mu.Lock()
+	code, found := m.codes[r.Form.Get("code")]
+	delete(m.codes, r.Form.Get("code")) // код одноразовый
+	m.mu.Unlock()
+	if !found || Challenge(r.Form.Get("code_verifier")) != code.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     m.idToken(code.nonce),
+	})
+}
+
+// idToken - подписанный ID токен с claims по умолчанию
+func (m *mockProvider) idToken(nonce string) string {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                m.server.URL,
+		"aud":                testClientID,
+		"sub":                "subject-1",
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              nonce,
+		"email":              "comrade@example.com",
+		"email_verified":     true,
+		"preferred_username": "comrade",
+		"name":               "Товарищ",
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.modify != nil {
+		m.modify(claims)
+	}
+	return m.sign(m.signKid, m.keys[m.signKid], claims)
+}
+
+func (m *mockProvider) sign(kid string, key crypto.Signer, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(key)
+	if err != nil {
+		m.t.Fatalf("подпись: %v", err)
+	}
+	return raw
+}
+
+// hits - сколько раз запрошены discovery и JWKS
+func (m *mockProvider) hits() (discovery, jwks int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.discoveryHits, m.jwksHits
+}
+
+// authorize - то, что делает провайдер на странице входа: проверяет запрос
+// из AuthCodeURL и выдаёт код для этого code_challenge и nonce
+func (m *mockProvider) authorize(t *testing.T, target string) string {
+	t.Helper()
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatalf("адрес входа: %v", err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != m.server.URL+"/authorize" {
+		t.Fatalf("адрес входа %s, ожидался authorization_endpoint", got)
+	}
+	q := u.Query()
+	for param, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"code_challenge_method": "S256",
+	} {
+		if q.Get(param) != want {
+			t.Fatalf("%s = %q, ожидалось %q", param, q.Get(param), want)
+		}
+	}
+	if !strings.Contains(" "+q.Get("scope")+" ", " openid ") {
+		t.Fatalf("scope без openid: %q", q.Get("scope"))
+	}
+
+	code, err := RandomString()
+	if err != nil {
+		t.Fatalf("код: %v", err)
+	}
+	m.mu.Lock()
+	m.codes[code] = mockCode{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	m.mu.Unlock()
+	return code
+}
+
+// provider - клиент, настроенный на mockProvider
+func (m *mockProvider) provider(t *testing.T) *Provider {
+	t.Helper()
+	registry, err := NewRegistry(Config{Providers: []ProviderConfig{{
+		Name:         "mock",
+		Issuer:       m.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}}})
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	p, ok := registry.Get("mock")
+	if !ok {
+		t.Fatal("провайдер mock не найден")
+	}
+	return p
+}
+
+// login - полный вход: адрес входа, код, обмен с verifier и nonce.
+// callbackNonce - nonce, который сервер достаёт из своего состояния
+func (m *mockProvider) login(t *testing.T, p *Provider, callbackNonce string) (*Claims, error) {
+	t.Helper()
+	verifier, err := RandomString()
+	if err != nil {
+		t.Fatalf("verifier: %v", err)
+	}
+	target, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", Challenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code := m.authorize(t, target)
+	return p.Exchange(context.Background(), code, verifier, callbackNonce)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// publicJWK - открытый ключ в формате JWK
+func publicJWK(kid string, pub crypto.PublicKey) map[string]string {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return map[string]string{
+			"kty": "EC", "kid": kid, "use": "sig", "crv": key.Curve.Params().Name,
+			"x": enc(key.X.FillBytes(make([]byte, size))),
+			"y": enc(key.Y.FillBytes(make([]byte, size))),
+		}
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA", "kid": kid, "use": "sig",
+			"n": enc(key.N.Bytes()),
+			"e": enc(big.NewInt(int64(key.E)).Bytes()),
+		}
+	}
+	panic(fmt.Sprintf("неизвестный ключ %T", pub))
+}
+
+func TestDiscovery(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider(t)
+
+	for i := 0; i < 2; i++ {
+		target, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", Challenge("verifier"))
+		if err != nil {
+			t.Fatalf("AuthCodeURL: %v", err)
+		}
+		m.authorize(t, target)
+		u, _ := url.Parse(target)
+		if q := u.Query(); q.Get("state") != "state-1" || q.Get("nonce") != "nonce-1" || q.Get("code_challenge") != Challenge("verifier") {
+			t.Fatalf("параметры входа: %v", q)
+		}
+	}
+	if discovery, _ := m.hits(); discovery != 1 {
+		t.Fatalf("discovery запрошен %d раз, ожидался кэш", discovery)
+	}
+}
+
+func TestDiscoveryRejectsForeignIssuer(t *testing.T) {
+	m := newMockProvider(t)
+	m.issuer = "https://evil.example"
+	p := m.provider(t)
+
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "c"); err == nil {
+		t.Fatal("принят документ discovery с чужим issuer")
+	}
+}
+
+func TestDiscoveryUnavailable(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider(t)
+	m.server.Close()
+
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "c"); err == nil {
+		t.Fatal("вход без доступного провайдера")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider(t)
+
+	claims, err := m.login(t, p, "nonce-1")
+	if err != nil {
+		t.Fatalf("вход: %v", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "comrade@example.com" || !claims.EmailVerified ||
+		claims.PreferredUsername != "comrade" || claims.Name != "Товарищ" {
+		t.Fatalf("claims: %+v", claims)
+	}
+}
+
+func TestExchangeRequiresPKCEVerifier(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider(t)
+
+	target, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", Challenge("right-verifier"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code := m.authorize(t, target)
+	if _, err := p.Exchange(context.Background(), code, "wrong-verifier", "nonce-1"); err == nil {
+		t.Fatal("обмен кода с чужим code_verifier")
+	}
+
+	// Код одноразовый: после неудачной попытки им не воспользоваться
+	if _, err := p.Exchange(context.Background(), code, "right-verifier", "nonce-1"); err == nil {
+		t.Fatal("повторный обмен кода")
+	}
+}
+
+func TestExchangeRejectsBadIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		nonce  string
+		modify func(jwt.MapClaims)
+	}{
+		{name: "nonce", nonce: "other-nonce"},
+		{name: "iss", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }},
+		{name: "aud", modify: func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{name: "azp", modify: func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "other-client"}
+			c["azp"] = "other-client"
+		}},
+		{name: "expired", modify: func(c jwt.MapClaims) {
+			c["iat"] = time.Now().Add(-time.Hour).Unix()
+			c["exp"] = time.Now().Add(-10 * time.Minute).Unix()
+		}},
+		{name: "no exp", modify: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "no sub", modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockProvider(t)
+			m.modify = tt.modify
+			p := m.provider(t)
+
+			nonce := tt.nonce
+			if nonce == "" {
+				nonce = "nonce-1"
+			}
+			if claims, err := m.login(t, p, nonce); err == nil {
+				t.Fatalf("принят ID токен: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsUnknownSigner(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider(t)
+
+	// Токен подписан ключом с опубликованным kid, но не тем закрытым ключом
+	forged, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ключ: %v", err)
+	}
+	meta, err := p.discover(context.Background())
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	raw := m.sign("key-1", forged, jwt.MapClaims{
+		"iss": m.server.URL, "aud": testClientID, "sub": "subject-1", "nonce": "n",
+		"exp": time.Now().Add(time.Minute).Unix(), "iat": time.Now().Unix(),
+	})
+	if _, err := p.verifyIDToken(context.Background(), meta, raw, "n"); err == nil {
+		t.Fatal("принят токен с чужой подписью")
+	}
+
+	// Симметричная подпись не принимается, даже если секрет известен
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": m.server.URL, "aud": testClientID, "sub": "subject-1", "nonce": "n",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	rawHS, _ := hs.SignedString([]byte(testClientSecret))
+	if _, err := p.verifyIDToken(context.Background(), meta, rawHS, "n"); err == nil {
+		t.Fatal("принят токен HS256")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider(t)
+
+	if _, err := m.login(t, p, "nonce-1"); err != nil {
+		t.Fatalf("вход до смены ключа: %v", err)
+	}
+	if _, jwks := m.hits(); jwks != 1 {
+		t.Fatalf("JWKS запрошен %d раз", jwks)
+	}
+	if _, err := m.login(t, p, "nonce-1"); err != nil {
+		t.Fatalf("повторный вход: %v", err)
+	}
+	if _, jwks := m.hits(); jwks != 1 {
+		t.Fatalf("ключи не кэшируются: JWKS запрошен %d раз", jwks)
+	}
+
+	m.rotate("key-2")
+
+	// Неизвестный kid сразу после загрузки ключей не вызывает новый запрос JWKS
+	if _, err := m.login(t, p, "nonce-1"); err == nil {
+		t.Fatal("принят токен с неизвестным kid до перечитывания ключей")
+	}
+	if _, jwks := m.hits(); jwks != 1 {
+		t.Fatalf("JWKS перечитан раньше jwksMinRefresh: %d", jwks)
+	}
+
+	// По прошествии jwksMinRefresh неизвестный kid перечитывает ключи
+	p.mu.Lock()
+	p.keys.loadedAt = time.Now().Add(-jwksMinRefresh - time.Second)
+	p.mu.Unlock()
+	if _, err := m.login(t, p, "nonce-1"); err != nil {
+		t.Fatalf("вход после смены ключа: %v", err)
+	}
+	if _, jwks := m.hits(); jwks != 2 {
+		t.Fatalf("JWKS запрошен %d раз, ожидалось перечитывание", jwks)
+	}
+
+	// Убранный из JWKS ключ больше не принимается
+	meta, _ := p.discover(context.Background())
+	old, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ключ: %v", err)
+	}
+	raw := m.sign("key-1", old, jwt.MapClaims{
+		"iss": m.server.URL, "aud": testClientID, "sub": "subject-1", "nonce": "n",
+		"exp": time.Now().Add(time.Minute).Unix(), "iat": time.Now().Unix(),
+	})
+	if _, err := p.verifyIDToken(context.Background(), meta, raw, "n"); err == nil {
+		t.Fatal("принят токен со старым kid")
+	}
+}
+
+func TestRSAKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("ключ: %v", err)
+	}
+	jwkJSON, _ := json.Marshal(publicJWK("rsa", &key.PublicKey))
+	var k jwk
+	if err := json.Unmarshal(jwkJSON, &k); err != nil {
+		t.Fatalf("jwk: %v", err)
+	}
+	pub, err := k.publicKey()
+	if err != nil {
+		t.Fatalf("publicKey: %v", err)
+	}
+	if !key.PublicKey.Equal(pub) {
+		t.Fatal("ключ RSA разобран неверно")
+	}
+
+	// Короткие ключи RSA не принимаются
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("ключ: %v", err)
+	}
+	jwkJSON, _ = json.Marshal(publicJWK("weak", &weak.PublicKey))
+	json.Unmarshal(jwkJSON, &k)
+	if _, err := k.publicKey(); err == nil {
+		t.Fatal("принят RSA ключ 1024 бит")
+	}
+}
+
+func TestMapRole(t *testing.T) {
+	p := &Provider{Config: ProviderConfig{
+		RoleClaim:   "realm_access.roles",
+		RoleMapping: map[string]string{"staff": "moderator", "root": "admin"},
+		DefaultRole: "user",
+	}}
+
+	tests := []struct {
+		name string
+		raw  map[string]interface{}
+		want string
+	}{
+		{"старшая роль", map[string]interface{}{
+			"realm_access": map[string]interface{}{"roles": []interface{}{"staff", "root", "other"}},
+		}, "admin"},
+		{"одна роль", map[string]interface{}{
+			"realm_access": map[string]interface{}{"roles": []interface{}{"staff"}},
+		}, "moderator"},
+		{"строка", map[string]interface{}{
+			"realm_access": map[string]interface{}{"roles": "root"},
+		}, "admin"},
+		{"нет сопоставления", map[string]interface{}{
+			"realm_access": map[string]interface{}{"roles": []interface{}{"other"}},
+		}, "user"},
+		{"нет claim", map[string]interface{}{}, "user"},
+	}
+	for _, tt := range tests {
+		role, ok := p.MapRole(&Claims{Raw: tt.raw})
+		if !ok || role != tt.want {
+			t.Errorf("%s: %q, %v; ожидалось %q", tt.name, role, ok, tt.want)
+		}
+	}
+
+	// Без role_claim роль пользователя не трогается
+	p.Config.RoleClaim = ""
+	if _, ok := p.MapRole(&Claims{Raw: map[string]interface{}{}}); ok {
+		t.Fatal("роль сопоставлена без role_claim")
+	}
+}
@@ -0,0 +1,257 @@
+package openapi
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Document - корень OpenAPI 3 документа (только используемые поля)
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Servers    []Server              `json:"servers,omitempty"`
+	Tags       []Tag                 `json:"tags,omitempty"`
+	Paths      map[string]*PathItem  `json:"paths"`
+	Components Components            `json:"components"`
+	schemas    map[reflect.Type]bool `json:"-"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+// PathItem - операции одного пути по HTTP методам (в нижнем регистре)
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+}
+
+// New - пустой документ
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   make(map[string]*PathItem),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: make(map[string]*SecurityScheme),
+		},
+		schemas: make(map[reflect.Type]bool),
+	}
+}
+
+// AddOperation - операция для пути в формате OpenAPI (/posts/{id})
+func (d *Document) AddOperation(method, path string, op *Operation) {
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+}
+
+// HasOperation - описана ли операция
+func (d *Document) HasOperation(method, path string) bool {
+	item, ok := d.Paths[path]
+	if !ok {
+		return false
+	}
+	_, ok = (*item)[strings.ToLower(method)]
+	return ok
+}
+
+var ginParamRe = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// PathFromGin - /posts/:id -> /posts/{id}
+func PathFromGin(path string) string {
+	return ginParamRe.ReplaceAllString(path, "{$1}")
+}
+
+// PathParams - имена параметров пути gin (:id, *filepath)
+func PathParams(path string) []string {
+	var names []string
+	for _, m := range ginParamRe.FindAllStringSubmatch(path, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf - схема Go значения; именованные структуры попадают в components
+// и возвращаются как $ref. Поля и обязательность берутся из json-тегов.
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	if v == nil {
+		return &Schema{Type: "object"}
+	}
+	return d.schemaOfType(reflect.TypeOf(v))
+}
+
+func (d *Document) schemaOfType(t reflect.Type) *Schema {
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := d.schemaOfType(t.Elem())
+		if schema.Ref != "" {
+			return &Schema{AllOf: []*Schema{schema}, Nullable: true}
+		}
+		schema.Nullable = true
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schemaOfType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOfType(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		name := schemaName(t)
+		if !d.schemas[t] {
+			d.schemas[t] = true
+			d.Components.Schemas[name] = d.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	return &Schema{}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// Встроенная структура без имени - поля поднимаются наверх
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := d.structSchema(field.Type)
+			for k, v := range embedded.Properties {
+				schema.Properties[k] = v
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		prop := d.schemaOfType(field.Type)
+		if doc := field.Tag.Get("doc"); doc != "" {
+			prop.Description = doc
+		}
+		schema.Properties[name] = prop
+
+		if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+// schemaName - имя компоненты: models.Post -> Post, handlers.loginRequest -> LoginRequest
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	if name == "" {
+		return "Object"
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const memoryCleanupInterval = time.Minute
+
+// MemoryStore - корзины в памяти процесса (один экземпляр сервера)
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	stop    chan struct{}
+	once    sync.Once
+}
+
+type memoryBucket struct {
+	tokens float64
+	last   time.Time
+	idle   time.Duration // через сколько корзина снова полна и её можно забыть
+}
+
+// NewMemoryStore - хранилище в памяти с периодической очисткой полных корзин
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		buckets: make(map[string]*memoryBucket),
+		stop:    make(chan struct{}),
+	}
+	go s.cleanupLoop()
+	return s
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+
+	tokens, res := take(b.tokens, b.last, limit, now)
+	b.tokens = tokens
+	b.last = now
+	b.idle = res.ResetAfter
+	return res, nil
+}
+
+func (s *MemoryStore) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
+
+func (s *MemoryStore) cleanupLoop() {
+	ticker := time.NewTicker(memoryCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.evict(now)
+		}
+	}
+}
+
+// evict - забыть корзины, которые к моменту now снова полны
+func (s *MemoryStore) evict(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range s.buckets {
+		if now.Sub(b.last) > b.idle {
+			delete(s.buckets, key)
+		}
+	}
+}
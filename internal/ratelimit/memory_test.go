@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testLimit - 1 запрос в секунду, запас 2
+var testLimit = Limit{Rate: 1, Burst: 2}
+
+// storeTake - Take с проверкой ошибки
+func storeTake(t *testing.T, s Store, key string, now time.Time) Result {
+	t.Helper()
+	res, err := s.Take(context.Background(), key, testLimit, now)
+	if err != nil {
+		t.Fatalf("Take(%s): %v", key, err)
+	}
+	return res
+}
+
+// assertDuration - длительности совпадают с точностью до миллисекунды
+func assertDuration(t *testing.T, name string, got, want time.Duration) {
+	t.Helper()
+	if diff := got - want; diff < -time.Millisecond || diff > time.Millisecond {
+		t.Fatalf("%s = %v, ожидалось %v", name, got, want)
+	}
+}
+
+// testStoreBucket - общие проверки корзины для любого хранилища
+func testStoreBucket(t *testing.T, s Store) {
+	now := time.UnixMilli(1_700_000_000_000)
+
+	t.Run("allow and deny", func(t *testing.T) {
+		for i, remaining := range []int{1, 0} {
+			res := storeTake(t, s, "deny", now)
+			if !res.Allowed || res.Remaining != remaining {
+				t.Fatalf("запрос %d: %+v, ожидалось разрешение и остаток %d", i+1, res, remaining)
+			}
+		}
+		res := storeTake(t, s, "deny", now)
+		if res.Allowed {
+			t.Fatalf("третий запрос разрешён: %+v", res)
+		}
+		assertDuration(t, "RetryAfter", res.RetryAfter, time.Second)
+		assertDuration(t, "ResetAfter", res.ResetAfter, 2*time.Second)
+
+		if res := storeTake(t, s, "other", now); !res.Allowed {
+			t.Fatalf("корзина другого ключа пуста: %+v", res)
+		}
+	})
+
+	t.Run("refill", func(t *testing.T) {
+		storeTake(t, s, "refill", now)
+		storeTake(t, s, "refill", now)
+
+		res := storeTake(t, s, "refill", now.Add(500*time.Millisecond))
+		if res.Allowed {
+			t.Fatalf("через 0.5с запрос разрешён: %+v", res)
+		}
+		assertDuration(t, "RetryAfter", res.RetryAfter, 500*time.Millisecond)
+
+		if res := storeTake(t, s, "refill", now.Add(time.Second)); !res.Allowed {
+			t.Fatalf("через 1с запрос не разрешён: %+v", res)
+		}
+
+		// Корзина не наполняется выше burst
+		later := now.Add(time.Hour)
+		for i := 0; i < testLimit.Burst; i++ {
+			if res := storeTake(t, s, "refill", later); !res.Allowed {
+				t.Fatalf("через час запрос %d не разрешён: %+v", i+1, res)
+			}
+		}
+		if res := storeTake(t, s, "refill", later); res.Allowed {
+			t.Fatalf("корзина наполнилась выше burst: %+v", res)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	defer s.Close()
+	testStoreBucket(t, s)
+}
+
+func TestMemoryStoreEvictsIdleBuckets(t *testing.T) {
+	s := NewMemoryStore()
+	defer s.Close()
+
+	now := time.UnixMilli(1_700_000_000_000)
+	storeTake(t, s, "busy", now)
+	storeTake(t, s, "busy", now)
+	storeTake(t, s, "idle", now)
+
+	// "idle" полна через 1с, "busy" - через 2с
+	s.evict(now.Add(1500 * time.Millisecond))
+	if _, ok := s.buckets["idle"]; ok {
+		t.Fatal("полная корзина не удалена")
+	}
+	if _, ok := s.buckets["busy"]; !ok {
+		t.Fatal("удалена корзина, которая ещё не наполнилась")
+	}
+
+	s.evict(now.Add(3 * time.Second))
+	if len(s.buckets) != 0 {
+		t.Fatalf("осталось корзин: %d", len(s.buckets))
+	}
+
+	// Забытая корзина начинается заново полной
+	if res := storeTake(t, s, "busy", now.Add(3*time.Second)); !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("новая корзина: %+v", res)
+	}
+}
@@ -0,0 +1,281 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config - секция rate_limit в config.yaml
+type Config struct {
+	Enabled  bool                    `yaml:"enabled"`
+	Backend  string                  `yaml:"backend"` // memory | redis
+	Redis    RedisConfig             `yaml:"redis"`
+	Policies map[string]PolicyConfig `yaml:"policies"`
+	// Routes - "МЕТОД /api/v1/путь" -> имя политики. Алиас /api/... использует ту же политику.
+	Routes map[string]string `yaml:"routes"`
+}
+
+// PolicyConfig - limit запросов за period с запасом burst, ключ ip или user
+type PolicyConfig struct {
+	Limit  int           `yaml:"limit"`
+	Period time.Duration `yaml:"period"`
+	Burst  int           `yaml:"burst"`
+	Key    string        `yaml:"key"`
+}
+
+// Limit - параметры корзины токенов
+type Limit struct {
+	Rate  float64 // токенов в секунду
+	Burst int     // ёмкость корзины
+}
+
+// Result - итог проверки одного запроса
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration // до полного восстановления корзины
+	RetryAfter time.Duration // до следующего разрешённого запроса
+}
+
+// Store - хранилище корзин токенов
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+	Close() error
+}
+
+// Policy - именованная политика
+type Policy struct {
+	Name   string
+	Limit  Limit
+	KeyBy  string
+	Period time.Duration
+	Max    int
+}
+
+// ThrottleStat - клиент, получивший отказ
+type ThrottleStat struct {
+	Policy    string    `json:"policy"`
+	Key       string    `json:"key"`
+	Count     int       `json:"count"`
+	FirstAt   time.Time `json:"first_at"`
+	LastAt    time.Time `json:"last_at"`
+	LastRoute string    `json:"last_route"`
+}
+
+// Limiter - политики, маршруты и счётчики отказов
+type Limiter struct {
+	store    Store
+	policies map[string]*Policy
+	routes   map[string]string
+
+	mu        sync.Mutex
+	throttled map[string]*ThrottleStat
+}
+
+// maxTrackedClients - предел счётчиков отказов в памяти
+const maxTrackedClients = 10000
+
+// New - лимитер по конфигу; nil, если лимиты выключены
+func New(config Config) (*Limiter, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	var store Store
+	switch config.Backend {
+	case "", "memory":
+		store = NewMemoryStore()
+	case "redis":
+		redisStore, err := NewRedisStore(config.Redis)
+		if err != nil {
+			return nil, err
+		}
+		store = redisStore
+	default:
+		return nil, fmt.Errorf("неизвестный backend rate_limit: %s", config.Backend)
+	}
+
+	return NewLimiter(store, config)
+}
+
+// NewLimiter - лимитер поверх готового хранилища
+func NewLimiter(store Store, config Config) (*Limiter, error) {
+	l := &Limiter{
+		store:     store,
+		policies:  make(map[string]*Policy),
+		routes:    make(map[string]string),
+		throttled: make(map[string]*ThrottleStat),
+	}
+
+	for name, pc := range config.Policies {
+		if pc.Limit <= 0 || pc.Period <= 0 {
+			return nil, fmt.Errorf("политика %s: limit и period должны быть больше нуля", name)
+		}
+		keyBy := pc.Key
+		if keyBy == "" {
+			keyBy = "ip"
+		}
+		if keyBy != "ip" && keyBy != "user" {
+			return nil, fmt.Errorf("политика %s: key должен быть ip или user", name)
+		}
+		burst := pc.Burst
+		if burst <= 0 {
+			burst = pc.Limit
+		}
+
+		l.policies[name] = &Policy{
+			Name:   name,
+			Limit:  Limit{Rate: float64(pc.Limit) / pc.Period.Seconds(), Burst: burst},
+			KeyBy:  keyBy,
+			Period: pc.Period,
+			Max:    pc.Limit,
+		}
+	}
+
+	for route, name := range config.Routes {
+		if _, ok := l.policies[name]; !ok {
+			return nil, fmt.Errorf("маршрут %s: нет политики %s", route, name)
+		}
+		l.routes[normalizeRoute(route)] = name
+	}
+
+	return l, nil
+}
+
+// normalizeRoute - "post /api/login" -> "POST /api/v1/login"
+func normalizeRoute(route string) string {
+	method, path, _ := strings.Cut(strings.TrimSpace(route), " ")
+	path = strings.TrimSpace(path)
+	if strings.HasPrefix(path, "/api/") && !strings.HasPrefix(path, "/api/v1/") {
+		path = "/api/v1" + strings.TrimPrefix(path, "/api")
+	}
+	return strings.ToUpper(method) + " " + path
+}
+
+// PolicyFor - политика маршрута gin (метод и FullPath) или nil
+func (l *Limiter) PolicyFor(method, fullPath string) *Policy {
+	name, ok := l.routes[normalizeRoute(method+" "+fullPath)]
+	if !ok {
+		name, ok = l.routes[normalizeRoute("* "+fullPath)]
+	}
+	if !ok {
+		return nil
+	}
+	return l.policies[name]
+}
+
+// Allow - проверка запроса клиента key по политике. При недоступности
+// хранилища запрос пропускается: лимиты не должны ронять сайт.
+func (l *Limiter) Allow(ctx context.Context, policy *Policy, key, route string) Result {
+	now := time.Now()
+	res, err := l.store.Take(ctx, policy.Name+":"+key, policy.Limit, now)
+	if err != nil {
+		log.Printf("Ошибка хранилища rate limit: %v", err)
+		return Result{Allowed: true, Limit: policy.Max, Remaining: policy.Max}
+	}
+	res.Limit = policy.Max
+
+	if !res.Allowed {
+		l.recordThrottle(policy.Name, key, route, now)
+	}
+	return res
+}
+
+func (l *Limiter) recordThrottle(policy, key, route string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := policy + ":" + key
+	stat, ok := l.throttled[id]
+	if !ok {
+		if len(l.throttled) >= maxTrackedClients {
+			l.evictOldestLocked()
+		}
+		stat = &ThrottleStat{Policy: policy, Key: key, FirstAt: now}
+		l.throttled[id] = stat
+	}
+	stat.Count++
+	stat.LastAt = now
+	stat.LastRoute = route
+}
+
+func (l *Limiter) evictOldestLocked() {
+	var oldestID string
+	var oldest time.Time
+	for id, stat := range l.throttled {
+		if oldestID == "" || stat.LastAt.Before(oldest) {
+			oldestID, oldest = id, stat.LastAt
+		}
+	}
+	delete(l.throttled, oldestID)
+}
+
+// Throttled - клиенты с отказами, сначала самые активные
+func (l *Limiter) Throttled() []ThrottleStat {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := make([]ThrottleStat, 0, len(l.throttled))
+	for _, stat := range l.throttled {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		return stats[i].LastAt.After(stats[j].LastAt)
+	})
+	return stats
+}
+
+// ResetThrottled - обнуление счётчиков отказов
+func (l *Limiter) ResetThrottled() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.throttled = make(map[string]*ThrottleStat)
+}
+
+// Policies - все политики по имени
+func (l *Limiter) Policies() []Policy {
+	policies := make([]Policy, 0, len(l.policies))
+	for _, p := range l.policies {
+		policies = append(policies, *p)
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies
+}
+
+// Close - закрытие хранилища
+func (l *Limiter) Close() error {
+	return l.store.Close()
+}
+
+// take - общий расчёт корзины токенов для обоих хранилищ
+func take(tokens float64, last time.Time, limit Limit, now time.Time) (float64, Result) {
+	burst := float64(limit.Burst)
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*limit.Rate)
+	}
+
+	res := Result{}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - tokens) / limit.Rate)
+	}
+	res.Remaining = int(math.Floor(tokens))
+	res.ResetAfter = secondsToDuration((burst - tokens) / limit.Rate)
+	return tokens, res
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
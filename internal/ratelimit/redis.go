@@ -0,0 +1,263 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"time"
+)
+
+// RedisConfig - подключение к Redis-совместимому серверу
+type RedisConfig struct {
+	Addr        string        `yaml:"addr"`
+	Password    string        `yaml:"password"`
+	DB          int           `yaml:"db"`
+	Prefix      string        `yaml:"prefix"`
+	PoolSize    int           `yaml:"pool_size"`
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+}
+
+// takeScript - корзина токенов атомарно на стороне Redis.
+// Токены возвращаются строкой: числа Lua в ответе обрезаются до целых.
+const takeScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 't', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+if now > ts then
+  tokens = math.min(burst, tokens + (now - ts) * rate)
+end
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HMSET', KEYS[1], 't', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`
+
+// RedisStore - общие корзины для нескольких экземпляров сервера
+type RedisStore struct {
+	config RedisConfig
+	pool   chan *redisConn
+}
+
+// NewRedisStore - хранилище в Redis; соединения открываются по требованию
+func NewRedisStore(config RedisConfig) (*RedisStore, error) {
+	if config.Addr == "" {
+		return nil, errors.New("rate_limit.redis.addr не задан")
+	}
+	if config.Prefix == "" {
+		config.Prefix = "unitycn:rl:"
+	}
+	if config.PoolSize <= 0 {
+		config.PoolSize = 8
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = 2 * time.Second
+	}
+
+	s := &RedisStore{config: config, pool: make(chan *redisConn, config.PoolSize)}
+
+	// Проверка доступности при старте, соединение возвращается в пул
+	conn, err := s.get(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("redis %s: %w", config.Addr, err)
+	}
+	s.put(conn)
+
+	return s, nil
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	conn, err := s.get(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	ratePerMs := limit.Rate / 1000
+	reply, err := conn.do(ctx, "EVAL", takeScript, "1", s.config.Prefix+key,
+		strconv.FormatFloat(ratePerMs, 'g', -1, 64),
+		strconv.Itoa(limit.Burst),
+		strconv.FormatInt(now.UnixMilli(), 10))
+	if err != nil {
+		conn.close()
+		return Result{}, err
+	}
+	s.put(conn)
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("неожиданный ответ redis: %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	tokensStr, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("неожиданный ответ redis: %v", reply)
+	}
+
+	res := Result{
+		Allowed:    allowed == 1,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: secondsToDuration((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !res.Allowed {
+		res.RetryAfter = secondsToDuration((1 - tokens) / limit.Rate)
+	}
+	return res, nil
+}
+
+func (s *RedisStore) Close() error {
+	for {
+		select {
+		case conn := <-s.pool:
+			conn.close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (s *RedisStore) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-s.pool:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: s.config.DialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", s.config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: netConn, r: bufio.NewReader(netConn), timeout: s.config.DialTimeout}
+
+	if s.config.Password != "" {
+		if _, err := conn.do(ctx, "AUTH", s.config.Password); err != nil {
+			conn.close()
+			return nil, err
+		}
+	}
+	if s.config.DB != 0 {
+		if _, err := conn.do(ctx, "SELECT", strconv.Itoa(s.config.DB)); err != nil {
+			conn.close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (s *RedisStore) put(conn *redisConn) {
+	select {
+	case s.pool <- conn:
+	default:
+		conn.close()
+	}
+}
+
+// redisConn - минимальный клиент протокола RESP2
+type redisConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+}
+
+// redisError - ответ сервера с ошибкой (-ERR ...)
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func (c *redisConn) do(ctx context.Context, args ...string) (interface{}, error) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+
+	reply, err := c.readReply()
+	if err != nil {
+		return nil, err
+	}
+	if rerr, ok := reply.(redisError); ok {
+		return nil, rerr
+	}
+	return reply, nil
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: некорректная строка ответа %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return redisError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("redis: неизвестный тип ответа %q", kind)
+}
+
+func (c *redisConn) close() {
+	c.conn.Close()
+}
@@ -0,0 +1,267 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis - заменитель Redis в процессе: RESP2, AUTH, SELECT и EVAL
+// takeScript, исполненный на Go по тем же правилам, что и скрипт Lua
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu      sync.Mutex
+	conns   []net.Conn
+	buckets map[string][2]float64 // токены и время последнего обращения, мс
+	dials   int
+	db      string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeRedis{ln: ln, password: password, buckets: make(map[string][2]float64)}
+	go f.serve()
+	t.Cleanup(f.close)
+	return f
+}
+
+func (f *fakeRedis) addr() string {
+	return f.ln.Addr().String()
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		f.dials++
+		f.mu.Unlock()
+		go f.handle(conn)
+	}
+}
+
+// dropConnections - оборвать все открытые соединения, как при перезапуске сервера
+func (f *fakeRedis) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeRedis) close() {
+	f.ln.Close()
+	f.dropConnections()
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			if len(args) == 2 && args[1] == f.password {
+				authed = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case "SELECT":
+			f.mu.Lock()
+			f.db = args[1]
+			f.mu.Unlock()
+			reply = "+OK\r\n"
+		case "EVAL":
+			switch {
+			case !authed:
+				reply = "-NOAUTH Authentication required.\r\n"
+			case len(args) != 7 || args[1] != takeScript || args[2] != "1":
+				reply = "-ERR unexpected EVAL\r\n"
+			default:
+				reply = f.take(args[3], args[4], args[5], args[6])
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// take - takeScript для ключа key
+func (f *fakeRedis) take(key, rateArg, burstArg, nowArg string) string {
+	rate, _ := strconv.ParseFloat(rateArg, 64)
+	burst, _ := strconv.ParseFloat(burstArg, 64)
+	now, _ := strconv.ParseFloat(nowArg, 64)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tokens, ts := burst, now
+	if state, ok := f.buckets[key]; ok {
+		tokens, ts = state[0], state[1]
+	}
+	if now > ts {
+		tokens = math.Min(burst, tokens+(now-ts)*rate)
+	}
+	allowed := 0
+	if tokens >= 1 {
+		tokens--
+		allowed = 1
+	}
+	f.buckets[key] = [2]float64{tokens, now}
+
+	// tostring в Lua - 14 значащих цифр
+	tokensStr := strconv.FormatFloat(tokens, 'g', 14, 64)
+	return fmt.Sprintf("*2\r\n:%d\r\n$%d\r\n%s\r\n", allowed, len(tokensStr), tokensStr)
+}
+
+// readCommand - массив bulk-строк RESP2
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("ожидался массив: %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("некорректный массив: %q", line)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(header, "$") {
+			return nil, fmt.Errorf("ожидалась bulk-строка: %q", header)
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func newTestRedisStore(t *testing.T, f *fakeRedis, config RedisConfig) *RedisStore {
+	t.Helper()
+	config.Addr = f.addr()
+	s, err := NewRedisStore(config)
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestRedisStore(t *testing.T) {
+	f := newFakeRedis(t, "")
+	s := newTestRedisStore(t, f, RedisConfig{})
+	testStoreBucket(t, s)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.buckets["unitycn:rl:deny"]; !ok {
+		t.Fatalf("ключ без префикса по умолчанию: %v", f.buckets)
+	}
+}
+
+func TestRedisStoreAuthAndSelect(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+
+	if _, err := NewRedisStore(RedisConfig{Addr: f.addr(), Password: "wrong"}); err == nil {
+		t.Fatal("неверный пароль принят")
+	}
+
+	s := newTestRedisStore(t, f, RedisConfig{Password: "secret", DB: 3, Prefix: "test:"})
+	if res := storeTake(t, s, "k", time.Now()); !res.Allowed {
+		t.Fatalf("первый запрос не разрешён: %+v", res)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.db != "3" {
+		t.Fatalf("SELECT %q, ожидалось 3", f.db)
+	}
+	if _, ok := f.buckets["test:k"]; !ok {
+		t.Fatalf("ключ без заданного префикса: %v", f.buckets)
+	}
+}
+
+func TestRedisStoreReconnect(t *testing.T) {
+	f := newFakeRedis(t, "")
+	s := newTestRedisStore(t, f, RedisConfig{})
+
+	now := time.UnixMilli(1_700_000_000_000)
+	storeTake(t, s, "k", now)
+	f.dropConnections()
+
+	// Оборванное соединение из пула даёт не больше одной ошибки,
+	// дальше хранилище подключается заново, состояние корзины сохраняется
+	res, err := s.Take(context.Background(), "k", testLimit, now)
+	if err != nil {
+		res, err = s.Take(context.Background(), "k", testLimit, now)
+	}
+	if err != nil {
+		t.Fatalf("после обрыва соединения: %v", err)
+	}
+	if !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("после переподключения: %+v, ожидался последний токен", res)
+	}
+	if res := storeTake(t, s, "k", now); res.Allowed {
+		t.Fatalf("корзина сброшена переподключением: %+v", res)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dials < 2 {
+		t.Fatalf("соединений: %d, ожидалось переподключение", f.dials)
+	}
+}
+
+func TestRedisStoreUnavailable(t *testing.T) {
+	f := newFakeRedis(t, "")
+	addr := f.addr()
+	f.close()
+
+	if _, err := NewRedisStore(RedisConfig{Addr: addr, DialTimeout: 100 * time.Millisecond}); err == nil {
+		t.Fatal("недоступный сервер принят")
+	}
+}
@@ -0,0 +1,101 @@
+package realtime
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// maxNotifyPayload - предел NOTIFY в PostgreSQL (8000 байт) с запасом
+	maxNotifyPayload    = 7900
+	listenerMinInterval = 10 * time.Second
+	listenerMaxInterval = time.Minute
+)
+
+// ErrEventTooLarge - событие не помещается в NOTIFY
+var ErrEventTooLarge = errors.New("событие больше предела NOTIFY")
+
+// notification - событие и его получатели в канале LISTEN/NOTIFY
+type notification struct {
+	UserIDs []int `json:"u"`
+	Event   Event `json:"e"`
+}
+
+// PostgresBroker - события между экземплярами сервера через LISTEN/NOTIFY:
+// каждый экземпляр слушает канал и раздаёт события своим соединениям
+type PostgresBroker struct {
+	*Hub
+	publisher *sql.DB
+	channel   string
+	listener  *pq.Listener
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewPostgresBroker(publisher *sql.DB, connString, channel string) (*PostgresBroker, error) {
+	listener := pq.NewListener(connString, listenerMinInterval, listenerMaxInterval,
+		func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Printf("Ошибка соединения LISTEN %s: %v", channel, err)
+			}
+		})
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("LISTEN %s: %v", channel, err)
+	}
+
+	b := &PostgresBroker{
+		Hub:       NewHub(),
+		publisher: publisher,
+		channel:   channel,
+		listener:  listener,
+		done:      make(chan struct{}),
+	}
+	go b.listen()
+	return b, nil
+}
+
+func (b *PostgresBroker) Publish(userIDs []int, event Event) error {
+	payload, err := json.Marshal(notification{UserIDs: userIDs, Event: event})
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		return ErrEventTooLarge
+	}
+	_, err = b.publisher.Exec("SELECT pg_notify($1, $2)", b.channel, string(payload))
+	return err
+}
+
+// listen - раздача уведомлений канала. После переподключения listener
+// присылает nil: пропущенные события клиенты дочитывают запросом.
+func (b *PostgresBroker) listen() {
+	defer close(b.done)
+	for n := range b.listener.Notify {
+		if n == nil {
+			continue
+		}
+		var msg notification
+		if err := json.Unmarshal([]byte(n.Extra), &msg); err != nil {
+			log.Printf("Ошибка разбора уведомления %s: %v", b.channel, err)
+			continue
+		}
+		b.Deliver(msg.UserIDs, msg.Event)
+	}
+}
+
+func (b *PostgresBroker) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		err = b.listener.Close()
+		<-b.done
+	})
+	return err
+}
@@ -0,0 +1,146 @@
+package realtime
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Config - секция realtime в config.yaml
+type Config struct {
+	Backend string `yaml:"backend"` // memory | postgres
+	// Channel - канал LISTEN/NOTIFY (postgres)
+	Channel string `yaml:"channel"`
+}
+
+const (
+	defaultChannel = "unitycn_events"
+	// subscriptionBuffer - события, которые ждут медленного клиента;
+	// сверх этого они отбрасываются, клиент дочитает их запросом
+	subscriptionBuffer = 32
+)
+
+// Event - событие для пользователя: тип и данные JSON
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// NewEvent - событие с данными data в JSON
+func NewEvent(typ string, data interface{}) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Type: typ, Data: raw}, nil
+}
+
+// Broker - доставка событий пользователям с открытым соединением
+type Broker interface {
+	Publish(userIDs []int, event Event) error
+	Subscribe(userID int) *Subscription
+	Close() error
+}
+
+// New - брокер по конфигу. Для postgres нужна строка подключения и
+// основная БД: события между экземплярами идут через NOTIFY.
+func New(config Config, publisher *sql.DB, connString string) (Broker, error) {
+	switch config.Backend {
+	case "", "memory":
+		return NewMemoryBroker(), nil
+	case "postgres":
+		channel := config.Channel
+		if channel == "" {
+			channel = defaultChannel
+		}
+		return NewPostgresBroker(publisher, connString, channel)
+	default:
+		return nil, fmt.Errorf("неизвестный backend realtime: %s", config.Backend)
+	}
+}
+
+// Subscription - поток событий одного соединения
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	hub    *Hub
+	userID int
+	once   sync.Once
+}
+
+// Close - отписка; C закрывается
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.remove(s)
+	})
+}
+
+// Hub - подписки этого процесса
+type Hub struct {
+	mu   sync.Mutex
+	subs map[int]map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[int]map[*Subscription]struct{})}
+}
+
+// Subscribe - события пользователя userID
+func (h *Hub) Subscribe(userID int) *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	s := &Subscription{C: c, c: c, hub: h, userID: userID}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	h.subs[userID][s] = struct{}{}
+	return s
+}
+
+func (h *Hub) remove(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[s.userID], s)
+	if len(h.subs[s.userID]) == 0 {
+		delete(h.subs, s.userID)
+	}
+	close(s.c)
+}
+
+// Deliver - событие всем соединениям пользователей этого процесса
+func (h *Hub) Deliver(userIDs []int, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, userID := range userIDs {
+		for s := range h.subs[userID] {
+			select {
+			case s.c <- event:
+			default:
+				log.Printf("Предупреждение: событие %s для пользователя %d отброшено - клиент не успевает", event.Type, userID)
+			}
+		}
+	}
+}
+
+// MemoryBroker - события только внутри процесса (один экземпляр сервера)
+type MemoryBroker struct {
+	*Hub
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{Hub: NewHub()}
+}
+
+func (b *MemoryBroker) Publish(userIDs []int, event Event) error {
+	b.Deliver(userIDs, event)
+	return nil
+}
+
+func (b *MemoryBroker) Close() error {
+	return nil
+}
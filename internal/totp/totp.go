@@ -0,0 +1,148 @@
+// Package totp - одноразовые пароли по времени (RFC 6238, HMAC-SHA1, 6 цифр, шаг 30с),
+// совместимые с Google Authenticator, FreeOTP, Aegis и т.п.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+
+	// Skew - сколько соседних шагов принимается (расхождение часов телефона)
+	Skew = 1
+
+	secretSize = 20 // 160 бит, как рекомендует RFC 4226
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret - новый секрет в base32 без выравнивания
+func GenerateSecret() (string, error) {
+	buf := make([]byte, secretSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(buf), nil
+}
+
+// Step - номер временного шага для момента t
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code - код для шага step
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", fmt.Errorf("неверный секрет TOTP: %w", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Динамическое усечение (RFC 4226, 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%mod), nil
+}
+
+// Validate - проверка кода в окне ±Skew шагов. Возвращает совпавший шаг:
+// вызывающий хранит последний принятый шаг и отклоняет шаги не новее него,
+// чтобы один код нельзя было использовать дважды.
+func Validate(secret, code string, t time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+	for step := current - Skew; step <= current+Skew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// ProvisioningURI - otpauth:// ссылка для QR-кода приложения-аутентификатора
+func ProvisioningURI(secret, issuer, account string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// recoveryAlphabet - без похожих символов (0/O, 1/I/L)
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCodes - n одноразовых кодов восстановления вида xxxxx-xxxxx
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	// Байты не меньше limit отбрасываются, чтобы символы были равновероятны
+	limit := byte(256 - 256%len(recoveryAlphabet))
+
+	codes := make([]string, n)
+	buf := make([]byte, 1)
+	for i := range codes {
+		var sb strings.Builder
+		for sb.Len() < 11 {
+			if sb.Len() == 5 {
+				sb.WriteByte('-')
+				continue
+			}
+			if _, err := rand.Read(buf); err != nil {
+				return nil, err
+			}
+			if buf[0] >= limit {
+				continue
+			}
+			sb.WriteByte(recoveryAlphabet[int(buf[0])%len(recoveryAlphabet)])
+		}
+		codes[i] = sb.String()
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode - хэш кода восстановления для хранения в БД.
+// Коды случайные и длинные, поэтому достаточно SHA-256 без соли.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	if !strings.Contains(normalized, "-") && len(normalized) == 10 {
+		normalized = normalized[:5] + "-" + normalized[5:]
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
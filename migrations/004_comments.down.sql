@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trg_comments_count ON comments;
+DROP FUNCTION IF EXISTS update_post_comments_count();
+ALTER TABLE posts DROP COLUMN IF EXISTS comments_count;
+DROP TABLE IF EXISTS comments;
@@ -0,0 +1,3 @@
+-- Блокировка пользователей администратором
+ALTER TABLE users ADD COLUMN IF NOT EXISTS banned_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS ban_reason TEXT;
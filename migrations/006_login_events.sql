@@ -0,0 +1,14 @@
+-- История входов: неудачные попытки по логину и IP для задержек и блокировки
+CREATE TABLE IF NOT EXISTS login_events (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    username VARCHAR(255) NOT NULL,
+    ip VARCHAR(64) NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    result VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_events_username ON login_events(username, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_events_ip ON login_events(ip, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_events_user_id ON login_events(user_id, created_at DESC);
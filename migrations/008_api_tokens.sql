@@ -0,0 +1,16 @@
+-- Персональные токены API для ботов и интеграций (хранится только хэш)
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    scopes TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    last_used_ip VARCHAR(64),
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS user_identities;
+DROP INDEX IF EXISTS idx_users_email;
+ALTER TABLE users DROP COLUMN IF EXISTS email;
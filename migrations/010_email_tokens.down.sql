@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS email_tokens;
+DROP INDEX IF EXISTS idx_users_email;
+DROP INDEX IF EXISTS idx_users_email_verified;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users(LOWER(email)) WHERE email IS NOT NULL;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,23 @@
+-- Подтверждение email и восстановление пароля по ссылкам из писем
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
+
+-- Адреса от провайдеров OIDC уже подтверждены ими
+UPDATE users SET email_verified_at = created_at WHERE email IS NOT NULL AND email_verified_at IS NULL;
+
+-- Уникален только подтверждённый адрес: неподтверждённым чужой адрес не занять
+DROP INDEX IF EXISTS idx_users_email;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_verified ON users(LOWER(email)) WHERE email_verified_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(LOWER(email));
+
+-- Одноразовые ссылки: сам токен подписан, здесь - его jti, срок и отметка использования
+CREATE TABLE IF NOT EXISTS email_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(20) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_tokens_user_id ON email_tokens(user_id, purpose);
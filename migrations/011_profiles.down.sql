@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_posts_user_id_created_at;
+ALTER TABLE users DROP COLUMN IF EXISTS locale;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
@@ -0,0 +1,7 @@
+-- Профили: о себе, аватар и язык интерфейса
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio VARCHAR(500);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url VARCHAR(500);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(5);
+
+-- Посты пользователя на странице профиля
+CREATE INDEX IF NOT EXISTS idx_posts_user_id_created_at ON posts(user_id, created_at DESC);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_deletion_scheduled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_mode;
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_scheduled_at;
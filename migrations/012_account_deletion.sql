@@ -0,0 +1,8 @@
+-- Удаление аккаунта самим пользователем: запрос с отсрочкой и способ удаления
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_mode VARCHAR(20);
+-- Обезличенный аккаунт: строка остаётся ради постов и комментариев
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_at ON users(deletion_scheduled_at)
+    WHERE deletion_scheduled_at IS NOT NULL;
@@ -0,0 +1,29 @@
+-- Сообщества: открытые (public) видны всем, закрытые (private) видны в списке,
+-- но посты читают только участники, по приглашениям (invite) скрыты от посторонних
+CREATE TABLE IF NOT EXISTS communities (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(50) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    visibility VARCHAR(10) NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'private', 'invite')),
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Участники. role: owner | moderator | member;
+-- status: active - участник, requested - заявка в закрытое, invited - приглашён
+CREATE TABLE IF NOT EXISTS community_members (
+    community_id INTEGER NOT NULL REFERENCES communities(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'moderator', 'member')),
+    status VARCHAR(10) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'requested', 'invited')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (community_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_community_members_user_id ON community_members(user_id);
+
+-- Пост без сообщества попадает только в общую ленту
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS community_id INTEGER REFERENCES communities(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_posts_community_id ON posts(community_id, created_at DESC);
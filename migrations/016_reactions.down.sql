@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS post_likes (
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER REFERENCES posts(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(post_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_likes_post_user ON post_likes(post_id, user_id);
+
+-- Остальные реакции теряются
+INSERT INTO post_likes (post_id, user_id, created_at)
+SELECT post_id, user_id, created_at FROM post_reactions WHERE reaction = 'like'
+ORDER BY created_at
+ON CONFLICT DO NOTHING;
+
+DROP TABLE IF EXISTS comment_reactions;
+DROP TABLE IF EXISTS post_reactions;
@@ -0,0 +1,38 @@
+-- Реакции на посты: у пользователя может быть несколько разных реакций на пост,
+-- каждая ставится и снимается отдельно. Реакция like - прежний лайк,
+-- её количество по-прежнему хранится в posts.likes
+CREATE TABLE IF NOT EXISTS post_reactions (
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reaction VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, user_id, reaction)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_reactions_post_reaction ON post_reactions(post_id, reaction, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_post_reactions_user_id ON post_reactions(user_id);
+
+-- Реакции на комментарии
+CREATE TABLE IF NOT EXISTS comment_reactions (
+    comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reaction VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (comment_id, user_id, reaction)
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_reactions_comment_reaction ON comment_reactions(comment_id, reaction, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_comment_reactions_user_id ON comment_reactions(user_id);
+
+-- Лайки переносятся в реакцию like
+INSERT INTO post_reactions (post_id, user_id, reaction, created_at)
+SELECT post_id, user_id, 'like', COALESCE(created_at, CURRENT_TIMESTAMP)
+FROM post_likes
+WHERE post_id IS NOT NULL AND user_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+UPDATE posts p SET likes = (
+    SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id AND r.reaction = 'like'
+);
+
+DROP TABLE IF EXISTS post_likes;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_comments_post_likes;
+ALTER TABLE comments DROP COLUMN IF EXISTS likes;
@@ -0,0 +1,9 @@
+-- Лайки комментариев - реакция like из comment_reactions; количество
+-- хранится в comments.likes для сортировки по популярности
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS likes INTEGER NOT NULL DEFAULT 0;
+
+UPDATE comments c SET likes = (
+    SELECT COUNT(*) FROM comment_reactions r WHERE r.comment_id = c.id AND r.reaction = 'like'
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_likes ON comments(post_id, likes DESC, created_at);
@@ -0,0 +1,23 @@
+-- Подборки закладок: у каждого пользователя свои, названия не повторяются
+CREATE TABLE IF NOT EXISTS bookmark_collections (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+-- Закладки видны только владельцу и удаляются вместе с постом. Пост лежит
+-- в закладках один раз: без подборки или в одной из подборок; при удалении
+-- подборки её закладки остаются без подборки
+CREATE TABLE IF NOT EXISTS bookmarks (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    collection_id INTEGER REFERENCES bookmark_collections(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bookmarks_user_created ON bookmarks(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_post_id ON bookmarks(post_id);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_collection_id ON bookmarks(collection_id);
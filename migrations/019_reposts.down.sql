@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS trg_posts_reposts_count ON posts;
+DROP FUNCTION IF EXISTS update_post_reposts_count();
+DELETE FROM posts WHERE kind = 'repost';
+DROP INDEX IF EXISTS idx_posts_repost_unique;
+DROP INDEX IF EXISTS idx_posts_original_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS quotes_count;
+ALTER TABLE posts DROP COLUMN IF EXISTS reposts_count;
+ALTER TABLE posts DROP COLUMN IF EXISTS original_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS kind;
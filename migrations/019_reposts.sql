@@ -0,0 +1,34 @@
+-- Репосты и цитаты - посты со ссылкой на исходный: repost без своего текста,
+-- quote с комментарием автора. Репост репоста ссылается на исходный пост.
+-- При удалении исходного ссылка обнуляется, репосты и цитаты остаются.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS kind VARCHAR(10) NOT NULL DEFAULT 'post'
+    CHECK (kind IN ('post', 'repost', 'quote'));
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS original_id INTEGER REFERENCES posts(id) ON DELETE SET NULL;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS reposts_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS quotes_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_posts_original_id ON posts(original_id);
+-- Один репост поста от пользователя
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_repost_unique ON posts(user_id, original_id) WHERE kind = 'repost';
+
+-- Счётчики репостов и цитат исходного поста
+CREATE OR REPLACE FUNCTION update_post_reposts_count()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' AND NEW.original_id IS NOT NULL THEN
+        UPDATE posts SET reposts_count = reposts_count + CASE WHEN NEW.kind = 'repost' THEN 1 ELSE 0 END,
+                         quotes_count = quotes_count + CASE WHEN NEW.kind = 'quote' THEN 1 ELSE 0 END
+        WHERE id = NEW.original_id;
+    ELSIF TG_OP = 'DELETE' AND OLD.original_id IS NOT NULL THEN
+        UPDATE posts SET reposts_count = reposts_count - CASE WHEN OLD.kind = 'repost' THEN 1 ELSE 0 END,
+                         quotes_count = quotes_count - CASE WHEN OLD.kind = 'quote' THEN 1 ELSE 0 END
+        WHERE id = OLD.original_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_posts_reposts_count ON posts;
+CREATE TRIGGER trg_posts_reposts_count
+AFTER INSERT OR DELETE ON posts
+FOR EACH ROW EXECUTE FUNCTION update_post_reposts_count();
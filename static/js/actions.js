@@ -0,0 +1,25 @@
+// Обработчики кнопок без inline onclick (их запрещает Content-Security-Policy).
+// <button data-action="likePost" data-id="5"> вызывает зарегистрированный
+// обработчик likePost("5", кнопка); data-confirm - подтверждение перед действием
+// или переходом по ссылке.
+const pageActions = {};
+
+function registerActions(actions) {
+    Object.assign(pageActions, actions);
+}
+
+document.addEventListener('click', function (event) {
+    const el = event.target.closest('[data-action], [data-confirm]');
+    if (!el) {
+        return;
+    }
+    if (el.dataset.confirm && !confirm(el.dataset.confirm)) {
+        event.preventDefault();
+        return;
+    }
+    const action = pageActions[el.dataset.action];
+    if (action) {
+        event.preventDefault();
+        action(el.dataset.id, el);
+    }
+});
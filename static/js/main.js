@@ -1,8 +1,8 @@
-const API_URL = '/api';
+const API_URL = '/api/v1';
 
 async function loadPosts() {
     const response = await fetch(`${API_URL}/posts`);
-    const posts = await response.json();
+    const posts = (await response.json()).data;
     
     const container = document.getElementById('posts');
     container.innerHTML = posts.map(post => `